@@ -0,0 +1,65 @@
+"""
+HTTP 访问日志格式
+
+- combined（默认）：Apache/Nginx Combined Log Format，GoAccess 选 COMBINED 即可解析
+      127.0.0.1 - - [16/Oct/2026:18:48:25 +0800] "GET /api/names HTTP/1.1" 200 512 "-" "curl/8.5.0"
+- json：每行一个对象，字段 time/remote/method/path/protocol/status/bytes/referer/user_agent/duration_ms/request_id，
+  便于 Filebeat/Logstash 直接摄取
+
+输出目的地由 ACCESS_LOG_FILE 决定（见 logsetup.py）：配置后访问日志单独写入该文件（"-" 为 stdout），
+每行只有日志本身，不带应用日志的时间与级别前缀。
+"""
+
+import json
+import time
+from typing import Any, Dict, Optional
+
+
+def _quote(val: Optional[str]) -> str:
+    if not val:
+        return '-'
+    return str(val).replace('\\', '\\\\').replace('"', '\\"')
+
+
+def entry(remote: str, requestline: str, command: str, path: str, protocol: str, status: Any,
+          length: Optional[str], referer: Optional[str], user_agent: Optional[str], duration: float,
+          request_id: Optional[str], ts: Optional[float] = None) -> Dict[str, Any]:
+    try:
+        size = int(length) if length is not None else None
+    except ValueError:
+        size = None
+    return {
+        'time': ts if ts is not None else time.time(),
+        'remote': remote,
+        'requestline': requestline,
+        'method': command,
+        'path': path,
+        'protocol': protocol,
+        'status': int(status) if str(status).isdigit() else status,
+        'bytes': size,
+        'referer': referer,
+        'user_agent': user_agent,
+        'duration_ms': round(duration * 1000, 1),
+        'request_id': request_id,
+    }
+
+
+def combined(e: Dict[str, Any]) -> str:
+    t = time.strftime('%d/%b/%Y:%H:%M:%S %z', time.localtime(e['time']))
+    return '%s - - [%s] "%s" %s %s "%s" "%s"' % (
+        e['remote'], t, _quote(e['requestline']), e['status'], e['bytes'] if e['bytes'] is not None else '-',
+        _quote(e['referer']), _quote(e['user_agent']))
+
+
+def to_json(e: Dict[str, Any]) -> str:
+    out = dict(e)
+    out['time'] = time.strftime('%Y-%m-%dT%H:%M:%S%z', time.localtime(e['time']))
+    out.pop('requestline', None)
+    return json.dumps(out, ensure_ascii=False)
+
+
+FORMATS = {'combined': combined, 'json': to_json}
+
+
+def format_entry(e: Dict[str, Any], fmt: str) -> str:
+    return FORMATS.get(fmt, combined)(e)
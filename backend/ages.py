@@ -0,0 +1,87 @@
+"""
+年龄推算与核对
+
+出生年份依次取：人物元数据 birth_year → 标题/详情含「出生」「诞生」的事件 → 首个同时有年份与年龄的事件（年份 − 年龄）。
+- 缺失的年龄按 年份 − 出生年份 补齐
+- 已有年龄与推算值相差超过 AGE_TOLERANCE 岁时视为矛盾：AGE_MODE=flag（默认）只在事件上记录 age_derived，
+  AGE_MODE=replace 时改为推算值，原值保留在 age_reported
+年份支持公元前写法（见 datacheck.parse_year）。
+"""
+
+import re
+from typing import Any, Dict, List, Optional
+
+import config
+import datacheck
+
+_AGE_RE = re.compile(r'\d{1,3}')
+
+
+def parse_age(value: Any) -> Optional[int]:
+    if isinstance(value, bool):
+        return None
+    if isinstance(value, (int, float)):
+        return int(value)
+    m = _AGE_RE.search(str(value or ''))
+    return int(m.group(0)) if m else None
+
+
+def birth_year(person: Dict[str, Any]) -> Optional[int]:
+    meta = datacheck.parse_year(person.get('birth_year')) if person.get('birth_year') not in (None, '') else None
+    if meta is not None:
+        return meta
+    events = person.get('events') or []
+    for e in events:
+        text = str(e.get('title', '')) + str(e.get('detail', ''))
+        y = datacheck.parse_year(e.get('year'))
+        if y is not None and ('出生' in text or '诞生' in text):
+            return y
+    for e in events:
+        y, age = datacheck.parse_year(e.get('year')), parse_age(e.get('age'))
+        if y is not None and age is not None:
+            return y - age
+    return None
+
+
+def mismatches(person: Dict[str, Any], tolerance: Optional[int] = None) -> List[Dict[str, Any]]:
+    """年龄与年份矛盾的事件：[{index, reported, derived}]。"""
+    birth = birth_year(person)
+    if birth is None:
+        return []
+    tolerance = config.get_age_tolerance() if tolerance is None else tolerance
+    out = []
+    for i, e in enumerate(person.get('events') or []):
+        y, age = datacheck.parse_year(e.get('year')), parse_age(e.get('age'))
+        if y is None or age is None or y < birth:
+            continue
+        if abs((y - birth) - age) > tolerance:
+            out.append({'index': i, 'reported': age, 'derived': y - birth})
+    return out
+
+
+def apply(person: Dict[str, Any], mode: Optional[str] = None) -> Dict[str, Any]:
+    """补齐缺失年龄并处理矛盾年龄，返回 {'birth_year', 'filled', 'mismatched', 'replaced'}。"""
+    mode = mode or config.get_age_mode()
+    birth = birth_year(person)
+    report = {'birth_year': birth, 'filled': 0, 'mismatched': 0, 'replaced': 0}
+    if birth is None:
+        return report
+    events = person.get('events') or []
+    for m in mismatches(person):
+        e = events[m['index']]
+        report['mismatched'] += 1
+        if mode == 'replace':
+            e.setdefault('age_reported', e.get('age'))
+            e['age'] = str(m['derived'])
+            e.pop('age_derived', None)
+            report['replaced'] += 1
+        else:
+            e['age_derived'] = str(m['derived'])
+    for e in events:
+        if str(e.get('age', '')).strip():
+            continue
+        y = datacheck.parse_year(e.get('year'))
+        if y is not None and y >= birth:
+            e['age'] = str(y - birth)
+            report['filled'] += 1
+    return report
@@ -0,0 +1,128 @@
+"""
+人物别名表：字 / 号 / 谥号 等 → 规范姓名
+
+- 内置常见别名，另可在 data/aliases.json 中追加（格式：{"别名": "规范姓名"}）
+- 运行时新增的别名（如 AI 辅助识别）会原子写回 data/aliases.json
+- 键统一经过 textnorm.name_key 归一，繁简、空白差异不影响匹配
+"""
+
+import os
+import json
+import threading
+from typing import Dict, List, Optional
+from textnorm import normalize_name, name_key
+
+# 内置别名（规范姓名 → 别名列表）
+BUILTIN_ALIASES: Dict[str, List[str]] = {
+    "苏轼": ["苏东坡", "东坡居士", "子瞻", "和仲", "苏文忠"],
+    "李白": ["李太白", "太白", "青莲居士", "谪仙人"],
+    "杜甫": ["杜子美", "子美", "杜工部", "少陵野老", "杜少陵"],
+    "白居易": ["白乐天", "乐天", "香山居士"],
+    "王安石": ["王介甫", "介甫", "半山", "王荆公", "王文公"],
+    "欧阳修": ["欧阳永叔", "永叔", "醉翁", "六一居士", "欧阳文忠"],
+    "李清照": ["易安居士", "李易安"],
+    "辛弃疾": ["辛幼安", "稼轩", "稼轩居士"],
+    "陆游": ["陆放翁", "放翁", "陆务观"],
+    "孔子": ["孔丘", "仲尼", "孔夫子"],
+    "老子": ["李耳", "老聃"],
+    "鲁迅": ["周树人", "周豫才"],
+    "毛泽东": ["毛润之", "润之"],
+    "孙中山": ["孙文", "孙逸仙", "孙中山先生"],
+}
+
+
+class AliasTable:
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._map: Dict[str, str] = {}   # alias key -> 规范姓名
+        self._custom: Dict[str, str] = {}  # 用户/运行时追加部分（原样落盘）
+        self._path: Optional[str] = None
+        self.revision = 0  # 每次增改后递增（见 Cache.data_version）
+        for canonical, aliases in BUILTIN_ALIASES.items():
+            for a in aliases:
+                self._map[name_key(a)] = canonical
+
+    def load(self, path: str):
+        self._path = path
+        if not os.path.exists(path):
+            return
+        try:
+            with open(path, 'r', encoding='utf-8') as f:
+                data = json.load(f)
+        except Exception:
+            return
+        if not isinstance(data, dict):
+            return
+        with self._lock:
+            for alias, canonical in data.items():
+                a = normalize_name(alias)
+                c = normalize_name(canonical)
+                if a and c and name_key(a) != name_key(c):
+                    self._custom[a] = c
+                    self._map[name_key(a)] = c
+            self.revision += 1
+
+    def resolve(self, name: str) -> str:
+        """返回规范姓名；非别名时原样（归一化后）返回。"""
+        n = normalize_name(name)
+        with self._lock:
+            return self._map.get(name_key(n), n)
+
+    def all(self) -> Dict[str, str]:
+        with self._lock:
+            out = {a: c for c, aliases in BUILTIN_ALIASES.items() for a in aliases}
+            out.update(self._custom)
+            return out
+
+    def add(self, alias: str, canonical: str) -> bool:
+        a = normalize_name(alias)
+        c = normalize_name(canonical)
+        if not a or not c or name_key(a) == name_key(c):
+            return False
+        with self._lock:
+            self._custom[a] = c
+            self._map[name_key(a)] = c
+            self.revision += 1
+            data = dict(self._custom)
+        self._save(data)
+        return True
+
+    def rename_canonical(self, old: str, new: str) -> int:
+        """规范姓名改名：指向旧名的别名（含内置）改指新名，旧名本身登记为新名的别名。返回改指的别名数。"""
+        o, n = normalize_name(old), normalize_name(new)
+        if not o or not n or name_key(o) == name_key(n):
+            return 0
+        moved = 0
+        with self._lock:
+            pointing = {a: c for c, aliases in BUILTIN_ALIASES.items() for a in aliases}
+            pointing.update(self._custom)
+            for alias, canonical in pointing.items():
+                if name_key(canonical) == name_key(o) and name_key(alias) != name_key(n):
+                    self._custom[alias] = n
+                    self._map[name_key(alias)] = n
+                    moved += 1
+            # 新名此前若是别名则不再解析到别处
+            for alias in [a for a in self._custom if name_key(a) == name_key(n)]:
+                del self._custom[alias]
+            self._map.pop(name_key(n), None)
+            self._custom[o] = n
+            self._map[name_key(o)] = n
+            self.revision += 1
+            data = dict(self._custom)
+        self._save(data)
+        return moved
+
+    def _save(self, data: Dict[str, str]):
+        if not self._path:
+            return
+        tmp = self._path + '.tmp'
+        try:
+            with open(tmp, 'w', encoding='utf-8') as f:
+                json.dump(data, f, ensure_ascii=False, indent=2)
+            os.replace(tmp, self._path)
+        except Exception:
+            try:
+                if os.path.exists(tmp):
+                    os.remove(tmp)
+            except Exception:
+                pass
@@ -0,0 +1,161 @@
+"""
+查询热度统计（GET /api/admin/analytics）
+
+记录用户查了哪些人物、搜了什么词，帮助维护者决定下一步导入哪些缺失人物、哪些缓存条目值得常驻预热：
+- names     按归一化姓名累计请求次数，区分 found（命中缓存或生成成功）与 missing（最终未找到），附首末时间与来源接口
+- searches  /api/names?q= 与 /api/search/semantic 的检索词，记录次数与零结果次数
+- daily     按 UTC 日期汇总 requests / missing / searches，保留 ANALYTICS_RETENTION_DAYS 天
+姓名与检索词各最多保留 ANALYTICS_MAX_KEYS 条，超出时淘汰最久未出现的条目。
+
+统计在内存中累加，随缓存周期落盘写入 data/analytics.json（停机前再写一次）；ANALYTICS_ENABLED=0 时不记录。
+"""
+
+import os
+import json
+import time
+import threading
+from typing import Any, Callable, Dict, Optional
+
+import config
+from textnorm import name_key
+
+MAX_QUERY = 100
+
+
+def _today(now: float) -> str:
+    return time.strftime('%Y-%m-%d', time.gmtime(now))
+
+
+class Analytics:
+    def __init__(self):
+        self._lock = threading.Lock()
+        self.path: Optional[str] = None
+        self._dirty = False
+        self._data: Dict[str, Dict[str, Any]] = {'names': {}, 'searches': {}, 'daily': {}}
+
+    def configure(self, path: Optional[str]):
+        self.path = path
+        if not path or not os.path.isfile(path):
+            return
+        try:
+            with open(path, 'r', encoding='utf-8') as f:
+                data = json.load(f)
+        except (OSError, ValueError):
+            return
+        if isinstance(data, dict):
+            with self._lock:
+                self._data = {k: dict(data.get(k) or {}) for k in ('names', 'searches', 'daily')}
+
+    def _day(self, now: float) -> Dict[str, int]:
+        return self._data['daily'].setdefault(_today(now), {'requests': 0, 'missing': 0, 'searches': 0})
+
+    def _trim(self, table: str):
+        items = self._data[table]
+        limit = config.get_analytics_max_keys()
+        if len(items) > limit:
+            for key, _ in sorted(items.items(), key=lambda kv: kv[1].get('last_seen', 0))[:len(items) - limit]:
+                del items[key]
+
+    def record_request(self, endpoint: str, name: str, found: bool):
+        """一次人物请求的最终结果（found=False 表示缓存未命中且未能生成）。"""
+        key = name_key(name)
+        if not key or not config.get_analytics_enabled():
+            return
+        now = time.time()
+        with self._lock:
+            entry = self._data['names'].setdefault(key, {'name': name, 'requests': 0, 'found': 0, 'missing': 0,
+                                                         'first_seen': now, 'endpoints': {}})
+            entry['requests'] += 1
+            entry['found' if found else 'missing'] += 1
+            entry['last_seen'] = now
+            entry['last_found'] = found
+            entry['endpoints'][endpoint] = entry['endpoints'].get(endpoint, 0) + 1
+            if found:
+                entry['name'] = name
+            day = self._day(now)
+            day['requests'] += 1
+            if not found:
+                day['missing'] += 1
+            self._trim('names')
+            self._dirty = True
+
+    def record_search(self, kind: str, query: str, results: int):
+        query = ' '.join(str(query or '').split())[:MAX_QUERY]
+        if not query or not config.get_analytics_enabled():
+            return
+        now = time.time()
+        with self._lock:
+            entry = self._data['searches'].setdefault(f'{kind}:{query.lower()}', {'kind': kind, 'query': query, 'count': 0,
+                                                                                  'zero_results': 0, 'first_seen': now})
+            entry['count'] += 1
+            if results == 0:
+                entry['zero_results'] += 1
+            entry['last_seen'] = now
+            entry['last_results'] = results
+            self._day(now)['searches'] += 1
+            self._trim('searches')
+            self._dirty = True
+
+    def report(self, limit: int = 20, days: int = 30, is_cached: Optional[Callable[[str], bool]] = None) -> Dict[str, Any]:
+        """汇总：
+        - top_requested   请求最多的人物
+        - missing         最近一次仍未找到、且当前不在缓存中的人物（按未找到次数排序），即待导入清单
+        - keep_warm       请求最多且当前已缓存的人物，适合加入预热
+        - top_searches / zero_result_searches  检索词排行与无结果的检索词
+        - daily           最近 days 天的按日汇总
+        """
+        is_cached = is_cached or (lambda name: False)
+        cutoff = _today(time.time() - max(0, days - 1) * 86400)
+        with self._lock:
+            names = [dict(v, key=k) for k, v in self._data['names'].items()]
+            searches = [dict(v) for v in self._data['searches'].values()]
+            daily = {d: dict(v) for d, v in self._data['daily'].items() if d >= cutoff}
+        for n in names:
+            n['cached'] = is_cached(n['name'])
+            n.pop('key')
+        by_requests = sorted(names, key=lambda n: (-n['requests'], -n.get('last_seen', 0)))
+        missing = sorted((n for n in names if n['missing'] and not n['cached'] and not n.get('last_found')),
+                         key=lambda n: (-n['missing'], -n.get('last_seen', 0)))
+        searches.sort(key=lambda s: (-s['count'], -s.get('last_seen', 0)))
+        return {
+            'totals': {'names': len(names), 'searches': len(searches),
+                       'requests': sum(n['requests'] for n in names), 'missing': sum(n['missing'] for n in names)},
+            'top_requested': by_requests[:limit],
+            'missing': missing[:limit],
+            'keep_warm': [n['name'] for n in by_requests if n['cached']][:limit],
+            'top_searches': searches[:limit],
+            'zero_result_searches': [s for s in searches if s.get('last_results') == 0][:limit],
+            'daily': [dict(v, date=d) for d, v in sorted(daily.items())],
+        }
+
+    def reset(self):
+        with self._lock:
+            self._data = {'names': {}, 'searches': {}, 'daily': {}}
+            self._dirty = True
+
+    def flush(self) -> bool:
+        """有变更时写入文件，并清理超出保留期的按日汇总；返回是否写入。"""
+        if not self.path:
+            return False
+        with self._lock:
+            if not self._dirty:
+                return False
+            cutoff = _today(time.time() - config.get_analytics_retention_days() * 86400)
+            for d in [d for d in self._data['daily'] if d < cutoff]:
+                del self._data['daily'][d]
+            data = json.loads(json.dumps(self._data))
+            self._dirty = False
+        try:
+            os.makedirs(os.path.dirname(self.path) or '.', exist_ok=True)
+            tmp = self.path + '.tmp'
+            with open(tmp, 'w', encoding='utf-8') as f:
+                json.dump(data, f, ensure_ascii=False)
+            os.replace(tmp, self.path)
+            return True
+        except OSError:
+            with self._lock:
+                self._dirty = True
+            return False
+
+
+ANALYTICS = Analytics()
@@ -0,0 +1,163 @@
+"""
+前端资源指纹（缓存失效）
+
+启动时扫描 FRONTEND_DIR，为每个资源计算内容哈希，并改写引用处附加 ?v=<哈希>：
+- HTML：src / href 中的站内相对或绝对路径（外部地址、协议相对地址、锚点不改）
+- JS：ES 模块的静态与动态 import（'./x.js'、'../x.js'）
+- CSS：url(...) 中的站内路径
+被引用资源的哈希基于改写后的内容计算，依赖变化会沿引用链传递到入口文件；循环引用时回退为原始内容哈希。
+
+响应缓存策略（见 index.py 的 _serve_asset）：
+- 带 ?v= 且与当前哈希一致：Cache-Control: public, max-age=31536000, immutable
+- 其他（HTML、无版本号或版本号已过期）：no-cache，按 ETag 协商
+文件变动后（按路径、mtime、大小判断，至多每秒检查一次）自动重建，开发时无需重启。
+ASSET_FINGERPRINT=0 时不改写也不加长缓存。`python index.py assets` 输出当前清单。
+"""
+
+import os
+import re
+import json
+import time
+import hashlib
+import posixpath
+import threading
+from typing import Dict, Optional, Tuple
+
+IMMUTABLE = 'public, max-age=31536000, immutable'
+REVALIDATE = 'no-cache'
+HASH_LEN = 10
+REWRITE_EXTS = ('.html', '.htm', '.js', '.mjs', '.css')
+# 跳过的目录（依赖包、隐藏目录）
+SKIP_DIRS = ('node_modules',)
+
+_HTML_REF = re.compile(r'''(\s(?:src|href)\s*=\s*)(["'])([^"'#?]+)\2''', re.I)
+_JS_REF = re.compile(r'''(\bimport\s*\(\s*|\bfrom\s*|\bimport\s+)(["'])(\.\.?/[^"'?#]+)\2''')
+_CSS_REF = re.compile(r'''(url\(\s*)(["']?)([^"')?#]+)\2(?=\s*\))''', re.I)
+
+
+def _local_ref(ref: str) -> bool:
+    return bool(ref) and not ref.startswith('//') and ':' not in ref
+
+
+class Manifest:
+    def __init__(self, root: str):
+        self.root = root
+        self.versions: Dict[str, str] = {}   # 相对路径 → 哈希
+        self.bodies: Dict[str, bytes] = {}   # 改写后的内容（仅内容有变化的文本资源）
+        self.signature: Tuple = ()
+
+    def _resolve(self, rel: str, ref: str) -> str:
+        base = '' if ref.startswith('/') else posixpath.dirname(rel)
+        return posixpath.normpath(posixpath.join(base, ref.lstrip('/')))
+
+    def _rewrite(self, rel: str, text: str, stack: set) -> str:
+        ext = os.path.splitext(rel)[1].lower()
+        pattern = _JS_REF if ext in ('.js', '.mjs') else _CSS_REF if ext == '.css' else _HTML_REF
+
+        def sub(m):
+            ref = m.group(3).strip()
+            if not _local_ref(ref):
+                return m.group(0)
+            target = self._resolve(rel, ref)
+            version = self._version(target, stack)
+            if not version:
+                return m.group(0)
+            return f'{m.group(1)}{m.group(2)}{m.group(3)}?v={version}{m.group(2)}'
+        return pattern.sub(sub, text)
+
+    def _version(self, rel: str, stack: set) -> Optional[str]:
+        if rel in self.versions:
+            return self.versions[rel]
+        path = os.path.join(self.root, *rel.split('/'))
+        if rel.startswith('..') or not os.path.isfile(path):
+            return None
+        with open(path, 'rb') as f:
+            data = f.read()
+        if rel in stack:
+            # 循环引用：此处先用原始内容哈希，不写入清单
+            return hashlib.sha256(data).hexdigest()[:HASH_LEN]
+        if rel.lower().endswith(REWRITE_EXTS):
+            try:
+                text = data.decode('utf-8')
+            except UnicodeDecodeError:
+                text = None
+            if text is not None:
+                rewritten = self._rewrite(rel, text, stack | {rel}).encode('utf-8')
+                if rewritten != data:
+                    self.bodies[rel] = rewritten
+                    data = rewritten
+        self.versions[rel] = hashlib.sha256(data).hexdigest()[:HASH_LEN]
+        return self.versions[rel]
+
+    def build(self) -> 'Manifest':
+        for rel in sorted(_walk(self.root)):
+            self._version(rel, set())
+        self.signature = _signature(self.root)
+        return self
+
+    def to_dict(self) -> Dict[str, object]:
+        return {'root': self.root, 'assets': dict(sorted(self.versions.items())), 'rewritten': sorted(self.bodies)}
+
+
+def _walk(root: str):
+    for dirpath, dirs, files in os.walk(root):
+        dirs[:] = [d for d in dirs if not d.startswith('.') and d not in SKIP_DIRS]
+        for fn in files:
+            if not fn.startswith('.'):
+                yield os.path.relpath(os.path.join(dirpath, fn), root).replace(os.sep, '/')
+
+
+def _signature(root: str) -> Tuple:
+    out = []
+    for rel in sorted(_walk(root)):
+        try:
+            st = os.stat(os.path.join(root, rel))
+        except OSError:
+            continue
+        out.append((rel, st.st_mtime_ns, st.st_size))
+    return tuple(out)
+
+
+class Assets:
+    """线程安全的清单持有者，按需重建。"""
+
+    def __init__(self, root: str, enabled: bool = True, check_interval: float = 1.0):
+        self.root = root
+        self.enabled = enabled
+        self.check_interval = check_interval
+        self._lock = threading.Lock()
+        self._manifest: Optional[Manifest] = None
+        self._checked = 0.0
+
+    def manifest(self) -> Optional[Manifest]:
+        if not self.enabled or not os.path.isdir(self.root):
+            return None
+        with self._lock:
+            now = time.monotonic()
+            if self._manifest is None:
+                self._manifest = Manifest(self.root).build()
+                self._checked = now
+            elif now - self._checked >= self.check_interval:
+                self._checked = now
+                if _signature(self.root) != self._manifest.signature:
+                    self._manifest = Manifest(self.root).build()
+            return self._manifest
+
+    def lookup(self, fs_path: str, query_version: str) -> Tuple[Optional[bytes], str, str]:
+        """返回 (改写后的内容或 None, Cache-Control, 当前哈希)；未启用或不在清单中时返回 (None, '', '')。"""
+        m = self.manifest()
+        if m is None:
+            return None, '', ''
+        rel = os.path.relpath(fs_path, os.path.realpath(self.root)).replace(os.sep, '/')
+        if rel.startswith('..') or rel not in m.versions:
+            return None, '', ''
+        version = m.versions[rel]
+        fresh = bool(query_version) and query_version == version
+        return m.bodies.get(rel), IMMUTABLE if fresh else REVALIDATE, version
+
+
+def main(argv, root: str) -> int:
+    """打印资源清单（CI 中可据此确认入口文件的版本号随依赖变化）。"""
+    m = Manifest(root).build()
+    print(json.dumps(m.to_dict(), ensure_ascii=False, indent=2))
+    return 0
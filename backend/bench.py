@@ -0,0 +1,205 @@
+"""
+压测 / 基准模式
+
+    python index.py bench [--target http://127.0.0.1:8001] [--duration 10] [--concurrency 8]
+                          [--mix people=1,person=3,search=2] [--json]
+
+- 按权重混合回放 /api/people、/api/person（仅已缓存的人物，不触发 AI 生成）与 /api/names?q= 搜索
+- 每个并发 worker 复用一条 HTTP/1.1 连接（服务端关闭 keep-alive 时自动重连）
+- 输出各类请求的次数、错误数、吞吐与 p50/p90/p99/max 延迟
+"""
+
+import sys
+import json
+import time
+import random
+import argparse
+import threading
+import http.client
+from urllib.parse import urlsplit, urlencode
+from typing import Any, Dict, List, Optional
+
+KINDS = ('people', 'person', 'search')
+
+
+def parse_mix(text: str) -> Dict[str, int]:
+    mix: Dict[str, int] = {}
+    for part in str(text or '').split(','):
+        if not part.strip():
+            continue
+        kind, _, weight = part.partition('=')
+        kind = kind.strip()
+        if kind not in KINDS:
+            raise ValueError(f'未知的请求类型：{kind}（可选 {", ".join(KINDS)}）')
+        mix[kind] = max(0, int(weight or 1))
+    if not sum(mix.values()):
+        raise ValueError('mix 权重之和必须大于 0')
+    return mix
+
+
+def percentile(sorted_values: List[float], p: float) -> Optional[float]:
+    if not sorted_values:
+        return None
+    idx = min(len(sorted_values) - 1, max(0, int(round(p / 100.0 * len(sorted_values) + 0.5)) - 1))
+    return sorted_values[idx]
+
+
+class Client:
+    def __init__(self, target: str, timeout: float):
+        u = urlsplit(target)
+        self.https = u.scheme == 'https'
+        self.host = u.hostname or '127.0.0.1'
+        self.port = u.port or (443 if self.https else 80)
+        self.timeout = timeout
+        self.conn: Optional[http.client.HTTPConnection] = None
+
+    def get(self, path: str, headers: Optional[Dict[str, str]] = None) -> int:
+        return self.fetch(path, headers)[0]
+
+    def fetch(self, path: str, headers: Optional[Dict[str, str]] = None):
+        for attempt in range(2):
+            if self.conn is None:
+                cls = http.client.HTTPSConnection if self.https else http.client.HTTPConnection
+                self.conn = cls(self.host, self.port, timeout=self.timeout)
+            try:
+                self.conn.request('GET', path, headers=headers or {})
+                resp = self.conn.getresponse()
+                body = resp.read()
+                if resp.getheader('Connection', '').lower() == 'close':
+                    self.close()
+                return resp.status, body
+            except (http.client.RemoteDisconnected, BrokenPipeError, ConnectionResetError):
+                # 复用的连接已被服务端关闭：重连后重试一次
+                self.close()
+                if attempt:
+                    raise
+        return 0, b''
+
+    def close(self):
+        if self.conn is not None:
+            self.conn.close()
+            self.conn = None
+
+
+def _load_names(target: str, timeout: float) -> List[str]:
+    # 只取已缓存的人物，避免压测触发 AI 生成
+    client = Client(target, timeout)
+    try:
+        _, raw = client.fetch('/api/names?' + urlencode({'limit': 200}))
+        body = json.loads(raw.decode('utf-8') or '{}')
+    except OSError as e:
+        raise RuntimeError(f'无法连接目标实例 {target}：{e}')
+    except ValueError:
+        return []
+    finally:
+        client.close()
+    return [it['name'] for it in (body.get('data') or []) if isinstance(it, dict) and it.get('cached')]
+
+
+def _build_path(kind: str, names: List[str], rnd: random.Random) -> str:
+    if kind == 'people':
+        return '/api/people'
+    name = rnd.choice(names)
+    if kind == 'person':
+        return '/api/person?' + urlencode({'name': name})
+    return '/api/names?' + urlencode({'q': name[:1], 'limit': 20})
+
+
+def run_bench(target: str, duration: float, concurrency: int, mix: Dict[str, int],
+              timeout: float = 10.0, names: Optional[List[str]] = None) -> Dict[str, Any]:
+    names = names if names is not None else _load_names(target, timeout)
+    if not names:
+        mix = {k: w for k, w in mix.items() if k == 'people'}
+        if not sum(mix.values()):
+            raise RuntimeError('目标实例没有已缓存的人物，无法回放 person/search 请求')
+    kinds = [k for k, w in mix.items() for _ in range(w)]
+    lock = threading.Lock()
+    samples: Dict[str, List[float]] = {k: [] for k in mix}
+    errors: Dict[str, int] = {k: 0 for k in mix}
+    deadline = time.monotonic() + duration
+
+    def worker(seed: int):
+        rnd = random.Random(seed)
+        client = Client(target, timeout)
+        local = {k: [] for k in mix}
+        local_err = {k: 0 for k in mix}
+        while time.monotonic() < deadline:
+            kind = rnd.choice(kinds)
+            start = time.perf_counter()
+            try:
+                status = client.get(_build_path(kind, names, rnd))
+                ok = 200 <= status < 400
+            except Exception:
+                client.close()
+                ok = False
+            local[kind].append(time.perf_counter() - start)
+            if not ok:
+                local_err[kind] += 1
+        client.close()
+        with lock:
+            for k in mix:
+                samples[k].extend(local[k])
+                errors[k] += local_err[k]
+
+    started = time.monotonic()
+    threads = [threading.Thread(target=worker, args=(i,), daemon=True) for i in range(concurrency)]
+    for t in threads:
+        t.start()
+    for t in threads:
+        t.join()
+    elapsed = time.monotonic() - started
+
+    def summarize(values: List[float], errs: int) -> Dict[str, Any]:
+        values = sorted(values)
+        ms = lambda v: None if v is None else round(v * 1000, 2)
+        return {
+            'requests': len(values),
+            'errors': errs,
+            'rps': round(len(values) / elapsed, 1) if elapsed else None,
+            'p50_ms': ms(percentile(values, 50)),
+            'p90_ms': ms(percentile(values, 90)),
+            'p99_ms': ms(percentile(values, 99)),
+            'max_ms': ms(values[-1] if values else None),
+        }
+
+    all_values = [v for vs in samples.values() for v in vs]
+    return {
+        'target': target,
+        'duration_sec': round(elapsed, 2),
+        'concurrency': concurrency,
+        'mix': mix,
+        'names': len(names),
+        'total': summarize(all_values, sum(errors.values())),
+        'by_kind': {k: summarize(samples[k], errors[k]) for k in mix},
+    }
+
+
+def render_text(r: Dict[str, Any]) -> str:
+    header = f'{"类型":<8}{"请求":>6}{"错误":>4}{"rps":>9}{"p50":>9}{"p90":>9}{"p99":>9}{"max":>9}'
+    lines = [f'{r["target"]}  并发 {r["concurrency"]}  时长 {r["duration_sec"]}s  人物样本 {r["names"]}', header]
+    rows = list(r['by_kind'].items()) + [('total', r['total'])]
+    for kind, s in rows:
+        fmt = lambda v: '-' if v is None else f'{v:.1f}'
+        lines.append(f'{kind:<10}{s["requests"]:>8}{s["errors"]:>6}{fmt(s["rps"]):>9}'
+                     f'{fmt(s["p50_ms"]):>9}{fmt(s["p90_ms"]):>9}{fmt(s["p99_ms"]):>9}{fmt(s["max_ms"]):>9}')
+    lines.append('（延迟单位 ms）')
+    return '\n'.join(lines)
+
+
+def main(argv: List[str], default_target: str) -> int:
+    parser = argparse.ArgumentParser(prog='index.py bench', description='对运行中的实例回放混合流量并统计延迟')
+    parser.add_argument('--target', default=default_target, help=f'目标地址（默认 {default_target}）')
+    parser.add_argument('--duration', type=float, default=10.0, help='持续秒数（默认 10）')
+    parser.add_argument('--concurrency', type=int, default=8, help='并发连接数（默认 8）')
+    parser.add_argument('--mix', default='people=1,person=3,search=2', help='请求类型权重')
+    parser.add_argument('--timeout', type=float, default=10.0, help='单个请求超时秒数')
+    parser.add_argument('--json', action='store_true', help='以 JSON 输出报告')
+    args = parser.parse_args(argv)
+    try:
+        mix = parse_mix(args.mix)
+        report = run_bench(args.target.rstrip('/'), max(0.1, args.duration), max(1, args.concurrency), mix, args.timeout)
+    except (ValueError, RuntimeError) as e:
+        print(str(e), file=sys.stderr)
+        return 1
+    print(json.dumps(report, ensure_ascii=False, indent=2) if args.json else render_text(report))
+    return 1 if report['total']['errors'] else 0
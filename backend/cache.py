@@ -1,26 +1,133 @@
 import os
 import json
+import contextlib
 import threading
 import time
-from typing import Any, Dict, List, Optional
+from typing import Any, Callable, Dict, List, Optional
+from textnorm import normalize_name, name_key
+from aliases import AliasTable
+import integrity
+import importer
+import config
+import migrate
+from datacheck import parse_year
 
-try:
-    import xlrd
-except Exception:
-    xlrd = None
+# /api/people 与 /api/names 的 sort= 取值，前缀 - 表示降序；added 为加入缓存（姓名列表）的先后
+SORTS = ('name', 'events', 'year', 'added')
+
+
+# 模糊查找时从查询末尾去掉的称谓（「鲁迅先生」→「鲁迅」）
+HONORIFICS = ('先生', '女士', '同志', '老师', '教授', '大师', '将军', '元帅', '主席', '总理', '夫人', '公')
+
+
+def edit_distance(a: str, b: str, cap: int) -> int:
+    """Levenshtein 距离；超过 cap 时提前返回 cap + 1。"""
+    if abs(len(a) - len(b)) > cap:
+        return cap + 1
+    prev = list(range(len(b) + 1))
+    for i, ca in enumerate(a, 1):
+        cur = [i]
+        for j, cb in enumerate(b, 1):
+            cur.append(min(prev[j] + 1, cur[j - 1] + 1, prev[j - 1] + (ca != cb)))
+        if min(cur) > cap:
+            return cap + 1
+        prev = cur
+    return prev[-1]
+
+
+def _earliest_year(person: Optional[Dict[str, Any]]) -> Optional[int]:
+    years = [y for y in (parse_year(e.get('year')) for e in (person or {}).get('events') or []) if y is not None]
+    return min(years) if years else None
+
+
+def sort_entries(entries: List[Any], sort: str, name_of: Callable[[Any], str],
+                 person_of: Callable[[Any], Optional[Dict[str, Any]]]) -> List[Any]:
+    """按 sort 稳定排序（entries 需为加入顺序）；同值按姓名升序，没有该值的（无事件、无年份）排在最后。"""
+    field, desc = sort.lstrip('-'), sort.startswith('-')
+    if field == 'added':
+        return list(reversed(entries)) if desc else list(entries)
+    if field == 'name':
+        return sorted(entries, key=lambda x: name_key(name_of(x)), reverse=desc)
+    value = (lambda x: len((person_of(x) or {}).get('events') or []) or None) if field == 'events' \
+        else (lambda x: _earliest_year(person_of(x)))
+    by_name = sorted(entries, key=lambda x: name_key(name_of(x)))
+    present = [x for x in by_name if value(x) is not None]
+    missing = [x for x in by_name if value(x) is None]
+    return sorted(present, key=value, reverse=desc) + missing
+
+
+def _span(ctx, name: str, **attrs):
+    # ctx 为请求上下文时记入耗时分段（见 reqctx.py），后台调用（定时落盘、启动）传 None
+    return ctx.span(name, **attrs) if ctx is not None else contextlib.nullcontext()
 
 
 class Cache:
+    """人物与姓名缓存。
+
+    查询与修改只在内存中进行、不阻塞，不接收请求上下文；读写磁盘的 flush_now、backup_person、reload_names
+    接收可选的 ctx（reqctx.Context）：磁盘操作记入 ctx.span，开始前 ctx 已到期或取消时不再写入（备份除外）。
+    """
+
     def __init__(self):
         self._lock = threading.Lock()
         self.people: Optional[Dict[str, Any]] = None
         self.names: List[str] = []
         self.dirty: bool = False
         self._root: Optional[str] = None
+        self.aliases = AliasTable()
+        self.last_save_at: Optional[float] = None
+        self.last_save_bytes: int = 0
+        self._fallback: Optional[Dict[str, Any]] = None
+        # 命中统计：{'endpoints': {ep: {hit, miss}}, 'names': {name: {hit, miss}}}，周期落盘至 cache_stats.json
+        self.lookup_stats: Dict[str, Dict[str, Dict[str, int]]] = {'endpoints': {}, 'names': {}}
+        self._stats_dirty: bool = False
+        # 热门人物索引（name_key -> person），启动预热时按访问量建立，查找时优先命中
+        self._hot: Dict[str, Dict[str, Any]] = {}
+        # 覆盖 people.json 前保留的备份份数；启动完整性检查结果（清理的临时文件、恢复所用备份）
+        self.backup_keep: int = 5
+        # 只读模式判断（由启动流程接入开关 read_only）；只读期间定时与停机落盘均跳过，待写标记保留
+        self.read_only: Callable[[], bool] = lambda: False
+        self.integrity: Dict[str, Any] = {'removed_tmp': [], 'restored_from': None}
+        # 增量同步：被移除或改名的人物留下删除记录（name_key -> {name, deleted_at}），落盘至 deleted.json；
+        # tracked_since 之前的删除无从得知，早于它的 since 需要客户端全量重拉
+        self.tombstones: Dict[str, Dict[str, Any]] = {}
+        self.tracked_since: float = time.time()
+        self._tombstones_dirty: bool = False
+        # 数据版本：人物或姓名列表每次变更后递增，与启动时刻、别名表版本一起构成 data_version（GET 接口的 ETag 据此计算）
+        self.revision: int = 0
+        self._epoch: str = format(int(time.time() * 1000), 'x')
+        # 仅从内存移除的人物（name_key -> 记录，见 evict_person）：落盘时原样保留在 people.json 中，重新生成后被新记录取代
+        self._evicted: Dict[str, Dict[str, Any]] = {}
+        # 变更订阅者（见 subscribe），人物新增、修改、删除、改名与批量导入后在锁外回调
+        self._listeners: List[Callable[[Dict[str, Any]], None]] = []
+
+    # -------- Listeners --------
+    def subscribe(self, listener: Callable[[Dict[str, Any]], None]):
+        """登记变更回调，参数为 {'type': 'person.added' | 'person.updated' | 'person.deleted' | 'person.evicted' | 'person.renamed' | 'people.imported', ...}。"""
+        self._listeners.append(listener)
+
+    def data_version(self) -> str:
+        """人物、姓名列表与别名表的当前版本；不变时同一查询的结果不变，重启后不会与之前的版本重复。"""
+        return f'{self._epoch}.{self.revision}.{self.aliases.revision}'
+
+    def _notify(self, event: Dict[str, Any]):
+        # 变更已写入：先递增数据版本，再通知订阅者
+        with self._lock:
+            self.revision += 1
+        for listener in list(self._listeners):
+            try:
+                listener(event)
+            except Exception:
+                pass
 
     # -------- Preload --------
-    def preload(self, root: str, data_dir: str, fallback: Dict[str, Any]):
+    def preload(self, root: str, data_dir: str, fallback: Dict[str, Any], repair: bool = False):
         self._root = root
+        self._fallback = fallback
+        self._check_integrity(root, repair)
+        self.aliases.load(os.path.join(root, 'data', 'aliases.json'))
+        self._load_lookup_stats()
+        self._load_tombstones()
         data = self._read_people_json(root)
         if data and not self._is_empty(data):
             self.people = data
@@ -38,24 +145,39 @@ class Cache:
         for n in (excel_names + json_names):
             if not n:
                 continue
-            low = str(n).lower()
-            if low in seen:
+            key = name_key(n)
+            if key in seen:
                 continue
-            seen.add(low)
-            merged.append(n)
+            seen.add(key)
+            merged.append(normalize_name(n))
         with self._lock:
             self.names = merged
             self.dirty = False
+            self.revision += 1
+
+    def _check_integrity(self, root: str, repair: bool):
+        """清理崩溃遗留的临时文件；people.json 损坏时在修复模式下从备份恢复，否则拒绝启动。"""
+        store = os.path.join(root, 'data')
+        path = os.path.join(store, 'people.json')
+        self.integrity = {'removed_tmp': integrity.remove_stale_tmp(store), 'restored_from': None}
+        if not os.path.exists(path):
+            return
+        try:
+            integrity.load_people(path)
+        except integrity.DataCorruptError as e:
+            if not repair:
+                raise integrity.DataCorruptError(f'{e}（可设置 DATA_REPAIR=1 从备份恢复）')
+            restored = integrity.restore_latest(path, store)
+            if not restored:
+                raise integrity.DataCorruptError(f'{e}（没有可用的备份）')
+            self.integrity['restored_from'] = restored
 
     def _read_people_json(self, root: str) -> Optional[Dict[str, Any]]:
         path = os.path.join(root, 'data', 'people.json')
         if not os.path.exists(path):
             return None
-        try:
-            with open(path, 'r', encoding='utf-8') as f:
-                return json.load(f)
-        except Exception:
-            return None
+        # 完整性已在 _check_integrity 中校验，此处解析失败直接抛出，避免以空数据静默启动
+        return integrity.load_people(path)
 
     def _is_empty(self, data: Dict[str, Any]) -> bool:
         try:
@@ -64,124 +186,745 @@ class Cache:
         except Exception:
             return True
 
-    def _load_excel_names(self, data_dir: str) -> List[str]:
-        names: List[str] = []
+    def _name_sources(self, data_dir: str) -> List[str]:
+        # peoples.xls 优先，其余表格与 CSV 按文件名排序
         candidates: List[str] = []
         preferred = os.path.join(data_dir, 'peoples.xls')
         if os.path.exists(preferred):
             candidates.append(preferred)
         if os.path.isdir(data_dir):
-            for f in os.listdir(data_dir):
-                if f.lower().endswith('.xls'):
+            for f in sorted(os.listdir(data_dir)):
+                if f.lower().endswith(('.xls', '.xlsx', '.csv')):
                     p = os.path.join(data_dir, f)
                     if p not in candidates:
                         candidates.append(p)
-        if not candidates or not xlrd:
-            return []
-        path = candidates[0]
-        try:
-            wb = xlrd.open_workbook(path)
-            sh = wb.sheet_by_index(0)
-            name_col = 0
-            if sh.nrows:
-                header = [str(sh.cell_value(0, c)).strip().lower() for c in range(sh.ncols)]
-                for i, h in enumerate(header):
-                    if ('姓名' in h) or ('人物' in h) or ('人名' in h) or ('name' in h):
-                        name_col = i
-                        break
-            for r in range(1, sh.nrows):
-                val = sh.cell_value(r, name_col)
-                if isinstance(val, str) and val.strip():
-                    names.append(val.strip())
-        except Exception:
-            return []
+        return candidates
+
+    def _load_excel_names(self, data_dir: str, report: Optional[Dict[str, Any]] = None, ctx=None) -> List[str]:
+        names: List[str] = []
+        for path in self._name_sources(data_dir):
+            if ctx is not None and ctx.done():
+                if report is not None:
+                    report['cancelled'] = True
+                break
+            try:
+                if path.lower().endswith('.csv'):
+                    found = [normalize_name(p['name']) for p in importer.read_csv_persons(path)]
+                else:
+                    found = importer.read_excel_names(path)
+            except Exception as e:
+                if report is not None:
+                    report['failed'].append({'file': os.path.basename(path), 'error': str(e)})
+                continue
+            names.extend(found)
+            if report is not None:
+                report['files'].append({'file': os.path.basename(path), 'names': len(found)})
         seen = set()
         uniq = []
         for n in names:
-            low = n.lower()
-            if low in seen:
+            key = name_key(n)
+            if not key or key in seen:
                 continue
-            seen.add(low)
+            seen.add(key)
             uniq.append(n)
         return uniq
 
+    def reload_names(self, data_dir: str, ctx=None) -> Dict[str, Any]:
+        """重新扫描姓名来源（表格目录与 people.json），把新姓名追加到姓名列表，已有姓名及顺序不变。
+        ctx 到期或取消后不再读取剩余文件，已读到的姓名照常并入，报告中 cancelled 为 True。"""
+        report: Dict[str, Any] = {'files': [], 'failed': [], 'added': 0, 'total': 0}
+        with _span(ctx, 'disk.names'):
+            excel_names = self._load_excel_names(data_dir, report, ctx)
+        with self._lock:
+            json_names = [p.get('name') for p in (self.people or {}).get('persons', []) if p.get('name')]
+            names_out = list(self.names or [])
+            known = set(name_key(n) for n in names_out)
+            for n in excel_names + json_names:
+                key = name_key(n)
+                if not key or key in known:
+                    continue
+                known.add(key)
+                names_out.append(normalize_name(n))
+            report['added'] = len(names_out) - len(self.names or [])
+            report['total'] = len(names_out)
+            if report['added']:
+                self.names = names_out
+                self.revision += 1
+        return report
+
+    # -------- Aliases --------
+    def add_alias(self, alias: str, canonical: str) -> bool:
+        """登记别名并写入 aliases.json（见 aliases.py）；为空或与规范姓名相同时不登记，返回 False。"""
+        return self.aliases.add(alias, canonical)
+
+    def alias_map(self) -> Dict[str, str]:
+        """别名 → 规范姓名（内置与自定义合并）。"""
+        return self.aliases.all()
+
     # -------- Accessors --------
     def get_people_or_fallback(self, fallback: Dict[str, Any]) -> Dict[str, Any]:
         return self.people or fallback
 
+    def get_people_page(self, fallback: Dict[str, Any], offset: int = 0, limit: Optional[int] = None,
+                        where: Optional[Callable[[Dict[str, Any]], bool]] = None, sort: str = 'added'):
+        """按 sort（见 SORTS，默认原有顺序）分页返回人物，where 为可选过滤条件。返回 (total, persons)，total 为过滤后的总数。"""
+        with self._lock:
+            persons = list(((self.people or fallback) or {}).get('persons') or [])
+        if where is not None:
+            persons = [p for p in persons if where(p)]
+        persons = sort_entries(persons, sort, lambda p: p.get('name', ''), lambda p: p)
+        total = len(persons)
+        start = max(0, offset or 0)
+        end = total if limit is None else start + max(0, limit)
+        return total, persons[start:end]
+
+    def changes_since(self, since: float, fallback: Dict[str, Any], limit: Optional[int] = None) -> Dict[str, Any]:
+        """返回 updated_at 晚于 since 的人物（按 updated_at 升序，最多 limit 个，同一时刻的不拆开）与此后的删除记录。
+
+        since <= 0 时返回全部人物（无 updated_at 的旧数据视为 0）；reset 为 True 表示 since 早于删除记录的起点，
+        客户端应全量重拉。
+        """
+        now = time.time()
+        with self._lock:
+            persons = list(((self.people or fallback) or {}).get('persons') or [])
+            deleted = [dict(t) for t in self.tombstones.values() if t.get('deleted_at', 0) > since]
+            tracked_since = self.tracked_since
+        changed = sorted((p for p in persons if since <= 0 or (p.get('updated_at') or 0) > since),
+                         key=lambda p: p.get('updated_at') or 0)
+        total = len(changed)
+        if limit is not None and total > limit:
+            last = changed[limit - 1].get('updated_at') or 0
+            end = limit
+            while end < total and (changed[end].get('updated_at') or 0) == last:
+                end += 1
+            changed = changed[:end]
+        has_more = len(changed) < total
+        # 未取完时下一次从本页最后一个时间点继续，删除记录也截到同一时间点
+        cursor = (changed[-1].get('updated_at') or 0) if has_more and changed else now
+        deleted = sorted((t for t in deleted if t['deleted_at'] <= cursor), key=lambda t: t['deleted_at'])
+        return {'persons': changed, 'deleted': deleted, 'total': total, 'has_more': has_more,
+                'next_since': cursor, 'now': now, 'reset': 0 < since < tracked_since}
+
     def get_names(self) -> List[str]:
         return self.names or []
 
+    def find_person(self, name: str, fallback: Optional[Dict[str, Any]] = None) -> Optional[Dict[str, Any]]:
+        # 按归一化键查找人物（繁简、全半角、空白差异视为同一人），未命中时再按别名表解析
+        keys = [name_key(name)]
+        canonical = name_key(self.aliases.resolve(name))
+        if canonical not in keys:
+            keys.append(canonical)
+        if not keys[0]:
+            return None
+        with self._lock:
+            for key in keys:
+                if key in self._hot:
+                    return self._hot[key]
+            persons = (self.people or fallback or {}).get('persons') or []
+            for key in keys:
+                for p in persons:
+                    if name_key(p.get('name', '')) == key:
+                        return p
+        return None
+
+    def find_fuzzy(self, name: str, max_distance: int = 0) -> Optional[Dict[str, Any]]:
+        """精确与别名查找都未命中时的近似查找，只在已有轨迹的人物中进行：
+        1. 去掉全部空白后相同（「Sun Yat sen」与「Sun Yatsen」）
+        2. 去掉末尾称谓后命中（「鲁迅先生」）
+        3. 编辑距离不超过 max_distance（且不超过姓名长度的一半取整减一，两字姓名不做近似），且最近的只有一位
+        返回 {'person', 'match': compact|honorific|edit, 'distance'}，未找到或有歧义时返回 None。
+        """
+        compact = ''.join(name_key(name).split())
+        if not compact:
+            return None
+        with self._lock:
+            persons = [p for p in ((self.people or {}).get('persons') or []) if p.get('events')]
+        keyed = [(''.join(name_key(p.get('name', '')).split()), p) for p in persons]
+        for key, p in keyed:
+            if key == compact:
+                return {'person': p, 'match': 'compact', 'distance': 0}
+        for suffix in HONORIFICS:
+            stem = compact[:-len(suffix)] if compact.endswith(suffix) else ''
+            if len(stem) >= 2:
+                found = self.find_person(stem) or next((p for key, p in keyed if key == stem), None)
+                if found and found.get('events'):
+                    return {'person': found, 'match': 'honorific', 'distance': 0}
+        cap = min(max_distance, (len(compact) - 1) // 2)
+        if cap <= 0:
+            return None
+        best, best_d, ambiguous = None, cap + 1, False
+        for key, p in keyed:
+            d = edit_distance(compact, key, cap)
+            if d < best_d:
+                best, best_d, ambiguous = p, d, False
+            elif d == best_d and d <= cap:
+                ambiguous = True
+        if best is None or ambiguous:
+            return None
+        return {'person': best, 'match': 'edit', 'distance': best_d}
+
+    def has_person(self, name: str) -> bool:
+        # 判断该姓名是否已有可直接返回的缓存轨迹（events 非空）
+        p = self.find_person(name)
+        return bool(p) and len(p.get('events') or []) > 0
+
+    def suggest_names(self, q: str, limit: int = 10) -> List[Dict[str, Any]]:
+        """输入提示：姓名（及别名）以 q 开头的排在前面，其次包含 q 的；同级内已缓存的、较短的优先。
+        比较时去掉全部空白（「李 白」「李白」视为同一个），结果按规范姓名去重。
+        返回 [{name, cached, match: exact|prefix|substring, alias?}]。"""
+        term = ''.join(name_key(q).split())
+        if not term:
+            return []
+        with self._lock:
+            names = list(self.names or [])
+            persons = (self.people or {}).get('persons') or []
+            cached = set(name_key(p.get('name', '')) for p in persons if p.get('events'))
+        candidates = [(n, None) for n in names] + [(c, a) for a, c in self.aliases.all().items()]
+        best: Dict[str, Dict[str, Any]] = {}
+        for name, alias in candidates:
+            text = ''.join(name_key(alias if alias else name).split())
+            pos = text.find(term)
+            if pos < 0:
+                continue
+            rank = 0 if text == term else (1 if pos == 0 else 2)
+            key = ''.join(name_key(name).split())
+            item = {'name': normalize_name(name), 'cached': name_key(name) in cached,
+                    'match': ('exact', 'prefix', 'substring')[rank], '_rank': rank, '_len': len(text)}
+            if alias:
+                item['alias'] = alias
+            cur = best.get(key)
+            if cur is None or (rank, alias is not None) < (cur['_rank'], 'alias' in cur):
+                best[key] = item
+        ranked = sorted(best.values(), key=lambda it: (it['_rank'], not it['cached'], it['_len'], name_key(it['name'])))
+        return [{k: v for k, v in it.items() if not k.startswith('_')} for it in ranked[:max(0, limit)]]
+
+    def get_names_page(self, q: str = '', offset: int = 0, limit: Optional[int] = None, sort: str = 'added'):
+        """按子串过滤、按 sort（见 SORTS，默认姓名列表原有顺序）排序并分页返回姓名，附带是否已缓存标记。
+        返回 (total, items)，items 为 [{name, cached}]。
+        """
+        term = name_key(q)
+        with self._lock:
+            names = list(self.names or [])
+            persons = (self.people or {}).get('persons') or []
+            by_key = {name_key(p.get('name', '')): p for p in persons}
+            cached = set(k for k, p in by_key.items() if k and len(p.get('events') or []) > 0)
+        if term:
+            # 别名命中时也返回其规范姓名（如搜「东坡」返回「苏轼」）
+            alias_hits = set(name_key(c) for a, c in self.aliases.all().items() if term in name_key(a))
+            names = [n for n in names if term in name_key(n) or name_key(n) in alias_hits]
+        names = sort_entries(names, sort, lambda n: n, lambda n: by_key.get(name_key(n)))
+        total = len(names)
+        start = max(0, offset or 0)
+        end = total if limit is None else start + max(0, limit)
+        items = [{'name': n, 'cached': name_key(n) in cached} for n in names[start:end]]
+        return total, items
+
+    def summary(self) -> Dict[str, Any]:
+        # 缓存规模概览（人物数、事件数、姓名数、落盘信息）
+        with self._lock:
+            persons = (self.people or {}).get('persons') or []
+            events = sum(len(p.get('events') or []) for p in persons)
+            names = len(self.names or [])
+            dirty = self.dirty
+        path = os.path.join(self._root, 'data', 'people.json') if self._root else None
+        file_bytes = os.path.getsize(path) if path and os.path.exists(path) else 0
+        return {
+            'persons': len(persons),
+            'events': events,
+            'names': names,
+            'aliases': len(self.aliases.all()),
+            'dirty': dirty,
+            'file_bytes': file_bytes,
+            'last_save_at': self.last_save_at,
+            'last_save_bytes': self.last_save_bytes,
+        }
+
+    # -------- Hit/Miss accounting --------
+    def _stats_path(self) -> Optional[str]:
+        return os.path.join(self._root, 'data', 'cache_stats.json') if self._root else None
+
+    def _load_lookup_stats(self):
+        path = self._stats_path()
+        if not path or not os.path.exists(path):
+            return
+        try:
+            with open(path, 'r', encoding='utf-8') as f:
+                data = json.load(f)
+            if isinstance(data, dict):
+                with self._lock:
+                    self.lookup_stats = {
+                        'endpoints': dict(data.get('endpoints') or {}),
+                        'names': dict(data.get('names') or {}),
+                    }
+        except Exception:
+            pass
+
+    def record_lookup(self, endpoint: str, name: str, hit: bool):
+        field = 'hit' if hit else 'miss'
+        key = normalize_name(name)
+        with self._lock:
+            ep = self.lookup_stats['endpoints'].setdefault(endpoint, {'hit': 0, 'miss': 0})
+            ep[field] = ep.get(field, 0) + 1
+            if key:
+                per = self.lookup_stats['names'].setdefault(key, {'hit': 0, 'miss': 0})
+                per[field] = per.get(field, 0) + 1
+            self._stats_dirty = True
+
+    def lookup_summary(self, top: int = 10) -> Dict[str, Any]:
+        """汇总命中率；hot 为请求最多的姓名，misses 为未命中（触发生成）最多的姓名。"""
+        with self._lock:
+            endpoints = {k: dict(v) for k, v in self.lookup_stats['endpoints'].items()}
+            names = {k: dict(v) for k, v in self.lookup_stats['names'].items()}
+        hit = sum(v.get('hit', 0) for v in endpoints.values())
+        miss = sum(v.get('miss', 0) for v in endpoints.values())
+        for v in endpoints.values():
+            total = v.get('hit', 0) + v.get('miss', 0)
+            v['hit_rate'] = round(v.get('hit', 0) / total, 4) if total else None
+        ranked = sorted(names.items(), key=lambda kv: -(kv[1].get('hit', 0) + kv[1].get('miss', 0)))
+        missed = sorted([kv for kv in names.items() if kv[1].get('miss', 0)], key=lambda kv: -kv[1].get('miss', 0))
+        return {
+            'hit': hit,
+            'miss': miss,
+            'hit_rate': round(hit / (hit + miss), 4) if (hit + miss) else None,
+            'endpoints': endpoints,
+            'hot': [{'name': k, **v} for k, v in ranked[:top]],
+            'misses': [{'name': k, **v} for k, v in missed[:top]],
+        }
+
+    def hot_names(self, top: int = 20) -> List[str]:
+        """按累计访问次数（hit + miss）降序返回最常被请求的姓名。"""
+        with self._lock:
+            names = list(self.lookup_stats['names'].items())
+        ranked = sorted(names, key=lambda kv: -(kv[1].get('hit', 0) + kv[1].get('miss', 0)))
+        return [k for k, _ in ranked[:max(0, top)]]
+
+    def warm_up(self, top: int = 20) -> List[Dict[str, Any]]:
+        """为访问最多的 top 个人物建立热门索引，返回已缓存（events 非空）的人物。"""
+        hot: Dict[str, Dict[str, Any]] = {}
+        for name in self.hot_names(top):
+            p = self.find_person(name)
+            if p and len(p.get('events') or []) > 0:
+                hot[name_key(p.get('name', ''))] = p
+        with self._lock:
+            self._hot = hot
+        return list(hot.values())
+
     # -------- Mutators --------
     def upsert_person(self, person: Dict[str, Any], fallback: Dict[str, Any]):
-        name = str(person.get('name', '')).strip()
+        name = normalize_name(person.get('name', ''))
         if not name:
             return
+        person['name'] = name
+        migrate.assign_ids(person)
+        person['updated_at'] = time.time()
+        key = name_key(name)
         with self._lock:
+            self._undelete(key)
+            self._evicted.pop(key, None)
             base = self.people or fallback
             persons = (base or {}).get('persons') or []
             idx = None
             for i, p in enumerate(persons):
-                if str(p.get('name', '')).strip().lower() == name.lower():
+                if name_key(p.get('name', '')) == key:
                     idx = i
                     break
             if idx is None:
                 persons.append(person)
             else:
                 persons[idx] = person
+            if key in self._hot:
+                self._hot[key] = person
             if base is fallback:
                 self.people = {'persons': persons}
             else:
                 self.people['persons'] = persons
             # names 去重
-            low_names = set([n.lower() for n in (self.names or [])])
-            if name.lower() not in low_names:
+            keys = set([name_key(n) for n in (self.names or [])])
+            if key not in keys:
                 self.names.append(name)
             self.dirty = True
+        self._notify({'type': 'person.added' if idx is None else 'person.updated', 'name': name,
+                      'updated_at': person['updated_at']})
+
+    def backup_person(self, name: str, ctx=None) -> Optional[str]:
+        """整体替换人物前另存其当前版本（见 integrity.backup_person），返回备份路径；人物不存在或写入失败时返回 None。
+        备份是覆盖前的保护，不因 ctx 到期而跳过。"""
+        person = self.find_person(name)
+        if not person or not self._root:
+            return None
+        with self._lock:
+            snapshot = json.loads(json.dumps(person))
+        try:
+            with _span(ctx, 'disk.backup'):
+                return integrity.backup_person(snapshot, name_key(snapshot.get('name', name)),
+                                               os.path.join(self._root, 'data'), self.backup_keep)
+        except Exception:
+            return None
+
+    def evict_person(self, name: str, persist: bool = False) -> Optional[Dict[str, Any]]:
+        """从缓存移除人物（姓名仍保留在姓名列表中，下次查询重新生成），返回被移除的记录，未命中返回 None。
+
+        默认只移除内存中的记录，people.json 中的仍保留（落盘时原样写回），直到重新生成后被新记录取代；
+        persist=True 时同时从磁盘删除：登记删除记录并标记待落盘。
+        """
+        keys = [name_key(name)]
+        canonical = name_key(self.aliases.resolve(name))
+        if canonical not in keys:
+            keys.append(canonical)
+        removed = None
+        with self._lock:
+            persons = (self.people or {}).get('persons') or []
+            for key in keys:
+                idx = next((i for i, p in enumerate(persons) if key and name_key(p.get('name', '')) == key), None)
+                if idx is not None:
+                    removed = persons.pop(idx)
+                    self._hot.pop(key, None)
+                    if persist:
+                        self._tombstone(removed.get('name', ''))
+                        self.dirty = True
+                    else:
+                        self._evicted[key] = removed
+                    break
+            if removed is None and persist:
+                # 已从内存移除的人物再要求删除磁盘记录
+                key = next((k for k in keys if k in self._evicted), None)
+                if key is not None:
+                    removed = self._evicted.pop(key)
+                    self._tombstone(removed.get('name', ''))
+                    self.dirty = True
+        if removed is None:
+            return None
+        self._notify({'type': 'person.deleted' if persist else 'person.evicted', 'name': removed.get('name', '')})
+        return removed
+
+    def rename_person(self, old: str, new: str) -> Dict[str, Any]:
+        """更改人物的规范姓名，同步姓名列表、热门索引、命中统计与别名表（旧名成为新名的别名，原有链接继续有效）。
+
+        返回 {'status': 'ok' | 'not_found' | 'exists', ...}；新名已是另一位人物时不改动。
+        """
+        new = normalize_name(new)
+        old_key, new_key = name_key(self.aliases.resolve(old)), name_key(new)
+        with self._lock:
+            persons = (self.people or {}).get('persons') or []
+            idx = next((i for i, p in enumerate(persons) if name_key(p.get('name', '')) == old_key), None)
+            if idx is None or not new_key:
+                return {'status': 'not_found'}
+            if new_key != old_key and any(name_key(p.get('name', '')) == new_key for p in persons):
+                return {'status': 'exists'}
+            person = dict(persons[idx], name=new, updated_at=time.time())
+            old_name = persons[idx].get('name', '')
+            persons[idx] = person
+            if new_key != old_key:
+                self._tombstone(old_name)
+                self._undelete(new_key)
+            # 姓名列表中原位替换，去掉重复的新名
+            names_out = []
+            for n in (self.names or []) + [new]:
+                k = name_key(n)
+                if k in (old_key, new_key):
+                    if new in names_out:
+                        continue
+                    n = new
+                names_out.append(n)
+            self.names = names_out
+            if self._hot.pop(old_key, None) is not None:
+                self._hot[new_key] = person
+            stats = self.lookup_stats['names']
+            if old_key in stats:
+                moved = stats.pop(old_key)
+                merged = stats.setdefault(new_key, {'hit': 0, 'miss': 0})
+                for field in ('hit', 'miss'):
+                    merged[field] = merged.get(field, 0) + moved.get(field, 0)
+                self._stats_dirty = True
+            self.dirty = True
+        aliases_moved = self.aliases.rename_canonical(old_name, new)
+        self._notify({'type': 'person.renamed', 'from': old_name, 'to': new, 'name': new,
+                      'updated_at': person['updated_at']})
+        return {'status': 'ok', 'from': old_name, 'to': new, 'aliases_moved': aliases_moved}
+
+    def update_event(self, name: str, event_id: str, update: Callable[[Dict[str, Any]], Any]) -> Optional[Dict[str, Any]]:
+        """在锁内按事件 id 找到人物的事件，对其副本调用 update(event)，以新记录替换人物（写时复制，见 flush_now），
+        标记待落盘并返回更新后的事件；人物或事件不存在时返回 None。"""
+        keys = [name_key(name), name_key(self.aliases.resolve(name))]
+        with self._lock:
+            persons = (self.people or {}).get('persons') or []
+            idx = next((i for i, p in enumerate(persons) if name_key(p.get('name', '')) in keys), None)
+            events = list(persons[idx].get('events') or []) if idx is not None else []
+            pos = next((i for i, e in enumerate(events) if event_id and e.get('id') == event_id), None)
+            if pos is None:
+                return None
+            event = dict(events[pos])
+            update(event)
+            events[pos] = event
+            person = dict(persons[idx], events=events, updated_at=time.time())
+            self._replace(idx, person)
+        self._notify({'type': 'person.updated', 'name': person.get('name', ''), 'event': event_id,
+                      'updated_at': person['updated_at']})
+        return event
+
+    def set_translation(self, name: str, lang: str, items: Optional[List[Dict[str, str]]]) -> Optional[Dict[str, Any]]:
+        """写入（items 为 None 时删除）人物的 lang 译文（见 translations.py），以新记录替换人物（写时复制）并返回；
+        人物不存在时返回 None。"""
+        keys = [name_key(name), name_key(self.aliases.resolve(name))]
+        with self._lock:
+            persons = (self.people or {}).get('persons') or []
+            idx = next((i for i, p in enumerate(persons) if name_key(p.get('name', '')) in keys), None)
+            if idx is None:
+                return None
+            person = dict(persons[idx], updated_at=time.time())
+            langs = dict(person.get('translations') or {})
+            if items is None:
+                langs.pop(lang, None)
+            else:
+                langs[lang] = {'events': items}
+            if langs:
+                person['translations'] = langs
+            else:
+                person.pop('translations', None)
+            self._replace(idx, person)
+        self._notify({'type': 'person.updated', 'name': person.get('name', ''), 'lang': lang,
+                      'updated_at': person['updated_at']})
+        return person
+
+    def _replace(self, idx: int, person: Dict[str, Any]):
+        # 调用方持有 _lock：以新记录替换 persons[idx]（同步热门索引）并标记待落盘
+        self.people['persons'][idx] = person
+        hot_key = name_key(person.get('name', ''))
+        if hot_key in self._hot:
+            self._hot[hot_key] = person
+        self.dirty = True
+
+    def import_persons(self, persons: List[Dict[str, Any]], on_conflict: str = 'replace', dry_run: bool = False) -> Dict[str, Any]:
+        """批量导入人物；空轨迹仅登记姓名且不覆盖已有轨迹。返回各类计数，dry_run 时不修改缓存。"""
+        report = {'added': 0, 'updated': 0, 'unchanged': 0, 'skipped': 0, 'names_only': 0}
+        now = time.time()
+        touched: List[str] = []
+        changed = False
+        with self._lock:
+            base = self.people if self.people is not None else {'persons': []}
+            existing = {name_key(p.get('name', '')): i for i, p in enumerate(base.get('persons') or [])}
+            persons_out = list(base.get('persons') or [])
+            names_out = list(self.names or [])
+            known_names = set(name_key(n) for n in names_out)
+            for person in persons:
+                name = normalize_name(person.get('name', ''))
+                key = name_key(name)
+                if not key:
+                    report['skipped'] += 1
+                    continue
+                person = dict(person, name=name, events=list(person.get('events') or []), updated_at=now)
+                if key not in known_names:
+                    known_names.add(key)
+                    names_out.append(name)
+                idx = existing.get(key)
+                if idx is None:
+                    existing[key] = len(persons_out)
+                    persons_out.append(person)
+                    touched.append(key)
+                    report['names_only' if not person['events'] else 'added'] += 1
+                    continue
+                current = persons_out[idx]
+                if not person['events']:
+                    report['names_only' if not current.get('events') else 'unchanged'] += 1
+                elif dict(current, updated_at=now) == person:
+                    report['unchanged'] += 1
+                elif current.get('events') and on_conflict == 'skip':
+                    report['skipped'] += 1
+                else:
+                    persons_out[idx] = person
+                    touched.append(key)
+                    report['updated'] += 1
+            if not dry_run and (report['added'] or report['updated'] or report['names_only']):
+                self.people = dict(base, persons=persons_out)
+                self.names = names_out
+                self._hot = {}
+                for key in touched:
+                    self._undelete(key)
+                self.dirty = True
+                changed = True
+        if changed:
+            self._notify(dict(report, type='people.imported', updated_at=now))
+        return report
+
+    def merge_from_disk(self, root: str) -> int:
+        """把 people.json 中内存里还没有的人物并入缓存（已有的保持不变），返回新增数。
+
+        用于重启交接：旧进程在新进程加载数据之后才完成最后一次落盘，可能覆盖了新进程此前写入的人物，
+        因此无论是否新增都标记待落盘，由下一次落盘写回合并后的完整数据。
+        """
+        data = self._read_people_json(root)
+        if not data:
+            return 0
+        with self._lock:
+            evicted = set(self._evicted)
+        persons = [p for p in data.get('persons') or [] if name_key(p.get('name', '')) not in evicted]
+        added = self.import_persons(persons, on_conflict='skip')['added']
+        with self._lock:
+            self.dirty = True
+        return added
+
+    # -------- Tombstones --------
+    def _tombstones_path(self) -> Optional[str]:
+        return os.path.join(self._root, 'data', 'deleted.json') if self._root else None
+
+    def _load_tombstones(self):
+        path = self._tombstones_path()
+        if not path:
+            return
+        if not os.path.exists(path):
+            # 首次启用：写下起点，重启后不再前移
+            self._tombstones_dirty = True
+            return
+        try:
+            with open(path, 'r', encoding='utf-8') as f:
+                data = json.load(f)
+            if isinstance(data, dict):
+                with self._lock:
+                    self.tombstones = dict(data.get('deleted') or {})
+                    self.tracked_since = float(data.get('tracked_since') or self.tracked_since)
+        except Exception:
+            pass
+
+    def _tombstone(self, name: str):
+        """在锁内调用：登记删除记录，超出保留期的旧记录一并清理并前移 tracked_since。"""
+        now = time.time()
+        key = name_key(name)
+        if key:
+            self.tombstones[key] = {'name': name, 'deleted_at': now}
+        cutoff = now - config.get_people_tombstone_days() * 86400
+        expired = [k for k, t in self.tombstones.items() if t.get('deleted_at', 0) < cutoff]
+        for k in expired:
+            del self.tombstones[k]
+        if expired:
+            self.tracked_since = max(self.tracked_since, cutoff)
+        self._tombstones_dirty = True
+
+    def _undelete(self, key: str):
+        """在锁内调用：人物重新出现时撤销删除记录。"""
+        if self.tombstones.pop(key, None) is not None:
+            self._tombstones_dirty = True
+
+    def _flush_tombstones(self):
+        path = self._tombstones_path()
+        if not path:
+            return
+        with self._lock:
+            if not self._tombstones_dirty:
+                return
+            data = {'tracked_since': self.tracked_since, 'deleted': json.loads(json.dumps(self.tombstones))}
+            self._tombstones_dirty = False
+        if not self._write_json_atomic(path, data):
+            with self._lock:
+                self._tombstones_dirty = True
 
     # -------- Flush to disk --------
-    def _save_people_json_atomic(self, data: Dict[str, Any]):
+    def storage_writable(self) -> bool:
+        """落盘能否进行：原子写入先写临时文件再替换，只要求 data 目录可写（/readyz 使用）。"""
         if not self._root:
-            return
-        path = os.path.join(self._root, 'data', 'people.json')
+            return False
+        store = os.path.join(self._root, 'data')
+        return os.path.isdir(store) and os.access(store, os.W_OK)
+
+    def _write_json_atomic(self, path: str, data: Any) -> bool:
         tmp = path + '.tmp'
         try:
             with open(tmp, 'w', encoding='utf-8') as f:
                 json.dump(data, f, ensure_ascii=False, indent=2)
             os.replace(tmp, path)
+            return True
         except Exception:
             try:
                 if os.path.exists(tmp):
                     os.remove(tmp)
             except Exception:
                 pass
+            return False
+
+    def _save_people_json_atomic(self, data: Dict[str, Any]) -> bool:
+        if not self._root:
+            return False
+        path = os.path.join(self._root, 'data', 'people.json')
+        try:
+            integrity.backup_file(path, os.path.join(self._root, 'data'), self.backup_keep)
+        except Exception:
+            pass
+        if self._write_json_atomic(path, data):
+            self.last_save_at = time.time()
+            self.last_save_bytes = os.path.getsize(path)
+            return True
+        return False
+
+    def _flush_lookup_stats(self):
+        path = self._stats_path()
+        if not path:
+            return
+        with self._lock:
+            if not self._stats_dirty:
+                return
+            data = json.loads(json.dumps(self.lookup_stats))
+            self._stats_dirty = False
+        self._write_json_atomic(path, data)
 
     def start_flush_thread(self, interval_sec: int = 30, logger=None):
         t = threading.Thread(target=self._periodic_flush, kwargs={'interval_sec': interval_sec, 'logger': logger}, daemon=True)
         t.start()
 
+    def flush(self) -> Optional[int]:
+        """立即落盘待写变更；返回写入的人物数，无变更或只读时返回 None。"""
+        if self.read_only():
+            return None
+        report = self.flush_now()
+        return report['persons'] if report['attempted'] else None
+
+    def flush_now(self, force: bool = False, ctx=None) -> Dict[str, Any]:
+        """落盘并返回明细：attempted（有变更或 force）、saved、persons、bytes、duration_ms。
+        写入失败时保留待写标记，由下次落盘重试；ctx 已到期或取消时不写入（cancelled 为 True），待写标记同样保留。"""
+        if ctx is not None and ctx.done():
+            return {'attempted': False, 'saved': False, 'cancelled': True, 'persons': 0, 'bytes': 0, 'duration_ms': 0.0}
+        start = time.perf_counter()
+        data: Optional[Dict[str, Any]] = None
+        with self._lock:
+            # 内置示例数据不落盘：强制落盘只针对已有的真实数据
+            if self.dirty or (force and self.people is not None and self.people is not self._fallback):
+                base = self.people or {'persons': []}
+                data = dict(base) if isinstance(base, dict) else {'persons': []}
+                # 人物记录放入 persons 后不再原地修改（各修改方法以新 dict 替换，写时复制），
+                # 复制列表即得到一致的快照，可在锁外序列化
+                data['persons'] = list(data.get('persons') or [])
+                present = {name_key(p.get('name', '')) for p in data['persons']}
+                data['persons'] += [p for k, p in self._evicted.items() if k not in present]
+                self.dirty = False
+        saved = False
+        if data is not None:
+            with _span(ctx, 'disk.people', persons=len(data['persons'])):
+                saved = self._save_people_json_atomic(data)
+            if not saved:
+                with self._lock:
+                    self.dirty = True
+        with _span(ctx, 'disk.meta'):
+            self._flush_lookup_stats()
+            self._flush_tombstones()
+        return {
+            'attempted': data is not None,
+            'saved': saved,
+            'persons': len(data['persons']) if data is not None else 0,
+            'bytes': self.last_save_bytes if saved else 0,
+            'duration_ms': round((time.perf_counter() - start) * 1000, 1),
+        }
+
     def _periodic_flush(self, interval_sec: int = 30, logger=None):
         while True:
             time.sleep(interval_sec)
             try:
-                do_write = False
-                data: Dict[str, Any] = {'persons': []}
-                with self._lock:
-                    if self.dirty:
-                        base = self.people or {'persons': []}
-                        data = base if isinstance(base, dict) else {'persons': []}
-                        self.dirty = False
-                        do_write = True
-                if do_write:
-                    self._save_people_json_atomic(data)
-                    if logger:
-                        try:
-                            logger.info("已将缓存写入 people.json（周期=%ss，persons=%d）", interval_sec, len((data or {}).get('persons', [])))
-                        except Exception:
-                            pass
+                written = self.flush()
+                if written is not None and logger:
+                    try:
+                        logger.info("已将缓存写入 people.json（周期=%ss，persons=%d）", interval_sec, written)
+                    except Exception:
+                        pass
             except Exception:
                 if logger:
                     try:
                         logger.error("写入 people.json 失败，将在下次周期重试")
                     except Exception:
-                        pass
\ No newline at end of file
+                        pass
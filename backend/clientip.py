@@ -0,0 +1,70 @@
+"""
+客户端地址识别：部署在反向代理（nginx）之后时，对端地址总是代理本身
+
+对端属于可信代理（TRUSTED_PROXIES）时按以下顺序取客户端地址，否则直接用对端地址：
+- X-Forwarded-For 自右向左跳过可信代理后的第一个地址（左侧的条目可由客户端伪造，不予采信）
+- X-Real-IP
+格式不合法的条目及其左侧的条目均不采信，此时取其右侧最近的地址（没有时退回 X-Real-IP）。
+"""
+
+import ipaddress
+import threading
+from typing import List, Optional, Tuple
+
+import config
+
+_lock = threading.Lock()
+_parsed: Tuple[Tuple[str, ...], List, bool] = ((), [], False)
+
+
+def _trusted():
+    # 按配置值缓存解析结果：(网段列表, 是否信任 Unix 套接字)
+    global _parsed
+    raw = tuple(config.get_trusted_proxies())
+    with _lock:
+        if _parsed[0] != raw:
+            nets = []
+            for item in raw:
+                if item.lower() == 'unix':
+                    continue
+                try:
+                    nets.append(ipaddress.ip_network(item, strict=False))
+                except ValueError:
+                    pass
+            _parsed = (raw, nets, any(item.lower() == 'unix' for item in raw))
+        return _parsed[1], _parsed[2]
+
+
+def _ip(value: str):
+    try:
+        return ipaddress.ip_address(value.strip())
+    except ValueError:
+        return None
+
+
+def _is_trusted(addr: str, nets, unix: bool) -> bool:
+    if addr == 'unix':
+        return unix
+    ip = _ip(addr)
+    return ip is not None and any(ip in net for net in nets)
+
+
+def resolve(handler) -> str:
+    """返回请求的客户端地址（字符串）。"""
+    peer = handler.address_string()
+    nets, unix = _trusted()
+    if not _is_trusted(peer, nets, unix):
+        return peer
+    forwarded = [p.strip() for p in str(handler.headers.get('X-Forwarded-For') or '').split(',') if p.strip()]
+    client: Optional[str] = None
+    for addr in reversed(forwarded):
+        if _ip(addr) is None:
+            break
+        client = addr
+        if not _is_trusted(addr, nets, unix):
+            return addr
+    if client is not None:
+        # 整条链均为可信代理：取最左侧（最早的）地址
+        return client
+    real = str(handler.headers.get('X-Real-IP') or '').strip()
+    return real if _ip(real) is not None else peer
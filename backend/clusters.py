@@ -0,0 +1,215 @@
+"""
+时空聚类分析（GET /api/analysis/clusters）
+
+把全部已缓存人物的事件按“地点 × 时期”聚成簇，供研究者在大量轨迹中发现规律（如“11世纪开封的官员”）：
+1. 地点：有坐标的地点按出现次数从多到少贪心合并，距簇中心不超过 radius_km 的并入该簇，以最常见的地名命名；
+   无坐标的地点按归一化名称单独成簇
+2. 时期：同一地点簇内的事件按年份排序，相邻年份间隔超过 gap_years 即切分（一维密度聚类）
+3. 只保留涉及至少 min_persons 位不同人物的簇
+簇名由时期（同一世纪内为“11世纪”，否则为起止年代）、地名与人物身份组成；身份取事件标题关键词最多的一类，
+都不匹配时为“人物”。同一时期若整体落在某朝代内，附带朝代名。
+
+分析为后台任务：POST /api/admin/analysis/clusters 触发（参数可调），结果保存到 data/clusters.json，
+GET 接口返回最近一次结果；`python index.py clusters` 离线运行并打印摘要。
+"""
+
+import os
+import json
+import time
+import logging
+import threading
+from collections import Counter
+from typing import Any, Dict, List, Optional
+
+import dynasty
+import overlap
+from textnorm import name_key
+
+logger = logging.getLogger('api')
+
+DEFAULTS = {'radius_km': 30, 'gap_years': 30, 'min_persons': 3}
+# 身份 → 事件标题/详情中的关键词
+ROLE_KEYWORDS = [
+    ('官员', ('任', '知', '官', '丞相', '尚书', '刺史', '太守', '通判', '御史', '宰相', '入朝', '贬')),
+    ('将领', ('战', '军', '征', '将', '攻', '守', '伐', '役')),
+    ('文人', ('诗', '词', '文', '著', '书', '作', '画')),
+    ('学子', ('学', '读', '考', '留学', '师从', '进士', '科举')),
+    ('革命者', ('革命', '起义', '党', '运动')),
+    ('演员', ('出演', '主演', '影', '剧', '演出')),
+]
+
+
+def century_label(year: int) -> str:
+    if year <= 0:
+        return f'公元前{(-year) // 100 + 1}世纪'
+    return f'{(year - 1) // 100 + 1}世纪'
+
+
+def period_label(start: int, end: int) -> str:
+    if century_label(start) == century_label(end):
+        return century_label(start)
+    fmt = lambda y: f'公元前{-y}' if y < 0 else str(y)  # noqa: E731
+    return f'{fmt(start)}–{fmt(end)}年'
+
+
+def _role(texts: List[str]) -> str:
+    scores = Counter()
+    for role, words in ROLE_KEYWORDS:
+        for t in texts:
+            if any(w in t for w in words):
+                scores[role] += 1
+    return scores.most_common(1)[0][0] if scores else '人物'
+
+
+def _points(persons: List[Dict[str, Any]]) -> List[Dict[str, Any]]:
+    out = []
+    for p in persons:
+        for s in overlap.stays(p):
+            if s['place']:
+                e = (p.get('events') or [])[s['event']]
+                out.append({'name': p.get('name', ''), 'year': s['start'], 'place': s['place'], 'coords': s['coords'],
+                            'event': s['event'], 'text': f"{e.get('title') or ''} {e.get('detail') or ''}"})
+    return out
+
+
+def _place_groups(points: List[Dict[str, Any]], radius_km: float) -> List[Dict[str, Any]]:
+    counts = Counter(name_key(pt['place']) for pt in points)
+    names: Dict[str, str] = {}
+    coords: Dict[str, Any] = {}
+    for pt in points:
+        key = name_key(pt['place'])
+        names.setdefault(key, pt['place'])
+        if pt['coords'] and key not in coords:
+            coords[key] = pt['coords']
+    groups: List[Dict[str, Any]] = []
+    assigned: Dict[str, int] = {}
+    for key, _ in sorted(counts.items(), key=lambda kv: (-kv[1], kv[0])):
+        c = coords.get(key)
+        if c is not None:
+            for i, g in enumerate(groups):
+                if g['center'] is not None and overlap.distance_km(g['center'], c) <= radius_km:
+                    assigned[key] = i
+                    g['places'].append(names[key])
+                    break
+        if key not in assigned:
+            assigned[key] = len(groups)
+            groups.append({'label': names[key], 'center': c, 'places': [names[key]], 'points': []})
+    for pt in points:
+        groups[assigned[name_key(pt['place'])]]['points'].append(pt)
+    return groups
+
+
+def analyze(persons: List[Dict[str, Any]], radius_km: float = DEFAULTS['radius_km'], gap_years: int = DEFAULTS['gap_years'],
+            min_persons: int = DEFAULTS['min_persons']) -> List[Dict[str, Any]]:
+    """返回簇列表，按涉及人数降序。"""
+    clusters = []
+    for g in _place_groups(_points(persons), radius_km):
+        pts = sorted(g['points'], key=lambda pt: (pt['year'], pt['name']))
+        runs: List[List[Dict[str, Any]]] = []
+        for pt in pts:
+            if runs and pt['year'] - runs[-1][-1]['year'] <= gap_years:
+                runs[-1].append(pt)
+            else:
+                runs.append([pt])
+        for run in runs:
+            names = sorted({pt['name'] for pt in run})
+            if len(names) < min_persons:
+                continue
+            start, end = run[0]['year'], run[-1]['year']
+            role = _role([pt['text'] for pt in run])
+            era_a, era_b = dynasty.TABLE.lookup(start), dynasty.TABLE.lookup(end)
+            era = era_a['dynasty'] if era_a and era_b and era_a['dynasty'] == era_b['dynasty'] else None
+            label = f"{period_label(start, end)}{g['label']}的{role}"
+            clusters.append({
+                'label': label, 'place': g['label'], 'places': sorted(set(g['places'])),
+                'center': list(g['center']) if g['center'] else None,
+                'period': [start, end], 'dynasty': era, 'role': role,
+                'persons': names, 'person_count': len(names), 'event_count': len(run),
+                'events': [{'name': pt['name'], 'index': pt['event'], 'year': pt['year'], 'place': pt['place']} for pt in run],
+            })
+    clusters.sort(key=lambda c: (-c['person_count'], -c['event_count'], c['period'][0], c['label']))
+    for i, c in enumerate(clusters):
+        c['id'] = i
+    return clusters
+
+
+class ClusterJob:
+    """后台运行聚类并保存结果；同时只运行一个任务。"""
+
+    def __init__(self, path: str):
+        self.path = path
+        self._lock = threading.Lock()
+        self._running = False
+        self._result: Optional[Dict[str, Any]] = None
+
+    def result(self) -> Optional[Dict[str, Any]]:
+        with self._lock:
+            if self._result is None and os.path.isfile(self.path):
+                try:
+                    with open(self.path, 'r', encoding='utf-8') as f:
+                        self._result = json.load(f)
+                except (OSError, ValueError):
+                    self._result = None
+            return self._result
+
+    def status(self) -> Dict[str, Any]:
+        res = self.result()
+        with self._lock:
+            return {'running': self._running, 'computed_at': (res or {}).get('computed_at'),
+                    'params': (res or {}).get('params'), 'total': len((res or {}).get('clusters') or [])}
+
+    def start(self, persons: List[Dict[str, Any]], params: Dict[str, Any]) -> bool:
+        """启动后台任务；已有任务运行时返回 False。"""
+        with self._lock:
+            if self._running:
+                return False
+            self._running = True
+        threading.Thread(target=self.run, args=(persons, params), name='cluster-job', daemon=True).start()
+        return True
+
+    def run(self, persons: List[Dict[str, Any]], params: Dict[str, Any]) -> Dict[str, Any]:
+        start = time.monotonic()
+        try:
+            clusters = analyze(persons, **params)
+            result = {'computed_at': time.time(), 'params': params, 'persons': len(persons), 'clusters': clusters,
+                      'elapsed_ms': int((time.monotonic() - start) * 1000)}
+            os.makedirs(os.path.dirname(self.path) or '.', exist_ok=True)
+            tmp = self.path + '.tmp'
+            with open(tmp, 'w', encoding='utf-8') as f:
+                json.dump(result, f, ensure_ascii=False)
+            os.replace(tmp, self.path)
+            with self._lock:
+                self._result = result
+            logger.info("聚类分析完成：人物 %d 个，簇 %d 个，耗时 %dms", len(persons), len(clusters), result['elapsed_ms'])
+            return result
+        except Exception:
+            logger.exception("聚类分析失败")
+            raise
+        finally:
+            with self._lock:
+                self._running = False
+
+
+def parse_params(raw: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+    """校验并补全参数；非法时返回 None。"""
+    out = dict(DEFAULTS)
+    for key in DEFAULTS:
+        if raw.get(key) is None:
+            continue
+        try:
+            val = int(raw[key])
+        except (TypeError, ValueError):
+            return None
+        if val < (1 if key == 'min_persons' else 0) or val > 10000:
+            return None
+        out[key] = val
+    return out
+
+
+def main(argv, job: ClusterJob, persons: List[Dict[str, Any]]) -> int:
+    """`python index.py clusters`：离线运行一次聚类，打印前 20 个簇。"""
+    result = job.run(persons, dict(DEFAULTS))
+    for c in result['clusters'][:20]:
+        print(f"{c['label']}  人物 {c['person_count']}  事件 {c['event_count']}  {'、'.join(c['persons'][:6])}")
+    print(f"共 {len(result['clusters'])} 个簇，耗时 {result['elapsed_ms']}ms")
+    return 0
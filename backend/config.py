@@ -8,7 +8,8 @@
 
 import os
 import json
-from typing import Any, Dict, Optional
+import threading
+from typing import Any, Dict, List, Optional, Tuple
 
 ROOT = os.path.dirname(__file__)
 CONFIG_PATH = os.path.join(ROOT, 'config/config.json')
@@ -31,6 +32,28 @@ def get(key: str, default: Optional[Any] = None) -> Any:
     return cfg.get(key, default)
 
 
+_SAVE_LOCK = threading.Lock()
+
+
+def source(key: str) -> str:
+    """配置值来源：env / config / default。"""
+    if key in os.environ:
+        return 'env'
+    return 'config' if key in _load_config() else 'default'
+
+
+def save(key: str, value: Any):
+    """写回 config.json（原子替换），供运行时管理接口使用；其余键保持不变。"""
+    with _SAVE_LOCK:
+        cfg = _load_config()
+        cfg[key] = value
+        os.makedirs(os.path.dirname(CONFIG_PATH), exist_ok=True)
+        tmp = CONFIG_PATH + '.tmp'
+        with open(tmp, 'w', encoding='utf-8') as f:
+            json.dump(cfg, f, ensure_ascii=False, indent=2)
+        os.replace(tmp, CONFIG_PATH)
+
+
 def get_port() -> int:
     val = get('PORT', '8001')
     try:
@@ -51,4 +74,911 @@ def get_deepseek_api_key() -> Optional[str]:
     key = get('DEEPSEEK_API_KEY', None)
     if isinstance(key, str) and key.strip():
         return key.strip()
-    return None
\ No newline at end of file
+    return None
+
+
+def get_maintenance_mode() -> bool:
+    # 维护模式（迁移、恢复数据期间）；运行时可通过开关 maintenance 切换
+    val = get('MAINTENANCE_MODE', False)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_maintenance_retry_after_sec() -> int:
+    val = get('MAINTENANCE_RETRY_AFTER_SEC', '300')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 300
+
+
+def get_maintenance_message() -> str:
+    # 维护公告（如预计恢复时间），为空时使用默认文案
+    return str(get('MAINTENANCE_MESSAGE', '') or '').strip()
+
+
+def get_read_only() -> bool:
+    # 只读模式（演示部署、外部维护数据文件期间）；运行时可通过开关 read_only 切换
+    val = get('READ_ONLY', False)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_alias_ai_enabled() -> bool:
+    val = get('ALIAS_AI_ENABLED', False)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_person_batch_max() -> int:
+    val = get('PERSON_BATCH_MAX', '20')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 20
+
+
+def get_person_batch_workers() -> int:
+    val = get('PERSON_BATCH_WORKERS', '3')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 3
+
+
+def get_admin_token() -> Optional[str]:
+    token = get('ADMIN_TOKEN', None)
+    if isinstance(token, str) and token.strip():
+        return token.strip()
+    return None
+
+
+def get_admin_open() -> bool:
+    # 本地开发开关：未配置 ADMIN_TOKEN 时放行管理接口（默认拒绝），生产环境不要开启
+    val = get('ADMIN_OPEN', False)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_request_timeout_sec() -> int:
+    # 连接读写超时（秒）：慢客户端/空闲连接不会长期占用处理线程
+    val = get('REQUEST_TIMEOUT_SEC', '15')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 15
+
+
+def get_generate_timeout_sec() -> int:
+    # 生成类接口（未命中缓存、调用 AI）的整体时限（秒）
+    val = get('GENERATE_TIMEOUT_SEC', '90')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 90
+
+
+def get_name_max_len() -> int:
+    val = get('NAME_MAX_LEN', '40')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 40
+
+
+def get_fuzzy_lookup() -> Tuple[bool, int]:
+    # 人物精确查找未命中时先做近似查找（去空白、去称谓），命中则不再调用 AI；
+    # FUZZY_MAX_DISTANCE > 0 时另按编辑距离匹配，默认关闭（「毛泽民」与「毛泽东」只差一字却是两个人）
+    enabled = str(get('FUZZY_LOOKUP_ENABLED', '1')).strip().lower() in ('1', 'true', 'yes', 'on')
+    try:
+        distance = max(0, int(get('FUZZY_MAX_DISTANCE', '0')))
+    except Exception:
+        distance = 0
+    return enabled, distance
+
+
+def get_compare_max_years() -> int:
+    # /api/compare 对照表最多行数（years=all 时跨度过大直接拒绝）
+    val = get('COMPARE_MAX_YEARS', '1000')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 1000
+
+
+def get_job_ttl_sec() -> int:
+    # 异步生成任务完成后在内存中保留的秒数
+    val = get('JOB_TTL_SEC', '3600')
+    try:
+        return max(60, int(val))
+    except Exception:
+        return 3600
+
+
+def get_job_max() -> int:
+    val = get('JOB_MAX', '1000')
+    try:
+        return max(10, int(val))
+    except Exception:
+        return 1000
+
+
+def get_ws_max_clients() -> int:
+    # /ws 推送通道的最大连接数（每个连接占用一个处理线程），超出返回 503
+    val = get('WS_MAX_CLIENTS', '100')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 100
+
+
+def get_ws_queue_max() -> int:
+    # 单个连接积压的待发消息上限，超出即断开该慢客户端
+    val = get('WS_QUEUE_MAX', '256')
+    try:
+        return max(8, int(val))
+    except Exception:
+        return 256
+
+
+def get_ws_ping_sec() -> int:
+    # /ws 心跳间隔，防止代理因空闲断开连接
+    val = get('WS_PING_SEC', '30')
+    try:
+        return max(5, int(val))
+    except Exception:
+        return 30
+
+
+def get_names_suggest_max() -> int:
+    # /api/names/suggest 最多返回条数（?limit= 不能超过）
+    val = get('NAMES_SUGGEST_MAX', '10')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 10
+
+
+def get_max_body_bytes() -> int:
+    # 上传/导入类接口的请求体上限（字节），默认 2MB
+    val = get('MAX_BODY_BYTES', str(2 * 1024 * 1024))
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 2 * 1024 * 1024
+
+
+def get_excel_dir(default: str) -> str:
+    # 姓名表格目录（.xls/.xlsx/.csv），启动与 /api/admin/reload-names 时扫描
+    val = get('EXCEL_DIR', None)
+    if isinstance(val, str) and val.strip():
+        return os.path.abspath(val.strip())
+    return default
+
+
+def get_frontend_dir(default: str) -> str:
+    val = get('FRONTEND_DIR', None)
+    if isinstance(val, str) and val.strip():
+        return os.path.abspath(val.strip())
+    return default
+
+
+def get_media_dir(default: str) -> str:
+    val = get('MEDIA_DIR', None)
+    if isinstance(val, str) and val.strip():
+        return os.path.abspath(val.strip())
+    return default
+
+
+def get_media_max_bytes() -> int:
+    # 单个上传文件的上限（字节），默认 5MB
+    val = get('MEDIA_MAX_BYTES', str(5 * 1024 * 1024))
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 5 * 1024 * 1024
+
+
+def get_tile_providers(default: Dict[str, str]) -> Dict[str, str]:
+    # 瓦片代理的上游模板：环境变量写作 "osm=https://{s}.tile.../{z}/{x}/{y}.png,carto=..."，config.json 中也可写对象
+    val = get('TILE_PROVIDERS', None)
+    if isinstance(val, dict):
+        return {str(k).strip(): str(v).strip() for k, v in val.items() if str(v).strip()}
+    out = {}
+    for part in str(val or '').split(','):
+        if '=' in part:
+            k, v = part.split('=', 1)
+            if k.strip() and v.strip():
+                out[k.strip()] = v.strip()
+    return out or dict(default)
+
+
+def get_proxy_cache_dir(default: str) -> str:
+    val = get('PROXY_CACHE_DIR', None)
+    if isinstance(val, str) and val.strip():
+        return os.path.abspath(val.strip())
+    return default
+
+
+def get_proxy_cache_max_bytes() -> int:
+    # 瓦片与图片代理的磁盘缓存上限（字节），默认 200MB，0 为不缓存
+    val = get('PROXY_CACHE_MAX_BYTES', str(200 * 1024 * 1024))
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 200 * 1024 * 1024
+
+
+def get_proxy_upstream_rate_per_sec() -> float:
+    # 每个上游主机每秒的回源次数上限，0 为不限
+    val = get('PROXY_UPSTREAM_RATE_PER_SEC', '5')
+    try:
+        return max(0.0, float(val))
+    except Exception:
+        return 5.0
+
+
+def get_proxy_max_bytes() -> int:
+    # 单个代理图片的上限（字节），默认 5MB
+    val = get('PROXY_MAX_BYTES', str(5 * 1024 * 1024))
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 5 * 1024 * 1024
+
+
+def get_tts_provider() -> str:
+    # 语音解说的 TTS 提供方：none（默认，不合成）/ mock（本地提示音）/ openai（兼容 /v1/audio/speech），见 narration.py
+    val = str(get('TTS_PROVIDER', 'none') or 'none').strip().lower()
+    return val if val in ('none', 'mock', 'openai') else 'none'
+
+
+def get_tts_base_url() -> str:
+    return str(get('TTS_BASE_URL', 'https://api.openai.com') or 'https://api.openai.com').rstrip('/')
+
+
+def get_tts_api_key() -> Optional[str]:
+    key = get('TTS_API_KEY', None)
+    if isinstance(key, str) and key.strip():
+        return key.strip()
+    return None
+
+
+def get_tts_model() -> str:
+    return str(get('TTS_MODEL', 'tts-1') or 'tts-1').strip()
+
+
+def get_tts_voice() -> str:
+    return str(get('TTS_VOICE', 'alloy') or 'alloy').strip()
+
+
+def get_tts_voices() -> List[str]:
+    # 客户端可选的音色（?voice=），逗号分隔或 config.json 中的数组；默认音色 TTS_VOICE 总是可选
+    val = get('TTS_VOICES', None)
+    parts = val if isinstance(val, list) else str(val or '').split(',')
+    voices = [str(p).strip() for p in parts if str(p).strip()]
+    default = get_tts_voice()
+    return voices if default in voices else [default] + voices
+
+
+def get_tts_timeout_sec() -> int:
+    val = get('TTS_TIMEOUT_SEC', '60')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 60
+
+
+def get_narration_dir(default: str) -> str:
+    val = get('NARRATION_DIR', None)
+    if isinstance(val, str) and val.strip():
+        return os.path.abspath(val.strip())
+    return default
+
+
+def get_narration_max_chars() -> int:
+    # 单个解说音频的解说词上限（字符），超出的事件不再朗读
+    val = get('NARRATION_MAX_CHARS', '3000')
+    try:
+        return max(100, int(val))
+    except Exception:
+        return 3000
+
+
+def get_embedding_provider() -> str:
+    # 语义搜索的向量提供方：local（默认，本地哈希向量）/ openai（兼容 /v1/embeddings）/ none，见 embeddings.py
+    val = str(get('EMBEDDING_PROVIDER', 'local') or 'local').strip().lower()
+    return val if val in ('none', 'local', 'openai') else 'local'
+
+
+def get_embedding_base_url() -> str:
+    return str(get('EMBEDDING_BASE_URL', 'https://api.openai.com') or 'https://api.openai.com').rstrip('/')
+
+
+def get_embedding_api_key() -> Optional[str]:
+    key = get('EMBEDDING_API_KEY', None)
+    if isinstance(key, str) and key.strip():
+        return key.strip()
+    return None
+
+
+def get_embedding_model() -> str:
+    return str(get('EMBEDDING_MODEL', 'text-embedding-3-small') or 'text-embedding-3-small').strip()
+
+
+def get_embedding_index_file(default: str) -> str:
+    val = get('EMBEDDING_INDEX_FILE', None)
+    if isinstance(val, str) and val.strip():
+        return os.path.abspath(val.strip())
+    return default
+
+
+def get_api_keys() -> Dict[str, Dict[str, Any]]:
+    # 团队 API Key 与各自额度（见 quotas.py）：config.json 中写 {"team-a": {"key": "...", "generations_per_day": 50}}，
+    # 环境变量写作 "team-a=<key>,team-b=<key>"（额度取默认值）
+    val = get('API_KEYS', None)
+    if isinstance(val, dict):
+        out = {}
+        for name, v in val.items():
+            entry = dict(v) if isinstance(v, dict) else {'key': str(v)}
+            if str(entry.get('key') or '').strip():
+                out[str(name).strip()] = entry
+        return out
+    out = {}
+    for part in str(val or '').split(','):
+        if '=' in part:
+            k, v = part.split('=', 1)
+            if k.strip() and v.strip():
+                out[k.strip()] = {'key': v.strip()}
+    return out
+
+
+def get_api_key_required() -> bool:
+    return str(get('API_KEY_REQUIRED', '') or '').strip().lower() in ('1', 'true', 'yes', 'on')
+
+
+def get_quota_defaults() -> Dict[str, int]:
+    # 未单独设置额度的 Key（含 anonymous）的每日上限，0 为不限
+    out = {}
+    for kind, key in (('generations', 'QUOTA_GENERATIONS_PER_DAY'), ('geocode', 'QUOTA_GEOCODE_PER_DAY')):
+        try:
+            out[kind] = max(0, int(get(key, '0')))
+        except Exception:
+            out[kind] = 0
+    return out
+
+
+def get_usage_prices() -> Tuple[float, float]:
+    # 用量导出中的费用单价：(每千 token, 每次地理编码)，未配置为 0
+    out = []
+    for key in ('USAGE_PRICE_PER_1K_TOKENS', 'USAGE_PRICE_PER_GEOCODE'):
+        try:
+            out.append(max(0.0, float(get(key, '0'))))
+        except Exception:
+            out.append(0.0)
+    return out[0], out[1]
+
+
+def get_people_default_page_size() -> int:
+    # /api/people 仅带 page 参数时的每页人数
+    val = get('PEOPLE_DEFAULT_PAGE_SIZE', '50')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 50
+
+
+def get_people_max_page_size() -> int:
+    val = get('PEOPLE_MAX_PAGE_SIZE', '500')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 500
+
+
+def get_people_tombstone_days() -> int:
+    # /api/people/changes 删除记录保留天数，更早的 since 需全量重拉
+    val = get('PEOPLE_TOMBSTONE_DAYS', '30')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 30
+
+
+def get_person_max_events() -> int:
+    # 人工录入（POST/PUT /api/person）单个人物的事件数上限
+    val = get('PERSON_MAX_EVENTS', '500')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 500
+
+
+def get_analytics_enabled() -> bool:
+    # 查询热度统计（见 analytics.py），默认开启
+    return str(get('ANALYTICS_ENABLED', '1') or '').strip().lower() in ('1', 'true', 'yes', 'on')
+
+
+def get_analytics_retention_days() -> int:
+    val = get('ANALYTICS_RETENTION_DAYS', '90')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 90
+
+
+def get_analytics_max_keys() -> int:
+    val = get('ANALYTICS_MAX_KEYS', '5000')
+    try:
+        return max(100, int(val))
+    except Exception:
+        return 5000
+
+
+def get_exports_dir(default: str) -> str:
+    val = get('EXPORTS_DIR', None)
+    if isinstance(val, str) and val.strip():
+        return os.path.abspath(val.strip())
+    return default
+
+
+def get_exports_serve_enabled() -> bool:
+    # 通过 /exports/ 提供导出目录（内部数据）默认关闭；开启后也只在 admin 与 all 作用域的监听上提供
+    val = get('EXPORTS_SERVE_ENABLED', False)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_dir_index_enabled() -> bool:
+    # 静态目录列表默认关闭，仅建议在内部部署开启
+    val = get('DIR_INDEX_ENABLED', False)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_asset_fingerprint_enabled() -> bool:
+    # 前端资源指纹与长期缓存（见 assets.py）
+    val = get('ASSET_FINGERPRINT', True)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_static_compress_enabled() -> bool:
+    val = get('STATIC_COMPRESS_ENABLED', True)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_api_compress_enabled() -> bool:
+    # API 的 JSON 响应即时压缩；未配置时跟随 STATIC_COMPRESS_ENABLED（前置 nginx 已压缩时可单独关闭）
+    val = get('API_COMPRESS_ENABLED', None)
+    if val is None:
+        return get_static_compress_enabled()
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_compress_brotli_enabled() -> bool:
+    # 即时压缩优先使用 brotli（需安装 brotli 模块，未安装时自动只用 gzip）
+    val = get('COMPRESS_BROTLI', True)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_compress_min_bytes() -> int:
+    val = get('COMPRESS_MIN_BYTES', '1024')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 1024
+
+
+def get_api_request_timeout_sec() -> float:
+    # 单个 API 请求的截止时间（秒），上游调用的超时不超过剩余时间；0 为不限
+    val = get('API_REQUEST_TIMEOUT_SEC', '0')
+    try:
+        return max(0.0, float(val))
+    except Exception:
+        return 0.0
+
+
+def get_api_rate_limit_per_min() -> int:
+    # 每个客户端每分钟的 API 请求上限，0 为不限
+    val = get('API_RATE_LIMIT_PER_MIN', '0')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 0
+
+
+def get_trusted_proxies() -> List[str]:
+    # 可信反向代理的地址或网段（如 "127.0.0.1,10.0.0.0/8"，Unix 套接字写作 unix），config.json 中也可写数组；
+    # 仅当对端属于其中时才采信 X-Forwarded-For / X-Real-IP，为空时一律以对端地址为客户端
+    val = get('TRUSTED_PROXIES', None)
+    parts = val if isinstance(val, list) else str(val or '').split(',')
+    return [str(p).strip() for p in parts if str(p).strip()]
+
+
+def get_compress_max_bytes() -> int:
+    # 即时压缩需整体读入内存，超过该大小的文件按原样流式输出
+    val = get('COMPRESS_MAX_BYTES', str(8 * 1024 * 1024))
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 8 * 1024 * 1024
+
+
+def get_http_keepalive_enabled() -> bool:
+    val = get('HTTP_KEEPALIVE', True)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_tls_files() -> Tuple[Optional[str], Optional[str]]:
+    cert = get('TLS_CERT_FILE', None)
+    key = get('TLS_KEY_FILE', None)
+    if isinstance(cert, str) and cert.strip():
+        return cert.strip(), (key.strip() if isinstance(key, str) and key.strip() else None)
+    return None, None
+
+
+def get_grpc_listen() -> str:
+    # gRPC 服务监听地址（如 0.0.0.0:50051，见 grpcapi.py），为空时不启动
+    return str(get('GRPC_LISTEN', '') or '').strip()
+
+
+def get_grpc_max_workers() -> int:
+    val = get('GRPC_MAX_WORKERS', '8')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 8
+
+
+def get_listen():
+    # LISTEN 优先（支持 unix:/path.sock、多个监听与作用域，见 listeners.py），未配置时回退到 PORT
+    val = get('LISTEN', None)
+    if isinstance(val, list) and val:
+        return val
+    if isinstance(val, str) and val.strip():
+        return val.strip()
+    return str(get_port())
+
+
+def get_listen_socket_mode() -> int:
+    val = get('LISTEN_SOCKET_MODE', '0660')
+    try:
+        return int(str(val), 8)
+    except Exception:
+        return 0o660
+
+
+def get_listen_socket_group() -> Optional[str]:
+    val = get('LISTEN_SOCKET_GROUP', None)
+    if isinstance(val, str) and val.strip():
+        return val.strip()
+    return None
+
+
+def get_shutdown_drain_sec() -> int:
+    # 停止前的排空时长（秒）：先让 /readyz 失败，期间继续服务，便于滚动更新时摘除流量
+    val = get('SHUTDOWN_DRAIN_SEC', '0')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 0
+
+
+def get_shutdown_timeout_sec() -> int:
+    # 停止监听后等待进行中的请求与生成任务完成的最长时间（秒），超时后照常落盘退出；
+    # 加上 SHUTDOWN_DRAIN_SEC 应小于编排系统的强制终止期限（Kubernetes 默认 30 秒）
+    val = get('SHUTDOWN_TIMEOUT_SEC', '25')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 25
+
+
+def get_readyz_check_ttl_sec() -> int:
+    # /readyz 中上游可达性检查结果的有效期（秒），过期后在后台重新检查，探针本身不等待上游
+    val = get('READYZ_CHECK_TTL_SEC', '30')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 30
+
+
+def get_readyz_require_upstream() -> bool:
+    # 上游（AI、地理编码）不可达时 /readyz 是否失败；默认只报告状态，避免上游故障时所有实例同时被摘除
+    val = get('READYZ_REQUIRE_UPSTREAM', False)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_health_check_timeout_sec() -> float:
+    val = get('HEALTH_CHECK_TIMEOUT_SEC', '3')
+    try:
+        return max(0.1, float(val))
+    except Exception:
+        return 3.0
+
+
+def get_warmup_top_n() -> int:
+    # 启动预热的热门人物数量（按 cache_stats.json 中的累计访问次数排序），0 表示关闭
+    val = get('WARMUP_TOP_N', '20')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 20
+
+
+def get_warmup_geocode_max() -> int:
+    # 预热时为缺少坐标的地点发起的地理编码请求上限（后台执行，不阻塞就绪）
+    val = get('WARMUP_GEOCODE_MAX', '20')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 20
+
+
+def get_data_repair_enabled() -> bool:
+    # 修复模式：people.json 损坏时从 data/backups/ 中最新的可用备份恢复（默认拒绝启动）
+    val = get('DATA_REPAIR', False)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_backup_keep() -> int:
+    # 覆盖 people.json 前保留的备份份数，0 表示不备份
+    val = get('BACKUP_KEEP', '5')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 5
+
+
+def get_replay_log_file() -> Optional[str]:
+    # 非空时将 API 请求（匿名化）追加记录到该文件，供 `python index.py replay` 回放
+    val = get('REPLAY_LOG_FILE', None)
+    return str(val).strip() if val else None
+
+
+def get_replay_log_sample() -> float:
+    val = get('REPLAY_LOG_SAMPLE', '1')
+    try:
+        return min(1.0, max(0.0, float(val)))
+    except Exception:
+        return 1.0
+
+
+def get_replay_log_max_bytes() -> int:
+    val = get('REPLAY_LOG_MAX_BYTES', str(50 * 1024 * 1024))
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 50 * 1024 * 1024
+
+
+def get_log_output() -> str:
+    # 日志目的地：stderr（默认）、stdout 或 file（写入 LOG_FILE 并轮转）
+    val = str(get('LOG_OUTPUT', 'stderr') or 'stderr').strip().lower()
+    return val if val in ('stderr', 'stdout', 'file') else 'stderr'
+
+
+def get_log_file() -> str:
+    return str(get('LOG_FILE', os.path.join(ROOT, 'data', 'logs', 'fetrace.log')) or '')
+
+
+def get_log_rotate() -> str:
+    # 轮转方式：size（按 LOG_MAX_BYTES）或 time（按 LOG_ROTATE_WHEN，如 midnight、H）
+    val = str(get('LOG_ROTATE', 'size') or 'size').strip().lower()
+    return val if val in ('size', 'time') else 'size'
+
+
+def get_log_rotate_when() -> str:
+    return str(get('LOG_ROTATE_WHEN', 'midnight') or 'midnight').strip()
+
+
+def get_log_max_bytes() -> int:
+    val = get('LOG_MAX_BYTES', str(10 * 1024 * 1024))
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 10 * 1024 * 1024
+
+
+def get_log_backup_count() -> int:
+    val = get('LOG_BACKUP_COUNT', '5')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 5
+
+
+def get_log_level() -> str:
+    return str(get('LOG_LEVEL', 'INFO') or 'INFO').strip().upper()
+
+
+def get_log_levels() -> Dict[str, str]:
+    # 按组件覆盖级别：环境变量写作 "deepseek=WARNING,access=ERROR"，config.json 中也可写对象
+    val = get('LOG_LEVELS', None)
+    if isinstance(val, dict):
+        return {str(k).strip(): str(v).strip().upper() for k, v in val.items()}
+    out = {}
+    for part in str(val or '').split(','):
+        if '=' in part:
+            k, v = part.split('=', 1)
+            if k.strip() and v.strip():
+                out[k.strip()] = v.strip().upper()
+    return out
+
+
+def get_access_log_file() -> Optional[str]:
+    # 非空时访问日志单独写入该文件（"-" 为 stdout），沿用 LOG_ROTATE 等轮转设置；为空时随应用日志输出
+    val = get('ACCESS_LOG_FILE', None)
+    return str(val).strip() if val else None
+
+
+def get_access_log_format() -> str:
+    # combined（Combined Log Format，默认）或 json，见 accesslog.py
+    val = str(get('ACCESS_LOG_FORMAT', 'combined') or 'combined').strip().lower()
+    return val if val in ('combined', 'json') else 'combined'
+
+
+def get_sentry_dsn() -> str:
+    # Sentry 兼容的 DSN，为空时不上报错误（见 errorreport.py）
+    return str(get('SENTRY_DSN', '') or '').strip()
+
+
+def get_sentry_release() -> str:
+    return str(get('SENTRY_RELEASE', 'fetrace@unknown') or 'fetrace@unknown').strip()
+
+
+def get_sentry_environment() -> str:
+    return str(get('SENTRY_ENVIRONMENT', 'production') or 'production').strip()
+
+
+def get_sentry_upstream_burst() -> Tuple[int, int]:
+    # (窗口秒数, 次数)：窗口内上游失败达到次数时上报一次
+    try:
+        window = max(1, int(get('SENTRY_UPSTREAM_BURST_WINDOW_SEC', '60')))
+    except Exception:
+        window = 60
+    try:
+        count = max(1, int(get('SENTRY_UPSTREAM_BURST_COUNT', '10')))
+    except Exception:
+        count = 10
+    return window, count
+
+
+def get_handover_timeout_sec() -> int:
+    # SIGHUP 交接时等待新进程就绪的最长时间（秒），见 handover.py
+    val = get('HANDOVER_TIMEOUT_SEC', '60')
+    try:
+        return max(1, int(val))
+    except Exception:
+        return 60
+
+
+def get_handover_drain_max_sec() -> int:
+    # 交接后旧进程等待进行中请求与生成任务完成的最长时间（秒）
+    val = get('HANDOVER_DRAIN_MAX_SEC', '300')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 300
+
+
+def get_age_mode() -> str:
+    # 年龄与年份矛盾时：flag 仅标记推算值（默认），replace 以推算值替换
+    val = str(get('AGE_MODE', 'flag') or 'flag').strip().lower()
+    return val if val in ('flag', 'replace') else 'flag'
+
+
+def get_age_tolerance() -> int:
+    # 允许的年龄误差（岁），默认 1（生日前后）
+    val = get('AGE_TOLERANCE', '1')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 1
+
+
+def get_dynasty_table() -> str:
+    # 自定义朝代 / 年号表（JSON），文件不存在时使用内置表
+    return str(get('DYNASTY_TABLE', os.path.join(ROOT, 'data', 'dynasties.json')) or '')
+
+
+def get_path_max_steps() -> int:
+    # 行程路径每段最多的插值点数
+    val = get('PATH_MAX_STEPS', '64')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 64
+
+
+def get_colocation_radius_km() -> int:
+    # 同地查询的默认半径（公里），0 时仅按地名匹配
+    val = get('COLOCATION_RADIUS_KM', '20')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 20
+
+
+def get_overlap_geocode_max() -> int:
+    # /api/overlap?geocode=1 单次请求最多发起的地理编码查询数
+    val = get('OVERLAP_GEOCODE_MAX', '20')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 20
+
+
+def get_geocode_enabled() -> bool:
+    val = get('GEOCODE_ENABLED', True)
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+def get_geocode_max_calls() -> int:
+    # 每个人物最多的地理编码请求数
+    val = get('GEOCODE_MAX_CALLS', '3')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 3
+
+
+def get_ai_provider() -> str:
+    # AI 提供方：deepseek（默认）或 mock（确定性模拟数据，不访问网络、不需要 API Key）
+    val = str(get('AI_PROVIDER', 'deepseek') or 'deepseek').strip().lower()
+    return val if val in ('deepseek', 'mock') else 'deepseek'
+
+
+def get_app_profile() -> str:
+    # 服务装配：default（DeepSeek + Nominatim）或 offline（模拟轨迹、不查坐标），见 services.py
+    val = str(get('APP_PROFILE', 'default') or 'default').strip().lower()
+    return val if val in ('default', 'offline') else 'default'
+
+
+def get_mock_ai_latency_ms() -> int:
+    val = get('MOCK_AI_LATENCY_MS', '0')
+    try:
+        return max(0, int(val))
+    except Exception:
+        return 0
+
+
+def get_mock_ai_fail() -> Optional[str]:
+    # 模拟上游失败：timeout / rate_limited / error，空为正常返回
+    val = str(get('MOCK_AI_FAIL', '') or '').strip().lower()
+    return val if val in ('timeout', 'rate_limited', 'error') else None
+
+
+def get_deepseek_base_url() -> str:
+    # 上游地址可替换（私有网关、集成测试中的假服务）
+    return str(get('DEEPSEEK_BASE_URL', 'https://api.deepseek.com') or 'https://api.deepseek.com').rstrip('/')
+
+
+def get_geocode_url() -> str:
+    return str(get('GEOCODE_URL', 'https://nominatim.openstreetmap.org/search') or 'https://nominatim.openstreetmap.org/search')
+
+
+def get_wikidata_url() -> str:
+    return str(get('WIKIDATA_URL', 'https://www.wikidata.org/w/api.php') or 'https://www.wikidata.org/w/api.php')
\ No newline at end of file
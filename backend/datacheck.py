@@ -0,0 +1,199 @@
+"""
+数据校验（上线前的数据闸门）
+
+    python index.py validate [people.json] [--strict] [--json]
+
+检查项：
+- schema       结构与字段类型（persons 数组、name、events、经纬度范围）        error
+- chronology   同一人物的事件年份倒序                                        error
+- duplicate    归一化后重名，或人物名是另一人物的别名                        error / warning
+- coordinates  事件缺少经纬度                                                warning
+- year         年份无法解析（如缺失）                                        warning
+- age          年龄与年份矛盾（按推算的出生年份，误差超过 AGE_TOLERANCE，见 ages.py）  warning
+
+normalize_events() 为写入前的时间顺序归一（排序、去重、编号），供增强流水线与导入使用。
+
+存在 error 时退出码为 1；--strict 时 warning 也视为失败。
+"""
+
+import re
+import sys
+import json
+import argparse
+from typing import Any, Dict, List, Optional
+
+from textnorm import name_key
+import ages
+import dynasty
+import integrity
+
+_YEAR_RE = re.compile(r'(前|公元前|BC\s*)?\s*(\d{1,4})', re.IGNORECASE)
+
+
+def parse_year(value: Any) -> Optional[int]:
+    """解析年份（支持 "约前571"、"前129年" 等公元前写法，返回负数；「元丰三年」等年号纪年换算为公元年份）。"""
+    if isinstance(value, bool):
+        return None
+    if isinstance(value, (int, float)):
+        return int(value)
+    era = dynasty.TABLE.parse_era_year(value)
+    if era is not None:
+        return era
+    m = _YEAR_RE.search(str(value or ''))
+    if not m:
+        return None
+    year = int(m.group(2))
+    return -year if m.group(1) else year
+
+
+def _issue(level: str, check: str, person: str, message: str, event: Optional[int] = None) -> Dict[str, Any]:
+    out = {'level': level, 'check': check, 'person': person, 'message': message}
+    if event is not None:
+        out['event'] = event
+    return out
+
+
+_PUNCT_RE = re.compile(r'[\W_]+')
+EVENT_FIELDS = ('year', 'age', 'place', 'lat', 'lon', 'title', 'detail')
+
+
+def _filled(e: Dict[str, Any]) -> int:
+    return sum(1 for f in EVENT_FIELDS if str(e.get(f, '')).strip() != '')
+
+
+def _same_event(a: Dict[str, Any], b: Dict[str, Any]) -> bool:
+    """同一年份且标题归一后相同（或互相包含且地点相同）视为重复事件。"""
+    if parse_year(a.get('year')) != parse_year(b.get('year')):
+        return False
+    ta, tb = (_PUNCT_RE.sub('', name_key(e.get('title', ''))) for e in (a, b))
+    if not ta or not tb:
+        return False
+    if ta == tb:
+        return True
+    same_place = name_key(a.get('place', '')) == name_key(b.get('place', ''))
+    return same_place and (ta in tb or tb in ta)
+
+
+def normalize_events(events: List[Dict[str, Any]]) -> List[Dict[str, Any]]:
+    """按年份排序（字符串/数字混排、公元前均可），合并重复事件（保留较完整者并补齐其缺失字段），
+    并写入从 0 起的 seq。年份无法解析的事件跟随其原先的前一事件。
+    以年号纪年的年份换算为公元年份，原文保留在 year_text。"""
+    keyed = []
+    last = None
+    for i, e in enumerate(events or []):
+        era = dynasty.TABLE.parse_era_year(e.get('year'))
+        if era is not None:
+            e.setdefault('year_text', e['year'])
+            e['year'] = str(era)
+        year = parse_year(e.get('year'))
+        if year is not None:
+            last = year
+        keyed.append((float('-inf') if last is None else last, i, e))
+    keyed.sort(key=lambda t: (t[0], t[1]))
+    out: List[Dict[str, Any]] = []
+    for _, _, e in keyed:
+        dup = next((k for k, kept in enumerate(out) if _same_event(kept, e)), None)
+        if dup is None:
+            out.append(e)
+            continue
+        keep, other = (e, out[dup]) if _filled(e) > _filled(out[dup]) else (out[dup], e)
+        for f in EVENT_FIELDS:
+            if str(keep.get(f, '')).strip() == '' and str(other.get(f, '')).strip() != '':
+                keep[f] = other[f]
+        out[dup] = keep
+    for i, e in enumerate(out):
+        e['seq'] = i
+    return out
+
+
+def _coord(value: Any) -> Optional[float]:
+    if value is None or str(value).strip() == '':
+        return None
+    return float(value)
+
+
+def check_people(data: Any, aliases=None) -> List[Dict[str, Any]]:
+    problem = integrity.validate_people(data)
+    if problem:
+        return [_issue('error', 'schema', '', problem)]
+    issues: List[Dict[str, Any]] = []
+    seen: Dict[str, str] = {}
+    names = {name_key(p['name']) for p in data['persons']}
+    for p in data['persons']:
+        name = p['name']
+        key = name_key(name)
+        if not key:
+            issues.append(_issue('error', 'schema', name, '姓名为空'))
+            continue
+        if key in seen:
+            issues.append(_issue('error', 'duplicate', name, f'与「{seen[key]}」重名'))
+        else:
+            seen[key] = name
+        if aliases is not None:
+            canonical = aliases.resolve(name)
+            if name_key(canonical) != key and name_key(canonical) in names:
+                issues.append(_issue('warning', 'duplicate', name, f'是「{canonical}」的别名，应合并'))
+        prev_year = None
+        for i, e in enumerate(p.get('events') or []):
+            if not isinstance(e, dict):
+                issues.append(_issue('error', 'schema', name, '事件应为对象', i))
+                continue
+            year = parse_year(e.get('year'))
+            if year is None:
+                issues.append(_issue('warning', 'year', name, f'年份无法解析：{e.get("year")!r}', i))
+            elif prev_year is not None and year < prev_year:
+                issues.append(_issue('error', 'chronology', name, f'年份 {e.get("year")} 早于前一事件（{prev_year}）', i))
+            if year is not None:
+                prev_year = year
+            try:
+                lat, lon = _coord(e.get('lat')), _coord(e.get('lon'))
+            except (TypeError, ValueError):
+                issues.append(_issue('error', 'schema', name, f'经纬度不是数字：{e.get("lat")!r}, {e.get("lon")!r}', i))
+                continue
+            if lat is None or lon is None:
+                issues.append(_issue('warning', 'coordinates', name, f'缺少经纬度（{e.get("place") or "未知地点"}）', i))
+            elif not (-90 <= lat <= 90 and -180 <= lon <= 180):
+                issues.append(_issue('error', 'schema', name, f'经纬度超出范围：{lat}, {lon}', i))
+        for m in ages.mismatches(p):
+            issues.append(_issue('warning', 'age', name, f'年龄 {m["reported"]} 与年份不符（推算为 {m["derived"]}）', m['index']))
+    return issues
+
+
+def summarize(issues: List[Dict[str, Any]]) -> Dict[str, Any]:
+    by_check: Dict[str, int] = {}
+    for it in issues:
+        by_check[it['check']] = by_check.get(it['check'], 0) + 1
+    return {
+        'errors': sum(1 for it in issues if it['level'] == 'error'),
+        'warnings': sum(1 for it in issues if it['level'] == 'warning'),
+        'by_check': by_check,
+    }
+
+
+def main(argv: List[str], default_path: str, aliases=None) -> int:
+    parser = argparse.ArgumentParser(prog='index.py validate', description='校验人物轨迹数据')
+    parser.add_argument('path', nargs='?', default=default_path, help='默认为当前数据目录下的 people.json')
+    parser.add_argument('--strict', action='store_true', help='warning 也视为失败')
+    parser.add_argument('--json', action='store_true', help='以 JSON 输出完整报告')
+    args = parser.parse_args(argv)
+
+    try:
+        with open(args.path, 'r', encoding='utf-8') as f:
+            data = json.load(f)
+        issues = check_people(data, aliases)
+        persons = len(data.get('persons') or []) if isinstance(data, dict) else 0
+    except Exception as e:
+        issues, persons = [_issue('error', 'schema', '', f'无法读取 {args.path}：{e}')], 0
+    summary = summarize(issues)
+    failed = summary['errors'] > 0 or (args.strict and summary['warnings'] > 0)
+
+    if args.json:
+        print(json.dumps({'path': args.path, 'persons': persons, 'ok': not failed, **summary, 'issues': issues},
+                         ensure_ascii=False, indent=2))
+    else:
+        for it in issues:
+            where = it['person'] + (f' #{it["event"]}' if 'event' in it else '')
+            print(f'[{it["level"]}] {it["check"]}: {where}: {it["message"]}')
+        print(f'{args.path}: persons={persons}, errors={summary["errors"]}, warnings={summary["warnings"]}'
+              f' → {"FAIL" if failed else "OK"}', file=sys.stderr)
+    return 1 if failed else 0
@@ -0,0 +1,150 @@
+"""
+数据统计（快速盘点，无需调用管理接口）
+
+    python index.py stats [people.json] [--top 10] [--json]
+
+- 人物数、事件数、地理编码覆盖率
+- 按朝代 / 时期分布：优先使用人物的 dynasty 字段，否则按首个事件年份归入下表
+- 按标签分布（人物的 tags 字段）
+- 事件按年代（十年）分布、最常出现的地点
+- 事件最多与最少的人物（后者提示哪些轨迹需要补充）
+
+同样的统计也由 GET /api/stats 返回（基于当前缓存）。
+"""
+
+import sys
+import json
+import argparse
+from typing import Any, Dict, List, Optional
+
+from datacheck import parse_year
+from textnorm import normalize_name
+
+# (起始年, 名称)，按起始年升序；年份 < 首项时归入「先秦以前」
+PERIODS = [
+    (-2070, '夏商周'),
+    (-770, '春秋'),
+    (-475, '战国'),
+    (-221, '秦'),
+    (-206, '汉'),
+    (220, '三国两晋南北朝'),
+    (581, '隋'),
+    (618, '唐'),
+    (907, '五代十国'),
+    (960, '宋'),
+    (1271, '元'),
+    (1368, '明'),
+    (1644, '清'),
+    (1912, '民国'),
+    (1949, '现代'),
+]
+
+
+def period_of(year: Optional[int]) -> str:
+    if year is None:
+        return '未知'
+    name = '先秦以前'
+    for start, label in PERIODS:
+        if year >= start:
+            name = label
+    return name
+
+
+def _has_coords(e: Dict[str, Any]) -> bool:
+    return str(e.get('lat', '')).strip() != '' and str(e.get('lon', '')).strip() != ''
+
+
+def decade_of(year: int) -> int:
+    """所在年代的起始年（1881 → 1880，-221 → -230）。"""
+    return year // 10 * 10
+
+
+def collect(data: Dict[str, Any], top: int = 10) -> Dict[str, Any]:
+    persons = (data or {}).get('persons') or []
+    events = [e for p in persons for e in (p.get('events') or [])]
+    with_coords = sum(1 for e in events if _has_coords(e))
+    by_decade: Dict[int, int] = {}
+    by_place: Dict[str, int] = {}
+    for e in events:
+        year = parse_year(e.get('year'))
+        if year is not None:
+            by_decade[decade_of(year)] = by_decade.get(decade_of(year), 0) + 1
+        place = normalize_name(e.get('place') or '')
+        if place:
+            by_place[place] = by_place.get(place, 0) + 1
+    by_period: Dict[str, int] = {}
+    by_tag: Dict[str, int] = {}
+    for p in persons:
+        evs = p.get('events') or []
+        label = p.get('dynasty') or period_of(parse_year(evs[0].get('year')) if evs else None)
+        by_period[label] = by_period.get(label, 0) + 1
+        for t in p.get('tags') or []:
+            by_tag[t] = by_tag.get(t, 0) + 1
+    order = {label: i for i, (_, label) in enumerate(PERIODS)}
+    largest = sorted(persons, key=lambda p: -len(p.get('events') or []))[:max(0, top)]
+    smallest = sorted((p for p in persons if p.get('events')), key=lambda p: len(p['events']))[:max(0, top)]
+    brief = lambda p: {'name': p.get('name', ''), 'events': len(p.get('events') or []),
+                       'with_coords': sum(1 for e in (p.get('events') or []) if _has_coords(e))}
+    return {
+        'persons': len(persons),
+        'persons_without_events': sum(1 for p in persons if not p.get('events')),
+        'events': len(events),
+        'events_with_coords': with_coords,
+        'geocode_coverage': round(with_coords / len(events), 4) if events else None,
+        'by_period': dict(sorted(by_period.items(), key=lambda kv: order.get(kv[0], -1 if kv[0] == '先秦以前' else len(order)))),
+        'by_tag': dict(sorted(by_tag.items(), key=lambda kv: -kv[1])),
+        'events_by_decade': [{'decade': d, 'events': n} for d, n in sorted(by_decade.items())],
+        'top_places': [{'place': k, 'events': v} for k, v in sorted(by_place.items(), key=lambda kv: (-kv[1], kv[0]))[:max(0, top)]],
+        'largest': [brief(p) for p in largest],
+        'smallest': [brief(p) for p in smallest],
+    }
+
+
+def _table(title: str, rows: List[List[Any]], header: List[str]) -> str:
+    cells = [[str(c) for c in header]] + [[str(c) for c in r] for r in rows]
+    # 中文字符按两个显示宽度计
+    width = lambda s: sum(2 if ord(ch) > 0x2E80 else 1 for ch in s)
+    cols = [max(width(r[i]) for r in cells) for i in range(len(header))]
+    lines = [title]
+    for j, r in enumerate(cells):
+        lines.append('  ' + '  '.join(c + ' ' * (cols[i] - width(c)) for i, c in enumerate(r)).rstrip())
+        if j == 0:
+            lines.append('  ' + '  '.join('-' * w for w in cols))
+    return '\n'.join(lines)
+
+
+def render_text(s: Dict[str, Any]) -> str:
+    coverage = '-' if s['geocode_coverage'] is None else f'{s["geocode_coverage"] * 100:.1f}%'
+    parts = [
+        f'人物 {s["persons"]}（无轨迹 {s["persons_without_events"]}），事件 {s["events"]}，'
+        f'有坐标 {s["events_with_coords"]}（覆盖率 {coverage}）',
+        _table('按时期', [[k, v] for k, v in s['by_period'].items()], ['时期', '人物']),
+    ]
+    if s['by_tag']:
+        parts.append(_table('按标签', [[k, v] for k, v in s['by_tag'].items()], ['标签', '人物']))
+    if s['events_by_decade']:
+        parts.append(_table('按年代', [[f'{d["decade"]}s', d['events']] for d in s['events_by_decade']], ['年代', '事件']))
+    if s['top_places']:
+        parts.append(_table('常见地点', [[p['place'], p['events']] for p in s['top_places']], ['地点', '事件']))
+    parts.append(_table('事件最多', [[p['name'], p['events'], p['with_coords']] for p in s['largest']],
+                        ['人物', '事件', '有坐标']))
+    parts.append(_table('事件最少', [[p['name'], p['events'], p['with_coords']] for p in s['smallest']],
+                        ['人物', '事件', '有坐标']))
+    return '\n\n'.join(parts)
+
+
+def main(argv: List[str], default_path: str) -> int:
+    parser = argparse.ArgumentParser(prog='index.py stats', description='输出数据统计')
+    parser.add_argument('path', nargs='?', default=default_path, help='默认为当前数据目录下的 people.json')
+    parser.add_argument('--top', type=int, default=10, help='列出事件最多的前 N 个人物（默认 10）')
+    parser.add_argument('--json', action='store_true', help='以 JSON 输出')
+    args = parser.parse_args(argv)
+    try:
+        with open(args.path, 'r', encoding='utf-8') as f:
+            data = json.load(f)
+    except Exception as e:
+        print(f'无法读取 {args.path}：{e}', file=sys.stderr)
+        return 1
+    s = collect(data, args.top)
+    print(json.dumps(s, ensure_ascii=False, indent=2) if args.json else render_text(s))
+    return 0
@@ -12,6 +12,9 @@ import logging
 import config
 import re
 import time
+from metrics import METRICS
+from flags import FLAGS
+import mockai
 
 try:
     import requests  # 需通过 pip 安装：pip install requests
@@ -163,18 +166,35 @@ def _get_tools_schema() -> List[Dict[str, Any]]:
     }]
 
 
-def query_celebrity_timeline(celebrity_name: str) -> Dict[str, Any]:
-    """调用后端服务，根据人名返回原始响应（未归一化）。"""
+def _timeouts_for(ctx):
+    return ctx.timeout(_get_timeouts()) if ctx is not None else _get_timeouts()
+
+
+def _trace_headers(ctx) -> Dict[str, str]:
+    return {"X-Request-ID": ctx.request_id} if ctx is not None else {}
+
+
+def _record_tokens(ctx, body: Dict[str, Any]):
+    # 响应中的 usage 计入请求所属租户（见 usage.py）
+    if ctx is not None and ctx.quota is not None and isinstance(body, dict):
+        ctx.quota.record_tokens(body.get('usage') or {})
+
+
+def query_celebrity_timeline(celebrity_name: str, ctx=None) -> Dict[str, Any]:
+    """调用后端服务，根据人名返回原始响应（未归一化）。ctx 为 reqctx.Context，到期或取消后不再发起请求。"""
+    if ctx is not None and ctx.done():
+        return {"error": "timeout: request deadline exceeded"}
     api_key = _get_api_key()
     if not api_key:
         return {"error": "missing_api_key"}
     if requests is None:
         return {"error": "missing_requests"}
 
-    url = "https://api.deepseek.com/v1/chat/completions"
+    url = config.get_deepseek_base_url() + "/v1/chat/completions"
     headers = {
         "Authorization": f"Bearer {api_key}",
-        "Content-Type": "application/json"
+        "Content-Type": "application/json",
+        **_trace_headers(ctx),
     }
     prompt = (
         "请根据维基百科、百科资料和常识，生成 " + celebrity_name + " 的生平轨迹"
@@ -199,7 +219,7 @@ def query_celebrity_timeline(celebrity_name: str) -> Dict[str, Any]:
         sess = _get_session()
         if sess is None:
             return {"error": "missing_requests"}
-        timeout = _get_timeouts()
+        timeout = _timeouts_for(ctx)
         start = time.monotonic()
         resp = sess.post(url, json=payload, headers=headers, timeout=timeout)
         resp.raise_for_status()
@@ -231,21 +251,52 @@ def query_celebrity_timeline(celebrity_name: str) -> Dict[str, Any]:
         return {"error": f"request_failed: {e}", "duration_ms": elapsed_ms}
 
 
-def get_person_timeline(name: str) -> Dict[str, Any]:
+def _use_mock() -> bool:
+    return config.get_ai_provider() == 'mock' or FLAGS.enabled('mock_provider')
+
+
+class UpstreamError(Exception):
+    """上游调用失败；kind 取值 timeout / rate_limited / unavailable / error。"""
+
+    def __init__(self, kind: str, message: str):
+        super().__init__(message)
+        self.kind = kind
+
+
+def _classify_error(err: str) -> str:
+    text = str(err or '')
+    if text.startswith('timeout'):
+        return 'timeout'
+    if '429' in text:
+        return 'rate_limited'
+    if text in ('missing_api_key', 'missing_requests'):
+        return 'unavailable'
+    return 'error'
+
+
+def get_person_timeline(name: str, raise_on_error: bool = False, ctx=None) -> Dict[str, Any]:
     """供 index.py 使用：返回符合 people.json 结构的单人物条目。
     结构：{ name, style, events }
     - style 可为空或给默认颜色
     - events 为数组，字段包含 year/age/place/lat/lon/title/detail（若缺失则尽量留空）
+    - raise_on_error=True 时，上游失败抛出 UpstreamError 而非返回空数据
+    - AI_PROVIDER=mock 时返回确定性的模拟数据（见 mockai.py）
+    - ctx 为 reqctx.Context：携带请求 ID，并以其截止时间收紧上游超时
     """
-    raw = query_celebrity_timeline(name)
+    if _use_mock():
+        return _mock_person_timeline(name, raise_on_error, ctx)
+    raw = query_celebrity_timeline(name, ctx)
     # 错误或不可用时返回空数据，避免阻断前端，并记录错误日志
     if 'error' in raw:
         try:
             logger.error("DeepSeek 请求失败：name=%s, error=%s", name, raw.get('error'))
         except Exception:
             pass
+        if raise_on_error:
+            raise UpstreamError(_classify_error(raw.get('error')), str(raw.get('error')))
         return {"name": name, "style": None, "events": []}
 
+    _record_tokens(ctx, raw)
     try:
         # 优先解析函数工具调用的 JSON 参数
         msg = ((raw.get('choices') or [{}])[0].get('message') or {})
@@ -262,54 +313,135 @@ def get_person_timeline(name: str) -> Dict[str, Any]:
         logger.warning("DeepSeek 响应解析失败，使用空事件：name=%s", name)
         events = []
 
-    # 最终补全 age/lat/lon
-    events = _augment_events(events)
-
+    # age/lat/lon 等补全由 enrich.py 的增强流水线负责
     style = {"markerColor": "#e91e63", "lineColor": "#f06292"}
     return {"name": name, "style": style, "events": events}
 
 
-_GEOCODE_CACHE: Dict[str, Optional[Dict[str, float]]] = {}
+def _mock_person_timeline(name: str, raise_on_error: bool, ctx=None) -> Dict[str, Any]:
+    fail = mockai.simulate_upstream()
+    if not fail and ctx is not None and ctx.done():
+        fail = 'timeout'
+    if fail:
+        logger.error("模拟上游失败：name=%s, kind=%s", name, fail)
+        if raise_on_error:
+            raise UpstreamError(fail, f'mock_{fail}')
+        return {"name": name, "style": None, "events": []}
+    return mockai.timeline(name)
+
+
+def resolve_canonical_name(name: str, ctx=None) -> Optional[str]:
+    """AI 辅助别名识别：若 name 是某人的字/号/谥号等，返回其通行本名，否则返回 None。"""
+    if _use_mock() or (ctx is not None and ctx.done()):
+        return None
+    api_key = _get_api_key()
+    sess = _get_session()
+    if not api_key or sess is None:
+        return None
+    payload = {
+        "model": "deepseek-chat",
+        "messages": [
+            {"role": "system", "content": (
+                "你是中国历史人物称谓识别助手。用户给出一个称谓，若它是某历史人物的字、号、谥号、别称，"
+                "只输出该人物最通行的本名；若它本身就是本名或无法确定，只输出空字符串。不要任何解释。"
+            )},
+            {"role": "user", "content": name},
+        ],
+        "temperature": 0,
+    }
+    try:
+        resp = sess.post(
+            config.get_deepseek_base_url() + "/v1/chat/completions",
+            json=payload,
+            headers={"Authorization": f"Bearer {api_key}", "Content-Type": "application/json", **_trace_headers(ctx)},
+            timeout=_timeouts_for(ctx)
+        )
+        resp.raise_for_status()
+        body = resp.json()
+        _record_tokens(ctx, body)
+        msg = ((body.get('choices') or [{}])[0].get('message') or {})
+        text = str(msg.get('content') or '').strip().strip('"“”「」')
+    except Exception as e:
+        logger.warning("DeepSeek 别名识别失败：name=%s, %s", name, e)
+        return None
+    if not text or len(text) > 20 or text == name:
+        return None
+    return text
+
+
+def translate_events(texts: List[Dict[str, str]], lang: str, ctx=None) -> List[Dict[str, str]]:
+    """将事件文本（place/title/detail）译为 lang，按原顺序返回；上游失败抛出 UpstreamError。"""
+    if _use_mock():
+        fail = mockai.simulate_upstream()
+        if fail:
+            raise UpstreamError(fail, f'mock_{fail}')
+        return mockai.translate(texts, lang)
+    if ctx is not None and ctx.done():
+        raise UpstreamError('timeout', 'request deadline exceeded')
+    api_key = _get_api_key()
+    sess = _get_session()
+    if not api_key or sess is None:
+        raise UpstreamError('unavailable', 'missing_api_key' if not api_key else 'missing_requests')
+    payload = {
+        "model": "deepseek-chat",
+        "messages": [
+            {"role": "system", "content": (
+                f"你是历史资料翻译助手。将用户给出的 JSON 数组中每个对象的 place、title、detail 字段译为语言代码 {lang} 对应的语言，"
+                "地名使用该语言的通行译名；保持数组长度与顺序不变，只输出 JSON 数组，不要任何解释。"
+            )},
+            {"role": "user", "content": json.dumps(texts, ensure_ascii=False)},
+        ],
+        "temperature": 0,
+    }
+    try:
+        resp = sess.post(
+            config.get_deepseek_base_url() + "/v1/chat/completions",
+            json=payload,
+            headers={"Authorization": f"Bearer {api_key}", "Content-Type": "application/json", **_trace_headers(ctx)},
+            timeout=_timeouts_for(ctx)
+        )
+        resp.raise_for_status()
+        body = resp.json()
+        _record_tokens(ctx, body)
+        msg = ((body.get('choices') or [{}])[0].get('message') or {})
+    except Timeout as e:
+        logger.warning("DeepSeek 翻译超时：lang=%s, %s", lang, e)
+        raise UpstreamError('timeout', f'timeout: {e}')
+    except Exception as e:
+        logger.warning("DeepSeek 翻译失败：lang=%s, %s", lang, e)
+        raise UpstreamError(_classify_error(str(e)), str(e))
+    items = _normalize_events(str(msg.get('content') or ''))
+    if len(items) != len(texts):
+        raise UpstreamError('error', f'translation length mismatch: {len(items)} != {len(texts)}')
+    return items
 
-def _parse_int_year(year_text: str) -> Optional[int]:
-    m = re.search(r"\d{4}", str(year_text))
-    return int(m.group(0)) if m else None
-
-def _infer_birth_year(events: List[Dict[str, Any]]) -> Optional[int]:
-    for e in events:
-        title = str(e.get("title", ""))
-        detail = str(e.get("detail", ""))
-        y = _parse_int_year(e.get("year", ""))
-        if y and ("出生" in title or "出生" in detail or "诞生" in title):
-            return y
-    return None
 
-def _fill_missing_age(events: List[Dict[str, Any]]) -> None:
-    birth_year = _infer_birth_year(events)
-    if birth_year is None:
-        return
-    for e in events:
-        if not str(e.get("age", "")).strip():
-            y = _parse_int_year(e.get("year", ""))
-            if y and y >= birth_year:
-                e["age"] = str(y - birth_year)
-
-def _geocode_place(place: str) -> Optional[Dict[str, float]]:
+_GEOCODE_CACHE: Dict[str, Optional[Dict[str, float]]] = {}
+
+def _geocode_place(place: str, ctx=None) -> Optional[Dict[str, float]]:
     p = (place or "").strip()
     if not p:
         return None
     if p in _GEOCODE_CACHE:
+        METRICS.incr('geocode.cache_hit')
         return _GEOCODE_CACHE[p]
+    if _use_mock():
+        return None  # 模拟模式不访问外部服务
+    if ctx is not None and ctx.done():
+        return None  # 请求已到期，不缓存结果，留待下次查询
     sess = _get_session()
     if sess is None:
         _GEOCODE_CACHE[p] = None
         return None
+    if ctx is not None and ctx.quota is not None and not ctx.quota.try_consume('geocode'):
+        return None  # 当日地理编码额度已用完，不缓存结果
+    METRICS.incr('geocode.calls')
     try:
         resp = sess.get(
-            "https://nominatim.openstreetmap.org/search",
+            config.get_geocode_url(),
             params={"q": p, "format": "json", "limit": 1},
-            headers={"User-Agent": "feTrace/1.0"},
-            timeout=_get_timeouts()
+            headers={"User-Agent": "feTrace/1.0", **_trace_headers(ctx)},
+            timeout=_timeouts_for(ctx)
         )
         resp.raise_for_status()
         arr = resp.json() or []
@@ -319,30 +451,101 @@ def _geocode_place(place: str) -> Optional[Dict[str, float]]:
             _GEOCODE_CACHE[p] = {"lat": lat, "lon": lon}
             return _GEOCODE_CACHE[p]
     except Exception:
-        pass
+        METRICS.incr('geocode.errors')
+        if ctx is not None and ctx.done():
+            return None
     _GEOCODE_CACHE[p] = None
     return None
 
-def _augment_events(events: List[Dict[str, Any]]) -> List[Dict[str, Any]]:
-    # 填充年龄
-    _fill_missing_age(events)
-    # 填充经纬度（保守限流）
-    max_calls = int(config.get("GEOCODE_MAX_CALLS", 3))
+def _probe(url: str, headers: Dict[str, str], timeout: float, params: Optional[Dict[str, str]] = None) -> Dict[str, Any]:
+    # 可达性探测：单次 GET、不重试；能收到 5xx 以外的响应即视为可达（鉴权失败除外）
+    if requests is None:
+        return {"status": "fail", "detail": "missing_requests"}
+    start = time.monotonic()
+    try:
+        resp = requests.get(url, headers=headers, params=params, timeout=timeout)
+    except Exception as e:
+        return {"status": "fail", "detail": type(e).__name__}
+    elapsed_ms = int((time.monotonic() - start) * 1000)
+    if resp.status_code >= 500:
+        return {"status": "fail", "detail": f"http_{resp.status_code}", "latency_ms": elapsed_ms}
+    if resp.status_code in (401, 403):
+        return {"status": "fail", "detail": "unauthorized", "latency_ms": elapsed_ms}
+    return {"status": "ok", "latency_ms": elapsed_ms}
+
+
+def health_check(timeout: float, ctx=None) -> Dict[str, Any]:
+    """上游 AI 是否可达：GET /v1/models（不消耗 token），供 /readyz 使用。ctx 到期或取消后不再探测。"""
+    if _use_mock():
+        return {"status": "ok", "detail": "mock"}
+    api_key = _get_api_key()
+    if not api_key:
+        return {"status": "fail", "detail": "missing_api_key"}
+    if ctx is not None and ctx.done():
+        return {"status": "fail", "detail": "cancelled"}
+    headers = {"Authorization": f"Bearer {api_key}", **_trace_headers(ctx)}
+    return _probe(config.get_deepseek_base_url() + "/v1/models", headers, ctx.timeout(timeout) if ctx is not None else timeout)
+
+
+def geocoder_health_check(timeout: float, ctx=None) -> Dict[str, Any]:
+    """地理编码服务是否可达：不带查询词请求一次，供 /readyz 使用。ctx 同 health_check。"""
+    if _use_mock():
+        return {"status": "ok", "detail": "mock"}
+    if not config.get_geocode_enabled():
+        return {"status": "disabled"}
+    if ctx is not None and ctx.done():
+        return {"status": "fail", "detail": "cancelled"}
+    headers = {"User-Agent": "feTrace/1.0", **_trace_headers(ctx)}
+    return _probe(config.get_geocode_url(), headers, ctx.timeout(timeout) if ctx is not None else timeout, {"format": "json"})
+
+
+def seed_geocode_cache(events: List[Dict[str, Any]]) -> int:
+    """用已有事件中的经纬度预填地理编码缓存（不发起网络请求），返回新增条目数。"""
+    added = 0
+    for e in events or []:
+        p = str(e.get("place", "")).strip()
+        if not p or p in _GEOCODE_CACHE:
+            continue
+        try:
+            lat, lon = float(e.get("lat")), float(e.get("lon"))
+        except (TypeError, ValueError):
+            continue
+        _GEOCODE_CACHE[p] = {"lat": lat, "lon": lon}
+        added += 1
+    return added
+
+def prefetch_geocode(places: List[str], max_calls: int) -> int:
+    """为尚未缓存的地点预先查询坐标（最多 max_calls 次），返回实际查询次数。"""
     calls = 0
-    for e in events:
-        lat_empty = str(e.get("lat", "")).strip() == ""
-        lon_empty = str(e.get("lon", "")).strip() == ""
-        if (lat_empty or lon_empty) and calls < max_calls and bool(config.get("GEOCODE_ENABLED", True)):
-            coords = _geocode_place(str(e.get("place", "")))
-            calls += 1
-            if coords:
-                e["lat"] = coords["lat"]
-                e["lon"] = coords["lon"]
-            else:
-                # 若地理编码失败，确保有占位符
-                e["lat"] = e.get("lat", "")
-                e["lon"] = e.get("lon", "")
-    return events
+    for place in places:
+        p = str(place or "").strip()
+        if not p or p in _GEOCODE_CACHE:
+            continue
+        if calls >= max_calls:
+            break
+        _geocode_place(p)
+        calls += 1
+    return calls
+
+def search_wikidata(name: str, ctx=None) -> Optional[str]:
+    """按姓名检索 Wikidata 实体，返回首个匹配的 QID（如 Q36020）；不可用或未命中时返回 None。"""
+    n = (name or "").strip()
+    sess = _get_session()
+    if not n or sess is None or _use_mock() or (ctx is not None and ctx.done()):
+        return None
+    try:
+        resp = sess.get(
+            config.get_wikidata_url(),
+            params={"action": "wbsearchentities", "search": n, "language": "zh", "format": "json", "limit": 1},
+            headers={"User-Agent": "feTrace/1.0", **_trace_headers(ctx)},
+            timeout=_timeouts_for(ctx)
+        )
+        resp.raise_for_status()
+        hits = (resp.json() or {}).get("search") or []
+        return str(hits[0].get("id")) if hits and hits[0].get("id") else None
+    except Exception as e:
+        logger.warning("Wikidata 检索失败：name=%s, %s", n, e)
+        return None
 
 if __name__ == '__main__':
     # 简单自测：读取配置并尝试请求
@@ -0,0 +1,187 @@
+"""
+年份 → 朝代 / 年号
+
+- 内置中原王朝主线（重叠时期取起始较晚者，如 1271 年起为元）与宋、明、清年号及民国纪年
+- DYNASTY_TABLE 指定 JSON 文件时替换内置表，格式：
+  {"dynasties": [{"name": "北宋", "start": 960, "end": 1127}],
+   "eras": [{"dynasty": "北宋", "name": "元丰", "start": 1078}]}
+  公元前为负数；年号的结束年份默认为下一年号的起始年份，改元当年按新年号计
+- 增强步骤 dynasty 为事件写入 dynasty / era（如「元丰三年」），为人物写入 dynasties；/api/people?dynasty= 按朝代筛选
+- parse_era_year() 反向把「元丰三年」「北宋元丰三年」「民国十九年」换算为公元年份（datacheck.parse_year 优先使用）
+"""
+
+import re
+import json
+import logging
+import threading
+from typing import Any, Dict, List, Optional
+
+import config
+import datacheck
+
+logger = logging.getLogger('api')
+
+BUILTIN_DYNASTIES = [
+    ('夏', -2070, -1600), ('商', -1600, -1046), ('西周', -1046, -771), ('春秋', -770, -476), ('战国', -475, -221),
+    ('秦', -221, -207), ('西汉', -206, 8), ('新', 9, 23), ('东汉', 25, 220), ('三国', 220, 280), ('西晋', 266, 316),
+    ('东晋', 317, 420), ('南北朝', 420, 589), ('隋', 581, 618), ('唐', 618, 907), ('五代十国', 907, 960),
+    ('北宋', 960, 1127), ('南宋', 1127, 1279), ('元', 1271, 1368), ('明', 1368, 1644), ('清', 1644, 1912),
+    ('中华民国', 1912, 1949), ('中华人民共和国', 1949, None),
+]
+
+BUILTIN_ERAS = {
+    '北宋': [('建隆', 960), ('乾德', 963), ('开宝', 968), ('太平兴国', 976), ('雍熙', 984), ('端拱', 988), ('淳化', 990),
+           ('至道', 995), ('咸平', 998), ('景德', 1004), ('大中祥符', 1008), ('天禧', 1017), ('乾兴', 1022), ('天圣', 1023),
+           ('明道', 1032), ('景祐', 1034), ('宝元', 1038), ('康定', 1040), ('庆历', 1041), ('皇祐', 1049), ('至和', 1054),
+           ('嘉祐', 1056), ('治平', 1064), ('熙宁', 1068), ('元丰', 1078), ('元祐', 1086), ('绍圣', 1094), ('元符', 1098),
+           ('建中靖国', 1101), ('崇宁', 1102), ('大观', 1107), ('政和', 1111), ('重和', 1118), ('宣和', 1119), ('靖康', 1126)],
+    '南宋': [('建炎', 1127), ('绍兴', 1131), ('隆兴', 1163), ('乾道', 1165), ('淳熙', 1174), ('绍熙', 1190), ('庆元', 1195),
+           ('嘉泰', 1201), ('开禧', 1205), ('嘉定', 1208), ('宝庆', 1225), ('绍定', 1228), ('端平', 1234), ('嘉熙', 1237),
+           ('淳祐', 1241), ('宝祐', 1253), ('开庆', 1259), ('景定', 1260), ('咸淳', 1265), ('德祐', 1275), ('景炎', 1276),
+           ('祥兴', 1278)],
+    '明': [('洪武', 1368), ('建文', 1399), ('永乐', 1403), ('洪熙', 1425), ('宣德', 1426), ('正统', 1436), ('景泰', 1450),
+          ('天顺', 1457), ('成化', 1465), ('弘治', 1488), ('正德', 1506), ('嘉靖', 1522), ('隆庆', 1567), ('万历', 1573),
+          ('泰昌', 1620), ('天启', 1621), ('崇祯', 1628)],
+    '清': [('顺治', 1644), ('康熙', 1662), ('雍正', 1723), ('乾隆', 1736), ('嘉庆', 1796), ('道光', 1821), ('咸丰', 1851),
+          ('同治', 1862), ('光绪', 1875), ('宣统', 1909)],
+    '中华民国': [('民国', 1912)],
+}
+
+_DIGITS = '〇一二三四五六七八九'
+_NUMERAL = {'〇': 0, '零': 0, '一': 1, '二': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+
+
+def parse_era_number(text: str) -> Optional[int]:
+    """元 → 1，十九 → 19，廿三 → 23，12 → 12；无法解析时返回 None。"""
+    text = text.strip()
+    if text in ('元', '正'):
+        return 1
+    if text.isdigit():
+        return int(text)
+    text = text.replace('廿', '二十').replace('卅', '三十')
+    if '十' in text:
+        tens, _, ones = text.partition('十')
+        if (tens and tens not in _NUMERAL) or (ones and ones not in _NUMERAL):
+            return None
+        return (_NUMERAL[tens] if tens else 1) * 10 + (_NUMERAL[ones] if ones else 0)
+    if len(text) == 1 and text in _NUMERAL:
+        return _NUMERAL[text]
+    return None
+
+
+def era_year_label(n: int) -> str:
+    """1 → 元年，3 → 三年，21 → 二十一年。"""
+    if n == 1:
+        return '元年'
+    tens, ones = divmod(n, 10)
+    text = ('' if tens == 1 else _DIGITS[tens]) + '十' if tens else ''
+    return text + (_DIGITS[ones] if ones else '') + '年'
+
+
+class DynastyTable:
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._dynasties: List[Dict[str, Any]] = []
+        self._eras: List[Dict[str, Any]] = []
+        self._loaded_from: Optional[str] = None
+        self._era_re: Optional[re.Pattern] = None
+        self._use_builtin()
+
+    def _use_builtin(self):
+        self._dynasties = [{'name': n, 'start': s, 'end': e} for n, s, e in BUILTIN_DYNASTIES]
+        self._eras = [{'dynasty': d, 'name': n, 'start': s} for d, eras in BUILTIN_ERAS.items() for n, s in eras]
+        self._era_re = self._compile()
+
+    def _compile(self) -> Optional[re.Pattern]:
+        # 年号按长度降序，避免「建中靖国」被「建中」之类的短名截断
+        eras = sorted({e['name'] for e in self._eras}, key=len, reverse=True)
+        if not eras:
+            return None
+        dynasties = sorted({d['name'] for d in self._dynasties}, key=len, reverse=True)
+        return re.compile('(%s)?(%s)([元正〇零一二三四五六七八九十廿卅]{1,4}|\\d{1,3})年' % (
+            '|'.join(map(re.escape, dynasties)), '|'.join(map(re.escape, eras))))
+
+    def load(self, path: str):
+        """读取自定义表；文件缺失或格式错误时保留内置表。"""
+        try:
+            with open(path, 'r', encoding='utf-8') as f:
+                data = json.load(f)
+            dynasties = [{'name': str(d['name']), 'start': int(d['start']),
+                          'end': None if d.get('end') is None else int(d['end'])} for d in data.get('dynasties') or []]
+            eras = [{'dynasty': str(e['dynasty']), 'name': str(e['name']), 'start': int(e['start']),
+                     'end': None if e.get('end') is None else int(e['end'])} for e in data.get('eras') or []]
+        except FileNotFoundError:
+            return
+        except Exception as e:
+            logger.error("朝代表加载失败，使用内置表：%s, %s", path, repr(e))
+            return
+        if dynasties:
+            with self._lock:
+                self._dynasties, self._eras, self._loaded_from = dynasties, eras, path
+                self._era_re = self._compile()
+
+    def dynasties(self) -> List[Dict[str, Any]]:
+        with self._lock:
+            return [dict(d) for d in self._dynasties]
+
+    def lookup(self, year: Optional[int]) -> Optional[Dict[str, Any]]:
+        """{'dynasty', 'era', 'era_year', 'label'}；不在表中时返回 None，无年号时 era 为 None。"""
+        if year is None:
+            return None
+        with self._lock:
+            hits = [d for d in self._dynasties if d['start'] <= year and (d['end'] is None or year <= d['end'])]
+            if not hits:
+                return None
+            dynasty = max(hits, key=lambda d: d['start'])['name']
+            eras = sorted((e for e in self._eras if e['dynasty'] == dynasty and e['start'] <= year
+                           and (e.get('end') is None or year <= e['end'])), key=lambda e: e['start'])
+        out = {'dynasty': dynasty, 'era': None, 'era_year': None, 'label': dynasty}
+        if eras:
+            era = eras[-1]
+            n = year - era['start'] + 1
+            prefix = '' if era['name'] in dynasty else dynasty  # 民国纪年不重复朝代名
+            out.update(era=era['name'], era_year=n, label=f"{prefix}{era['name']}{era_year_label(n)}")
+        return out
+
+    def parse_era_year(self, text: Any) -> Optional[int]:
+        """「元丰三年」→ 1080；带朝代前缀时只在该朝代的年号中查找，同名年号取最早者。不含年号时返回 None。"""
+        if not isinstance(text, str) or self._era_re is None:
+            return None
+        m = self._era_re.search(text)
+        if not m:
+            return None
+        n = parse_era_number(m.group(3))
+        if not n:
+            return None
+        with self._lock:
+            eras = [e for e in self._eras if e['name'] == m.group(2) and (not m.group(1) or e['dynasty'] == m.group(1))]
+        if not eras:
+            return None
+        return min(eras, key=lambda e: e['start'])['start'] + n - 1
+
+    def annotate(self, person: Dict[str, Any], write: bool = True) -> List[str]:
+        """返回人物按时间先后经历的朝代；write 时为事件写入 dynasty / era、为人物写入 dynasties。
+        已缓存的旧数据没有这些字段，筛选时以 write=False 即时计算。"""
+        seen: List[str] = []
+        for e in person.get('events') or []:
+            info = self.lookup(datacheck.parse_year(e.get('year')))
+            if not info:
+                continue
+            if write:
+                e['dynasty'] = info['dynasty']
+                if info['era']:
+                    e['era'] = info['era'] + era_year_label(info['era_year'])
+            if info['dynasty'] not in seen:
+                seen.append(info['dynasty'])
+        if write:
+            person['dynasties'] = seen
+        return seen
+
+
+TABLE = DynastyTable()
+
+
+def load_configured():
+    path = config.get_dynasty_table()
+    if path:
+        TABLE.load(path)
@@ -0,0 +1,219 @@
+"""
+向量索引与语义搜索（GET /api/search/semantic）
+
+为人物（姓名 + 全部事件文本）与单个事件（年份、地点、标题、详情）生成向量，存入本地索引文件
+EMBEDDING_INDEX_FILE（JSON），查询时对问句向量做余弦相似度排序，使“被贬到南方的诗人”之类的描述也能找到相关轨迹。
+
+EMBEDDING_PROVIDER：
+- local（默认）：字符一元/二元组哈希到 256 维并归一化，不访问网络；只能捕捉字面相近，适合开发与小规模部署
+- openai：OpenAI 兼容的 /v1/embeddings（EMBEDDING_BASE_URL、EMBEDDING_API_KEY、EMBEDDING_MODEL），分批请求
+- none：不建索引，搜索接口返回空结果
+
+索引按文本内容哈希增量更新：未变化的条目复用旧向量，已删除的人物/事件随之移除；换用模型后全部重建。
+重建方式：启动后后台执行一次（local 时）、POST /api/admin/embeddings/rebuild、`python index.py embed`。
+目前只实现本地索引；接入 pgvector 等外部向量库时实现同样的 upsert/search 接口即可。
+"""
+
+import os
+import json
+import math
+import time
+import hashlib
+import logging
+import threading
+import urllib.error
+import urllib.request
+from typing import Any, Dict, List, Optional, Tuple
+
+import config
+import datacheck
+
+logger = logging.getLogger('api')
+
+LOCAL_DIM = 256
+BATCH = 64
+
+
+class EmbeddingError(Exception):
+    pass
+
+
+class LocalEmbedder:
+    model = f'local-hash-{LOCAL_DIM}'
+
+    def embed(self, texts: List[str]) -> List[List[float]]:
+        out = []
+        for text in texts:
+            vec = [0.0] * LOCAL_DIM
+            chars = [ch for ch in str(text) if not ch.isspace()]
+            grams = chars + [a + b for a, b in zip(chars, chars[1:])]
+            for g in grams:
+                h = int(hashlib.md5(g.encode('utf-8')).hexdigest()[:8], 16)
+                vec[h % LOCAL_DIM] += (1.0 if len(g) == 1 else 2.0) * (1 if h & 0x100 else -1)
+            out.append(_normalize(vec))
+        return out
+
+
+class OpenAIEmbedder:
+    def __init__(self, model: str, base_url: str, api_key: Optional[str], timeout: float = 30):
+        self.model = model
+        self.base_url = base_url
+        self.api_key = api_key
+        self.timeout = timeout
+
+    def embed(self, texts: List[str]) -> List[List[float]]:
+        if not self.api_key:
+            raise EmbeddingError('missing EMBEDDING_API_KEY')
+        out: List[List[float]] = []
+        for i in range(0, len(texts), BATCH):
+            body = json.dumps({'model': self.model, 'input': texts[i:i + BATCH]}).encode('utf-8')
+            req = urllib.request.Request(self.base_url + '/v1/embeddings', data=body, method='POST',
+                                         headers={'Authorization': f'Bearer {self.api_key}', 'Content-Type': 'application/json',
+                                                  'User-Agent': 'feTrace/1.0'})
+            try:
+                with urllib.request.urlopen(req, timeout=self.timeout) as resp:
+                    data = json.loads(resp.read().decode('utf-8')).get('data') or []
+            except (urllib.error.URLError, OSError, ValueError) as e:
+                raise EmbeddingError(repr(e))
+            data.sort(key=lambda d: d.get('index', 0))
+            out.extend(_normalize([float(x) for x in d.get('embedding') or []]) for d in data)
+        if len(out) != len(texts):
+            raise EmbeddingError(f'embedding count mismatch: {len(out)} != {len(texts)}')
+        return out
+
+
+def build_embedder(provider: str):
+    if provider == 'local':
+        return LocalEmbedder()
+    if provider == 'openai':
+        return OpenAIEmbedder(config.get_embedding_model(), config.get_embedding_base_url(), config.get_embedding_api_key())
+    return None
+
+
+def _normalize(vec: List[float]) -> List[float]:
+    norm = math.sqrt(sum(v * v for v in vec)) or 1.0
+    return [round(v / norm, 6) for v in vec]
+
+
+def _dot(a: List[float], b: List[float]) -> float:
+    return sum(x * y for x, y in zip(a, b))
+
+
+def documents(persons: List[Dict[str, Any]]) -> Dict[str, Tuple[str, Dict[str, Any]]]:
+    """索引条目：键 → (文本, 元数据)。人物键为 person:<姓名>，事件键为 event:<姓名>#<下标>。"""
+    docs = {}
+    for p in persons:
+        name = str(p.get('name') or '')
+        events = p.get('events') or []
+        if not name or not events:
+            continue
+        lines = []
+        for i, e in enumerate(events):
+            year = e.get('year_text') or e.get('year') or ''
+            text = ' '.join(str(x) for x in (year, e.get('place'), e.get('title'), e.get('detail')) if x)
+            lines.append(text)
+            docs[f'event:{name}#{i}'] = (f'{name} {text}', {'type': 'event', 'name': name, 'index': i,
+                                                             'year': datacheck.parse_year(e.get('year')),
+                                                             'place': e.get('place', ''), 'title': e.get('title', '')})
+        years = [y for y in (datacheck.parse_year(e.get('year')) for e in events) if y is not None]
+        docs[f'person:{name}'] = (name + '\n' + '\n'.join(lines), {'type': 'person', 'name': name,
+                                                                  'years': [min(years), max(years)] if years else None})
+    return docs
+
+
+class EmbeddingIndex:
+    def __init__(self, path: str, embedder):
+        self.path = path
+        self.embedder = embedder
+        self._lock = threading.Lock()
+        self._items: Dict[str, Dict[str, Any]] = {}
+        self.model = ''
+        self.built_at: Optional[float] = None
+        self._loaded = False
+
+    def _load(self):
+        if self._loaded:
+            return
+        self._loaded = True
+        try:
+            with open(self.path, 'r', encoding='utf-8') as f:
+                data = json.load(f)
+        except (OSError, ValueError):
+            return
+        if self.embedder is not None and data.get('model') == self.embedder.model:
+            self._items = data.get('items') or {}
+            self.model = data.get('model', '')
+            self.built_at = data.get('built_at')
+
+    def _save(self):
+        os.makedirs(os.path.dirname(self.path) or '.', exist_ok=True)
+        tmp = self.path + '.tmp'
+        with open(tmp, 'w', encoding='utf-8') as f:
+            json.dump({'model': self.model, 'built_at': self.built_at, 'items': self._items}, f, ensure_ascii=False)
+        os.replace(tmp, self.path)
+
+    def rebuild(self, persons: List[Dict[str, Any]]) -> Dict[str, Any]:
+        """增量重建：只为新增或文本变化的条目生成向量。返回各类计数；向量服务失败抛出 EmbeddingError。"""
+        if self.embedder is None:
+            return {'enabled': False}
+        start = time.monotonic()
+        docs = documents(persons)
+        with self._lock:
+            self._load()
+            old = self._items if self.model == self.embedder.model else {}
+        items, pending = {}, []
+        for key, (text, meta) in docs.items():
+            digest = hashlib.sha1(text.encode('utf-8')).hexdigest()
+            prev = old.get(key)
+            if prev and prev.get('hash') == digest:
+                items[key] = dict(prev, meta=meta)
+            else:
+                items[key] = {'hash': digest, 'meta': meta}
+                pending.append((key, text))
+        vectors = self.embedder.embed([t for _, t in pending]) if pending else []
+        for (key, _), vec in zip(pending, vectors):
+            items[key]['vector'] = vec
+        with self._lock:
+            self._items = items
+            self.model = self.embedder.model
+            self.built_at = time.time()
+            self._save()
+        report = {'enabled': True, 'model': self.model, 'items': len(items), 'embedded': len(pending),
+                  'reused': len(items) - len(pending), 'removed': len(set(old) - set(items)),
+                  'elapsed_ms': int((time.monotonic() - start) * 1000)}
+        logger.info("向量索引已更新：%s", report)
+        return report
+
+    def search(self, query: str, limit: int = 10, kind: Optional[str] = None) -> List[Dict[str, Any]]:
+        if self.embedder is None:
+            return []
+        with self._lock:
+            self._load()
+            items = list(self._items.items())
+        if not items:
+            return []
+        qvec = self.embedder.embed([query])[0]
+        scored = []
+        for key, item in items:
+            meta = item.get('meta') or {}
+            if kind and meta.get('type') != kind:
+                continue
+            scored.append((_dot(qvec, item.get('vector') or []), key, meta))
+        scored.sort(key=lambda t: (-t[0], t[1]))
+        return [dict(meta, score=round(score, 4)) for score, _, meta in scored[:limit] if score > 0]
+
+    def stats(self) -> Dict[str, Any]:
+        with self._lock:
+            self._load()
+            return {'model': self.model, 'items': len(self._items), 'built_at': self.built_at}
+
+
+def main(argv, index: EmbeddingIndex, persons: List[Dict[str, Any]]) -> int:
+    """`python index.py embed`：按当前 people.json 重建索引并打印统计。"""
+    try:
+        report = index.rebuild(persons)
+    except EmbeddingError as e:
+        print(f'向量生成失败：{e}')
+        return 1
+    print(json.dumps(report, ensure_ascii=False, indent=2))
+    return 0 if report.get('enabled') else 1
@@ -0,0 +1,92 @@
+"""
+API 响应的内容协商与编码（按请求的 Accept 头选择）
+
+- application/json        默认；Accept 缺省、为 */* 或列出的类型都不支持时均返回 JSON（不回 406，兼容旧客户端）
+- application/msgpack     所有 JSON 接口均可用，结构与 JSON 信封相同（亦接受 application/x-msgpack）
+- application/x-protobuf  仅登记了消息模型的接口可用（如 GET /api/v1/people 返回 fetrace.v1.ListPeopleResponse），
+                          只含 data 中的业务字段，不含 meta 与 version；错误响应仍为 JSON 信封（亦接受 application/protobuf）
+
+消息模型为 (消息全名, pbwire 结构, 构造函数)，构造函数接收 (data, meta) 返回消息字典，结构见 proto/fetrace.proto。
+可协商多种格式的接口须带 Vary: Accept，并把格式计入 ETag（见 routes._cache_headers）。
+"""
+
+import json
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+import mpwire
+import pbwire
+
+JSON = 'application/json'
+MSGPACK = 'application/msgpack'
+PROTOBUF = 'application/x-protobuf'
+
+# 同义的媒体类型 → 规范名
+ALIASES = {
+    'application/x-msgpack': MSGPACK,
+    'application/vnd.msgpack': MSGPACK,
+    'application/protobuf': PROTOBUF,
+    'application/vnd.google.protobuf': PROTOBUF,
+}
+
+Model = Tuple[str, Dict[str, tuple], Callable[[Any, Dict[str, Any]], Dict[str, Any]]]
+
+
+def _parse_accept(header: str) -> List[Tuple[str, float]]:
+    out = []
+    for part in (header or '').split(','):
+        fields = [f.strip() for f in part.split(';')]
+        media = fields[0].lower()
+        if not media:
+            continue
+        q = 1.0
+        for f in fields[1:]:
+            if f.lower().startswith('q='):
+                try:
+                    q = float(f[2:])
+                except ValueError:
+                    q = 0.0
+        out.append((ALIASES.get(media, media), q))
+    return out
+
+
+def negotiate(accept: Optional[str], offered: List[str]) -> str:
+    """在 offered（按服务端偏好排序）中选出 Accept 权重最高的类型；精确匹配优先于通配，q=0 表示拒绝，无可用类型时为 offered[0]。"""
+    ranges = _parse_accept(accept or '')
+    best, best_key = offered[0], (-1.0, -1, 0)
+    for i, media in enumerate(offered):
+        q, specificity = None, -1
+        for pattern, weight in ranges:
+            if pattern == media:
+                level = 2
+            elif pattern == media.split('/')[0] + '/*':
+                level = 1
+            elif pattern == '*/*':
+                level = 0
+            else:
+                continue
+            if level > specificity:
+                q, specificity = weight, level
+        if q is None or q <= 0:
+            continue
+        key = (q, specificity, -i)
+        if key > best_key:
+            best, best_key = media, key
+    return best
+
+
+def offered(model: Optional[Model] = None) -> List[str]:
+    return [JSON, MSGPACK] + ([PROTOBUF] if model else [])
+
+
+def choose(headers, model: Optional[Model] = None) -> str:
+    return negotiate(headers.get('Accept') if headers is not None else None, offered(model))
+
+
+def encode(media: str, envelope: Dict[str, Any], model: Optional[Model] = None) -> Tuple[bytes, str]:
+    """按协商结果编码响应信封，返回 (响应体, Content-Type)；protobuf 只编码 data（error 不为空时退回 JSON）。"""
+    if media == MSGPACK:
+        return mpwire.encode(envelope), MSGPACK
+    if media == PROTOBUF and model and envelope.get('error') is None:
+        name, schema, build = model
+        return pbwire.encode(schema, build(envelope.get('data'), envelope.get('meta') or {})), f'{PROTOBUF}; messageType={name}'
+    return json.dumps(envelope, ensure_ascii=False).encode('utf-8'), JSON
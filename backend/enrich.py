@@ -0,0 +1,217 @@
+"""
+人物数据增强流水线
+
+AI 生成的人物在写入缓存前依次经过各增强步骤（Enricher：person → person）。
+
+- ENRICH_PIPELINE 指定步骤与顺序（逗号分隔或 config.json 中的列表），默认 "chronology,dynasty,age,geocode,validation,scoring"；
+  未列出的步骤不执行
+- 内置步骤：chronology（按年份排序、去重并编号）、dynasty（标注朝代与年号）、age（由出生年份补齐并核对年龄）、geocode（补全缺失坐标）、wikidata（关联 Wikidata 实体，默认不启用）、
+  validation（清理非法坐标并记录问题数）、scoring（计算完整度评分）
+- ENRICH_PLUGINS 指定额外模块（逗号分隔），模块在导入时调用 register() 注册自定义步骤
+- 单个步骤失败只记录日志并跳过，不影响其余步骤与接口返回
+- 步骤的 ctx 属性为所属请求的 reqctx.Context（后台调用时为 None），请求到期后跳过需访问网络的步骤
+"""
+
+import importlib
+import logging
+from typing import Any, Callable, Dict, List, Optional
+
+import ages
+import config
+import deepseek
+import datacheck
+import dynasty
+import reqctx
+
+logger = logging.getLogger('api')
+
+
+class Enricher:
+    """增强步骤基类：实现 enrich()，可原地修改并返回 person。"""
+    name = ''
+    ctx = None
+
+    def enrich(self, person: Dict[str, Any]) -> Dict[str, Any]:
+        raise NotImplementedError
+
+
+class ChronologyEnricher(Enricher):
+    """事件按年份排序、合并重复事件并编号 seq（见 datacheck.normalize_events）。"""
+    name = 'chronology'
+
+    def enrich(self, person):
+        person['events'] = datacheck.normalize_events(person.get('events') or [])
+        return person
+
+
+class DynastyEnricher(Enricher):
+    """按年份标注朝代与年号（见 dynasty.py）。"""
+    name = 'dynasty'
+
+    def enrich(self, person):
+        dynasty.TABLE.annotate(person)
+        return person
+
+
+class AgeEnricher(Enricher):
+    """由出生年份补齐缺失年龄，并核对与年份矛盾的年龄（见 ages.py），矛盾数记入 person["quality"]。"""
+    name = 'age'
+
+    def enrich(self, person):
+        report = ages.apply(person)
+        if report['birth_year'] is not None:
+            person.setdefault('quality', {})['age_mismatches'] = report['mismatched']
+        return person
+
+
+class GeocodeEnricher(Enricher):
+    """为缺少坐标的事件查询地点坐标；每个人物最多 GEOCODE_MAX_CALLS 次外部请求。
+
+    geocoder 为 services.Geocoder，未注入时直接使用 deepseek._geocode_place。
+    """
+    name = 'geocode'
+    geocoder = None
+
+    def enrich(self, person):
+        if not config.get_geocode_enabled():
+            return person
+        max_calls = config.get_geocode_max_calls()
+        calls = 0
+        for e in person.get('events') or []:
+            if calls >= max_calls or (self.ctx is not None and self.ctx.done()):
+                break
+            if str(e.get("lat", "")).strip() != "" and str(e.get("lon", "")).strip() != "":
+                continue
+            place = str(e.get("place", ""))
+            if self.geocoder is not None:
+                coords = self.geocoder.geocode(self.ctx or reqctx.background(), place)
+            else:
+                coords = deepseek._geocode_place(place, self.ctx)
+            calls += 1
+            if coords:
+                e["lat"] = coords["lat"]
+                e["lon"] = coords["lon"]
+            else:
+                e["lat"] = e.get("lat", "")
+                e["lon"] = e.get("lon", "")
+        return person
+
+
+class WikidataEnricher(Enricher):
+    """按姓名检索 Wikidata 实体，命中时写入 person["wikidata"]（QID）。"""
+    name = 'wikidata'
+
+    def enrich(self, person):
+        if person.get('wikidata'):
+            return person
+        qid = deepseek.search_wikidata(person.get('name', ''), self.ctx)
+        if qid:
+            person['wikidata'] = qid
+        return person
+
+
+class ValidationEnricher(Enricher):
+    """清理无法解析的坐标，并把校验问题数记录到 person["quality"]。"""
+    name = 'validation'
+
+    def enrich(self, person):
+        for e in person.get('events') or []:
+            for k in ('lat', 'lon'):
+                try:
+                    if str(e.get(k, '')).strip() != '':
+                        float(e[k])
+                except (TypeError, ValueError):
+                    e[k] = ''
+        issues = datacheck.check_people({'persons': [person]})
+        quality = person.setdefault('quality', {})
+        quality['errors'] = sum(1 for i in issues if i['level'] == 'error')
+        quality['warnings'] = sum(1 for i in issues if i['level'] == 'warning')
+        return person
+
+
+class ScoringEnricher(Enricher):
+    """完整度评分（0–1）：事件中年份、地点、坐标、标题、详情的填写比例。"""
+    name = 'scoring'
+    FIELDS = ('year', 'place', 'lat', 'title', 'detail')
+
+    def enrich(self, person):
+        events = person.get('events') or []
+        if events:
+            filled = sum(1 for e in events for f in self.FIELDS if str(e.get(f, '')).strip() != '')
+            score = round(filled / (len(events) * len(self.FIELDS)), 3)
+        else:
+            score = 0.0
+        person.setdefault('quality', {})['score'] = score
+        return person
+
+
+REGISTRY: Dict[str, Callable[[], Enricher]] = {
+    'chronology': ChronologyEnricher,
+    'dynasty': DynastyEnricher,
+    'age': AgeEnricher,
+    'geocode': GeocodeEnricher,
+    'wikidata': WikidataEnricher,
+    'validation': ValidationEnricher,
+    'scoring': ScoringEnricher,
+}
+DEFAULT_PIPELINE = ['chronology', 'dynasty', 'age', 'geocode', 'validation', 'scoring']
+_plugins_loaded = False
+
+
+def register(name: str, factory: Callable[[], Enricher]):
+    """注册自定义步骤（供 ENRICH_PLUGINS 中的模块调用），同名覆盖内置步骤。"""
+    REGISTRY[name] = factory
+
+
+def _load_plugins():
+    global _plugins_loaded
+    if _plugins_loaded:
+        return
+    _plugins_loaded = True
+    raw = config.get('ENRICH_PLUGINS', '')
+    modules = raw if isinstance(raw, list) else str(raw or '').split(',')
+    for mod in modules:
+        mod = str(mod).strip()
+        if not mod:
+            continue
+        try:
+            importlib.import_module(mod)
+        except Exception as e:
+            logger.error("增强插件加载失败：%s, %s", mod, repr(e))
+
+
+def pipeline_names() -> List[str]:
+    raw = config.get('ENRICH_PIPELINE', None)
+    if raw is None:
+        return list(DEFAULT_PIPELINE)
+    items = raw if isinstance(raw, list) else str(raw).split(',')
+    return [str(n).strip() for n in items if str(n).strip()]
+
+
+def build_pipeline(geocoder=None, ctx=None) -> List[Enricher]:
+    _load_plugins()
+    steps = []
+    for name in pipeline_names():
+        factory = REGISTRY.get(name)
+        if factory is None:
+            logger.warning("未知的增强步骤：%s（已跳过）", name)
+            continue
+        step = factory()
+        step.ctx = ctx
+        if geocoder is not None and isinstance(step, GeocodeEnricher):
+            step.geocoder = geocoder
+        steps.append(step)
+    return steps
+
+
+def run(person: Dict[str, Any], steps: Optional[List[Enricher]] = None) -> Dict[str, Any]:
+    for step in (steps if steps is not None else build_pipeline()):
+        try:
+            if step.ctx is not None:
+                with step.ctx.span('enrich.' + step.name):
+                    person = step.enrich(person) or person
+            else:
+                person = step.enrich(person) or person
+        except Exception as e:
+            logger.warning("增强步骤失败：step=%s, name=%s, %s", step.name, person.get('name'), repr(e))
+    return person
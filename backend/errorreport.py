@@ -0,0 +1,174 @@
+"""
+错误上报（Sentry 兼容）
+
+配置 SENTRY_DSN 后启用（为空时所有调用均为空操作），以 envelope 协议发往 Sentry 或兼容服务（如 GlitchTip）：
+- 未捕获异常：接口处理中的异常（middleware.recover），附请求方法、路径、请求 ID
+- 5xx 响应：除上游类错误外的 5xx 逐条上报
+- 上游失败突增：SENTRY_UPSTREAM_BURST_WINDOW_SEC 秒内上游失败（超时/限流/错误）达到 SENTRY_UPSTREAM_BURST_COUNT 次时
+  上报一次，同一窗口内不再重复
+
+事件带 release（SENTRY_RELEASE）与 environment（SENTRY_ENVIRONMENT）标签。
+发送在后台线程进行，队列满或发送失败时丢弃，不影响请求处理。
+"""
+
+import json
+import time
+import uuid
+import queue
+import logging
+import platform
+import threading
+import traceback
+import urllib.request
+from urllib.parse import urlparse
+from typing import Any, Dict, List, Optional
+
+import config
+
+logger = logging.getLogger('api')
+
+UPSTREAM_CODES = ('UPSTREAM_TIMEOUT', 'UPSTREAM_ERROR', 'RATE_LIMITED')
+
+
+def parse_dsn(dsn: str) -> Optional[Dict[str, str]]:
+    """https://<key>@<host>/<project> → envelope 地址与公钥；格式不对时返回 None。"""
+    u = urlparse(dsn or '')
+    project = u.path.rstrip('/').rsplit('/', 1)[-1] if u.path else ''
+    if u.scheme not in ('http', 'https') or not u.username or not u.hostname or not project:
+        return None
+    prefix = u.path.rstrip('/')[:-len(project)].rstrip('/')
+    host = u.hostname + (f':{u.port}' if u.port else '')
+    return {
+        'key': u.username,
+        'url': f'{u.scheme}://{host}{prefix}/api/{project}/envelope/',
+        'dsn': dsn,
+    }
+
+
+def _frames(tb) -> List[Dict[str, Any]]:
+    return [{'filename': f.filename, 'function': f.name, 'lineno': f.lineno, 'context_line': f.line}
+            for f in traceback.extract_tb(tb)]
+
+
+class Reporter:
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._queue: 'queue.Queue[Dict[str, Any]]' = queue.Queue(maxsize=100)
+        self._thread: Optional[threading.Thread] = None
+        self._target: Optional[Dict[str, str]] = None
+        self._burst: List[float] = []
+        self._burst_reported_at = 0.0
+        self.sent = 0
+        self.dropped = 0
+
+    def configure(self):
+        dsn = config.get_sentry_dsn()
+        self._target = parse_dsn(dsn) if dsn else None
+        if dsn and self._target is None:
+            logger.warning("SENTRY_DSN 格式无效，错误上报未启用")
+        if self._target and self._thread is None:
+            self._thread = threading.Thread(target=self._worker, name='errorreport', daemon=True)
+            self._thread.start()
+
+    @property
+    def enabled(self) -> bool:
+        return self._target is not None
+
+    def _event(self, level: str, **fields) -> Dict[str, Any]:
+        event = {
+            'event_id': uuid.uuid4().hex,
+            'timestamp': time.time(),
+            'platform': 'python',
+            'level': level,
+            'logger': 'fetrace',
+            'server_name': platform.node(),
+            'release': config.get_sentry_release(),
+            'environment': config.get_sentry_environment(),
+        }
+        event.update(fields)
+        return event
+
+    def _enqueue(self, event: Dict[str, Any]):
+        try:
+            self._queue.put_nowait(event)
+        except queue.Full:
+            self.dropped += 1
+
+    def capture_exception(self, exc: BaseException, request: Optional[Dict[str, Any]] = None, tags: Optional[Dict[str, str]] = None):
+        if not self.enabled:
+            return
+        self._enqueue(self._event(
+            'error',
+            exception={'values': [{
+                'type': type(exc).__name__,
+                'value': str(exc),
+                'stacktrace': {'frames': _frames(exc.__traceback__)},
+            }]},
+            request=request or {},
+            tags=tags or {},
+        ))
+
+    def capture_message(self, message: str, level: str = 'error', request: Optional[Dict[str, Any]] = None,
+                        tags: Optional[Dict[str, str]] = None, extra: Optional[Dict[str, Any]] = None):
+        if not self.enabled:
+            return
+        self._enqueue(self._event(level, message={'formatted': message}, request=request or {},
+                                  tags=tags or {}, extra=extra or {}))
+
+    def record_upstream_failure(self, kind: str, name: str = ''):
+        """累计上游失败；窗口内达到阈值时上报一次突增事件。"""
+        if not self.enabled:
+            return
+        window, threshold = config.get_sentry_upstream_burst()
+        now = time.monotonic()
+        with self._lock:
+            self._burst = [t for t in self._burst if now - t < window]
+            self._burst.append(now)
+            count = len(self._burst)
+            if count < threshold or now - self._burst_reported_at < window:
+                return
+            self._burst_reported_at = now
+        self.capture_message(f'上游失败突增：{window}s 内 {count} 次', level='warning',
+                             tags={'kind': 'upstream_burst', 'last_kind': kind},
+                             extra={'window_sec': window, 'count': count, 'last_name': name})
+
+    def _send(self, event: Dict[str, Any]):
+        target = self._target
+        header = json.dumps({'event_id': event['event_id'], 'dsn': target['dsn'], 'sent_at': time.strftime('%Y-%m-%dT%H:%M:%SZ', time.gmtime())})
+        body = '\n'.join([header, json.dumps({'type': 'event'}), json.dumps(event, ensure_ascii=False, default=str)]).encode('utf-8')
+        req = urllib.request.Request(target['url'], data=body, method='POST', headers={
+            'Content-Type': 'application/x-sentry-envelope',
+            'X-Sentry-Auth': f"Sentry sentry_version=7, sentry_key={target['key']}, sentry_client=fetrace/1.0",
+        })
+        with urllib.request.urlopen(req, timeout=5) as resp:
+            resp.read()
+
+    def _worker(self):
+        while True:
+            event = self._queue.get()
+            try:
+                self._send(event)
+                self.sent += 1
+            except Exception as e:
+                self.dropped += 1
+                logger.debug("错误上报发送失败：%s", repr(e))
+
+    def flush(self, timeout: float = 2.0):
+        """等待队列发送完毕（最多 timeout 秒），用于停机前。"""
+        deadline = time.monotonic() + timeout
+        while self.enabled and not self._queue.empty() and time.monotonic() < deadline:
+            time.sleep(0.05)
+
+
+REPORTER = Reporter()
+
+
+def request_info(handler) -> Dict[str, Any]:
+    ctx = getattr(handler, 'ctx', None)
+    headers = getattr(handler, 'headers', None)
+    return {
+        'method': getattr(handler, 'command', ''),
+        'url': urlparse(getattr(handler, 'path', '')).path,
+        'headers': {'User-Agent': headers.get('User-Agent', '')} if headers else {},
+        'env': {'REMOTE_ADDR': handler.address_string(), 'REQUEST_ID': ctx.request_id if ctx else ''},
+    }
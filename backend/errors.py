@@ -0,0 +1,62 @@
+"""
+API 错误码与异常
+
+所有接口统一返回 {data, meta, error, version, requestId}，其中 error 为 {code, message, details} 或 null，
+requestId 同响应头 X-Request-ID。
+客户端应依据 code 分支处理，message 仅供展示与排查（按 Accept-Language 本地化，见 i18n.py）。
+"""
+
+from typing import Any, Dict, Optional
+import i18n
+
+BAD_REQUEST = 'BAD_REQUEST'
+UNAUTHORIZED = 'UNAUTHORIZED'
+FORBIDDEN = 'FORBIDDEN'
+NOT_FOUND = 'NOT_FOUND'
+PERSON_NOT_FOUND = 'PERSON_NOT_FOUND'
+METHOD_NOT_ALLOWED = 'METHOD_NOT_ALLOWED'
+LENGTH_REQUIRED = 'LENGTH_REQUIRED'
+PAYLOAD_TOO_LARGE = 'PAYLOAD_TOO_LARGE'
+RATE_LIMITED = 'RATE_LIMITED'
+READ_ONLY = 'READ_ONLY'
+MAINTENANCE = 'MAINTENANCE'
+CONFLICT = 'CONFLICT'
+UPSTREAM_TIMEOUT = 'UPSTREAM_TIMEOUT'
+UPSTREAM_ERROR = 'UPSTREAM_ERROR'
+INTERNAL_ERROR = 'INTERNAL_ERROR'
+
+HTTP_STATUS = {
+    BAD_REQUEST: 400,
+    UNAUTHORIZED: 401,
+    FORBIDDEN: 403,
+    NOT_FOUND: 404,
+    PERSON_NOT_FOUND: 404,
+    METHOD_NOT_ALLOWED: 405,
+    CONFLICT: 409,
+    LENGTH_REQUIRED: 411,
+    PAYLOAD_TOO_LARGE: 413,
+    RATE_LIMITED: 429,
+    READ_ONLY: 503,
+    MAINTENANCE: 503,
+    UPSTREAM_TIMEOUT: 504,
+    UPSTREAM_ERROR: 502,
+    INTERNAL_ERROR: 500,
+}
+
+
+class ApiError(Exception):
+    """message_key 为 i18n 文案 key，details 中的字段可作为文案参数。"""
+
+    def __init__(self, code: str, message_key: str, details: Optional[Any] = None, status: Optional[int] = None,
+                 headers: Optional[Dict[str, str]] = None):
+        super().__init__(message_key)
+        self.code = code
+        self.message_key = message_key
+        self.details = details
+        self.status = status or HTTP_STATUS.get(code, 500)
+        self.headers = headers  # 附加响应头，如 Retry-After
+
+    def to_dict(self, lang: Optional[str] = None):
+        params = self.details if isinstance(self.details, dict) else None
+        message = i18n.translate(self.message_key, lang or i18n.default_lang(), params)
+        return {"code": self.code, "message": message, "details": self.details}
@@ -0,0 +1,118 @@
+"""
+数据导出（不启动 HTTP 服务）
+
+    python index.py export [--format json,csv,geojson] [--names 苏轼,李白] [--tags 诗人] [--out 目录或 -]
+
+- 默认导出全部人物，--names 按姓名（支持别名、繁简）筛选，--tags 按人物的 tags 字段筛选
+- --out 为目录时按格式写入 people-<时间>.<ext>（默认 EXPORTS_DIR）；为 "-" 时输出到标准输出（仅限单一格式）
+- 文件先写临时文件再原子替换，适合定时任务与数据管道
+"""
+
+import os
+import io
+import csv
+import sys
+import json
+import time
+import argparse
+from typing import Any, Dict, List, Optional
+
+FORMATS = ('json', 'csv', 'geojson')
+CSV_COLUMNS = ['name', 'year', 'age', 'place', 'lat', 'lon', 'title', 'detail']
+EVENT_COLUMNS = CSV_COLUMNS[1:]  # 单个人物导出（GET /api/person/{name}/export）不含姓名列
+CONTENT_TYPES = {'json': 'application/json; charset=utf-8', 'csv': 'text/csv; charset=utf-8',
+                 'geojson': 'application/geo+json; charset=utf-8'}
+
+
+def select_persons(cache, names: List[str], tags: List[str]) -> List[Dict[str, Any]]:
+    persons = (cache.get_people_or_fallback({}) or {}).get('persons') or []
+    if names:
+        picked = []
+        for n in names:
+            p = cache.find_person(n)
+            if p is not None and p not in picked:
+                picked.append(p)
+        persons = picked
+    if tags:
+        wanted = set(tags)
+        persons = [p for p in persons if wanted & set(p.get('tags') or [])]
+    return persons
+
+
+def to_json(persons: List[Dict[str, Any]]) -> str:
+    return json.dumps({'persons': persons}, ensure_ascii=False, indent=2)
+
+
+def to_csv(persons: List[Dict[str, Any]], columns: List[str] = CSV_COLUMNS) -> str:
+    buf = io.StringIO()
+    w = csv.DictWriter(buf, fieldnames=columns, extrasaction='ignore')
+    w.writeheader()
+    for p in persons:
+        for e in p.get('events') or []:
+            w.writerow({**e, 'name': p.get('name', '')})
+    return buf.getvalue()
+
+
+def to_geojson(persons: List[Dict[str, Any]]) -> str:
+    features = []
+    for p in persons:
+        for e in p.get('events') or []:
+            try:
+                lat, lon = float(e.get('lat')), float(e.get('lon'))
+            except (TypeError, ValueError):
+                continue  # 无坐标的事件无法成为点要素
+            props = {k: v for k, v in e.items() if k not in ('lat', 'lon')}
+            props['name'] = p.get('name', '')
+            features.append({
+                'type': 'Feature',
+                'geometry': {'type': 'Point', 'coordinates': [lon, lat]},
+                'properties': props,
+            })
+    return json.dumps({'type': 'FeatureCollection', 'features': features}, ensure_ascii=False, indent=2)
+
+
+RENDERERS = {'json': to_json, 'csv': to_csv, 'geojson': to_geojson}
+
+
+def _write_atomic(path: str, text: str):
+    tmp = path + '.tmp'
+    with open(tmp, 'w', encoding='utf-8', newline='') as f:
+        f.write(text)
+    os.replace(tmp, path)
+
+
+def _split(value: Optional[str]) -> List[str]:
+    return [x.strip() for x in str(value or '').split(',') if x.strip()]
+
+
+def main(argv: List[str], cache, default_out: str) -> int:
+    parser = argparse.ArgumentParser(prog='index.py export', description='导出人物轨迹数据')
+    parser.add_argument('--format', default='json', help='json、csv、geojson，可逗号分隔多个')
+    parser.add_argument('--names', default='', help='逗号分隔的姓名，默认全部')
+    parser.add_argument('--tags', default='', help='逗号分隔的标签，匹配任一即导出')
+    parser.add_argument('--out', default=default_out, help='输出目录，"-" 表示标准输出')
+    args = parser.parse_args(argv)
+
+    formats = _split(args.format)
+    unknown = [f for f in formats if f not in FORMATS]
+    if not formats or unknown:
+        parser.error(f'不支持的格式：{", ".join(unknown) or "(空)"}（可选 {", ".join(FORMATS)}）')
+    if args.out == '-' and len(formats) > 1:
+        parser.error('输出到标准输出时只能指定一种格式')
+
+    names = _split(args.names)
+    persons = select_persons(cache, names, _split(args.tags))
+    missing = [n for n in names if cache.find_person(n) is None]
+    if missing:
+        print(f'未找到：{", ".join(missing)}', file=sys.stderr)
+
+    if args.out == '-':
+        sys.stdout.write(RENDERERS[formats[0]](persons))
+        return 0
+    os.makedirs(args.out, exist_ok=True)
+    stamp = time.strftime('%Y%m%d-%H%M%S')
+    for fmt in formats:
+        path = os.path.join(args.out, f'people-{stamp}.{fmt}')
+        _write_atomic(path, RENDERERS[fmt](persons))
+        print(f'{fmt}: {path}（persons={len(persons)}）', file=sys.stderr)
+    return 0
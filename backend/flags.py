@@ -0,0 +1,109 @@
+"""
+功能开关
+
+取值优先级（高 → 低）：
+1. 运行时覆盖：管理接口 POST /api/admin/flags 设置，持久化到 data/flags.json
+2. 环境变量 FLAG_<NAME>（如 FLAG_MOCK_PROVIDER=1）
+3. config.json 中的 "FLAGS": {"name": true}
+4. 下方 DEFINITIONS 中的默认值
+
+每次判断都会重新读取，切换立即生效，无需重启。
+"""
+
+import os
+import json
+import threading
+from typing import Any, Dict, List, Optional
+
+import config
+
+
+def _truthy(val: Any) -> bool:
+    if isinstance(val, str):
+        return val.strip().lower() in ('1', 'true', 'yes', 'on')
+    return bool(val)
+
+
+# 名称 → (默认值或取默认值的函数, 说明)
+DEFINITIONS: Dict[str, tuple] = {
+    'generation': (True, '未命中缓存时调用 AI 生成（关闭后仅返回已有数据）'),
+    'batch_generate': (True, '允许 /api/person?names=...&generate=1 批量生成'),
+    'alias_ai': (config.get_alias_ai_enabled, 'AI 辅助识别字/号等别名（默认取 ALIAS_AI_ENABLED）'),
+    'mock_provider': (False, '以模拟数据代替 DeepSeek 生成（与 AI_PROVIDER=mock 等效）'),
+    'maintenance': (config.get_maintenance_mode, '维护模式：数据接口返回 503 与维护公告，静态资源与健康检查照常（默认取 MAINTENANCE_MODE）'),
+    'read_only': (config.get_read_only, '只读模式：停用 AI 生成、数据修改接口与落盘，仅返回已有数据（默认取 READ_ONLY）'),
+}
+
+
+class Flags:
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._overrides: Dict[str, bool] = {}
+        self._path: Optional[str] = None
+
+    def load(self, path: str):
+        self._path = path
+        try:
+            with open(path, 'r', encoding='utf-8') as f:
+                data = json.load(f)
+        except Exception:
+            return
+        if isinstance(data, dict):
+            with self._lock:
+                self._overrides = {k: bool(v) for k, v in data.items() if k in DEFINITIONS}
+
+    def _resolve(self, name: str):
+        with self._lock:
+            if name in self._overrides:
+                return self._overrides[name], 'runtime'
+        env = os.environ.get('FLAG_' + name.upper())
+        if env is not None and env.strip():
+            return _truthy(env), 'env'
+        cfg = config.get('FLAGS', None)
+        if isinstance(cfg, dict) and name in cfg:
+            return _truthy(cfg[name]), 'config'
+        default = DEFINITIONS[name][0]
+        return bool(default() if callable(default) else default), 'default'
+
+    def enabled(self, name: str) -> bool:
+        if name not in DEFINITIONS:
+            return False
+        return self._resolve(name)[0]
+
+    def all(self) -> List[Dict[str, Any]]:
+        out = []
+        for name, (_, desc) in DEFINITIONS.items():
+            value, source = self._resolve(name)
+            out.append({'name': name, 'enabled': value, 'source': source, 'description': desc})
+        return out
+
+    def set(self, name: str, value: Optional[bool]) -> bool:
+        """设置运行时覆盖；value 为 None 时清除覆盖，回落到环境变量/配置/默认值。"""
+        if name not in DEFINITIONS:
+            return False
+        with self._lock:
+            if value is None:
+                self._overrides.pop(name, None)
+            else:
+                self._overrides[name] = bool(value)
+            data = dict(self._overrides)
+        self._save(data)
+        return True
+
+    def _save(self, data: Dict[str, bool]):
+        if not self._path:
+            return
+        tmp = self._path + '.tmp'
+        try:
+            with open(tmp, 'w', encoding='utf-8') as f:
+                json.dump(data, f, ensure_ascii=False, indent=2)
+            os.replace(tmp, self._path)
+        except Exception:
+            try:
+                if os.path.exists(tmp):
+                    os.remove(tmp)
+            except Exception:
+                pass
+
+
+FLAGS = Flags()
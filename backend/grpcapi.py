@@ -0,0 +1,206 @@
+"""
+gRPC 服务（与 HTTP API 并行，供其他后端服务以强类型客户端读取人物与时间线）
+
+接口定义见 proto/fetrace.proto（service fetrace.v1.People），只读，数据来自与 HTTP 接口相同的缓存：
+- GetPerson      按姓名或别名取人物（与 HTTP 一样做近似查找），缓存中没有时返回 NOT_FOUND，不触发 AI 生成
+- ListPeople     分页、排序与年份/地点过滤，语义同 GET /api/v1/people
+- GetPeopleData  全部人物
+- GetTimeline    多位人物的合并事件流，语义同 GET /api/v1/timeline/merged
+
+GRPC_LISTEN（如 0.0.0.0:50051）非空时启动，需安装 grpcio；消息编解码由 pbwire.py 完成，不需要 protoc 生成代码。
+参数错误等 ApiError 按错误码映射为 gRPC 状态码，details 为本地化的错误信息。
+"""
+
+from typing import Any, Callable, Dict, List, Optional
+
+import config
+import errors
+import overlap
+from cache import SORTS
+from errors import ApiError
+from pbwire import encode, decode
+from validation import validate_name, validate_names, validate_query_text
+
+try:
+    import grpc  # 需通过 pip 安装：pip install grpcio
+except Exception:
+    grpc = None
+
+SERVICE = 'fetrace.v1.People'
+
+# 与 proto/fetrace.proto 一一对应
+EVENT = {'id': (1, 'string', ''), 'year': (2, 'string', ''), 'age': (3, 'int32', 'optional'),
+         'place': (4, 'string', ''), 'lat': (5, 'double', 'optional'), 'lon': (6, 'double', 'optional'),
+         'title': (7, 'string', ''), 'detail': (8, 'string', '')}
+STYLE = {'marker_color': (1, 'string', ''), 'line_color': (2, 'string', '')}
+PERSON = {'id': (1, 'string', ''), 'name': (2, 'string', ''), 'style': (3, STYLE, ''),
+          'events': (4, EVENT, 'repeated'), 'updated_at': (5, 'double', '')}
+PEOPLE_DATA = {'persons': (1, PERSON, 'repeated')}
+GET_PERSON_REQUEST = {'name': (1, 'string', '')}
+LIST_PEOPLE_REQUEST = {'offset': (1, 'int32', ''), 'limit': (2, 'int32', ''), 'sort': (3, 'string', ''),
+                       'from_year': (4, 'int32', 'optional'), 'to_year': (5, 'int32', 'optional'),
+                       'place': (6, 'string', '')}
+LIST_PEOPLE_RESPONSE = {'persons': (1, PERSON, 'repeated'), 'total': (2, 'int32', '')}
+GET_PEOPLE_DATA_REQUEST: Dict[str, tuple] = {}
+TIMELINE_REQUEST = {'names': (1, 'string', 'repeated'), 'from_year': (2, 'int32', 'optional'),
+                    'to_year': (3, 'int32', 'optional')}
+TIMELINE_EVENT = {'year': (1, 'int32', ''), 'name': (2, 'string', ''), 'person': (3, 'int32', ''),
+                  'event': (4, 'int32', ''), 'place': (5, 'string', ''), 'lat': (6, 'double', 'optional'),
+                  'lon': (7, 'double', 'optional'), 'title': (8, 'string', ''), 'detail': (9, 'string', ''),
+                  'age': (10, 'int32', 'optional')}
+TIMELINE_RESPONSE = {'persons': (1, PERSON, 'repeated'), 'events': (2, TIMELINE_EVENT, 'repeated'),
+                     'undated': (3, 'int32', ''), 'missing': (4, 'string', 'repeated')}
+
+# ApiError 错误码 → gRPC 状态码名（未列出的为 INTERNAL）
+STATUS = {
+    errors.BAD_REQUEST: 'INVALID_ARGUMENT',
+    errors.NOT_FOUND: 'NOT_FOUND',
+    errors.PERSON_NOT_FOUND: 'NOT_FOUND',
+    errors.UNAUTHORIZED: 'UNAUTHENTICATED',
+    errors.FORBIDDEN: 'PERMISSION_DENIED',
+    errors.RATE_LIMITED: 'RESOURCE_EXHAUSTED',
+    errors.MAINTENANCE: 'UNAVAILABLE',
+    errors.UPSTREAM_TIMEOUT: 'DEADLINE_EXCEEDED',
+    errors.UPSTREAM_ERROR: 'UNAVAILABLE',
+}
+
+
+def _number(value: Any, cast: Callable[[Any], Any]) -> Optional[Any]:
+    if value is None or str(value).strip() == '':
+        return None
+    try:
+        return cast(value)
+    except (TypeError, ValueError):
+        return None
+
+
+def person_message(p: Dict[str, Any]) -> Dict[str, Any]:
+    style = p.get('style') if isinstance(p.get('style'), dict) else None
+    return {
+        'id': p.get('id') or '',
+        'name': p.get('name', ''),
+        'style': {'marker_color': style.get('markerColor') or '', 'line_color': style.get('lineColor') or ''} if style else None,
+        'events': [{'id': e.get('id') or '', 'year': '' if e.get('year') is None else str(e['year']),
+                    'age': _number(e.get('age'), int), 'place': e.get('place') or '',
+                    'lat': _number(e.get('lat'), float), 'lon': _number(e.get('lon'), float),
+                    'title': e.get('title') or '', 'detail': e.get('detail') or ''}
+                   for e in p.get('events') or [] if isinstance(e, dict)],
+        'updated_at': float(p.get('updated_at') or 0),
+    }
+
+
+def _year_range(req: Dict[str, Any]):
+    year_from, year_to = req.get('from_year'), req.get('to_year')
+    if year_from is not None and year_to is not None and year_from > year_to:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "to_year"})
+    return year_from, year_to
+
+
+class PeopleService:
+    """各方法接收解码后的请求字典、返回响应字典，与传输层无关。"""
+
+    def __init__(self, app: Callable[[], Any]):
+        self._app = app  # 取当前 APP（测试会替换）
+
+    def _find(self, name: str) -> Optional[Dict[str, Any]]:
+        app = self._app()
+        found = app.cache.find_person(name, app.fallback)
+        enabled, max_distance = config.get_fuzzy_lookup()
+        if not found and enabled:
+            fuzzy = app.cache.find_fuzzy(name, max_distance)
+            found = fuzzy['person'] if fuzzy else None
+        return found if found and found.get('events') else None
+
+    def get_person(self, req: Dict[str, Any]) -> Dict[str, Any]:
+        name = validate_name(req.get('name') or '', 'name')
+        found = self._find(name)
+        if found is None:
+            raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+        return person_message(found)
+
+    def list_people(self, req: Dict[str, Any]) -> Dict[str, Any]:
+        app = self._app()
+        sort = req.get('sort') or 'added'
+        if sort.lstrip('-') not in SORTS or sort.startswith('--'):
+            raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "sort", "allowed": list(SORTS)})
+        offset, limit = req.get('offset') or 0, req.get('limit') or 0
+        if offset < 0:
+            raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "offset"})
+        if not 0 <= limit <= config.get_people_max_page_size():
+            raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "limit"})
+        year_from, year_to = _year_range(req)
+        place = validate_query_text(req.get('place') or '', 'place')
+        where = None
+        if place or year_from is not None or year_to is not None:
+            where = lambda p: any(overlap.event_matches(e, year_from, year_to, place) for e in p.get('events') or [])
+        total, persons = app.cache.get_people_page(app.fallback, offset, limit or config.get_people_max_page_size(), where, sort)
+        return {'persons': [person_message(p) for p in persons], 'total': total}
+
+    def get_people_data(self, req: Dict[str, Any]) -> Dict[str, Any]:
+        app = self._app()
+        persons = (app.cache.get_people_or_fallback(app.fallback) or {}).get('persons') or []
+        return {'persons': [person_message(p) for p in persons]}
+
+    def get_timeline(self, req: Dict[str, Any]) -> Dict[str, Any]:
+        names = validate_names(','.join(req.get('names') or []))
+        year_from, year_to = _year_range(req)
+        persons: List[Dict[str, Any]] = []
+        missing: List[str] = []
+        for n in names:
+            found = self._find(n)
+            if found is None:
+                missing.append(n)
+            else:
+                persons.append(found)
+        if not persons:
+            raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": ','.join(missing)})
+        data = overlap.merged(persons, year_from, year_to)
+        return {'persons': [person_message(dict(p, events=[])) for p in data['persons']],
+                'events': data['events'], 'undated': data['undated'], 'missing': missing}
+
+
+# 方法名 → (服务方法名, 请求结构, 响应结构)
+METHODS = {
+    'GetPerson': ('get_person', GET_PERSON_REQUEST, PERSON),
+    'ListPeople': ('list_people', LIST_PEOPLE_REQUEST, LIST_PEOPLE_RESPONSE),
+    'GetPeopleData': ('get_people_data', GET_PEOPLE_DATA_REQUEST, PEOPLE_DATA),
+    'GetTimeline': ('get_timeline', TIMELINE_REQUEST, TIMELINE_RESPONSE),
+}
+
+
+def _unary(fn: Callable[[Dict[str, Any]], Dict[str, Any]], logger=None):
+    def handler(request, context):
+        try:
+            return fn(request)
+        except ApiError as e:
+            context.abort(getattr(grpc.StatusCode, STATUS.get(e.code, 'INTERNAL')), e.to_dict()['message'])
+        except Exception:
+            if logger:
+                logger.exception("gRPC 接口处理异常")
+            context.abort(grpc.StatusCode.INTERNAL, 'internal error')
+    return handler
+
+
+def serve(listen: str, service: PeopleService, max_workers: int = 8, logger=None):
+    """在 listen 上启动 gRPC 服务并返回 server（停止时调用 server.stop(grace)）；未安装 grpcio 时返回 None。"""
+    if grpc is None:
+        if logger:
+            logger.warning("已配置 GRPC_LISTEN=%s，但未安装 grpcio，gRPC 服务未启动", listen)
+        return None
+    from concurrent.futures import ThreadPoolExecutor
+    handlers = {
+        name: grpc.unary_unary_rpc_method_handler(
+            _unary(getattr(service, method), logger),
+            request_deserializer=lambda buf, schema=req: decode(schema, buf),
+            response_serializer=lambda msg, schema=resp: encode(schema, msg))
+        for name, (method, req, resp) in METHODS.items()
+    }
+    server = grpc.server(ThreadPoolExecutor(max_workers=max_workers, thread_name_prefix='grpc'))
+    server.add_generic_rpc_handlers((grpc.method_handlers_generic_handler(SERVICE, handlers),))
+    # grpcio 在 Linux 上默认开启 SO_REUSEPORT，SIGHUP 交接时新旧进程可同时监听同一端口
+    if not server.add_insecure_port(listen):
+        raise OSError(f'gRPC 无法监听 {listen}')
+    server.start()
+    if logger:
+        logger.info("gRPC server listening on %s (service=%s)", listen, SERVICE)
+    return server
@@ -0,0 +1,88 @@
+"""
+零停机重启（监听套接字交接）
+
+收到 SIGHUP 时（systemd 下为 systemctl reload fetrace）：
+1. 旧进程先落盘，再以相同命令启动新进程，监听套接字按 systemd 套接字激活的约定传入（LISTEN_FDS，自 fd 3 起，
+   LISTEN_FDNAMES 为各监听的路由作用域），新进程加载新的代码与配置
+2. 新进程完成数据加载并开始服务后，经 HANDOVER_FD 管道通知旧进程，并向 systemd 报告 MAINPID
+3. 旧进程停止 accept（未处理的连接留在共享的监听队列中由新进程接收），进入排空：已建立的连接响应后关闭，
+   等待进行中的请求与后台生成任务完成（最多 HANDOVER_DRAIN_MAX_SEC 秒），落盘后退出
+4. 旧进程最后一次落盘后向新进程发送 SIGUSR1，新进程把交接期间生成、尚不在内存中的人物从 people.json 并入缓存
+新进程在 HANDOVER_TIMEOUT_SEC 内未就绪或提前退出时，旧进程终止新进程并继续服务。
+"""
+
+import os
+import sys
+import fcntl
+import select
+import signal
+import subprocess
+import time
+from typing import List, Optional, Tuple
+
+import systemd
+
+ENV_FD = 'HANDOVER_FD'
+
+
+def spawn_successor(sockets: List[Tuple[int, str]], timeout: float, logger) -> Optional[int]:
+    """启动继任进程并等待其就绪；sockets 为 [(fd, 作用域)]。成功返回新进程 pid，失败返回 None。"""
+    r, w = os.pipe()
+    fds = [fd for fd, _ in sockets]
+    targets = list(range(systemd.SD_LISTEN_FDS_START, systemd.SD_LISTEN_FDS_START + len(fds)))
+
+    def _child_setup():
+        # 在子进程 exec 前把监听描述符移到 3.. 并写入 LISTEN_PID（需等于子进程自身的 pid）
+        tmp = [fcntl.fcntl(fd, fcntl.F_DUPFD, 100 + i) for i, fd in enumerate(fds)]
+        for t, target in zip(tmp, targets):
+            os.dup2(t, target)
+            os.close(t)
+        os.environ['LISTEN_PID'] = str(os.getpid())
+
+    env_fd = fcntl.fcntl(w, fcntl.F_DUPFD, max(targets) + 1)  # 不与 3.. 冲突，子进程中仍为同一编号
+    os.close(w)
+    os.environ.update(LISTEN_FDS=str(len(fds)), LISTEN_FDNAMES=':'.join(name for _, name in sockets), **{ENV_FD: str(env_fd)})
+    try:
+        proc = subprocess.Popen([sys.executable] + sys.argv, pass_fds=targets + [env_fd] + fds,
+                                preexec_fn=_child_setup)
+    except Exception as e:
+        logger.error("启动继任进程失败：%s", repr(e))
+        os.close(r)
+        return None
+    finally:
+        for key in ('LISTEN_FDS', 'LISTEN_FDNAMES', ENV_FD):
+            os.environ.pop(key, None)
+        os.close(env_fd)
+
+    deadline = time.monotonic() + timeout
+    ok = False
+    try:
+        while time.monotonic() < deadline:
+            ready, _, _ = select.select([r], [], [], 0.5)
+            if ready:
+                ok = os.read(r, 1) == b'R'
+                break
+            if proc.poll() is not None:
+                break
+    finally:
+        os.close(r)
+    if ok:
+        logger.info("继任进程已就绪：pid=%d", proc.pid)
+        return proc.pid
+    logger.error("继任进程未就绪（exit=%s），继续由当前进程服务", proc.poll())
+    if proc.poll() is None:
+        proc.send_signal(signal.SIGTERM)
+    return None
+
+
+def notify_parent():
+    """继任进程就绪后调用：通知旧进程开始退出，并告知 systemd 新的主进程。"""
+    fd = os.environ.pop(ENV_FD, None)
+    if not fd:
+        return
+    systemd.notify("MAINPID=%d" % os.getpid())
+    try:
+        os.write(int(fd), b'R')
+        os.close(int(fd))
+    except (OSError, ValueError):
+        pass
@@ -0,0 +1,84 @@
+"""
+就绪探针（/readyz）的组件检查
+
+- cache     人物数据已加载
+- storage   数据目录与 people.json 可写（只读模式下不可写时为 disabled）
+- ai        上游 AI 可达（TimelineProvider.health，见 services.py）
+- geocoder  地理编码服务可达（Geocoder.health）
+
+cache 与 storage 每次探测时检查；上游检查耗时不定，结果缓存 READYZ_CHECK_TTL_SEC 秒，过期后在后台线程刷新，
+探针本身不等待上游（首次检查完成前为 unknown）。上游失败默认只在报告中体现，
+READYZ_REQUIRE_UPSTREAM=1 时才使 /readyz 返回 503。
+"""
+
+import threading
+import time
+from typing import Any, Dict, List, Tuple
+
+import config
+import reqctx
+
+UPSTREAM = ('ai', 'geocoder')
+
+
+def _cache_status(app) -> Dict[str, Any]:
+    people = app.cache.people
+    if people is None:
+        return {"status": "fail", "detail": "not_loaded"}
+    return {"status": "ok", "persons": len(people.get('persons') or [])}
+
+
+def _storage_status(app) -> Dict[str, Any]:
+    if app.cache.storage_writable():
+        return {"status": "ok"}
+    if app.cache.read_only():
+        return {"status": "disabled", "detail": "read_only"}
+    return {"status": "fail", "detail": "not_writable"}
+
+
+class Readiness:
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._upstream: Dict[str, Dict[str, Any]] = {}
+        self._checked_at = 0.0
+        self._running = False
+
+    def _upstream_status(self, app) -> Dict[str, Dict[str, Any]]:
+        with self._lock:
+            if not self._running and time.time() - self._checked_at >= config.get_readyz_check_ttl_sec():
+                self._running = True
+                threading.Thread(target=self._refresh, args=(app,), name='readyz-check', daemon=True).start()
+            return dict(self._upstream)
+
+    def _refresh(self, app):
+        ctx = reqctx.background()
+        results: Dict[str, Dict[str, Any]] = {}
+        for name, service in zip(UPSTREAM, (app.timeline, app.geocoder)):
+            check = getattr(service, 'health', None)
+            try:
+                result = dict(check(ctx)) if check else {"status": "unknown"}
+            except Exception as e:
+                result = {"status": "fail", "detail": type(e).__name__}
+            result['checked_at'] = round(time.time(), 3)
+            results[name] = result
+        with self._lock:
+            self._upstream = results
+            self._checked_at = time.time()
+            self._running = False
+
+    def report(self, app, phase: str) -> Tuple[int, Dict[str, Any]]:
+        """phase 为生命周期状态（starting / draining / ready）；返回 (HTTP 状态码, 响应体)。"""
+        components = {'cache': _cache_status(app), 'storage': _storage_status(app)}
+        upstream = self._upstream_status(app)
+        for name in UPSTREAM:
+            components[name] = upstream.get(name) or {"status": "unknown"}
+        critical: List[str] = ['cache', 'storage'] + (list(UPSTREAM) if config.get_readyz_require_upstream() else [])
+        failed = [n for n in critical if components[n]['status'] == 'fail']
+        status = 'not_ready' if phase == 'ready' and failed else phase
+        body: Dict[str, Any] = {"status": status, "components": components}
+        if failed:
+            body['failed'] = failed
+        return (200 if status == 'ready' else 503), body
+
+
+READINESS = Readiness()
@@ -0,0 +1,156 @@
+"""
+接口错误/状态文案的多语言支持
+
+- 按请求头 Accept-Language 选择语言（目前支持 zh-CN、en），默认取配置 DEFAULT_LANG（zh-CN）
+- 文案以 key 索引，可用 {param} 引用错误 details 中的字段
+"""
+
+from typing import Any, Dict, Optional
+import config
+
+SUPPORTED = ('zh-CN', 'en')
+
+MESSAGES: Dict[str, Dict[str, str]] = {
+    'zh-CN': {
+        'missing_param': '缺少参数：{param}',
+        'too_many_names': '一次最多查询 {max} 个姓名',
+        'invalid_param': '参数不合法：{param}',
+        'param_too_long': '参数 {param} 过长（最多 {max} 个字符）',
+        'name_too_long': '姓名过长（最多 {max} 个字符）',
+        'name_invalid_chars': '姓名包含不支持的字符：{chars}',
+        'length_required': '请求缺少 Content-Length',
+        'payload_too_large': '请求体过大（最多 {max_bytes} 字节）',
+        'invalid_json': '请求体不是合法的 JSON',
+        'person_not_found': '未找到该人物的轨迹数据',
+        'person_invalid': '人物数据校验未通过：{reason}',
+        'refresh_empty': 'AI 未返回 {name} 的事件，已保留原有数据',
+        'route_not_found': '接口不存在',
+        'method_not_allowed': '该接口不支持此请求方法',
+        'unauthorized': '未授权：管理接口需要有效的管理令牌',
+        'admin_disabled': '管理接口未启用：请配置 ADMIN_TOKEN',
+        'upstream_timeout': 'AI 服务响应超时，请稍后重试',
+        'generation_timeout': '生成超过 {timeout_sec} 秒仍未完成，已转入后台，请稍后重试',
+        'upstream_rate_limited': 'AI 服务请求过于频繁，请稍后重试',
+        'upstream_unavailable': 'AI 服务不可用',
+        'internal_error': '服务器内部错误',
+        'generation_disabled': 'AI 生成暂未开放，仅可查看已有人物',
+        'read_only': '服务处于只读模式，暂不接受数据修改',
+        'maintenance': '系统维护中，请稍后再试',
+        'person_exists': '已存在同名人物：{name}',
+        'event_not_found': '未找到该事件：{name} #{index}',
+        'unsupported_media': '不支持的文件格式，仅接受 JPEG、PNG、GIF、WebP 或 PDF',
+        'invalid_media_url': '附件地址无效：需为 http(s) 地址或已上传的 /media/ 文件',
+        'too_many_media': '每个事件最多 {max} 个附件',
+        'unknown_tile_provider': '未知的瓦片源：{provider}',
+        'proxy_url_not_allowed': '仅可代理事件附件中引用的外部图片',
+        'proxy_rate_limited': '上游 {host} 请求过于频繁，请稍后重试',
+        'proxy_upstream_error': '上游图片获取失败：{reason}',
+        'proxy_upstream_timeout': '上游图片获取超时：{host}',
+        'tts_unavailable': '语音合成未启用',
+        'tts_timeout': '语音合成超时，请稍后重试',
+        'tts_failed': '语音合成失败：{reason}',
+        'embedding_failed': '向量生成失败：{reason}',
+        'job_running': '分析任务正在运行，请稍后再试',
+        'cluster_not_found': '未找到该聚类：{id}',
+        'job_not_found': '任务不存在或已过期：{id}',
+        'unknown_flag': '未知的功能开关：{name}',
+        'unknown_setting': '不支持运行时修改的配置项：{key}',
+        'flush_failed': '落盘失败，变更仍保留在内存中，将在下次落盘时重试',
+        'flush_cancelled': '请求已超时，未执行落盘，变更将在下次定时落盘时写入',
+        'client_rate_limited': '请求过于频繁（每分钟最多 {limit_per_min} 次），请稍后重试',
+        'quota_exceeded': '今日 {quota} 额度已用完（{key}：{used}/{limit}），{reset_in_sec} 秒后重置',
+        'api_key_invalid': '无效的 API Key',
+        'api_key_required': '此接口需要 API Key（请求头 X-API-Key）',
+    },
+    'en': {
+        'missing_param': 'Missing parameter: {param}',
+        'too_many_names': 'At most {max} names per request',
+        'invalid_param': 'Invalid parameter: {param}',
+        'param_too_long': 'Parameter {param} is too long (max {max} characters)',
+        'name_too_long': 'Name is too long (max {max} characters)',
+        'name_invalid_chars': 'Name contains unsupported characters: {chars}',
+        'length_required': 'Content-Length header is required',
+        'payload_too_large': 'Request body too large (max {max_bytes} bytes)',
+        'invalid_json': 'Request body is not valid JSON',
+        'person_not_found': 'No timeline found for this person',
+        'person_invalid': 'Person data failed validation: {reason}',
+        'refresh_empty': 'The AI returned no events for {name}; the existing record was kept',
+        'route_not_found': 'Endpoint not found',
+        'method_not_allowed': 'Method not allowed for this endpoint',
+        'unauthorized': 'Unauthorized: a valid admin token is required',
+        'admin_disabled': 'Admin endpoints are disabled: configure ADMIN_TOKEN',
+        'upstream_timeout': 'The AI service timed out, please retry later',
+        'generation_timeout': 'Generation did not finish within {timeout_sec}s and continues in the background, please retry later',
+        'upstream_rate_limited': 'The AI service is rate limited, please retry later',
+        'upstream_unavailable': 'The AI service is unavailable',
+        'internal_error': 'Internal server error',
+        'generation_disabled': 'AI generation is currently disabled; only existing persons are available',
+        'read_only': 'The service is in read-only mode; data changes are not accepted',
+        'maintenance': 'The service is under maintenance; please try again later',
+        'person_exists': 'A person with this name already exists: {name}',
+        'event_not_found': 'Event not found: {name} #{index}',
+        'unsupported_media': 'Unsupported file type; only JPEG, PNG, GIF, WebP or PDF are accepted',
+        'invalid_media_url': 'Invalid media URL: use an http(s) URL or an uploaded /media/ file',
+        'too_many_media': 'At most {max} attachments per event',
+        'unknown_tile_provider': 'Unknown tile provider: {provider}',
+        'proxy_url_not_allowed': 'Only external images referenced by event media can be proxied',
+        'proxy_rate_limited': 'Too many requests to upstream {host}, please retry later',
+        'proxy_upstream_error': 'Failed to fetch the upstream image: {reason}',
+        'proxy_upstream_timeout': 'Timed out fetching the upstream image: {host}',
+        'tts_unavailable': 'Speech synthesis is not enabled',
+        'tts_timeout': 'Speech synthesis timed out, please retry later',
+        'tts_failed': 'Speech synthesis failed: {reason}',
+        'embedding_failed': 'Failed to compute embeddings: {reason}',
+        'job_running': 'An analysis job is already running, please retry later',
+        'cluster_not_found': 'Cluster not found: {id}',
+        'job_not_found': 'Job not found or expired: {id}',
+        'unknown_flag': 'Unknown feature flag: {name}',
+        'unknown_setting': 'Setting cannot be changed at runtime: {key}',
+        'flush_failed': 'Flush failed; changes are kept in memory and will be retried on the next flush',
+        'flush_cancelled': 'The request timed out before flushing; changes will be written by the next periodic flush',
+        'client_rate_limited': 'Too many requests (max {limit_per_min} per minute), please retry later',
+        'quota_exceeded': 'Daily {quota} quota exhausted ({key}: {used}/{limit}), resets in {reset_in_sec}s',
+        'api_key_invalid': 'Invalid API key',
+        'api_key_required': 'An API key is required (X-API-Key header)',
+    },
+}
+
+
+def default_lang() -> str:
+    lang = str(config.get('DEFAULT_LANG', 'zh-CN') or 'zh-CN')
+    return lang if lang in SUPPORTED else 'zh-CN'
+
+
+def pick_lang(accept_language: Optional[str]) -> str:
+    """解析 Accept-Language（含 q 权重），返回支持的语言中权重最高者。"""
+    candidates = []
+    for i, part in enumerate(str(accept_language or '').split(',')):
+        bits = part.strip().split(';')
+        tag = bits[0].strip().lower()
+        if not tag:
+            continue
+        q = 1.0
+        for b in bits[1:]:
+            b = b.strip()
+            if b.startswith('q='):
+                try:
+                    q = float(b[2:])
+                except Exception:
+                    q = 0.0
+        candidates.append((-q, i, tag))
+    for _, _, tag in sorted(candidates):
+        if tag.startswith('zh'):
+            return 'zh-CN'
+        if tag.startswith('en'):
+            return 'en'
+    return default_lang()
+
+
+def translate(key: str, lang: str, params: Optional[Dict[str, Any]] = None) -> str:
+    """未登记的 key 原样返回，便于渐进迁移。"""
+    table = MESSAGES.get(lang) or MESSAGES['zh-CN']
+    text = table.get(key) or MESSAGES['zh-CN'].get(key) or key
+    try:
+        return text.format(**(params or {}))
+    except Exception:
+        return text
@@ -0,0 +1,139 @@
+"""
+数据导入（不启动 HTTP 服务）
+
+    python index.py import 文件... [--dry-run] [--on-conflict replace|skip]
+
+- .json：{"persons": [...]} 或人物数组
+- .csv：表头含 name/姓名，其余列同导出格式（year, age, place, lat, lon, title, detail），同名行合并为一个人物；
+  只有姓名列时仅登记姓名
+- .xls：读取首个工作表的姓名列（需安装 xlrd），仅登记姓名
+- 仅登记的姓名以空轨迹保存，首次查询时按需生成；已有轨迹的人物不会被空轨迹覆盖
+"""
+
+import os
+import csv
+import sys
+import json
+import argparse
+from typing import Any, Dict, List
+
+from textnorm import normalize_name, name_key
+import integrity
+import datacheck
+
+try:
+    import xlrd
+except Exception:
+    xlrd = None
+
+NAME_HEADERS = ('姓名', '人物', '人名', 'name')
+NUMERIC_COLUMNS = ('year', 'age', 'lat', 'lon')
+
+
+def _is_name_header(h: str) -> bool:
+    h = str(h).strip().lower()
+    return any(k in h for k in NAME_HEADERS)
+
+
+def read_excel_names(path: str) -> List[str]:
+    """读取 Excel 首个工作表的姓名列（按表头识别，默认第一列）。"""
+    if not xlrd:
+        raise RuntimeError('读取 .xls 需要安装 xlrd')
+    wb = xlrd.open_workbook(path)
+    sh = wb.sheet_by_index(0)
+    name_col = 0
+    if sh.nrows:
+        for c in range(sh.ncols):
+            if _is_name_header(sh.cell_value(0, c)):
+                name_col = c
+                break
+    names = []
+    for r in range(1, sh.nrows):
+        val = sh.cell_value(r, name_col)
+        if isinstance(val, str) and val.strip():
+            names.append(normalize_name(val))
+    return names
+
+
+def _coerce(col: str, val: str) -> Any:
+    val = (val or '').strip()
+    if col in NUMERIC_COLUMNS and val:
+        try:
+            num = float(val)
+            return int(num) if num.is_integer() and col in ('year', 'age') else num
+        except ValueError:
+            return val
+    return val
+
+
+def read_csv_persons(path: str) -> List[Dict[str, Any]]:
+    with open(path, 'r', encoding='utf-8-sig', newline='') as f:
+        rows = list(csv.DictReader(f))
+    if not rows:
+        return []
+    name_col = next((c for c in rows[0].keys() if c and _is_name_header(c)), None)
+    if not name_col:
+        raise ValueError(f'{path} 缺少姓名列')
+    persons: Dict[str, Dict[str, Any]] = {}
+    for row in rows:
+        name = normalize_name(row.get(name_col) or '')
+        if not name:
+            continue
+        p = persons.setdefault(name_key(name), {'name': name, 'events': []})
+        event = {c: _coerce(c, v) for c, v in row.items() if c and c != name_col}
+        if any(v != '' for v in event.values()):
+            p['events'].append(event)
+    return list(persons.values())
+
+
+def read_json_persons(path: str) -> List[Dict[str, Any]]:
+    with open(path, 'r', encoding='utf-8') as f:
+        data = json.load(f)
+    if isinstance(data, list):
+        data = {'persons': data}
+    problem = integrity.validate_people(data)
+    if problem:
+        raise ValueError(f'{path} 结构异常：{problem}')
+    return data['persons']
+
+
+def read_file(path: str) -> List[Dict[str, Any]]:
+    ext = os.path.splitext(path)[1].lower()
+    if ext == '.json':
+        return read_json_persons(path)
+    if ext == '.csv':
+        return read_csv_persons(path)
+    if ext in ('.xls', '.xlsx'):
+        return [{'name': n, 'events': []} for n in read_excel_names(path)]
+    raise ValueError(f'不支持的文件类型：{path}')
+
+
+def main(argv: List[str], cache, read=read_file) -> int:
+    parser = argparse.ArgumentParser(prog='index.py import', description='导入人物与轨迹数据')
+    parser.add_argument('files', nargs='+', help='.json / .csv / .xls 文件')
+    parser.add_argument('--dry-run', action='store_true', help='只输出报告，不写入 people.json')
+    parser.add_argument('--on-conflict', choices=('replace', 'skip'), default='replace',
+                        help='已有轨迹的人物：replace 覆盖（默认），skip 保留原数据')
+    args = parser.parse_args(argv)
+
+    incoming: List[Dict[str, Any]] = []
+    failed = 0
+    for path in args.files:
+        try:
+            persons = read(path)
+        except Exception as e:
+            print(f'读取失败：{path}：{e}', file=sys.stderr)
+            failed += 1
+            continue
+        print(f'{path}：{len(persons)} 个人物', file=sys.stderr)
+        incoming.extend(persons)
+
+    for p in incoming:
+        p['events'] = datacheck.normalize_events(p.get('events') or [])
+    report = cache.import_persons(incoming, on_conflict=args.on_conflict, dry_run=args.dry_run)
+    written = None if args.dry_run else cache.flush()
+    report['files_failed'] = failed
+    report['dry_run'] = args.dry_run
+    report['written_persons'] = written
+    print(json.dumps(report, ensure_ascii=False, indent=2))
+    return 1 if failed else 0
@@ -8,24 +8,169 @@
   3) 设置 CORS 头以允许前端从不同端口访问
 """
 
-from http.server import BaseHTTPRequestHandler, HTTPServer
+from http.server import BaseHTTPRequestHandler
 import json
 import os
+import email.utils
+import signal
+import socket
+import sys
+import ssl
+import time
 import threading
 import logging
-from urllib.parse import urlparse
-from typing import Dict, Any
+from urllib.parse import urlparse, parse_qs, unquote
+from typing import Dict, Any, List, Optional
+import accesslog
+import analytics
+import clusters
+import assets
 import config
 import routes
-from cache import Cache
+import deepseek
+import dynasty
+import embeddings
+import listeners
+import media
+import narration
+import proxy
+import quotas
+import search
+import usage
+import ws
+import logsetup
+import systemd
+import static
+import errorreport
+import grpcapi
+import handover
+import health
+import migrate
+import middleware
+import replaylog
+import router
+import reqctx
+import services
+from flags import FLAGS
 
 ROOT = os.path.dirname(__file__)  # 项目根目录
 # 文档目录优先使用 docs，否则回退为 doc（兼容旧结构）
 DATA_DIR = os.path.join(ROOT, 'data') if os.path.isdir(os.path.join(ROOT, 'data')) else os.path.join(ROOT, 'doc')
+# 姓名表格目录，可通过 EXCEL_DIR 覆盖
+EXCEL_DIR = config.get_excel_dir(DATA_DIR)
+
+# 前端静态资源根目录，可通过 FRONTEND_DIR 覆盖
+FRONTEND_ROOT = config.get_frontend_dir(os.path.join(os.path.dirname(ROOT), 'frontend'))
+# 前端资源指纹：改写引用并为带版本号的请求输出长期缓存头（见 assets.py）
+ASSETS = assets.Assets(FRONTEND_ROOT, enabled=config.get_asset_fingerprint_enabled())
+# 导出文件目录（内部使用），存在时挂载到 /exports/
+EXPORTS_ROOT = config.get_exports_dir(os.path.join(ROOT, 'data', 'exports'))
+# 事件附件目录，只读挂载到 /media/（见 media.py）
+MEDIA_ROOT = config.get_media_dir(os.path.join(ROOT, 'data', 'media'))
+# 语音解说音频缓存（见 narration.py）
+NARRATOR = narration.Narrator(config.get_narration_dir(os.path.join(ROOT, 'data', 'narration')), config.get_tts_provider())
+# 语义搜索的向量索引（见 embeddings.py）
+EMBEDDINGS = embeddings.EmbeddingIndex(config.get_embedding_index_file(os.path.join(ROOT, 'data', 'embeddings.json')),
+                                       embeddings.build_embedder(config.get_embedding_provider()))
+# 按 API Key 的每日配额（见 quotas.py）与按租户的用量记账（见 usage.py）
+USAGE = usage.UsageLedger(os.path.join(ROOT, 'data', 'usage.json'))
+QUOTAS = quotas.QuotaStore(os.path.join(ROOT, 'data', 'quotas.json'), USAGE)
+# 全文检索（见 search.py），目前线性扫描缓存中的人物
+SEARCH = search.LinearSearch(lambda: (APP.cache.get_people_or_fallback(APP.fallback) or {}).get('persons') or [])
+# 时空聚类分析任务（见 clusters.py）
+CLUSTER_JOB = clusters.ClusterJob(os.path.join(ROOT, 'data', 'clusters.json'))
+# 瓦片与外部图片代理（见 proxy.py）
+TILE_PROVIDERS = config.get_tile_providers(proxy.DEFAULT_PROVIDERS)
+PROXY = proxy.Proxy(proxy.DiskCache(config.get_proxy_cache_dir(os.path.join(ROOT, 'data', 'proxy-cache')), config.get_proxy_cache_max_bytes()),
+                    config.get_proxy_upstream_rate_per_sec(), config.get_proxy_max_bytes())
+# 只读的 gRPC 服务（见 grpcapi.py），配置 GRPC_LISTEN 时随 HTTP 监听一起启动
+GRPC_SERVICE = grpcapi.PeopleService(lambda: APP)
+GRPC_SERVER = None
+_replay_file = config.get_replay_log_file()
+REPLAY_LOG = replaylog.ReplayLog(_replay_file, config.get_replay_log_max_bytes(), config.get_replay_log_sample()) if _replay_file else None
+
+# API 路由表：路径 → (允许的方法, 分组, 处理函数)；处理函数在请求时取 APP，便于测试替换（见 testsupport.py）。
+# 路径中的 {参数} 匹配单段（URL 解码后存入 handler.route_params），精确路径优先，见 router.py
+API_ROUTES = {
+    # POST/PUT 为人工录入，处理函数内校验管理令牌与只读模式
+    '/api/person': (('GET', 'POST', 'PUT'), 'public', lambda h: routes.handle_person(h, APP, logger=logger)),
+    '/api/names': (('GET',), 'public', lambda h: routes.handle_names(h, APP)),
+    '/api/names/suggest': (('GET',), 'public', lambda h: routes.handle_names_suggest(h, APP)),
+    '/api/people': (('GET',), 'public', lambda h: routes.handle_people(h, APP)),
+    '/api/people/changes': (('GET',), 'public', lambda h: routes.handle_people_changes(h, APP)),
+    '/api/people/batch': (('POST',), 'public', lambda h: routes.handle_people_batch(h, APP, logger=logger)),
+    '/api/person/generate': (('POST',), 'public', lambda h: routes.handle_person_generate(h, APP, logger=logger)),
+    '/api/jobs/{id}': (('GET',), 'public', routes.handle_job),
+    '/api/overlap': (('GET',), 'public', lambda h: routes.handle_overlap(h, APP, logger=logger)),
+    '/api/compare': (('GET',), 'public', lambda h: routes.handle_compare(h, APP, logger=logger)),
+    '/api/timeline/merged': (('GET',), 'public', lambda h: routes.handle_timeline_merged(h, APP, logger=logger)),
+    '/api/query/colocation': (('GET',), 'public', lambda h: routes.handle_colocation(h, APP)),
+    '/api/snapshot': (('GET',), 'public', lambda h: routes.handle_snapshot(h, APP)),
+    '/api/person/{name}/path': (('GET',), 'public', lambda h: routes.handle_person_path(h, APP, logger=logger)),
+    '/api/stats': (('GET',), 'public', lambda h: routes.handle_stats(h, APP)),
+    '/api/dynasty': (('GET',), 'public', routes.handle_dynasty),
+    '/api/openapi.json': (('GET',), 'public', lambda h: routes.handle_openapi(h, API_ROUTES)),
+    '/api/person/{name}/export': (('GET',), 'public', lambda h: routes.handle_person_export(h, APP, logger=logger)),
+    '/api/person/{name}/report.pdf': (('GET',), 'public', lambda h: routes.handle_person_report(h, APP, logger=logger)),
+    '/api/person/{name}/narration': (('GET',), 'public', lambda h: routes.handle_person_narration(h, APP, NARRATOR, logger=logger)),
+    '/api/person/{name}/related': (('GET',), 'public', lambda h: routes.handle_person_related(h, APP, logger=logger)),
+    '/api/search': (('GET',), 'public', lambda h: routes.handle_search(h, SEARCH)),
+    '/api/search/semantic': (('GET',), 'public', lambda h: routes.handle_semantic_search(h, EMBEDDINGS)),
+    '/api/analysis/clusters': (('GET',), 'public', lambda h: routes.handle_clusters(h, CLUSTER_JOB)),
+    '/api/analysis/clusters/{id}': (('GET',), 'public', lambda h: routes.handle_cluster(h, CLUSTER_JOB)),
+    '/api/aliases': (('GET',), 'public', lambda h: routes.handle_aliases(h, APP)),
+    '/api/tiles/{provider}/{z}/{x}/{y}': (('GET',), 'proxy', lambda h: routes.handle_tile(h, PROXY, TILE_PROVIDERS)),
+    '/api/proxy/image': (('GET',), 'proxy', lambda h: routes.handle_proxy_image(h, APP, PROXY)),
+    '/api/person/rename': (('POST',), 'admin_write', lambda h: routes.handle_person_rename(h, APP)),
+    '/api/person/{name}/events': (('POST',), 'admin_write', lambda h: routes.handle_person_event(h, APP, logger=logger)),
+    '/api/person/{name}/events/{id}': (('PATCH', 'DELETE'), 'admin_write',
+                                       lambda h: routes.handle_person_event(h, APP, logger=logger)),
+    '/api/person/{name}/events/{id}/media': (('POST', 'DELETE'), 'admin_write',
+                                                lambda h: routes.handle_event_media(h, APP, MEDIA_ROOT)),
+    # 按需翻译会写入缓存，但供前端直接调用，不要求管理令牌（只读模式下拒绝）
+    '/api/person/{name}/translate': (('POST',), 'public', lambda h: routes.handle_person_translate(h, APP, logger=logger)),
+    '/api/person/{name}/translations/{lang}': (('POST', 'DELETE'), 'admin_write',
+                                               lambda h: routes.handle_person_translation(h, APP)),
+    '/api/admin/media': (('POST',), 'admin_write', lambda h: routes.handle_admin_media_upload(h, MEDIA_ROOT)),
+    '/api/admin/stats': (('GET',), 'admin', lambda h: routes.handle_admin_stats(h, APP)),
+    '/api/admin/cache-stats': (('GET',), 'admin', lambda h: routes.handle_admin_cache_stats(h, APP)),
+    '/api/admin/flags': (('GET', 'POST'), 'admin', routes.handle_admin_flags),
+    '/api/admin/analytics': (('GET', 'DELETE'), 'admin', lambda h: routes.handle_admin_analytics(h, APP)),
+    '/api/admin/quotas': (('GET', 'POST', 'DELETE'), 'admin', lambda h: routes.handle_admin_quotas(h, QUOTAS)),
+    '/api/admin/usage': (('GET',), 'admin', lambda h: routes.handle_admin_usage(h, USAGE)),
+    '/api/admin/log-levels': (('GET', 'POST'), 'admin', routes.handle_admin_log_levels),
+    '/api/admin/settings': (('GET', 'POST'), 'admin', routes.handle_admin_settings),
+    '/api/admin/flush': (('POST',), 'admin_write', lambda h: routes.handle_admin_flush(h, APP)),
+    '/api/admin/cache/person': (('DELETE',), 'admin_write', lambda h: routes.handle_admin_evict_person(h, APP)),
+    '/api/admin/embeddings/rebuild': (('POST',), 'admin', lambda h: routes.handle_admin_embeddings_rebuild(h, APP, EMBEDDINGS)),
+    '/api/admin/analysis/clusters': (('POST',), 'admin', lambda h: routes.handle_admin_clusters_run(h, APP, CLUSTER_JOB)),
+    '/api/admin/reload-names': (('POST',), 'admin_write', lambda h: routes.handle_admin_reload_names(h, APP, EXCEL_DIR)),
+}
+# 各分组的中间件链（靠前者在外层）；CORS 由 _set_headers 统一输出
+API_CHAINS = {
+    'public': middleware.chain(middleware.access_log(REPLAY_LOG), middleware.request_context, middleware.recover,
+                               middleware.compress_json, middleware.maintenance, middleware.rate_limit(),
+                               middleware.quota(QUOTAS)),
+    'admin': middleware.chain(middleware.access_log(REPLAY_LOG), middleware.request_context, middleware.recover,
+                              middleware.compress_json, middleware.require_admin),
+    # 修改数据的管理接口：只读模式下拒绝
+    'admin_write': middleware.chain(middleware.access_log(REPLAY_LOG), middleware.request_context, middleware.recover,
+                                    middleware.compress_json, middleware.require_admin, middleware.read_only),
+    # 瓦片与图片代理：请求量大且有上游限流兜底，不按客户端限流
+    'proxy': middleware.chain(middleware.access_log(REPLAY_LOG), middleware.request_context, middleware.recover),
+    'error': middleware.chain(middleware.access_log(REPLAY_LOG), middleware.request_context, middleware.recover),
+}
+# 路由器由各监听的 server 持有（httpd.router），见 router.py
+ROUTER = router.Router(API_ROUTES, API_CHAINS)
+API_VERSION_PREFIX = '/api/' + routes.API_VERSION + '/'
+
+
+def _api_path(path: str) -> str:
+    # /api/v1/... 为正式路径，未带版本的 /api/... 保留为兼容别名；路由表按未带版本的路径登记
+    if path.startswith(API_VERSION_PREFIX):
+        return '/api/' + path[len(API_VERSION_PREFIX):]
+    return path
 
-FRONTEND_ROOT =  os.path.join(os.path.dirname(ROOT), 'frontend')
-# 模块级缓存对象（封装）
-CACHE_OBJ = Cache()
 
 # 内存缓存
 CACHE: Dict[str, Any] = {
@@ -35,6 +180,18 @@ CACHE: Dict[str, Any] = {
 }
 
 CACHE_LOCK = threading.Lock()
+access_logger = logging.getLogger('access')
+ACCESS_LOG_FORMAT = config.get_access_log_format()
+
+# 生命周期：READY 在数据加载且监听就绪后置位；DRAINING 在收到停止信号后置位（/readyz 随即失败）
+READY = threading.Event()
+DRAINING = threading.Event()
+STOP = threading.Event()
+RELOAD = threading.Event()  # SIGHUP：交接监听套接字给新进程（见 handover.py）
+MERGE = threading.Event()   # SIGUSR1：旧进程已完成最后落盘，从 people.json 并入交接期间新增的人物
+# 进行中的请求数（已读到请求行、尚未写完响应），交接后旧进程据此等待
+INFLIGHT = [0]
+INFLIGHT_LOCK = threading.Lock()
 
 
 def read_people_json():
@@ -83,111 +240,718 @@ FALLBACK = {
     ]
 }
 
+# 应用容器：缓存与各外部服务按 APP_PROFILE 装配（见 services.py）
+APP = services.build_app(FALLBACK)
+
 
 class Handler(BaseHTTPRequestHandler):
     # 静态资源根目录改为项目根目录，默认渲染 frontend/index.html
     ROOT = os.path.dirname(os.path.dirname(__file__))
+    # 头部与正文分两次写出，关闭 Nagle 以免与客户端延迟 ACK 叠加产生约 40ms 的额外延迟
+    disable_nagle_algorithm = True
     MIME = {
         '.html': 'text/html; charset=utf-8',
         '.js': 'application/javascript; charset=utf-8',
         '.css': 'text/css; charset=utf-8',
         '.json': 'application/json; charset=utf-8',
+        '.geojson': 'application/geo+json; charset=utf-8',
+        '.csv': 'text/csv; charset=utf-8',
         '.png': 'image/png',
         '.jpg': 'image/jpeg',
         '.jpeg': 'image/jpeg',
+        '.gif': 'image/gif',
+        '.webp': 'image/webp',
+        '.pdf': 'application/pdf',
         '.svg': 'image/svg+xml',
+        '.mp4': 'video/mp4',
+        '.webm': 'video/webm',
+        '.mp3': 'audio/mpeg',
+        '.wav': 'audio/wav',
         '.xls': 'application/vnd.ms-excel',
         '.xlsx': 'application/vnd.openxmlformats-officedocument.spreadsheetml.sheet'
     }
 
-    def _set_headers(self, code=200, content_type='application/json', cors=True):
+    def parse_request(self):
+        self._req_start = time.perf_counter()
+        with INFLIGHT_LOCK:
+            INFLIGHT[0] += 1
+        self._inflight = True
+        return super().parse_request()
+
+    def send_header(self, keyword, value):
+        # 记录响应体长度与请求 ID，供访问日志使用
+        key = keyword.lower()
+        if key == 'content-length':
+            self._resp_length = str(value)
+        elif key == 'x-request-id':
+            self._resp_rid = str(value)
+        super().send_header(keyword, value)
+
+    def log_request(self, code='-', size='-'):
+        # send_response 时只记下状态码，请求处理完后再写访问日志（此时才知道长度与耗时）
+        self._access_code = getattr(code, 'value', code)
+
+    def handle_one_request(self):
+        self._req_start = time.perf_counter()
+        self._access_code = self._resp_length = self._resp_rid = None
+        self._inflight = False
+        try:
+            super().handle_one_request()
+        finally:
+            if self._inflight:
+                with INFLIGHT_LOCK:
+                    INFLIGHT[0] -= 1
+        if self._access_code is not None:
+            self._write_access_log()
+
+    def _write_access_log(self):
+        # 访问日志走 access 组件（Combined Log Format 或 JSON，见 accesslog.py），可单独调整级别与输出目的地
+        if not access_logger.isEnabledFor(logging.INFO):
+            return
+        headers = getattr(self, 'headers', None)
+        e = accesslog.entry(self.address_string(), self.requestline, self.command, urlparse(getattr(self, 'path', '')).path,
+                            self.request_version, self._access_code,
+                            None if self.command == 'HEAD' else self._resp_length,
+                            headers.get('Referer') if headers else None, headers.get('User-Agent') if headers else None,
+                            time.perf_counter() - self._req_start, self._resp_rid)
+        access_logger.info(accesslog.format_entry(e, ACCESS_LOG_FORMAT))
+
+    def log_message(self, format, *args):
+        # 其余服务器消息（请求超时、请求行非法等）记入应用日志
+        logging.getLogger('api').warning("%s - %s", self.address_string(), format % args)
+
+    def address_string(self):
+        # Unix 套接字连接没有 (host, port) 形式的客户端地址
+        if isinstance(self.client_address, tuple) and self.client_address:
+            return str(self.client_address[0])
+        return 'unix'
+
+    def _set_headers(self, code=200, content_type='application/json', cors=True, length=None, headers=None):
+        self._status = code
         self.send_response(code)
-        self.send_header('Content-Type', content_type)
+        if code != 304:
+            self.send_header('Content-Type', content_type)
+        for k, v in (headers or {}).items():
+            self.send_header(k, v)
+        ctx = getattr(self, 'ctx', None)
+        if ctx is not None:
+            self.send_header('X-Request-ID', ctx.request_id)
+        if DRAINING.is_set():
+            # 排空期间不再复用连接，促使负载均衡将后续请求发往其他实例
+            self.send_header('Connection', 'close')
+            self.close_connection = True
+        if length is not None:
+            self.send_header('Content-Length', str(length))
+        elif code != 304 and self.request_version != 'HTTP/1.0' and self.protocol_version == 'HTTP/1.1':
+            # 未知长度时关闭连接以界定响应结束（keep-alive 需要 Content-Length）
+            self.send_header('Connection', 'close')
+            self.close_connection = True
         if cors:
             # CORS 允许跨端口访问（仅对 API 必须，静态资源也无害）
             self.send_header('Access-Control-Allow-Origin', '*')
-            self.send_header('Access-Control-Allow-Methods', 'GET, OPTIONS')
-            self.send_header('Access-Control-Allow-Headers', 'Content-Type')
+            self.send_header('Access-Control-Allow-Methods', 'GET, POST, PUT, PATCH, DELETE, OPTIONS')
+            self.send_header('Access-Control-Allow-Headers', 'Content-Type, Authorization, X-Admin-Token, X-API-Key, X-Request-ID, If-None-Match')
+            self.send_header('Access-Control-Expose-Headers', 'X-Request-ID, Retry-After, Content-Disposition, X-Quota-Limit, X-Quota-Remaining, ETag')
         self.end_headers()
 
-    def _safe_path(self, url_path: str):
-        # 将 URL 路径安全映射到本地文件路径，防止目录穿越
-        rel = url_path.lstrip('/') or 'index.html'
-        fs_path = os.path.normpath(os.path.join(FRONTEND_ROOT, rel))
-        if not fs_path.startswith(FRONTEND_ROOT):
-            return None
-        return fs_path
-
-    def _serve_file(self, fs_path: str):
+    def _serve_file(self, fs_path: str, head_only: bool = False, cache_control: str = ''):
         if not fs_path or not os.path.isfile(fs_path):
-            self._set_headers(404, 'text/plain; charset=utf-8', cors=False)
-            self.wfile.write(b'Not Found')
+            self._set_headers(404, 'text/plain; charset=utf-8', cors=False, length=9)
+            if not head_only:
+                self.wfile.write(b'Not Found')
             return
         ext = os.path.splitext(fs_path)[1].lower()
         ctype = self.MIME.get(ext, 'application/octet-stream')
+        compress = config.get_static_compress_enabled()
+        encoding = None
+        serve_path = fs_path
+        # Range 请求始终按原始字节响应；否则优先使用预压缩的 .br/.gz 兄弟文件
+        if compress and not self.headers.get('Range'):
+            try:
+                variant, coding = static.pick_precompressed(self.headers, fs_path, os.path.getmtime(fs_path))
+            except Exception:
+                variant, coding = None, None
+            if variant:
+                serve_path, encoding = variant, coding
         try:
-            with open(fs_path, 'rb') as f:
-                data = f.read()
-            self._set_headers(200, ctype, cors=False)
-            self.wfile.write(data)
+            f = open(serve_path, 'rb')
         except Exception:
-            self._set_headers(500, 'text/plain; charset=utf-8', cors=False)
-            self.wfile.write(b'Internal Server Error')
+            self._set_headers(500, 'text/plain; charset=utf-8', cors=False, length=21)
+            if not head_only:
+                self.wfile.write(b'Internal Server Error')
+            return
+        with f:
+            st = os.fstat(f.fileno())
+            size = st.st_size
+            etag = static.file_etag(st)
+            last_modified = email.utils.formatdate(st.st_mtime, usegmt=True)
+            # 无预压缩文件时，对大小适中的文本类资源即时压缩（br 或 gzip）
+            body = None
+            if (compress and encoding is None and not self.headers.get('Range') and static.is_compressible(ctype)
+                    and config.get_compress_min_bytes() <= size <= config.get_compress_max_bytes()):
+                encoding = static.choose_encoding(self.headers, config.get_compress_brotli_enabled())
+            if encoding:
+                etag = etag[:-1] + '-' + encoding + '"'
+            if static.is_not_modified(self.headers, etag, st.st_mtime):
+                self.send_response(304)
+                self.send_header('ETag', etag)
+                self.send_header('Last-Modified', last_modified)
+                if cache_control:
+                    self.send_header('Cache-Control', cache_control)
+                if compress:
+                    self.send_header('Vary', 'Accept-Encoding')
+                self.end_headers()
+                return
+            if encoding and serve_path == fs_path:
+                body = static.compress(f.read(), encoding)
+                size = len(body)
+            rng = None if encoding else static.parse_range(self.headers, size, etag, last_modified)
+            if rng is False:
+                self.send_response(416)
+                self.send_header('Content-Range', f'bytes */{size}')
+                self.send_header('Content-Length', '0')
+                self.end_headers()
+                return
+            start, end = rng if rng else (0, size - 1)
+            length = max(0, end - start + 1)
+            self.send_response(206 if rng else 200)
+            self.send_header('Content-Type', ctype)
+            self.send_header('Content-Length', str(length))
+            self.send_header('Accept-Ranges', 'bytes')
+            self.send_header('ETag', etag)
+            self.send_header('Last-Modified', last_modified)
+            if cache_control:
+                self.send_header('Cache-Control', cache_control)
+            if encoding:
+                self.send_header('Content-Encoding', encoding)
+            if compress:
+                self.send_header('Vary', 'Accept-Encoding')
+            if rng:
+                self.send_header('Content-Range', f'bytes {start}-{end}/{size}')
+            self.end_headers()
+            if head_only:
+                return
+            if body is not None:
+                self.wfile.write(body)
+                return
+            # 分块写出，避免大文件整体读入内存
+            f.seek(start)
+            static.copy_range(f, self.wfile, length)
 
     def do_OPTIONS(self):
         # 处理预检请求
-        self._set_headers(200)
+        self._set_headers(200, length=0)
+
+    def _route_allowed(self, path: str) -> bool:
+        # 按路由分组判断（而非路径前缀），/api/ 之外的路径视为非管理路由
+        group = self._router().group(path) if path.startswith('/api/') else None
+        return listeners.route_allowed(getattr(self.server, 'route_scope', 'all'), group)
+
+    def _exports_allowed(self) -> bool:
+        # 导出目录是内部数据：需显式开启（EXPORTS_SERVE_ENABLED），且不在 public 监听上提供
+        return (config.get_exports_serve_enabled() and getattr(self.server, 'route_scope', 'all') in ('all', 'admin')
+                and os.path.isdir(EXPORTS_ROOT))
+
+    def _serve_ws(self):
+        # 缓存变更推送（见 ws.py）：长连接不计入进行中的请求，停机与交接时不等待它结束
+        if self._inflight:
+            with INFLIGHT_LOCK:
+                INFLIGHT[0] -= 1
+            self._inflight = False
+        self._access_code = None
+        ws.HUB.serve(self)
+
+    def _livez(self, head_only: bool = False):
+        # 存活探针（/livez，/healthz 为同义路径）：只证明 HTTP 循环仍在处理请求，不访问缓存锁与任何上游
+        self._write_probe(200, {"status": "ok"}, head_only)
+
+    def _readyz(self, head_only: bool = False):
+        # 就绪探针：启动完成前与排空期间返回 503，编排系统据此摘除流量；各组件状态见 health.py
+        if DRAINING.is_set():
+            phase = 'draining'
+        elif not READY.is_set():
+            phase = 'starting'
+        else:
+            phase = 'ready'
+        code, body = health.READINESS.report(APP, phase)
+        self._write_probe(code, body, head_only)
+
+    def _write_probe(self, code: int, payload: Dict[str, Any], head_only: bool):
+        body = json.dumps(payload, ensure_ascii=False).encode('utf-8')
+        self.send_response(code)
+        self.send_header('Content-Type', 'application/json')
+        self.send_header('Content-Length', str(len(body)))
+        self.send_header('Cache-Control', 'no-store')
+        self.end_headers()
+        if not head_only:
+            self.wfile.write(body)
 
     def do_GET(self):
         parsed = urlparse(self.path)
-        if parsed.path == '/api/person':
-            routes.handle_person(self, CACHE_OBJ, FALLBACK, logger=logger)
-        elif parsed.path == '/api/names':
-            routes.handle_names(self, CACHE_OBJ)
-        elif parsed.path == '/api/people':
-            routes.handle_people(self, CACHE_OBJ, FALLBACK)
+        path = _api_path(parsed.path)
+        if parsed.path in ('/livez', '/healthz'):
+            self._livez()
+        elif parsed.path == '/readyz':
+            self._readyz()
+        elif parsed.path == '/exports' or parsed.path.startswith('/exports/'):
+            if self._exports_allowed():
+                self._serve_static(EXPORTS_ROOT, parsed.path[len('/exports'):], parsed)
+            else:
+                self._serve_file(None)
+        elif not self._route_allowed(path):
+            # 当前监听不开放该路由（如公网端口上的管理接口），按不存在处理
+            if path.startswith('/api/'):
+                self._router().not_found(self)
+            else:
+                self._serve_file(None)
+        elif path.startswith('/api/'):
+            self._dispatch_api(path)
+        elif parsed.path == '/ws':
+            self._serve_ws()
+        elif parsed.path.startswith(media.URL_PREFIX):
+            self._serve_file(media.local_path(MEDIA_ROOT, unquote(parsed.path)))
         else:
             # 静态文件渲染：支持 / 、/index.html 以及项目内其他资源
-            if parsed.path in ('/', ''):
-                fs_path = self._safe_path('index.html')
+            self._serve_static(FRONTEND_ROOT, parsed.path, parsed)
+
+    def do_POST(self):
+        # 写操作仅限路由表中声明了该方法的接口，其余路径返回 405
+        path = _api_path(urlparse(self.path).path)
+        if not path.startswith('/api/') or not self._route_allowed(path):
+            self._router().not_found(self)
+        else:
+            self._dispatch_api(path)
+
+    def do_DELETE(self):
+        # 同 POST：仅路由表中声明了 DELETE 的接口
+        self.do_POST()
+
+    def do_PUT(self):
+        self.do_POST()
+
+    def do_PATCH(self):
+        self.do_POST()
+
+    def do_HEAD(self):
+        # 仅静态资源支持 HEAD（便于下载工具探测大小与 Range 支持）
+        parsed = urlparse(self.path)
+        path = _api_path(parsed.path)
+        if parsed.path in ('/livez', '/healthz'):
+            self._livez(head_only=True)
+        elif parsed.path == '/readyz':
+            self._readyz(head_only=True)
+        elif parsed.path == '/exports' or parsed.path.startswith('/exports/'):
+            if self._exports_allowed():
+                self._serve_static(EXPORTS_ROOT, parsed.path[len('/exports'):], parsed, head_only=True)
             else:
-                fs_path = self._safe_path(parsed.path)
-            self._serve_file(fs_path)
+                self._serve_file(None, head_only=True)
+        elif not self._route_allowed(path):
+            self._serve_file(None, head_only=True)
+        elif path.startswith('/api/'):
+            self.send_response(405)
+            self.send_header('Allow', 'GET, OPTIONS')
+            self.send_header('Content-Length', '0')
+            self.end_headers()
+        elif parsed.path.startswith(media.URL_PREFIX):
+            self._serve_file(media.local_path(MEDIA_ROOT, unquote(parsed.path)), head_only=True)
+        else:
+            self._serve_static(FRONTEND_ROOT, parsed.path, parsed, head_only=True)
+
+    def _serve_static(self, root: str, rel_url: str, parsed, head_only: bool = False):
+        fs_path = static.resolve_static_path(root, rel_url, default='')
+        if not fs_path or not os.path.isdir(fs_path):
+            self._serve_asset(root, fs_path, parsed, head_only)
+            return
+        index_path = os.path.join(fs_path, 'index.html')
+        if os.path.isfile(index_path):
+            self._serve_asset(root, index_path, parsed, head_only)
+            return
+        if not config.get_dir_index_enabled():
+            self._serve_file(None, head_only)
+            return
+        if not parsed.path.endswith('/'):
+            # 目录需以 / 结尾，保证列表中的相对链接正确
+            self.send_response(301)
+            self.send_header('Location', parsed.path + '/' + (('?' + parsed.query) if parsed.query else ''))
+            self.send_header('Content-Length', '0')
+            self.end_headers()
+            return
+        if head_only:
+            self._set_headers(200, 'text/html; charset=utf-8', cors=False)
+            return
+        self._serve_listing(root, fs_path, parsed)
+
+    def _serve_asset(self, root: str, fs_path: str, parsed, head_only: bool = False):
+        # 前端资源按指纹清单决定缓存策略；引用已改写的 HTML/JS/CSS 从内存输出（见 assets.py）
+        body, cache_control, version = None, '', ''
+        if root == FRONTEND_ROOT and fs_path and os.path.isfile(fs_path):
+            body, cache_control, version = ASSETS.lookup(fs_path, (parse_qs(parsed.query).get('v') or [''])[0])
+        if body is None:
+            self._serve_file(fs_path, head_only, cache_control=cache_control)
+            return
+        ctype = self.MIME.get(os.path.splitext(fs_path)[1].lower(), 'application/octet-stream')
+        compress = config.get_static_compress_enabled()
+        encoding = None
+        if compress and static.is_compressible(ctype) and len(body) >= config.get_compress_min_bytes():
+            encoding = static.choose_encoding(self.headers, config.get_compress_brotli_enabled())
+        # 内容随依赖变化而源文件 mtime 不变，只按 ETag 协商，不输出 Last-Modified
+        etag = f'"{version}-{encoding}"' if encoding else f'"{version}"'
+        headers = {'ETag': etag, 'Cache-Control': cache_control}
+        if compress:
+            headers['Vary'] = 'Accept-Encoding'
+        if self.headers.get('If-None-Match') and static.is_not_modified(self.headers, etag, 0):
+            self.send_response(304)
+            for k, v in headers.items():
+                self.send_header(k, v)
+            self.end_headers()
+            return
+        if encoding:
+            body = static.compress(body, encoding)
+            headers['Content-Encoding'] = encoding
+        self._set_headers(200, ctype, cors=False, length=len(body), headers=headers)
+        if not head_only:
+            self.wfile.write(body)
+
+    def _serve_listing(self, root: str, fs_dir: str, parsed):
+        entries = static.list_directory(root, fs_dir)
+        fmt = (parse_qs(parsed.query).get('format') or [''])[0].lower()
+        wants_json = fmt == 'json' or (not fmt and 'application/json' in str(self.headers.get('Accept') or ''))
+        if wants_json:
+            body = json.dumps({"path": unquote(parsed.path), "entries": entries}, ensure_ascii=False).encode('utf-8')
+            ctype = 'application/json; charset=utf-8'
+        else:
+            body = static.render_listing_html(unquote(parsed.path), entries).encode('utf-8')
+            ctype = 'text/html; charset=utf-8'
+        self._set_headers(200, ctype, cors=False, length=len(body))
+        self.wfile.write(body)
+
+    def _router(self) -> router.Router:
+        return getattr(self.server, 'router', None) or ROUTER
+
+    def _dispatch_api(self, path: str):
+        # 按所属 server 的路由器分派，横切逻辑（日志、异常、鉴权、限流、压缩）由各分组的中间件链处理
+        self._router().dispatch(self, path)
+
+
+def _rebuild_embeddings():
+    try:
+        EMBEDDINGS.rebuild((APP.cache.get_people_or_fallback(FALLBACK) or {}).get('persons') or [])
+    except Exception as e:
+        logger.warning("向量索引更新失败：%s", e)
 
 
 def preload_cache():
     # 封装后的缓存预加载（people 与 names）
-    CACHE_OBJ.preload(ROOT, DATA_DIR, FALLBACK)
+    APP.cache.backup_keep = config.get_backup_keep()
+    APP.cache.preload(ROOT, EXCEL_DIR, FALLBACK, repair=config.get_data_repair_enabled() or '--repair' in sys.argv[1:])
+    FLAGS.load(os.path.join(ROOT, 'data', 'flags.json'))
+    dynasty.load_configured()
+    APP.cache.read_only = lambda: FLAGS.enabled('read_only')
+    APP.cache.subscribe(ws.HUB.publish)
+    manifest = ASSETS.manifest()
+    if manifest is not None:
+        logger.info("前端资源指纹：%d 个文件，改写引用 %d 个", len(manifest.versions), len(manifest.bodies))
+    if config.get_embedding_provider() == 'local':
+        # 本地向量计算开销小：启动后在后台增量更新索引（远程提供方需手动重建）
+        threading.Thread(target=_rebuild_embeddings, daemon=True).start()
+    report = APP.cache.integrity
+    if report['removed_tmp']:
+        logger.warning("已清理上次异常退出遗留的临时文件：%s", ', '.join(report['removed_tmp']))
+    if report['restored_from']:
+        logger.warning("people.json 已损坏，已从备份恢复：%s", report['restored_from'])
+    if APP.cache.people is not FALLBACK and migrate.pending(APP.cache.people):
+        logger.warning("people.json 的 schema 版本为 v%d，最新为 v%d，可执行 `python index.py migrate` 升级",
+                       migrate.schema_version(APP.cache.people), migrate.LATEST)
+
+def warm_up_cache():
+    # 按历史访问量预热热门人物：建立热门索引、用已有坐标预填地理编码缓存，缺失坐标的地点在后台补查
+    top = config.get_warmup_top_n()
+    if top <= 0:
+        return
+    persons = APP.cache.warm_up(top)
+    seeded = 0
+    missing: List[str] = []
+    for p in persons:
+        events = p.get('events') or []
+        seeded += deepseek.seed_geocode_cache(events)
+        for e in events:
+            if str(e.get('lat', '')).strip() == '' or str(e.get('lon', '')).strip() == '':
+                missing.append(str(e.get('place', '')))
+    logger.info("启动预热：热门人物 %d 个，预填地理编码 %d 条，待补查地点 %d 个", len(persons), seeded, len(missing))
+    limit = config.get_warmup_geocode_max()
+    if missing and limit > 0 and config.get_geocode_enabled():
+        threading.Thread(target=deepseek.prefetch_geocode, args=(missing, limit), daemon=True).start()
 
 def _start_flush_background():
     # 使用封装的缓存对象启动后台周期落盘线程
-    CACHE_OBJ.start_flush_thread(interval_sec=config.get_flush_interval_sec(), logger=logger)
+    APP.cache.start_flush_thread(interval_sec=config.get_flush_interval_sec(), logger=logger)
+    threading.Thread(target=_flush_stats_loop, name='stats-flush', daemon=True).start()
 
 
-def run(server_class=HTTPServer, handler_class=Handler):
-    # 日志配置
+def _flush_stats_loop():
+    # 查询热度统计、配额用量、用量账本与缓存同周期落盘
+    interval = config.get_flush_interval_sec()
+    while not STOP.wait(interval):
+        analytics.ANALYTICS.flush()
+        QUOTAS.flush()
+        USAGE.flush()
+
+
+def _maybe_enable_tls(httpd) -> str:
+    # 配置 TLS_CERT_FILE/TLS_KEY_FILE 时直接提供 HTTPS；http.server 不实现 HTTP/2，ALPN 只协商 http/1.1，
+    # 需要 HTTP/2 时由 nginx 终结（见 nginx.conf、deploy/nginx/tls.conf）
+    cert, key = config.get_tls_files()
+    if not cert:
+        return 'http'
+    ctx = ssl.SSLContext(ssl.PROTOCOL_TLS_SERVER)
+    ctx.minimum_version = ssl.TLSVersion.TLSv1_2
+    ctx.load_cert_chain(cert, key)
+    ctx.set_alpn_protocols(['http/1.1'])
+    # 握手延迟到处理线程中的首次读写，避免慢客户端阻塞 accept
+    httpd.socket = ctx.wrap_socket(httpd.socket, server_side=True, do_handshake_on_connect=False)
+    return 'https'
+
+
+def _setup_logging(level=None):
+    # 目的地、轮转与各组件级别见 logsetup.py；level 覆盖 LOG_LEVEL
     global logger
+    logsetup.configure(level)
     logger = logging.getLogger('api')
-    if not logger.handlers:
-        _h = logging.StreamHandler()
-        _h.setFormatter(logging.Formatter('%(asctime)s [%(levelname)s] api: %(message)s'))
-        logger.addHandler(_h)
-    logger.setLevel(logging.INFO)
-
-    port = config.get_port()
-    server_address = ('', port)
+
+
+def run(handler_class=Handler):
+    global GRPC_SERVER
+    # 日志配置与错误上报（未配置 SENTRY_DSN 时不启用）
+    _setup_logging()
+    errorreport.REPORTER.configure()
+    analytics.ANALYTICS.configure(os.path.join(ROOT, 'data', 'analytics.json'))
+
+    specs = listeners.parse_listeners(config.get_listen())
+    # 每个连接的 socket 读写超时；生成类接口另有整体时限（GENERATE_TIMEOUT_SEC）
+    handler_class.timeout = config.get_request_timeout_sec()
+    # HTTP/1.1 持久连接：前端并发的多个小请求可复用连接（HTTP/2 由前置 nginx 终结，见 nginx.conf）
+    if config.get_http_keepalive_enabled():
+        handler_class.protocol_version = 'HTTP/1.1'
     try:
         # 启动前预加载数据到内存
         preload_cache()
-        httpd = server_class(server_address, handler_class)
+        warm_up_cache()
+        servers = []
+        inherited = systemd.listen_sockets()
+        if inherited:
+            # systemd 套接字激活或 SIGHUP 交接：忽略 LISTEN 配置，使用继承的监听描述符
+            for sock, fd_name in inherited:
+                httpd = listeners.server_from_socket(sock, handler_class, fd_name, router=ROUTER)
+                scheme = _maybe_enable_tls(httpd) if sock.family != socket.AF_UNIX else 'http'
+                servers.append(httpd)
+                logger.info("API server listening on %s (inherited, scope=%s)", listeners.describe(httpd, scheme), httpd.route_scope)
+        for spec, scope in ([] if inherited else specs):
+            httpd = listeners.make_server(spec, handler_class, config.get_listen_socket_mode(), config.get_listen_socket_group(), scope,
+                                          router=ROUTER)
+            scheme = _maybe_enable_tls(httpd) if not spec.startswith('unix:') else 'http'
+            servers.append(httpd)
+            logger.info("API server listening on %s (scope=%s)", listeners.describe(httpd, scheme), scope)
         # 启动后台定时落盘（封装线程）
         _start_flush_background()
-        logger.info("API server listening on http://localhost:%s/api/people", port)
-        httpd.serve_forever()
+        for httpd in servers:
+            threading.Thread(target=httpd.serve_forever, daemon=True).start()
+        if config.get_grpc_listen():
+            GRPC_SERVER = grpcapi.serve(config.get_grpc_listen(), GRPC_SERVICE, config.get_grpc_max_workers(), logger)
+        signal.signal(signal.SIGTERM, lambda signum, frame: STOP.set())
+        signal.signal(signal.SIGINT, lambda signum, frame: STOP.set())
+        signal.signal(signal.SIGHUP, lambda signum, frame: RELOAD.set())
+        signal.signal(signal.SIGUSR1, lambda signum, frame: MERGE.set())
+        # 数据已加载、监听已就绪，通知 systemd（Type=notify）；由旧进程交接启动时同时通知旧进程退出
+        READY.set()
+        handover.notify_parent()
+        systemd.notify("READY=1\nSTATUS=serving %d persons" % APP.cache.summary().get('persons', 0))
     except Exception as e:
         # 显式打印错误，便于诊断启动失败
         logger.error("Failed to start API server: %s", repr(e))
+        errorreport.REPORTER.capture_exception(e, tags={'phase': 'startup'})
+        errorreport.REPORTER.flush()
+        sys.exit(1)
+    # 主线程等待停止或交接信号（带超时以便及时响应信号）
+    while not STOP.wait(1):
+        if MERGE.is_set():
+            MERGE.clear()
+            try:
+                added = APP.cache.merge_from_disk(ROOT)
+                logger.info("已并入交接期间新增的人物：%d 个", added)
+            except Exception as e:
+                logger.error("并入交接数据失败：%s", repr(e))
+        if RELOAD.is_set():
+            RELOAD.clear()
+            successor = _handover(servers)
+            if successor:
+                _graceful_stop(servers, successor=successor)
+                return
+    _graceful_stop(servers)
+
+
+def _handover(servers) -> Optional[int]:
+    # 先落盘，保证新进程加载到最新数据；新进程就绪前本进程照常服务
+    logger.info("收到 SIGHUP，启动新进程并交接监听套接字")
+    systemd.notify("RELOADING=1")
+    try:
+        APP.cache.flush()
+    except Exception as e:
+        logger.error("交接前落盘失败：%s", repr(e))
+    sockets = [(httpd.socket.fileno(), getattr(httpd, 'route_scope', 'all')) for httpd in servers]
+    pid = handover.spawn_successor(sockets, config.get_handover_timeout_sec(), logger)
+    if not pid:
+        systemd.notify("READY=1")
+    return pid
+
+
+def _wait_idle(max_sec: int):
+    # 等待进行中的请求与后台生成任务完成，使长耗时生成不因重启中断
+    deadline = time.monotonic() + max_sec
+    while time.monotonic() < deadline:
+        with INFLIGHT_LOCK:
+            busy = INFLIGHT[0]
+        pending = routes.pending_generations()
+        if busy <= 0 and pending <= 0:
+            return
+        time.sleep(0.2)
+    logger.warning("等待超时，仍有进行中的请求 %d 个、生成任务 %d 个", INFLIGHT[0], routes.pending_generations())
+
+
+def _graceful_stop(servers, successor: Optional[int] = None):
+    # 先让 /readyz 失败，排空期内继续服务，待负载均衡摘除本实例后再停止监听，等进行中的请求完成后落盘
+    # 交接时监听套接字已由新进程接管：立即停止 accept，不删除 unix 套接字文件，等待进行中的工作完成
+    DRAINING.set()
+    if not successor:
+        systemd.notify("STOPPING=1")
+    drain = 0 if successor else config.get_shutdown_drain_sec()
+    if drain > 0:
+        logger.info("收到停止信号，进入排空期 %ss（/readyz 已返回 503）", drain)
+        time.sleep(drain)
+    for httpd in servers:
+        try:
+            httpd.shutdown()
+            httpd.server_close()
+            if not successor and isinstance(httpd.server_address, str) and os.path.exists(httpd.server_address):
+                os.remove(httpd.server_address)
+        except Exception:
+            pass
+    ws.HUB.close_all()
+    if GRPC_SERVER is not None:
+        # 不再接受新调用，进行中的调用最多再等 5 秒
+        GRPC_SERVER.stop(5).wait()
+    # 请求线程为守护线程，主线程返回即被终止：落盘前等待进行中的请求写完响应
+    _wait_idle(config.get_handover_drain_max_sec() if successor else config.get_shutdown_timeout_sec())
+    try:
+        written = APP.cache.flush()
+        logger.info("已停止监听并完成落盘（persons=%s）", written if written is not None else '无变更')
+        if successor and written is not None:
+            os.kill(successor, signal.SIGUSR1)
+    except Exception as e:
+        logger.error("停止前落盘失败：%s", repr(e))
+        errorreport.REPORTER.capture_exception(e, tags={'phase': 'shutdown'})
+    analytics.ANALYTICS.flush()
+    QUOTAS.flush()
+    USAGE.flush()
+    errorreport.REPORTER.flush()
+
+
+def run_export(argv):
+    # 离线导出：只加载数据，不启动监听与后台线程
+    import export
+    APP.cache.preload(ROOT, EXCEL_DIR, FALLBACK, repair=config.get_data_repair_enabled())
+    return export.main(argv, APP.cache, EXPORTS_ROOT)
+
+
+def run_import(argv):
+    # 离线导入：加载现有数据后合并写回（先备份，原子替换）
+    import importer
+    APP.cache.backup_keep = config.get_backup_keep()
+    APP.cache.preload(ROOT, EXCEL_DIR, FALLBACK, repair=config.get_data_repair_enabled())
+    return importer.main(argv, APP.cache, lambda path: APP.importer.read(reqctx.background(), path))
+
+
+def run_validate(argv):
+    # 数据闸门：校验 people.json（结构、时间顺序、重名、坐标），有错误时非零退出
+    import datacheck
+    APP.cache.aliases.load(os.path.join(ROOT, 'data', 'aliases.json'))
+    return datacheck.main(argv, os.path.join(ROOT, 'data', 'people.json'), APP.cache.aliases)
+
+
+def run_stats(argv):
+    # 数据统计：人物/事件数、坐标覆盖率、时期与标签分布
+    import datastats
+    return datastats.main(argv, os.path.join(ROOT, 'data', 'people.json'))
+
+
+def run_embed(argv):
+    # 按 people.json 增量重建语义搜索的向量索引
+    APP.cache.preload(ROOT, EXCEL_DIR, FALLBACK)
+    persons = (APP.cache.get_people_or_fallback(FALLBACK) or {}).get('persons') or []
+    return embeddings.main(argv, EMBEDDINGS, persons)
+
+
+def run_clusters(argv):
+    # 离线运行时空聚类分析，结果写入 data/clusters.json
+    APP.cache.preload(ROOT, EXCEL_DIR, FALLBACK)
+    dynasty.load_configured()
+    persons = (APP.cache.get_people_or_fallback(FALLBACK) or {}).get('persons') or []
+    return clusters.main(argv, CLUSTER_JOB, persons)
+
+
+def run_migrate(argv):
+    # 离线迁移数据文件的 schema 版本（先备份），服务启动时不做迁移
+    return migrate.main(argv, os.path.join(ROOT, 'data', 'people.json'), config.get_backup_keep())
+
+
+def run_bench(argv):
+    # 压测运行中的实例（默认本机 PORT），报告各类请求的延迟分位数
+    import bench
+    return bench.main(argv, 'http://127.0.0.1:%d' % config.get_port())
+
+
+def run_seed(argv):
+    # 生成合成数据集，用于本地测试分页、搜索与地图聚合
+    import seed
+    return seed.main(argv, os.path.join(ROOT, 'data', 'people.json'), config.get_backup_keep())
+
+
+def run_replay(argv):
+    # 将回放日志中的请求重发到其他实例，对比状态码与延迟
+    return replaylog.main(argv, 'http://127.0.0.1:%d' % config.get_port())
+
+
+def run_e2e(argv):
+    # 端到端测试（test_e2e.py）：进程内假上游 + 临时数据目录中的 API 服务，等同 python -m unittest test_e2e
+    import unittest
+    result = unittest.main(module='test_e2e', argv=['index.py e2e'] + argv, exit=False).result
+    return 0 if result.wasSuccessful() else 1
 
 
 if __name__ == '__main__':
+    if sys.argv[1:2] == ['export']:
+        sys.exit(run_export(sys.argv[2:]))
+    if sys.argv[1:2] == ['import']:
+        sys.exit(run_import(sys.argv[2:]))
+    if sys.argv[1:2] == ['validate']:
+        sys.exit(run_validate(sys.argv[2:]))
+    if sys.argv[1:2] == ['stats']:
+        sys.exit(run_stats(sys.argv[2:]))
+    if sys.argv[1:2] == ['migrate']:
+        sys.exit(run_migrate(sys.argv[2:]))
+    if sys.argv[1:2] == ['bench']:
+        sys.exit(run_bench(sys.argv[2:]))
+    if sys.argv[1:2] == ['seed']:
+        sys.exit(run_seed(sys.argv[2:]))
+    if sys.argv[1:2] == ['replay']:
+        sys.exit(run_replay(sys.argv[2:]))
+    if sys.argv[1:2] == ['assets']:
+        sys.exit(assets.main(sys.argv[2:], FRONTEND_ROOT))
+    if sys.argv[1:2] == ['embed']:
+        sys.exit(run_embed(sys.argv[2:]))
+    if sys.argv[1:2] == ['usage']:
+        sys.exit(usage.main(sys.argv[2:], USAGE))
+    if sys.argv[1:2] == ['clusters']:
+        sys.exit(run_clusters(sys.argv[2:]))
+    if sys.argv[1:2] == ['e2e']:
+        sys.exit(run_e2e(sys.argv[2:]))
     run()
\ No newline at end of file
@@ -0,0 +1,131 @@
+"""
+数据文件完整性检查与备份
+
+- 启动时清理崩溃遗留的 *.tmp（原子写入未完成的临时文件）
+- people.json 存在但无法完整解析时拒绝以空数据启动；修复模式下从最新的可用备份恢复
+- 每次覆盖 people.json 前将旧文件复制到 data/backups/，保留最近 BACKUP_KEEP 份
+- 单个人物被整体替换（如 /api/person?refresh=true 重新生成）前另存一份 person-<键哈希>-<时间>.json，每人保留 BACKUP_KEEP 份
+"""
+
+import os
+import json
+import shutil
+import time
+import hashlib
+from typing import Any, Dict, List, Optional
+
+BACKUP_DIR = 'backups'
+BACKUP_PREFIX = 'people-'
+PERSON_BACKUP_PREFIX = 'person-'
+
+
+class DataCorruptError(Exception):
+    pass
+
+
+def validate_people(data: Any) -> Optional[str]:
+    """返回结构问题描述；结构合法时返回 None。"""
+    if not isinstance(data, dict):
+        return '顶层应为对象'
+    persons = data.get('persons')
+    if persons is None:
+        return '缺少 persons 字段'
+    if not isinstance(persons, list):
+        return 'persons 应为数组'
+    for i, p in enumerate(persons):
+        if not isinstance(p, dict) or not isinstance(p.get('name'), str):
+            return f'persons[{i}] 缺少 name'
+        if not isinstance(p.get('events', []), list):
+            return f'persons[{i}].events 应为数组'
+    return None
+
+
+def load_people(path: str) -> Dict[str, Any]:
+    """完整解析并校验 people.json；失败时抛出 DataCorruptError。"""
+    try:
+        with open(path, 'r', encoding='utf-8') as f:
+            data = json.load(f)
+    except Exception as e:
+        raise DataCorruptError(f'{path} 解析失败：{e}')
+    problem = validate_people(data)
+    if problem:
+        raise DataCorruptError(f'{path} 结构异常：{problem}')
+    return data
+
+
+def remove_stale_tmp(data_dir: str) -> List[str]:
+    """删除上次崩溃遗留的临时文件，返回被删除的文件名。"""
+    removed: List[str] = []
+    if not os.path.isdir(data_dir):
+        return removed
+    for fn in sorted(os.listdir(data_dir)):
+        if not fn.endswith('.tmp'):
+            continue
+        try:
+            os.remove(os.path.join(data_dir, fn))
+            removed.append(fn)
+        except Exception:
+            pass
+    return removed
+
+
+def list_backups(data_dir: str) -> List[str]:
+    """按时间从新到旧返回备份文件路径。"""
+    bdir = os.path.join(data_dir, BACKUP_DIR)
+    if not os.path.isdir(bdir):
+        return []
+    files = [fn for fn in os.listdir(bdir) if fn.startswith(BACKUP_PREFIX) and fn.endswith('.json')]
+    return [os.path.join(bdir, fn) for fn in sorted(files, reverse=True)]
+
+
+def backup_file(path: str, data_dir: str, keep: int) -> Optional[str]:
+    """覆盖前备份当前文件，并清理超出保留数量的旧备份。"""
+    if keep <= 0 or not os.path.exists(path):
+        return None
+    bdir = os.path.join(data_dir, BACKUP_DIR)
+    os.makedirs(bdir, exist_ok=True)
+    stamp = time.strftime('%Y%m%d-%H%M%S') + '-%03d' % int(time.time() * 1000 % 1000)
+    dest = os.path.join(bdir, f'{BACKUP_PREFIX}{stamp}.json')
+    shutil.copy2(path, dest)
+    for old in list_backups(data_dir)[keep:]:
+        try:
+            os.remove(old)
+        except Exception:
+            pass
+    return dest
+
+
+def backup_person(person: Dict[str, Any], key: str, data_dir: str, keep: int) -> Optional[str]:
+    """另存单个人物的当前版本（key 为归一化姓名），并清理该人物超出保留数量的旧版本；返回备份路径。"""
+    if keep <= 0:
+        return None
+    bdir = os.path.join(data_dir, BACKUP_DIR)
+    os.makedirs(bdir, exist_ok=True)
+    prefix = PERSON_BACKUP_PREFIX + hashlib.sha1(key.encode('utf-8')).hexdigest()[:12] + '-'
+    stamp = time.strftime('%Y%m%d-%H%M%S') + '-%03d' % int(time.time() * 1000 % 1000)
+    dest = os.path.join(bdir, f'{prefix}{stamp}.json')
+    tmp = dest + '.tmp'
+    with open(tmp, 'w', encoding='utf-8') as f:
+        json.dump({'backed_up_at': time.time(), 'person': person}, f, ensure_ascii=False, indent=2)
+    os.replace(tmp, dest)
+    old = sorted((fn for fn in os.listdir(bdir) if fn.startswith(prefix) and fn.endswith('.json')), reverse=True)
+    for fn in old[keep:]:
+        try:
+            os.remove(os.path.join(bdir, fn))
+        except Exception:
+            pass
+    return dest
+
+
+def restore_latest(path: str, data_dir: str) -> Optional[str]:
+    """将损坏文件改名保留，并用最新的可完整解析的备份替换；返回所用备份路径。"""
+    for candidate in list_backups(data_dir):
+        try:
+            load_people(candidate)
+        except DataCorruptError:
+            continue
+        if os.path.exists(path):
+            os.replace(path, path + '.corrupt-' + time.strftime('%Y%m%d-%H%M%S'))
+        shutil.copy2(candidate, path)
+        return candidate
+    return None
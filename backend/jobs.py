@@ -0,0 +1,86 @@
+"""
+异步生成任务（POST /api/person/generate → 202 + 任务 ID，GET /api/jobs/{id} 查询状态与结果）
+
+任务在生成线程池（routes._GEN_POOL）中执行，与同步接口共用并发上限与停机等待：
+- status：queued（排队）→ running → done / failed；failed 时 error 为统一错误结构
+- 同一人物已有未完成的任务时直接返回该任务，不重复调用 AI
+- 任务只保存在内存中，完成后保留 JOB_TTL_SEC 秒，最多保留 JOB_MAX 个（超出时先淘汰最早完成的）
+"""
+
+import time
+import uuid
+import threading
+from collections import OrderedDict
+from typing import Any, Dict, Optional
+
+import config
+from errors import ApiError
+from textnorm import name_key
+
+
+class JobStore:
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._jobs: 'OrderedDict[str, Dict[str, Any]]' = OrderedDict()
+
+    def _prune(self, now: float):
+        ttl, limit = config.get_job_ttl_sec(), config.get_job_max()
+        for jid in [j for j, job in self._jobs.items() if job['finished_at'] and now - job['finished_at'] > ttl]:
+            del self._jobs[jid]
+        finished = [j for j, job in self._jobs.items() if job['finished_at']]
+        while len(self._jobs) > limit and finished:
+            del self._jobs[finished.pop(0)]
+
+    def active(self, name: str) -> Optional[Dict[str, Any]]:
+        """该人物未完成的任务。"""
+        key = name_key(name)
+        with self._lock:
+            for job in self._jobs.values():
+                if job['key'] == key and not job['finished_at']:
+                    return self._view(job)
+        return None
+
+    def create(self, name: str, status: str = 'queued') -> Dict[str, Any]:
+        now = time.time()
+        job = {'id': uuid.uuid4().hex[:16], 'type': 'generate', 'name': name, 'key': name_key(name), 'status': status,
+               'created_at': now, 'started_at': None, 'finished_at': now if status == 'done' else None,
+               'source': None, 'person': None, 'error': None}
+        with self._lock:
+            self._prune(now)
+            self._jobs[job['id']] = job
+        return self._view(job)
+
+    def _update(self, jid: str, **fields):
+        with self._lock:
+            job = self._jobs.get(jid)
+            if job is not None:
+                job.update(fields)
+
+    def started(self, jid: str):
+        self._update(jid, status='running', started_at=time.time())
+
+    def finished(self, jid: str, person: Optional[Dict[str, Any]], source: str = 'generated'):
+        self._update(jid, status='done', finished_at=time.time(), person=person, source=source)
+
+    def failed(self, jid: str, error: ApiError):
+        self._update(jid, status='failed', finished_at=time.time(), error=error)
+
+    def get(self, jid: str) -> Optional[Dict[str, Any]]:
+        with self._lock:
+            self._prune(time.time())
+            job = self._jobs.get(jid)
+            return self._view(job) if job else None
+
+    def stats(self) -> Dict[str, int]:
+        with self._lock:
+            out: Dict[str, int] = {}
+            for job in self._jobs.values():
+                out[job['status']] = out.get(job['status'], 0) + 1
+            return out
+
+    @staticmethod
+    def _view(job: Dict[str, Any]) -> Dict[str, Any]:
+        return {k: v for k, v in job.items() if k != 'key'}
+
+
+JOBS = JobStore()
@@ -0,0 +1,162 @@
+"""
+监听地址解析与服务器创建
+
+LISTEN 支持以下写法：
+- "8001" / ":8001"          所有地址的 TCP 端口
+- "127.0.0.1:8001"          指定地址的 TCP 端口（IPv6 使用 "[::1]:8001"）
+- "unix:/run/fetrace.sock"  Unix 域套接字（同机 nginx 反代无需开放回环端口）
+
+Unix 套接字的权限由 LISTEN_SOCKET_MODE（八进制，默认 0660）与可选的 LISTEN_SOCKET_GROUP 控制。
+
+可同时配置多个监听（逗号分隔），并以 "=作用域" 限定可访问的路由：
+- all（默认）：全部路由
+- public：除管理接口外的全部路由
+- admin：仅管理接口
+管理接口按路由表中的分组认定（ADMIN_GROUPS：admin、admin_write，含 /api/person/rename 等不在 /api/admin/ 下的写接口），
+不按路径前缀。探针 /livez、/readyz 在所有监听上均可访问；
+导出目录 /exports/ 需开启 EXPORTS_SERVE_ENABLED，且只在 admin 与 all 作用域提供。
+例如 LISTEN="8001=public,127.0.0.1:9001=admin"，管理接口只在本机端口暴露。
+"""
+
+import os
+import socket
+import stat
+import socketserver
+from http.server import HTTPServer, ThreadingHTTPServer
+from typing import List, Optional, Tuple
+
+
+class ThreadingUnixHTTPServer(socketserver.ThreadingMixIn, socketserver.UnixStreamServer):
+    daemon_threads = True
+    allow_reuse_address = True
+
+    def server_bind(self):
+        socketserver.UnixStreamServer.server_bind(self)
+        self.server_name = 'localhost'
+        self.server_port = 0
+
+
+class ThreadingHTTPServerV6(ThreadingHTTPServer):
+    address_family = socket.AF_INET6
+
+
+SCOPES = ('all', 'public', 'admin')
+# 需要管理令牌的路由分组（见 index.API_CHAINS），只在 admin 与 all 作用域开放
+ADMIN_GROUPS = ('admin', 'admin_write')
+
+
+def parse_listeners(value) -> List[Tuple[str, str]]:
+    """解析监听配置，返回 [(listen, scope)]；value 可为字符串或 config.json 中的列表。"""
+    items = value if isinstance(value, list) else str(value or '').split(',')
+    out: List[Tuple[str, str]] = []
+    for item in items:
+        if isinstance(item, dict):
+            spec, scope = str(item.get('listen') or '').strip(), str(item.get('scope') or 'all').strip()
+        else:
+            text = str(item).strip()
+            spec, _, scope = text.partition('=')
+            spec, scope = spec.strip(), (scope.strip() or 'all')
+        if not spec:
+            continue
+        if scope not in SCOPES:
+            raise ValueError(f'未知的监听作用域：{scope}（可选 {", ".join(SCOPES)}）')
+        parse_listen(spec)
+        out.append((spec, scope))
+    return out
+
+
+def route_allowed(scope: str, group: Optional[str]) -> bool:
+    """group 为请求所属路由的分组（router.Router.group），静态文件与未匹配的路径为 None。"""
+    is_admin = group in ADMIN_GROUPS
+    if scope == 'public':
+        return not is_admin
+    if scope == 'admin':
+        return is_admin
+    return True
+
+
+def parse_listen(spec: str) -> Tuple[str, object]:
+    """返回 ('unix', path) 或 ('tcp', (host, port))。"""
+    text = str(spec or '').strip()
+    if text.startswith('unix:'):
+        path = text[5:]
+        if not path:
+            raise ValueError('LISTEN 缺少 unix 套接字路径')
+        return 'unix', path
+    host = ''
+    port_text = text
+    if text.startswith('['):
+        end = text.find(']')
+        if end < 0:
+            raise ValueError(f'LISTEN 格式错误：{text}')
+        host = text[1:end]
+        port_text = text[end + 1:].lstrip(':')
+    elif ':' in text:
+        host, port_text = text.rsplit(':', 1)
+    port = int(port_text)
+    if not 0 <= port <= 65535:
+        raise ValueError(f'LISTEN 端口超出范围：{port}')
+    return 'tcp', (host, port)
+
+
+def _remove_stale_socket(path: str):
+    # 仅清理残留的套接字文件，避免误删普通文件
+    try:
+        if stat.S_ISSOCK(os.stat(path).st_mode):
+            os.remove(path)
+    except FileNotFoundError:
+        pass
+
+
+def _apply_socket_permissions(path: str, mode: int, group: Optional[str]):
+    os.chmod(path, mode)
+    if group:
+        import grp
+        gid = int(group) if str(group).isdigit() else grp.getgrnam(group).gr_gid
+        os.chown(path, -1, gid)
+
+
+def make_server(spec: str, handler_class, socket_mode: int = 0o660, socket_group: Optional[str] = None, scope: str = 'all',
+                router=None) -> HTTPServer:
+    kind, addr = parse_listen(spec)
+    if kind == 'unix':
+        _remove_stale_socket(addr)
+        httpd = ThreadingUnixHTTPServer(addr, handler_class)
+        _apply_socket_permissions(addr, socket_mode, socket_group)
+    else:
+        host, port = addr
+        server_class = ThreadingHTTPServerV6 if ':' in host else ThreadingHTTPServer
+        httpd = server_class((host, port), handler_class)
+    # 处理器通过 self.server.route_scope 判断该监听可访问的路由，通过 self.server.router 分派 API 请求
+    httpd.route_scope = scope
+    httpd.router = router
+    return httpd
+
+
+def server_from_socket(sock: socket.socket, handler_class, scope: str = 'all', router=None) -> HTTPServer:
+    """基于已绑定并监听的套接字（如 systemd 传入）创建服务器。"""
+    if sock.family == socket.AF_UNIX:
+        server_class = ThreadingUnixHTTPServer
+    elif sock.family == socket.AF_INET6:
+        server_class = ThreadingHTTPServerV6
+    else:
+        server_class = ThreadingHTTPServer
+    httpd = server_class(sock.getsockname(), handler_class, bind_and_activate=False)
+    httpd.socket.close()
+    httpd.socket = sock
+    httpd.server_address = sock.getsockname()
+    if sock.family == socket.AF_UNIX:
+        httpd.server_name, httpd.server_port = 'localhost', 0
+    else:
+        httpd.server_name, httpd.server_port = socket.getfqdn(httpd.server_address[0]), httpd.server_address[1]
+    httpd.route_scope = scope if scope in SCOPES else 'all'
+    httpd.router = router
+    return httpd
+
+
+def describe(httpd, scheme: str = 'http') -> str:
+    addr = httpd.server_address
+    if isinstance(addr, (str, bytes)):
+        return f'unix:{addr if isinstance(addr, str) else addr.decode()}'
+    host = addr[0] or 'localhost'
+    return f'{scheme}://{host}:{addr[1]}'
@@ -0,0 +1,93 @@
+"""
+日志输出管理
+
+- 组件：api（接口与启动）、deepseek（上游调用）、access（HTTP 访问日志）
+- 目的地：LOG_OUTPUT=stderr（默认）| stdout | file；file 写入 LOG_FILE，
+  按大小（LOG_ROTATE=size，LOG_MAX_BYTES）或时间（LOG_ROTATE=time，LOG_ROTATE_WHEN）轮转，保留 LOG_BACKUP_COUNT 份
+- 级别：LOG_LEVEL 为默认级别，LOG_LEVELS 按组件覆盖（如 "deepseek=WARNING,access=ERROR"）
+- 运行时调整：GET/POST /api/admin/log-levels（不持久化，重启后回到配置值）
+- 访问日志：ACCESS_LOG_FILE 非空时 access 组件单独输出到该文件（"-" 为 stdout），每行仅含日志本身，格式见 accesslog.py
+"""
+
+import os
+import sys
+import logging
+import logging.handlers
+import threading
+from typing import Dict, Optional
+
+import config
+
+COMPONENTS = ('api', 'deepseek', 'access')
+LEVELS = ('DEBUG', 'INFO', 'WARNING', 'ERROR', 'CRITICAL')
+
+_lock = threading.Lock()
+_handler: Optional[logging.Handler] = None
+_access_handler: Optional[logging.Handler] = None
+
+
+def _file_handler(path: str) -> logging.Handler:
+    os.makedirs(os.path.dirname(os.path.abspath(path)), exist_ok=True)
+    if config.get_log_rotate() == 'time':
+        return logging.handlers.TimedRotatingFileHandler(path, when=config.get_log_rotate_when(),
+                                                         backupCount=config.get_log_backup_count(), encoding='utf-8')
+    return logging.handlers.RotatingFileHandler(path, maxBytes=config.get_log_max_bytes(),
+                                                backupCount=config.get_log_backup_count(), encoding='utf-8')
+
+
+def _make_handler() -> logging.Handler:
+    output = config.get_log_output()
+    if output == 'stdout':
+        return logging.StreamHandler(sys.stdout)
+    if output == 'file':
+        return _file_handler(config.get_log_file())
+    return logging.StreamHandler()
+
+
+def _make_access_handler() -> Optional[logging.Handler]:
+    path = config.get_access_log_file()
+    if not path:
+        return None
+    handler = logging.StreamHandler(sys.stdout) if path == '-' else _file_handler(path)
+    handler.setFormatter(logging.Formatter('%(message)s'))
+    return handler
+
+
+def _parse_level(level: str) -> Optional[int]:
+    name = str(level or '').strip().upper()
+    return getattr(logging, name) if name in LEVELS else None
+
+
+def configure(default_level: Optional[int] = None):
+    """按配置安装日志目的地与各组件级别；default_level 覆盖 LOG_LEVEL（如测试只保留警告）。"""
+    global _handler, _access_handler
+    with _lock:
+        handler = _make_handler()
+        handler.setFormatter(logging.Formatter('%(asctime)s [%(levelname)s] %(name)s: %(message)s'))
+        access_handler = _make_access_handler()
+        base = default_level if default_level is not None else (_parse_level(config.get_log_level()) or logging.INFO)
+        overrides = config.get_log_levels()
+        for name in COMPONENTS:
+            lg = logging.getLogger(name)
+            for h in list(lg.handlers):
+                lg.removeHandler(h)
+                if h is _handler or h is _access_handler:
+                    h.close()
+            lg.addHandler(access_handler if name == 'access' and access_handler else handler)
+            lg.propagate = False
+            lg.setLevel(_parse_level(overrides.get(name, '')) or base)
+        _handler = handler
+        _access_handler = access_handler
+
+
+def levels() -> Dict[str, str]:
+    return {name: logging.getLevelName(logging.getLogger(name).level) for name in COMPONENTS}
+
+
+def set_level(component: str, level: str) -> bool:
+    """运行时调整组件级别；组件或级别无效时返回 False。"""
+    value = _parse_level(level)
+    if component not in COMPONENTS or value is None:
+        return False
+    logging.getLogger(component).setLevel(value)
+    return True
@@ -0,0 +1,82 @@
+"""
+事件配图与附件
+
+- 事件的 media 字段：[{"url", "type": "image" | "pdf" | "link", "caption"}]
+- 上传：POST /api/admin/media，请求体为文件原始内容（不超过 MEDIA_MAX_BYTES），按内容识别类型，
+  仅接受 JPEG / PNG / GIF / WebP / PDF；以内容哈希命名存入 MEDIA_DIR，重复上传得到同一地址
+- 关联：POST /api/person/{name}/events/{id}/media {"url", "caption"}，url 为外部 http(s) 地址或上传所得的 /media/...；
+  DELETE 同一路径 ?url= 解除关联
+- 访问：GET /media/<文件名>（只读静态文件，不列目录）
+"""
+
+import os
+import hashlib
+from typing import Any, Dict, Optional, Tuple
+from urllib.parse import urlparse
+
+URL_PREFIX = '/media/'
+MAX_PER_EVENT = 20
+MAX_CAPTION = 200
+
+# 文件头 → (扩展名, 类型)
+_SIGNATURES = [
+    (b'\xff\xd8\xff', '.jpg', 'image'),
+    (b'\x89PNG\r\n\x1a\n', '.png', 'image'),
+    (b'GIF87a', '.gif', 'image'),
+    (b'GIF89a', '.gif', 'image'),
+    (b'%PDF-', '.pdf', 'pdf'),
+]
+_TYPES_BY_EXT = {'.jpg': 'image', '.jpeg': 'image', '.png': 'image', '.gif': 'image', '.webp': 'image', '.pdf': 'pdf'}
+
+
+def sniff(data: bytes) -> Optional[Tuple[str, str]]:
+    """按文件头识别，返回 (扩展名, 类型)；不支持的格式返回 None。"""
+    for magic, ext, kind in _SIGNATURES:
+        if data.startswith(magic):
+            return ext, kind
+    if data[:4] == b'RIFF' and data[8:12] == b'WEBP':
+        return '.webp', 'image'
+    return None
+
+
+def store(root: str, data: bytes) -> Optional[Dict[str, Any]]:
+    """保存上传内容并返回 {url, type, bytes}；格式不支持时返回 None。"""
+    detected = sniff(data)
+    if detected is None:
+        return None
+    ext, kind = detected
+    name = hashlib.sha256(data).hexdigest()[:24] + ext
+    path = os.path.join(root, name)
+    if not os.path.exists(path):
+        os.makedirs(root, exist_ok=True)
+        tmp = path + '.tmp'
+        with open(tmp, 'wb') as f:
+            f.write(data)
+        os.replace(tmp, path)
+    return {'url': URL_PREFIX + name, 'type': kind, 'bytes': len(data)}
+
+
+def local_path(root: str, url: str) -> Optional[str]:
+    """/media/<文件名> → 磁盘路径（文件名不含目录成分）；其他地址返回 None。"""
+    if not url.startswith(URL_PREFIX):
+        return None
+    name = url[len(URL_PREFIX):]
+    if not name or '/' in name or '\\' in name or name.startswith('.'):
+        return None
+    return os.path.join(root, name)
+
+
+def make_entry(root: str, url: str, caption: str = '') -> Optional[Dict[str, Any]]:
+    """校验地址并生成 media 条目；外部地址须为 http(s)，本地地址须已上传。无效时返回 None。"""
+    url = str(url or '').strip()
+    path = local_path(root, url)
+    if path is not None:
+        if not os.path.isfile(path):
+            return None
+        kind = _TYPES_BY_EXT.get(os.path.splitext(path)[1].lower(), 'link')
+    else:
+        u = urlparse(url)
+        if u.scheme not in ('http', 'https') or not u.netloc:
+            return None
+        kind = _TYPES_BY_EXT.get(os.path.splitext(u.path)[1].lower(), 'link')
+    return {'url': url, 'type': kind, 'caption': str(caption or '').strip()[:MAX_CAPTION]}
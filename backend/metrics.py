@@ -0,0 +1,45 @@
+"""
+进程内运行指标（线程安全计数器）
+
+- generation：AI 生成成功/失败次数与耗时
+- geocode：地理编码外部调用次数（配额消耗）与缓存命中
+供 /api/admin/stats 等运维接口汇总展示。
+"""
+
+import threading
+import time
+from typing import Any, Dict
+
+
+class Metrics:
+    def __init__(self):
+        self._lock = threading.Lock()
+        self.started_at = time.time()
+        self._counters: Dict[str, int] = {}
+        self._durations: Dict[str, Dict[str, float]] = {}
+
+    def incr(self, key: str, n: int = 1):
+        with self._lock:
+            self._counters[key] = self._counters.get(key, 0) + n
+
+    def observe(self, key: str, seconds: float):
+        with self._lock:
+            d = self._durations.setdefault(key, {'count': 0, 'total': 0.0, 'max': 0.0})
+            d['count'] += 1
+            d['total'] += seconds
+            d['max'] = max(d['max'], seconds)
+
+    def counter(self, key: str) -> int:
+        with self._lock:
+            return self._counters.get(key, 0)
+
+    def snapshot(self) -> Dict[str, Any]:
+        with self._lock:
+            durations = {}
+            for k, d in self._durations.items():
+                avg = d['total'] / d['count'] if d['count'] else 0.0
+                durations[k] = {'count': d['count'], 'avg_ms': int(avg * 1000), 'max_ms': int(d['max'] * 1000)}
+            return {'counters': dict(self._counters), 'durations': durations}
+
+
+METRICS = Metrics()
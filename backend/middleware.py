@@ -0,0 +1,190 @@
+"""
+API 中间件链
+
+中间件形如 mw(next) -> handle，其中 handle(handler) 处理一次请求；chain() 按声明顺序组合，
+列表中靠前的中间件在外层。路由表（index.py 的 API_ROUTES）按分组声明各自的中间件链：
+
+- request_context 创建请求上下文 handler.ctx（请求 ID、截止时间，见 reqctx.py）
+- recover       捕获 ApiError 与未预期异常，输出标准错误信封；异常与非上游类 5xx 上报 Sentry（见 errorreport.py）
+- access_log    记录耗时与状态码（回放日志，见 replaylog.py）
+- require_admin 管理令牌校验（ADMIN_TOKEN）
+- read_only     只读模式（开关 read_only）下拒绝修改数据的接口
+- maintenance   维护模式（开关 maintenance）下数据接口返回 503 与维护公告（浏览器请求为 HTML 页面）
+- rate_limit    按客户端限流（API_RATE_LIMIT_PER_MIN，0 为不限；代理之后的客户端地址见 clientip.py）
+- quota         识别 API Key 并把每日额度绑定到 ctx.quota（见 quotas.py），按租户记账（见 usage.py）
+- compress_json 客户端支持时压缩较大的 JSON 响应（br 或 gzip，见 static.choose_encoding）
+
+CORS 头由 Handler._set_headers 统一输出，预检请求由 do_OPTIONS 处理。
+"""
+
+import time
+import logging
+import threading
+from urllib.parse import urlparse
+from typing import Callable, Dict, Optional
+
+import clientip
+import config
+import errors
+import errorreport
+import reqctx
+import routes
+import static
+from errors import ApiError
+from flags import FLAGS
+
+logger = logging.getLogger('api')
+
+Handle = Callable[[object], None]
+Middleware = Callable[[Handle], Handle]
+
+
+def chain(*middlewares: Middleware) -> Callable[[Handle], Handle]:
+    def apply(endpoint: Handle) -> Handle:
+        for mw in reversed(middlewares):
+            endpoint = mw(endpoint)
+        return endpoint
+    return apply
+
+
+def request_context(next_handle: Handle) -> Handle:
+    def handle(handler):
+        timeout = config.get_api_request_timeout_sec()
+        handler.ctx = reqctx.from_headers(handler.headers, timeout or None)
+        try:
+            next_handle(handler)
+        finally:
+            ctx, handler.ctx = handler.ctx, None
+            if ctx.spans:
+                logger.debug("请求耗时分段：rid=%s, path=%s, spans=%s", ctx.request_id, urlparse(handler.path).path, ctx.spans)
+    return handle
+
+
+def recover(next_handle: Handle) -> Handle:
+    def handle(handler):
+        handler._error_code = None
+        try:
+            next_handle(handler)
+        except ApiError as e:
+            routes.write_error(handler, e)
+        except Exception as e:
+            logger.exception("接口处理异常：path=%s", urlparse(handler.path).path)
+            errorreport.REPORTER.capture_exception(e, errorreport.request_info(handler))
+            routes.write_error(handler, ApiError(errors.INTERNAL_ERROR, 'internal_error', {"reason": repr(e)}))
+            return
+        status = getattr(handler, '_status', 0) or 0
+        # 上游类错误按突增汇总上报；只读、维护模式的拒绝属预期行为，不上报
+        if status >= 500 and handler._error_code not in errorreport.UPSTREAM_CODES + (errors.READ_ONLY, errors.MAINTENANCE):
+            errorreport.REPORTER.capture_message(f'{status} {handler._error_code or ""}'.strip(), request=errorreport.request_info(handler),
+                                                 tags={'status': str(status)})
+    return handle
+
+
+def access_log(replay_log) -> Middleware:
+    def mw(next_handle: Handle) -> Handle:
+        if replay_log is None:
+            return next_handle
+
+        def handle(handler):
+            start = time.perf_counter()
+            handler._status = 0
+            try:
+                next_handle(handler)
+            finally:
+                replay_log.record(handler.command, urlparse(handler.path).path, routes._query(handler),
+                                  routes.request_lang(handler), handler._status, time.perf_counter() - start)
+        return handle
+    return mw
+
+
+def require_admin(next_handle: Handle) -> Handle:
+    def handle(handler):
+        routes.require_admin(handler)
+        next_handle(handler)
+    return handle
+
+
+def read_only(next_handle: Handle) -> Handle:
+    def handle(handler):
+        if FLAGS.enabled('read_only'):
+            raise ApiError(errors.READ_ONLY, 'read_only')
+        next_handle(handler)
+    return handle
+
+
+def maintenance(next_handle: Handle) -> Handle:
+    def handle(handler):
+        if not FLAGS.enabled('maintenance'):
+            next_handle(handler)
+            return
+        retry_after = config.get_maintenance_retry_after_sec()
+        headers = {'Retry-After': str(retry_after)} if retry_after else {}
+        notice = config.get_maintenance_message()
+        err = ApiError(errors.MAINTENANCE, 'maintenance', {"retry_after": retry_after, "notice": notice}, headers=headers)
+        accept = str(handler.headers.get('Accept') or '')
+        if 'text/html' not in accept or 'application/json' in accept:
+            raise err
+        handler._error_code = err.code
+        message = err.to_dict(routes.request_lang(handler))['message']
+        body = static.render_notice_html(message, notice or message).encode('utf-8')
+        handler._set_headers(err.status, 'text/html; charset=utf-8', length=len(body), headers=headers)
+        handler.wfile.write(body)
+    return handle
+
+
+class RateLimiter:
+    """固定窗口计数（每客户端每分钟），窗口结束时整体清空。"""
+
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._window = 0
+        self._counts: Dict[str, int] = {}
+
+    def allow(self, client: str, limit: int) -> bool:
+        window = int(time.time() // 60)
+        with self._lock:
+            if window != self._window:
+                self._window = window
+                self._counts = {}
+            n = self._counts.get(client, 0) + 1
+            self._counts[client] = n
+            return n <= limit
+
+
+def rate_limit(limiter: Optional[RateLimiter] = None) -> Middleware:
+    limiter = limiter or RateLimiter()
+
+    def mw(next_handle: Handle) -> Handle:
+        def handle(handler):
+            limit = config.get_api_rate_limit_per_min()
+            if limit > 0 and not limiter.allow(clientip.resolve(handler), limit):
+                raise ApiError(errors.RATE_LIMITED, 'client_rate_limited', {"limit_per_min": limit})
+            next_handle(handler)
+        return handle
+    return mw
+
+
+def quota(store) -> Middleware:
+    def mw(next_handle: Handle) -> Handle:
+        def handle(handler):
+            key = str(handler.headers.get('X-API-Key') or '').strip() or (routes._query(handler).get('api_key') or [''])[0].strip()
+            if not key and config.get_api_key_required():
+                raise ApiError(errors.UNAUTHORIZED, 'api_key_required')
+            team = store.resolve(key)
+            if team is None:
+                raise ApiError(errors.UNAUTHORIZED, 'api_key_invalid')
+            handler.ctx.quota = store.bind(team)
+            handler.ctx.quota.record('requests')
+            next_handle(handler)
+        return handle
+    return mw
+
+
+def compress_json(next_handle: Handle) -> Handle:
+    # 协商 JSON 响应的压缩编码：response_encoding 为 None 表示不压缩（未开启），'' 表示客户端不接受压缩
+    def handle(handler):
+        handler.response_encoding = None
+        if config.get_api_compress_enabled():
+            handler.response_encoding = static.choose_encoding(handler.headers, config.get_compress_brotli_enabled()) or ''
+        next_handle(handler)
+    return handle
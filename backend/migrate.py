@@ -0,0 +1,136 @@
+"""
+数据文件离线迁移
+
+    python index.py migrate [people.json] [--check] [--to N]
+
+people.json 顶层的 schema_version 记录数据版本（缺省为 1）。迁移只通过本命令执行，
+服务启动时不做任何改写，仅在版本落后时给出提示。
+
+- v2 typed-years：year 统一为整数（公元前为负数）；无法直接用数字表示的原文（如「约前571」）保留在 year_label
+- v3 ids：为人物与事件补充稳定 id（人物 id 由归一化姓名派生，事件 id 为「人物 id-序号」）
+
+执行前先备份到 data/backups/；--check 只列出待执行的迁移，有待执行项时退出码为 1。
+"""
+
+import os
+import sys
+import json
+import hashlib
+import argparse
+from typing import Any, Callable, Dict, List, Tuple
+
+from textnorm import name_key
+from datacheck import parse_year
+import integrity
+
+
+def _typed_years(data: Dict[str, Any]) -> int:
+    changed = 0
+    for p in data.get('persons') or []:
+        for e in p.get('events') or []:
+            raw = e.get('year')
+            if isinstance(raw, int) and not isinstance(raw, bool):
+                continue
+            text = str(raw if raw is not None else '').strip()
+            year = parse_year(text)
+            e['year'] = year
+            if text and text != str(year):
+                e['year_label'] = text
+            changed += 1
+    return changed
+
+
+def person_id(name: str) -> str:
+    return 'p_' + hashlib.sha1(name_key(name).encode('utf-8')).hexdigest()[:10]
+
+
+def assign_ids(p: Dict[str, Any]) -> int:
+    """为人物及缺少 id 的事件补 id（序号接在已有最大序号之后，已有 id 不变），返回新增数。
+    写入缓存时调用，使新生成与人工录入的人物同样具备稳定的事件 id。"""
+    changed = 0
+    if not p.get('id'):
+        p['id'] = person_id(p.get('name', ''))
+        changed += 1
+    prefix = f'{p["id"]}-'
+    used = [int(e['id'][len(prefix):]) for e in p.get('events') or []
+            if isinstance(e, dict) and str(e.get('id') or '').startswith(prefix) and e['id'][len(prefix):].isdigit()]
+    n = max(used, default=0)
+    for e in p.get('events') or []:
+        if isinstance(e, dict) and not e.get('id'):
+            n += 1
+            e['id'] = f'{prefix}{n}'
+            changed += 1
+    return changed
+
+
+def _ids(data: Dict[str, Any]) -> int:
+    return sum(assign_ids(p) for p in data.get('persons') or [])
+
+
+# (目标版本, 名称, 迁移函数)；函数原地修改数据并返回变更条目数
+MIGRATIONS: List[Tuple[int, str, Callable[[Dict[str, Any]], int]]] = [
+    (2, 'typed-years', _typed_years),
+    (3, 'ids', _ids),
+]
+LATEST = MIGRATIONS[-1][0]
+
+
+def schema_version(data: Dict[str, Any]) -> int:
+    try:
+        return int((data or {}).get('schema_version') or 1)
+    except (TypeError, ValueError):
+        return 1
+
+
+def pending(data: Dict[str, Any], target: int = LATEST) -> List[Tuple[int, str, Callable]]:
+    current = schema_version(data)
+    return [m for m in MIGRATIONS if current < m[0] <= target]
+
+
+def upgrade(data: Dict[str, Any], target: int = LATEST) -> List[Dict[str, Any]]:
+    """依次执行待执行的迁移并更新 schema_version，返回每一步的变更计数。"""
+    steps = []
+    for version, name, fn in pending(data, target):
+        changed = fn(data)
+        data['schema_version'] = version
+        steps.append({'version': version, 'name': name, 'changed': changed})
+    return steps
+
+
+def main(argv: List[str], default_path: str, backup_keep: int = 5) -> int:
+    parser = argparse.ArgumentParser(prog='index.py migrate', description='升级数据文件的 schema 版本')
+    parser.add_argument('path', nargs='?', default=default_path, help='默认为当前数据目录下的 people.json')
+    parser.add_argument('--check', action='store_true', help='只列出待执行的迁移，不修改文件')
+    parser.add_argument('--to', type=int, default=LATEST, help=f'目标版本（默认最新 v{LATEST}）')
+    args = parser.parse_args(argv)
+
+    try:
+        data = integrity.load_people(args.path)
+    except integrity.DataCorruptError as e:
+        print(str(e), file=sys.stderr)
+        return 1
+    current = schema_version(data)
+    todo = pending(data, args.to)
+    print(f'{args.path}: schema v{current}，目标 v{args.to}', file=sys.stderr)
+    for version, name, _ in todo:
+        print(f'  待执行：v{version} {name}', file=sys.stderr)
+    if not todo:
+        print('  已是目标版本', file=sys.stderr)
+        return 0
+    if args.check:
+        return 1
+
+    steps = upgrade(data, args.to)
+    problem = integrity.validate_people(data)
+    if problem:
+        print(f'迁移结果校验失败，未写入：{problem}', file=sys.stderr)
+        return 1
+    backup = integrity.backup_file(args.path, os.path.dirname(os.path.abspath(args.path)), max(1, backup_keep))
+    tmp = args.path + '.tmp'
+    with open(tmp, 'w', encoding='utf-8') as f:
+        json.dump(data, f, ensure_ascii=False, indent=2)
+    os.replace(tmp, args.path)
+    for s in steps:
+        print(f'  完成：v{s["version"]} {s["name"]}（变更 {s["changed"]} 项）', file=sys.stderr)
+    print(f'  备份：{backup}', file=sys.stderr)
+    return 0
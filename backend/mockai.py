@@ -0,0 +1,47 @@
+"""
+模拟 AI 提供方（AI_PROVIDER=mock）
+
+- 不访问网络、不需要 API Key：按姓名生成确定性的轨迹（同名每次结果相同）
+- 供前端开发与 CI 使用；生成的人物带 tags: ["mock"]，落盘后可据此识别
+- 翻译：在原文前加 [语言] 标记，便于核对按语言选择与按需生成
+- MOCK_AI_LATENCY_MS 模拟上游耗时；MOCK_AI_FAIL=timeout|rate_limited|error 模拟上游失败
+"""
+
+import time
+import random
+import hashlib
+from typing import Any, Dict, List, Optional
+
+import config
+import seed
+
+STYLES = [
+    {"markerColor": "#e91e63", "lineColor": "#f06292"},
+    {"markerColor": "#3B82F6", "lineColor": "#93C5FD"},
+    {"markerColor": "#10B981", "lineColor": "#6EE7B7"},
+    {"markerColor": "#F59E0B", "lineColor": "#FCD34D"},
+]
+
+
+def _rng(name: str) -> random.Random:
+    return random.Random(int(hashlib.sha1(name.encode('utf-8')).hexdigest()[:12], 16))
+
+
+def simulate_upstream() -> Optional[str]:
+    """按配置等待并返回要模拟的失败类型（无则 None）。"""
+    latency = config.get_mock_ai_latency_ms()
+    if latency > 0:
+        time.sleep(latency / 1000.0)
+    return config.get_mock_ai_fail()
+
+
+def timeline(name: str) -> Dict[str, Any]:
+    rnd = _rng(name)
+    person = seed.make_person(name, rnd)
+    for e in person['events']:
+        e['detail'] = e['detail'].replace('（合成数据）', '（模拟数据）')
+    return {"name": name, "style": dict(rnd.choice(STYLES)), "tags": ["mock"], "events": person['events']}
+
+
+def translate(texts: List[Dict[str, str]], lang: str) -> List[Dict[str, str]]:
+    return [{k: f'[{lang}] {v}' for k, v in t.items() if v} for t in texts]
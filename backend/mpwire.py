@@ -0,0 +1,74 @@
+"""
+MessagePack 的最小编码，供 encoders.py 输出二进制响应，不依赖 msgpack 运行库
+
+支持 JSON 可表示的值：None、bool、int、float（按 float64 写出）、str、list/tuple、dict（键转为字符串），另支持 bytes（bin）。
+整数超出 64 位或遇到其他类型时抛 TypeError，与 json.dumps 的行为一致。
+"""
+
+import struct
+from typing import Any
+
+
+def _int(n: int) -> bytes:
+    if 0 <= n <= 0x7F:
+        return bytes((n,))
+    if -32 <= n < 0:
+        return struct.pack('b', n)
+    if n >= 0:
+        for fmt, tag in (('>B', 0xCC), ('>H', 0xCD), ('>I', 0xCE), ('>Q', 0xCF)):
+            try:
+                return bytes((tag,)) + struct.pack(fmt, n)
+            except struct.error:
+                continue
+    else:
+        for fmt, tag in (('>b', 0xD0), ('>h', 0xD1), ('>i', 0xD2), ('>q', 0xD3)):
+            try:
+                return bytes((tag,)) + struct.pack(fmt, n)
+            except struct.error:
+                continue
+    raise TypeError(f'integer out of range: {n}')
+
+
+def _header(size: int, fix: int, fix_max: int, tags: tuple) -> bytes:
+    """fix 为短格式的前缀（长度在低位）；tags 为 8/16/32 位长度格式的类型字节，None 表示该宽度不可用。"""
+    if size <= fix_max:
+        return bytes((fix | size,))
+    for fmt, limit, tag in zip(('>B', '>H', '>I'), (0xFF, 0xFFFF, 0xFFFFFFFF), tags):
+        if tag is not None and size <= limit:
+            return bytes((tag,)) + struct.pack(fmt, size)
+    raise TypeError('value too large')
+
+
+def _pack(value: Any, out: bytearray):
+    if value is None:
+        out.append(0xC0)
+    elif value is True:
+        out.append(0xC3)
+    elif value is False:
+        out.append(0xC2)
+    elif isinstance(value, int):
+        out += _int(value)
+    elif isinstance(value, float):
+        out += b'\xcb' + struct.pack('>d', value)
+    elif isinstance(value, str):
+        data = value.encode('utf-8')
+        out += _header(len(data), 0xA0, 31, (0xD9, 0xDA, 0xDB)) + data
+    elif isinstance(value, (bytes, bytearray)):
+        out += _header(len(value), 0, -1, (0xC4, 0xC5, 0xC6)) + value
+    elif isinstance(value, (list, tuple)):
+        out += _header(len(value), 0x90, 15, (None, 0xDC, 0xDD))
+        for item in value:
+            _pack(item, out)
+    elif isinstance(value, dict):
+        out += _header(len(value), 0x80, 15, (None, 0xDE, 0xDF))
+        for k, v in value.items():
+            _pack(k if isinstance(k, str) else str(k), out)
+            _pack(v, out)
+    else:
+        raise TypeError(f'Object of type {type(value).__name__} is not MessagePack serializable')
+
+
+def encode(value: Any) -> bytes:
+    out = bytearray()
+    _pack(value, out)
+    return bytes(out)
@@ -0,0 +1,152 @@
+"""
+人物轨迹语音解说（导览模式）
+
+GET /api/person/{name}/narration[?lang=&voice=]：按时间顺序把事件组织成解说词，经 TTS 合成音频后缓存到
+NARRATION_DIR，再以静态文件方式输出（支持 Range，供 <audio> 拖动进度）；?script=1 只返回解说词与分段。
+voice 限于 TTS_VOICES 列出的音色；未命中缓存、需要合成时计入请求方的 generations 额度（见 quotas.py）。
+
+TTS_PROVIDER：
+- none（默认）：不合成，接口返回 tts_unavailable
+- mock：本地生成 WAV 提示音（每字一个音节、标点处停顿），不访问网络，用于开发与 CI
+- openai：OpenAI 兼容的 /v1/audio/speech（TTS_BASE_URL、TTS_API_KEY、TTS_MODEL、TTS_VOICE），输出 mp3
+
+缓存键为 (提供方, 模型, 音色, 语言, 解说词) 的哈希，事件或译文变化后自动生成新文件；同一键并发请求只合成一次。
+解说词超过 NARRATION_MAX_CHARS 时按事件截断。
+"""
+
+import io
+import os
+import json
+import math
+import wave
+import struct
+import hashlib
+import logging
+import threading
+import urllib.error
+import urllib.request
+from typing import Any, Dict, List, Tuple
+
+import config
+import datacheck
+
+logger = logging.getLogger('api')
+
+EXTENSIONS = {'mock': '.wav', 'openai': '.mp3'}
+
+
+class TTSError(Exception):
+    """合成失败；kind 取值 unavailable / disabled / timeout / error。"""
+
+    def __init__(self, kind: str, message: str):
+        super().__init__(message)
+        self.kind = kind
+
+
+def script(person: Dict[str, Any], max_chars: int) -> List[Dict[str, Any]]:
+    """解说分段：开场一句，其后每个事件一句；超出 max_chars 的事件不再加入。"""
+    events = datacheck.normalize_events([dict(e) for e in person.get('events') or []])
+    name = str(person.get('name') or '')
+    english = person.get('lang') == 'en'
+    intro = f'{name}: a journey through {len(events)} events.' if english else f'{name}的生平轨迹，共{len(events)}个事件。'
+    segments = [{'seq': None, 'text': intro}]
+    total = len(intro)
+    for e in events:
+        year = e.get('year_text') or e.get('year') or ''
+        place, title, detail = (str(e.get(k) or '').strip() for k in ('place', 'title', 'detail'))
+        if english:
+            head = ', '.join(str(x) for x in (year, place) if x)
+            text = f'{head}: {title}. {detail}'.strip()
+        else:
+            head = '，'.join(str(x) for x in (f'{year}年' if year else '', place) if x)
+            text = f'{head}，{title}。{detail}'.strip('，')
+        if total + len(text) > max_chars:
+            break
+        segments.append({'seq': e.get('seq'), 'text': text})
+        total += len(text)
+    return segments
+
+
+def _mock_wav(text: str, rate: int = 8000) -> bytes:
+    # 每个字符 80ms 正弦音（频率由字符决定），标点处 250ms 静音
+    frames = bytearray()
+    for ch in text:
+        if ch in '，。,.:：；;！!？? \n':
+            frames += b'\x00\x00' * int(rate * 0.25)
+            continue
+        freq = 220 + (ord(ch) % 40) * 10
+        n = int(rate * 0.08)
+        for i in range(n):
+            fade = min(1.0, i / 80, (n - i) / 80)
+            frames += struct.pack('<h', int(6000 * fade * math.sin(2 * math.pi * freq * i / rate)))
+    buf = io.BytesIO()
+    with wave.open(buf, 'wb') as w:
+        w.setnchannels(1)
+        w.setsampwidth(2)
+        w.setframerate(rate)
+        w.writeframes(bytes(frames))
+    return buf.getvalue()
+
+
+def _openai_speech(text: str, voice: str, timeout: float) -> bytes:
+    api_key = config.get_tts_api_key()
+    if not api_key:
+        raise TTSError('unavailable', 'missing TTS_API_KEY')
+    body = json.dumps({'model': config.get_tts_model(), 'input': text, 'voice': voice, 'response_format': 'mp3'}).encode('utf-8')
+    req = urllib.request.Request(config.get_tts_base_url() + '/v1/audio/speech', data=body, method='POST',
+                                 headers={'Authorization': f'Bearer {api_key}', 'Content-Type': 'application/json',
+                                          'User-Agent': 'feTrace/1.0'})
+    try:
+        with urllib.request.urlopen(req, timeout=timeout) as resp:
+            return resp.read()
+    except urllib.error.HTTPError as e:
+        raise TTSError('error', f'HTTP {e.code}')
+    except (TimeoutError, OSError) as e:
+        raise TTSError('timeout' if isinstance(e, TimeoutError) or 'timed out' in str(e) else 'error', repr(e))
+
+
+class Narrator:
+    def __init__(self, root: str, provider: str):
+        self.root = root
+        self.provider = provider
+        self._lock = threading.Lock()
+        self._key_locks: Dict[str, threading.Lock] = {}
+
+    def cache_key(self, text: str, lang: str, voice: str) -> str:
+        model = config.get_tts_model() if self.provider == 'openai' else ''
+        raw = json.dumps([self.provider, model, voice, lang, text], ensure_ascii=False)
+        return hashlib.sha256(raw.encode('utf-8')).hexdigest()[:32]
+
+    def cached(self, text: str, lang: str, voice: str) -> bool:
+        """该解说词是否已合成（命中缓存时无需合成，也不计额度）。"""
+        if self.provider not in EXTENSIONS:
+            return False
+        return os.path.isfile(os.path.join(self.root, self.cache_key(text, lang, voice) + EXTENSIONS[self.provider]))
+
+    def audio(self, text: str, lang: str, voice: str, timeout: float, synthesize: bool = True) -> Tuple[str, bool]:
+        """返回 (音频文件路径, 是否命中缓存)；合成失败抛出 TTSError，synthesize=False 且未缓存时 kind 为 disabled。"""
+        if self.provider not in EXTENSIONS:
+            raise TTSError('unavailable', f'TTS_PROVIDER={self.provider}')
+        key = self.cache_key(text, lang, voice)
+        path = os.path.join(self.root, key + EXTENSIONS[self.provider])
+        if os.path.isfile(path):
+            return path, True
+        if not synthesize:
+            raise TTSError('disabled', 'synthesis disabled')
+        with self._lock:
+            key_lock = self._key_locks.setdefault(key, threading.Lock())
+        with key_lock:
+            if os.path.isfile(path):
+                return path, True
+            data = _mock_wav(text) if self.provider == 'mock' else _openai_speech(text, voice, timeout)
+            if not data:
+                raise TTSError('error', 'empty audio')
+            os.makedirs(self.root, exist_ok=True)
+            tmp = f'{path}.{threading.get_ident()}.tmp'
+            with open(tmp, 'wb') as f:
+                f.write(data)
+            os.replace(tmp, path)
+            logger.info("已合成解说音频：provider=%s, chars=%d, bytes=%d", self.provider, len(text), len(data))
+        with self._lock:
+            self._key_locks.pop(key, None)
+        return path, False
@@ -0,0 +1,172 @@
+"""
+OpenAPI 3 描述（GET /api/v1/openapi.json），由路由表与处理函数生成，不另行手工维护
+
+- 路径、方法、分组（鉴权方式）来自 index.API_ROUTES；路径参数来自 {参数} 段
+- 摘要与说明取处理函数的文档字符串（首行为 summary）
+- 查询参数从处理函数源码中识别：qs.get('x') 为字符串，_int_param / _year_param / _count_param 为整数，_sort_param 为 sort，
+  写出时带 project_path 的接口另有 fields；处理函数直接调用的同模块辅助函数（_x、handle_x）一并扫描
+- 读取 JSON 请求体（read_json_body）的接口声明 application/json 请求体
+- 信封响应均可按 Accept 返回 application/msgpack；write_ok 带消息模型（model=）的接口另有 application/x-protobuf
+响应统一为 Envelope {data, meta, error, version, requestId}；人物相关接口在 data 中给出 Person 结构。
+新增接口只需登记路由并写好文档字符串与参数读取，描述随之更新。
+"""
+
+import re
+import inspect
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+import encoders
+import errors
+
+_STRING_PARAM = re.compile(r"qs\.get\('([A-Za-z_]+)'")
+_INT_PARAM = re.compile(r"_(?:int|year|count)_param\(qs, '([A-Za-z_]+)'")
+_CALL = re.compile(r"\b((?:_|handle_)[a-z][a-z_]*)\(")
+# 非 JSON 响应的接口
+CONTENT_TYPES = {
+    'handle_person_report': 'application/pdf',
+    'handle_person_narration': 'audio/mpeg',
+    'handle_person_export': '*/*',
+    'handle_tile': 'image/*',
+    'handle_proxy_image': 'image/*',
+}
+# data 为人物或人物列表的接口
+DATA_SCHEMAS = {
+    'handle_person': {'$ref': '#/components/schemas/Person'},
+    'handle_people': {'type': 'object', 'properties': {'persons': {'type': 'array', 'items': {'$ref': '#/components/schemas/Person'}}}},
+    'handle_person_generate': {'$ref': '#/components/schemas/Job'},
+    'handle_job': {'$ref': '#/components/schemas/Job'},
+}
+SCHEMAS = {
+    'Event': {'type': 'object', 'properties': {
+        'id': {'type': 'string'}, 'year': {'oneOf': [{'type': 'integer'}, {'type': 'string'}]},
+        'age': {'type': 'integer', 'nullable': True}, 'place': {'type': 'string'},
+        'lat': {'type': 'number', 'nullable': True}, 'lon': {'type': 'number', 'nullable': True},
+        'title': {'type': 'string'}, 'detail': {'type': 'string'}}},
+    'Person': {'type': 'object', 'required': ['name', 'events'], 'properties': {
+        'id': {'type': 'string'}, 'name': {'type': 'string'},
+        'style': {'type': 'object', 'nullable': True, 'properties': {'markerColor': {'type': 'string'}, 'lineColor': {'type': 'string'}}},
+        'events': {'type': 'array', 'items': {'$ref': '#/components/schemas/Event'}},
+        'updated_at': {'type': 'number', 'description': 'Unix 秒'}}},
+    'Job': {'type': 'object', 'properties': {
+        'id': {'type': 'string'}, 'type': {'type': 'string'}, 'name': {'type': 'string'},
+        'status': {'type': 'string', 'enum': ['queued', 'running', 'done', 'failed']},
+        'person': {'allOf': [{'$ref': '#/components/schemas/Person'}], 'nullable': True},
+        'error': {'allOf': [{'$ref': '#/components/schemas/Error'}], 'nullable': True}}},
+    'Error': {'type': 'object', 'required': ['code', 'message'], 'properties': {
+        'code': {'type': 'string', 'enum': sorted(errors.HTTP_STATUS)}, 'message': {'type': 'string'}, 'details': {}}},
+    'Envelope': {'type': 'object', 'required': ['data', 'meta', 'error'], 'properties': {
+        'data': {}, 'meta': {'type': 'object'}, 'error': {'allOf': [{'$ref': '#/components/schemas/Error'}], 'nullable': True},
+        'version': {'type': 'string'}, 'requestId': {'type': 'string'}}},
+}
+SECURITY_SCHEMES = {
+    'adminBearer': {'type': 'http', 'scheme': 'bearer', 'description': 'ADMIN_TOKEN'},
+    'adminToken': {'type': 'apiKey', 'in': 'header', 'name': 'X-Admin-Token'},
+    'apiKey': {'type': 'apiKey', 'in': 'header', 'name': 'X-API-Key', 'description': '按 Key 计每日配额，未带时计入 anonymous'},
+}
+
+
+def resolve_handler(endpoint: Callable) -> Optional[Callable]:
+    """路由表中的处理函数：直接登记的函数原样返回；lambda h: routes.handle_x(...) 解析出 routes.handle_x。"""
+    if getattr(endpoint, '__name__', '') != '<lambda>':
+        return endpoint
+    names = endpoint.__code__.co_names
+    for i, name in enumerate(names):
+        if name.startswith('handle_') and i > 0:
+            fn = getattr(endpoint.__globals__.get(names[i - 1]), name, None)
+            if callable(fn):
+                return fn
+    return None
+
+
+def _source(fn: Callable) -> str:
+    """处理函数及其直接调用的同模块辅助函数（不含参数解析函数）的源码。"""
+    try:
+        text = inspect.getsource(fn)
+    except (OSError, TypeError):
+        return ''
+    module = inspect.getmodule(fn)
+    for name in sorted(set(_CALL.findall(text))):
+        helper = getattr(module, name, None)
+        if inspect.isfunction(helper) and helper is not fn and not name.endswith('_param'):
+            try:
+                text += inspect.getsource(helper)
+            except (OSError, TypeError):
+                pass
+    return text
+
+
+def _params(source: str, path_params: List[str]) -> List[Dict[str, Any]]:
+    found: Dict[str, str] = {}
+    for name in _INT_PARAM.findall(source):
+        found[name] = 'integer'
+    for name in _STRING_PARAM.findall(source):
+        found.setdefault(name, 'string')
+    if '_sort_param(qs)' in source:
+        found['sort'] = 'string'
+    if 'project_path=' in source:
+        found['fields'] = 'string'
+    out = [{'name': p, 'in': 'path', 'required': True, 'schema': {'type': 'string'}} for p in path_params]
+    out += [{'name': n, 'in': 'query', 'required': False, 'schema': {'type': t}}
+            for n, t in sorted(found.items()) if n not in path_params]
+    return out
+
+
+def _operation(method: str, group: str, fn: Optional[Callable], path_params: List[str], tag: str) -> Dict[str, Any]:
+    name = getattr(fn, '__name__', '')
+    doc = inspect.cleandoc(fn.__doc__) if fn is not None and fn.__doc__ else ''
+    source = _source(fn) if fn is not None else ''
+    data_schema = DATA_SCHEMAS.get(name, {})
+    content_type = CONTENT_TYPES.get(name)
+    if content_type:
+        ok = {'description': 'OK', 'content': {content_type: {'schema': {'type': 'string', 'format': 'binary'}}}}
+    else:
+        envelope = {'allOf': [{'$ref': '#/components/schemas/Envelope'}, {'properties': {'data': data_schema}}]} if data_schema \
+            else {'$ref': '#/components/schemas/Envelope'}
+        ok = {'description': 'OK', 'content': {encoders.JSON: {'schema': envelope}, encoders.MSGPACK: {'schema': envelope}}}
+        if 'model=' in source:
+            ok['content'][encoders.PROTOBUF] = {'schema': {'type': 'string', 'format': 'binary'}}
+    error = {'description': '错误（error.code 见 Error）',
+             'content': {'application/json': {'schema': {'$ref': '#/components/schemas/Envelope'}}}}
+    op: Dict[str, Any] = {
+        'operationId': f"{method.lower()}_{name[len('handle_'):] if name.startswith('handle_') else name or 'unknown'}",
+        'summary': doc.split('\n', 1)[0] if doc else '',
+        'tags': [tag],
+        'parameters': _params(source, path_params),
+        'responses': {'200': ok, 'default': error},
+    }
+    if doc and '\n' in doc:
+        op['description'] = doc
+    if method in ('POST', 'PUT', 'PATCH') and 'read_json_body' in source:
+        op['requestBody'] = {'required': False, 'content': {'application/json': {'schema': {'type': 'object'}}}}
+    if group.startswith('admin'):
+        op['security'] = [{'adminBearer': []}, {'adminToken': []}]
+    elif group == 'public':
+        op['security'] = [{}, {'apiKey': []}]
+    return op
+
+
+def build(api_routes: Dict[str, Tuple], version: str, title: str = 'feTrace API') -> Dict[str, Any]:
+    """返回 OpenAPI 3.0 文档；路径不含 /api 前缀，servers 指向 /api/{version}。"""
+    paths: Dict[str, Dict[str, Any]] = {}
+    seen_ids: Dict[str, int] = {}
+    for route, (methods, group, endpoint) in sorted(api_routes.items()):
+        rel = route[len('/api'):] if route.startswith('/api/') else route
+        segments = rel.split('/')
+        path_params = [s[1:-1] for s in segments if s.startswith('{') and s.endswith('}')]
+        tag = 'admin' if group.startswith('admin') else (segments[1] if len(segments) > 1 else 'api')
+        fn = resolve_handler(endpoint)
+        item = paths.setdefault(rel, {})
+        for method in methods:
+            op = _operation(method, group, fn, path_params, tag)
+            n = seen_ids.get(op['operationId'], 0)
+            seen_ids[op['operationId']] = n + 1
+            if n:
+                op['operationId'] += f'_{n + 1}'
+            item[method.lower()] = op
+    return {
+        'openapi': '3.0.3',
+        'info': {'title': title, 'version': version},
+        'servers': [{'url': f'/api/{version}'}],
+        'paths': paths,
+        'components': {'schemas': SCHEMAS, 'securitySchemes': SECURITY_SCHEMES},
+    }
@@ -0,0 +1,304 @@
+"""
+人物轨迹时空查询：交集分析（GET /api/overlap）、同地查询（GET /api/query/colocation）、年份快照（GET /api/snapshot）、
+行程路径（GET /api/person/{name}/path）、行程统计（/api/person 的 meta.travel 与 GET /api/stats）
+
+每个事件视为一段停留：自该事件年份起，到下一个有年份的事件为止（最后一个事件只占当年）。
+两位人物的停留在时间上相交（可放宽 window 年）且地点相同时记为一次交集：
+地点按归一化名称相同，或双方都有坐标且相距不超过 radius_km 公里。
+同地查询返回在给定时段内停留于某地（名称相同或在半径内）的全部人物；人物列表（GET /api/people）按事件年份与地点筛选。
+年份快照返回当年处于活动期（首末事件之间）的人物及其最近一次事件的位置。
+多人对照（GET /api/compare）按年份对齐多位人物：每一年各人在做什么、在哪里、几岁。
+合并时间线（GET /api/timeline/merged）把多位人物的事件按年份排成一条事件流，供合并地图动画使用。
+行程路径按时间顺序串联有坐标的停留，相邻两点间可按大圆插值，便于地图平滑动画。
+行程统计基于行程路径：总里程、到过的不同地点数、停留最久之处、离出生地（首个有坐标的停留）最远之处。
+仅使用已缓存的数据，不触发生成。
+"""
+
+import math
+from typing import Any, Dict, List, Optional, Tuple
+
+import ages
+import datacheck
+from textnorm import name_key
+
+
+def _coords(e: Dict[str, Any]) -> Optional[Tuple[float, float]]:
+    try:
+        return float(e.get('lat')), float(e.get('lon'))
+    except (TypeError, ValueError):
+        return None
+
+
+def distance_km(a: Tuple[float, float], b: Tuple[float, float]) -> float:
+    lat1, lon1, lat2, lon2 = map(math.radians, (a[0], a[1], b[0], b[1]))
+    h = math.sin((lat2 - lat1) / 2) ** 2 + math.cos(lat1) * math.cos(lat2) * math.sin((lon2 - lon1) / 2) ** 2
+    return 6371.0 * 2 * math.asin(math.sqrt(min(1.0, h)))
+
+
+def stays(person: Dict[str, Any]) -> List[Dict[str, Any]]:
+    """[{start, end, place, coords, event}]，按年份升序；年份无法解析的事件不参与。"""
+    dated = []
+    for i, e in enumerate(person.get('events') or []):
+        year = datacheck.parse_year(e.get('year'))
+        if year is not None:
+            dated.append((year, i, e))
+    dated.sort(key=lambda t: (t[0], t[1]))
+    out = []
+    for k, (year, i, e) in enumerate(dated):
+        end = dated[k + 1][0] if k + 1 < len(dated) and dated[k + 1][0] > year else year
+        out.append({'start': year, 'end': end, 'place': str(e.get('place') or '').strip(),
+                    'coords': _coords(e), 'event': i, 'title': e.get('title', '')})
+    return out
+
+
+def _same_place(a: Dict[str, Any], b: Dict[str, Any], radius_km: float) -> Optional[float]:
+    """同地返回距离（公里，名称相同时为 0），否则 None。"""
+    if a['place'] and name_key(a['place']) == name_key(b['place']):
+        return 0.0
+    if radius_km > 0 and a['coords'] and b['coords']:
+        d = distance_km(a['coords'], b['coords'])
+        if d <= radius_km:
+            return round(d, 1)
+    return None
+
+
+def find(persons: List[Dict[str, Any]], window: int = 0, radius_km: float = 0) -> List[Dict[str, Any]]:
+    """两两比较人物停留，返回交集列表（按起始年份排序）。"""
+    spans = [(p.get('name', ''), stays(p)) for p in persons]
+    out = []
+    for x in range(len(spans)):
+        for y in range(x + 1, len(spans)):
+            (name_a, stays_a), (name_b, stays_b) = spans[x], spans[y]
+            for a in stays_a:
+                for b in stays_b:
+                    if a['start'] > b['end'] + window or b['start'] > a['end'] + window:
+                        continue
+                    dist = _same_place(a, b, radius_km)
+                    if dist is None:
+                        continue
+                    out.append({
+                        'years': [max(a['start'], b['start']), min(a['end'], b['end'])],
+                        'place': a['place'] or b['place'],
+                        'distance_km': dist,
+                        'persons': [
+                            {'name': name_a, 'event': a['event'], 'place': a['place'], 'title': a['title'], 'years': [a['start'], a['end']]},
+                            {'name': name_b, 'event': b['event'], 'place': b['place'], 'title': b['title'], 'years': [b['start'], b['end']]},
+                        ],
+                    })
+    out.sort(key=lambda o: (o['years'][0], o['place']))
+    return out
+
+
+def event_matches(e: Dict[str, Any], year_from: Optional[int], year_to: Optional[int], place: str = '') -> bool:
+    """事件年份落在 [year_from, year_to]（任一端可为空，有年份条件时无法解析的年份不匹配），
+    且地点包含 place（归一化后子串匹配，「上海」匹配「上海县」）。"""
+    if year_from is not None or year_to is not None:
+        year = datacheck.parse_year(e.get('year'))
+        if year is None or (year_from is not None and year < year_from) or (year_to is not None and year > year_to):
+            return False
+    return not place or name_key(place) in name_key(str(e.get('place') or ''))
+
+
+def place_coords(persons: List[Dict[str, Any]], place: str) -> Optional[Tuple[float, float]]:
+    """从已缓存事件中取该地名的坐标（无需地理编码）。"""
+    key = name_key(place)
+    for p in persons:
+        for e in p.get('events') or []:
+            if name_key(str(e.get('place') or '')) == key:
+                c = _coords(e)
+                if c:
+                    return c
+    return None
+
+
+def colocated(persons: List[Dict[str, Any]], place: str, coords: Optional[Tuple[float, float]],
+              year_from: Optional[int], year_to: Optional[int], radius_km: float = 0) -> List[Dict[str, Any]]:
+    """时段 [year_from, year_to]（任一端可为空）内停留于该地的人物，按最早停留年份排序。"""
+    target = {'place': place, 'coords': coords}
+    out = []
+    for p in persons:
+        matched = []
+        for s in stays(p):
+            if (year_to is not None and s['start'] > year_to) or (year_from is not None and s['end'] < year_from):
+                continue
+            dist = _same_place(target, s, radius_km)
+            if dist is None:
+                continue
+            matched.append({'event': s['event'], 'place': s['place'], 'title': s['title'],
+                            'years': [s['start'], s['end']], 'distance_km': dist})
+        if matched:
+            out.append({'name': p.get('name', ''), 'events': matched})
+    out.sort(key=lambda r: (r['events'][0]['years'][0], r['name']))
+    return out
+
+
+def snapshot(persons: List[Dict[str, Any]], year: int) -> List[Dict[str, Any]]:
+    """各人物在 year 年的位置：取起始年份不晚于 year 的最近一次停留；status 为 event（当年有事件）或 staying。"""
+    out = []
+    for p in persons:
+        spans = stays(p)
+        if not spans or year < spans[0]['start'] or year > spans[-1]['end']:
+            continue
+        current = [s for s in spans if s['start'] <= year][-1]
+        event = (p.get('events') or [])[current['event']]
+        birth = ages.birth_year(p)
+        out.append({
+            'name': p.get('name', ''),
+            'place': current['place'],
+            'lat': current['coords'][0] if current['coords'] else None,
+            'lon': current['coords'][1] if current['coords'] else None,
+            'title': current['title'],
+            'event': current['event'],
+            'since': current['start'],
+            'status': 'event' if current['start'] == year else 'staying',
+            'age': year - birth if birth is not None and year >= birth else None,
+            'year': event.get('year'),
+            'style': p.get('style'),
+        })
+    out.sort(key=lambda r: r['name'])
+    return out
+
+
+def compare(persons: List[Dict[str, Any]], year_from: Optional[int] = None, year_to: Optional[int] = None,
+            all_years: bool = False, max_rows: int = 1000) -> Optional[Dict[str, Any]]:
+    """按年份对齐多位人物的轨迹。
+
+    行取各人事件年份的并集（all_years 时取首末年份之间的每一年），限定在 [year_from, year_to] 内；
+    每行 persons 与输入顺序一致，各项 status 为 event（当年有事件，events 为这些事件的序号）、
+    staying（仍在上一次事件的地点）、before / after（不在其首末事件之间，只给出 status）。
+    行数超过 max_rows 时返回 None。
+    """
+    infos = []
+    for p in persons:
+        spans = stays(p)
+        by_year: Dict[int, List[int]] = {}
+        for s in spans:
+            by_year.setdefault(s['start'], []).append(s['event'])
+        infos.append({'person': p, 'spans': spans, 'by_year': by_year, 'birth': ages.birth_year(p)})
+    starts = [i['spans'][0]['start'] for i in infos if i['spans']]
+    ends = [i['spans'][-1]['end'] for i in infos if i['spans']]
+    if not starts:
+        years: List[int] = []
+    elif all_years:
+        lo = max(min(starts), year_from) if year_from is not None else min(starts)
+        hi = min(max(ends), year_to) if year_to is not None else max(ends)
+        if hi - lo + 1 > max_rows:
+            return None
+        years = list(range(lo, hi + 1))
+    else:
+        years = sorted(set(y for i in infos for y in i['by_year']
+                           if (year_from is None or y >= year_from) and (year_to is None or y <= year_to)))
+    if len(years) > max_rows:
+        return None
+    rows = []
+    for year in years:
+        entries = []
+        for i in infos:
+            spans = i['spans']
+            if not spans or year < spans[0]['start']:
+                entries.append({'status': 'before'})
+                continue
+            if year > spans[-1]['end']:
+                entries.append({'status': 'after'})
+                continue
+            current = [s for s in spans if s['start'] <= year][-1]
+            birth = i['birth']
+            entry = {'status': 'event' if year in i['by_year'] else 'staying', 'place': current['place'],
+                     'title': current['title'], 'since': current['start'],
+                     'age': year - birth if birth is not None and year >= birth else None}
+            if year in i['by_year']:
+                entry['events'] = i['by_year'][year]
+            entries.append(entry)
+        rows.append({'year': year, 'persons': entries})
+    summary = [{'name': i['person'].get('name', ''), 'birth_year': i['birth'], 'style': i['person'].get('style'),
+                'span': [i['spans'][0]['start'], i['spans'][-1]['end']] if i['spans'] else None} for i in infos]
+    # 所有人都处于活动期的年份区间（无交集时为 None）
+    common = [max(starts), min(ends)] if len(starts) == len(infos) and starts and max(starts) <= min(ends) else None
+    return {'persons': summary, 'rows': rows, 'common_span': common}
+
+
+def merged(persons: List[Dict[str, Any]], year_from: Optional[int] = None, year_to: Optional[int] = None) -> Dict[str, Any]:
+    """多位人物的事件按年份稳定排序：同一年按人物的输入顺序、同一人按原事件顺序。
+    每项带 person（人物序号）与 event（原事件序号）；年份无法解析的事件不参与，计入 undated。"""
+    items, undated = [], 0
+    for pi, p in enumerate(persons):
+        birth = ages.birth_year(p)
+        for ei, e in enumerate(p.get('events') or []):
+            year = datacheck.parse_year(e.get('year'))
+            if year is None:
+                undated += 1
+                continue
+            if (year_from is not None and year < year_from) or (year_to is not None and year > year_to):
+                continue
+            coords = _coords(e)
+            items.append({'year': year, 'name': p.get('name', ''), 'person': pi, 'event': ei,
+                          'place': e.get('place', ''), 'lat': coords[0] if coords else None, 'lon': coords[1] if coords else None,
+                          'title': e.get('title', ''), 'detail': e.get('detail', ''),
+                          'age': year - birth if birth is not None and year >= birth else None})
+    items.sort(key=lambda it: (it['year'], it['person'], it['event']))
+    return {'persons': [{'name': p.get('name', ''), 'style': p.get('style')} for p in persons],
+            'events': items, 'undated': undated}
+
+
+def great_circle(a: Tuple[float, float], b: Tuple[float, float], steps: int) -> List[List[float]]:
+    """a、b 之间大圆上等分的 steps 个中间点（不含端点），[[lat, lon], ...]。"""
+    lat1, lon1, lat2, lon2 = map(math.radians, (a[0], a[1], b[0], b[1]))
+    d = distance_km(a, b) / 6371.0
+    if steps <= 0 or d == 0:
+        return []
+    out = []
+    for k in range(1, steps + 1):
+        f = k / (steps + 1)
+        s1, s2 = math.sin((1 - f) * d) / math.sin(d), math.sin(f * d) / math.sin(d)
+        x = s1 * math.cos(lat1) * math.cos(lon1) + s2 * math.cos(lat2) * math.cos(lon2)
+        y = s1 * math.cos(lat1) * math.sin(lon1) + s2 * math.cos(lat2) * math.sin(lon2)
+        z = s1 * math.sin(lat1) + s2 * math.sin(lat2)
+        out.append([round(math.degrees(math.atan2(z, math.hypot(x, y))), 5), round(math.degrees(math.atan2(y, x)), 5)])
+    return out
+
+
+def path(person: Dict[str, Any], steps: int = 0) -> Dict[str, Any]:
+    """{'points': [{lat, lon, year, place, title, event}], 'segments': [{from, to, years, distance_km, points?}]}；
+    相邻且坐标相同的停留合并为一个点。steps > 0 时每段附带大圆插值点。"""
+    points: List[Dict[str, Any]] = []
+    for s in stays(person):
+        if not s['coords']:
+            continue
+        if points and [points[-1]['lat'], points[-1]['lon']] == list(s['coords']):
+            points[-1]['until'] = s['end']
+            continue
+        points.append({'lat': s['coords'][0], 'lon': s['coords'][1], 'year': s['start'], 'until': s['end'],
+                       'place': s['place'], 'title': s['title'], 'event': s['event']})
+    segments = []
+    for i in range(1, len(points)):
+        a, b = points[i - 1], points[i]
+        seg = {'from': i - 1, 'to': i, 'years': [a['year'], b['year']],
+               'distance_km': round(distance_km((a['lat'], a['lon']), (b['lat'], b['lon'])), 1)}
+        if steps > 0:
+            seg['points'] = great_circle((a['lat'], a['lon']), (b['lat'], b['lon']), steps)
+        segments.append(seg)
+    return {'points': points, 'segments': segments}
+
+
+def travel_stats(person: Dict[str, Any]) -> Dict[str, Any]:
+    route = path(person)
+    points = route['points']
+    places = {name_key(str(e.get('place') or '')) for e in person.get('events') or []} - {''}
+    out: Dict[str, Any] = {
+        'total_km': round(sum(s['distance_km'] for s in route['segments']), 1),
+        'distinct_places': len(places),
+        'longest_stay': None,
+        'furthest_from_birthplace': None,
+    }
+    if not points:
+        return out
+    longest = max(points, key=lambda p: (p['until'] - p['year'], -p['year']))
+    out['longest_stay'] = {'place': longest['place'], 'years': [longest['year'], longest['until']],
+                           'duration': longest['until'] - longest['year']}
+    home = points[0]
+    far = max(points, key=lambda p: distance_km((home['lat'], home['lon']), (p['lat'], p['lon'])))
+    out['furthest_from_birthplace'] = {
+        'place': far['place'], 'year': far['year'], 'birthplace': home['place'],
+        'distance_km': round(distance_km((home['lat'], home['lon']), (far['lat'], far['lon'])), 1),
+    }
+    return out
@@ -0,0 +1,114 @@
+"""
+protobuf（proto3）线格式的最小编解码，供 grpcapi.py 使用，不依赖 protobuf 运行库与 protoc 生成代码
+
+消息结构以字典描述：{字段名: (字段号, 类型, 标签)}
+- 类型：'string' | 'int32' | 'bool' | 'double'，或嵌套消息的结构字典
+- 标签：'' 普通字段（缺省为零值）、'optional'（未设置时解码为 None）、'repeated'（仅支持 string 与消息）
+编码时值为 None 的字段不写出；解码时跳过未知字段，便于 .proto 向后兼容地增加字段。
+结构须与 proto/fetrace.proto 保持一致。
+"""
+
+import struct
+from typing import Any, Dict, Tuple
+
+VARINT, FIXED64, LEN, FIXED32 = 0, 1, 2, 5
+_WIRE = {'string': LEN, 'int32': VARINT, 'bool': VARINT, 'double': FIXED64}
+_DEFAULTS = {'string': '', 'int32': 0, 'bool': False, 'double': 0.0}
+
+
+def _varint(n: int) -> bytes:
+    n &= 0xFFFFFFFFFFFFFFFF  # 负数按 64 位补码写出（与 protobuf 的 int32 一致）
+    out = bytearray()
+    while True:
+        b = n & 0x7F
+        n >>= 7
+        if n:
+            out.append(b | 0x80)
+        else:
+            out.append(b)
+            return bytes(out)
+
+
+def _read_varint(buf: bytes, pos: int) -> Tuple[int, int]:
+    n = shift = 0
+    while True:
+        if pos >= len(buf) or shift > 63:
+            raise ValueError('truncated varint')
+        b = buf[pos]
+        pos += 1
+        n |= (b & 0x7F) << shift
+        if not b & 0x80:
+            return n, pos
+        shift += 7
+
+
+def _encode_value(kind: Any, value: Any) -> bytes:
+    if isinstance(kind, dict):
+        return encode(kind, value)
+    if kind == 'string':
+        return str(value).encode('utf-8')
+    if kind == 'double':
+        return struct.pack('<d', float(value))
+    return _varint(int(value))
+
+
+def encode(schema: Dict[str, tuple], msg: Dict[str, Any]) -> bytes:
+    out = bytearray()
+    for name, (number, kind, label) in schema.items():
+        value = msg.get(name)
+        if value is None:
+            continue
+        wire = LEN if isinstance(kind, dict) else _WIRE[kind]
+        for item in (value if label == 'repeated' else [value]):
+            data = _encode_value(kind, item)
+            out += _varint(number << 3 | wire)
+            out += _varint(len(data)) + data if wire == LEN else data
+    return bytes(out)
+
+
+def decode(schema: Dict[str, tuple], buf: bytes) -> Dict[str, Any]:
+    by_number = {spec[0]: (name, spec[1], spec[2]) for name, spec in schema.items()}
+    msg: Dict[str, Any] = {}
+    for name, (_, kind, label) in schema.items():
+        if label == 'repeated':
+            msg[name] = []
+        elif label == 'optional' or isinstance(kind, dict):
+            msg[name] = None
+        else:
+            msg[name] = _DEFAULTS[kind]
+    pos = 0
+    while pos < len(buf):
+        tag, pos = _read_varint(buf, pos)
+        number, wire = tag >> 3, tag & 7
+        if wire == VARINT:
+            raw, pos = _read_varint(buf, pos)
+        elif wire == FIXED64:
+            raw, pos = buf[pos:pos + 8], pos + 8
+        elif wire == FIXED32:
+            raw, pos = buf[pos:pos + 4], pos + 4
+        elif wire == LEN:
+            size, pos = _read_varint(buf, pos)
+            raw, pos = buf[pos:pos + size], pos + size
+        else:
+            raise ValueError(f'unsupported wire type {wire}')
+        if pos > len(buf):
+            raise ValueError('truncated message')
+        field = by_number.get(number)
+        if field is None:
+            continue
+        name, kind, label = field
+        if isinstance(kind, dict):
+            value = decode(kind, raw)
+        elif kind == 'string':
+            value = bytes(raw).decode('utf-8')
+        elif kind == 'double':
+            value = struct.unpack('<d', raw)[0]
+        elif kind == 'bool':
+            value = bool(raw)
+        else:
+            value = raw - (1 << 64) if raw >= 1 << 63 else raw
+        if label == 'repeated':
+            msg[name].append(value)
+        else:
+            msg[name] = value
+    return msg
@@ -0,0 +1,200 @@
+"""
+人物传记 PDF 报告（GET /api/person/{name}/report.pdf）
+
+不依赖第三方库：直接输出 PDF 1.4，中文使用阅读器内置的 Adobe-GB1 字体 STSong-Light（不嵌入字体，
+UniGB-UCS2-H 编码），A4 纵向。内容依次为：
+- 标题与概要（事件数、年份跨度、朝代、行程统计）
+- 行程缩略图：按经纬度等比缩放的路线与地点（无底图）
+- 按时间顺序的事件表（年份、年龄、地点、事件、详情），超出一页自动分页
+"""
+
+import time
+from typing import Any, Dict, List, Tuple
+
+import datacheck
+import dynasty
+import overlap
+
+PAGE_W, PAGE_H = 595, 842
+MARGIN = 40
+FONT_SIZE = 9
+LINE_H = 13
+# 事件表各列：(表头, 字段, 宽度)
+COLUMNS = [('年份', 'year', 48), ('年龄', 'age', 30), ('地点', 'place', 72), ('事件', 'title', 130), ('详情', 'detail', 235)]
+
+
+def _hex(text: str) -> str:
+    # UniGB-UCS2-H：每个字符两字节；BMP 以外的字符无法表示，以问号代替
+    return ''.join('%04X' % (ord(ch) if ord(ch) <= 0xFFFF else 0x3F) for ch in text)
+
+
+def text_width(text: str, size: float) -> float:
+    return sum(size * (0.5 if ord(ch) < 0x80 else 1.0) for ch in text)
+
+
+def wrap(text: str, width: float, size: float) -> List[str]:
+    lines, line = [], ''
+    for ch in str(text or '').replace('\r', ''):
+        if ch == '\n':
+            lines.append(line)
+            line = ''
+            continue
+        if text_width(line + ch, size) > width:
+            lines.append(line)
+            line = ''
+        line += ch
+    if line or not lines:
+        lines.append(line)
+    return lines
+
+
+class Canvas:
+    """单页绘图指令（PDF 坐标原点在左下角，此处统一换算为自上而下的 y）。"""
+
+    def __init__(self):
+        self.ops: List[str] = []
+
+    def text(self, x: float, y: float, text: str, size: float = FONT_SIZE):
+        if text:
+            self.ops.append(f'BT /F1 {size} Tf {x:.1f} {PAGE_H - y:.1f} Td <{_hex(text)}> Tj ET')
+
+    def line(self, x1: float, y1: float, x2: float, y2: float, width: float = 0.5, gray: float = 0):
+        self.ops.append(f'{gray} G {width} w {x1:.1f} {PAGE_H - y1:.1f} m {x2:.1f} {PAGE_H - y2:.1f} l S')
+
+    def rect(self, x: float, y: float, w: float, h: float, gray: float = 0.6):
+        self.ops.append(f'{gray} G 0.5 w {x:.1f} {PAGE_H - y - h:.1f} {w:.1f} {h:.1f} re S')
+
+    def dot(self, x: float, y: float, r: float = 2):
+        # 以小方块近似圆点，足够缩略图使用
+        self.ops.append(f'0.2 0.4 0.8 rg {x - r:.1f} {PAGE_H - y - r:.1f} {2 * r:.1f} {2 * r:.1f} re f 0 g')
+
+    def stream(self) -> bytes:
+        return '\n'.join(self.ops).encode('latin-1')
+
+
+def _route_thumbnail(c: Canvas, points: List[Dict[str, Any]], x: float, y: float, w: float, h: float):
+    c.rect(x, y, w, h)
+    if not points:
+        c.text(x + 8, y + h / 2, '无坐标数据')
+        return
+    lats = [p['lat'] for p in points]
+    lons = [p['lon'] for p in points]
+    span = max(max(lats) - min(lats), max(lons) - min(lons), 0.5)
+    scale = min((w - 24) / span, (h - 24) / span)
+    cx, cy = (max(lons) + min(lons)) / 2, (max(lats) + min(lats)) / 2
+
+    def pos(p) -> Tuple[float, float]:
+        return x + w / 2 + (p['lon'] - cx) * scale, y + h / 2 - (p['lat'] - cy) * scale
+
+    for a, b in zip(points, points[1:]):
+        (x1, y1), (x2, y2) = pos(a), pos(b)
+        c.line(x1, y1, x2, y2, width=0.8, gray=0.5)
+    labelled = set()
+    for p in points:
+        px, py = pos(p)
+        c.dot(px, py)
+        if p['place'] and p['place'] not in labelled:
+            labelled.add(p['place'])
+            c.text(px + 4, py - 3, p['place'], size=7)
+
+
+def _summary(person: Dict[str, Any]) -> List[str]:
+    events = person.get('events') or []
+    spans = overlap.stays(person)
+    travel = overlap.travel_stats(person)
+    lines = [f'事件 {len(events)} 条' + (f'，{spans[0]["start"]}–{spans[-1]["end"]} 年' if spans else '')]
+    eras = dynasty.TABLE.annotate(person, write=False)
+    if eras:
+        lines.append('朝代：' + '、'.join(eras))
+    lines.append(f'行程约 {travel["total_km"]:.0f} 公里，到过 {travel["distinct_places"]} 个地点')
+    if travel['longest_stay']:
+        s = travel['longest_stay']
+        lines.append(f'停留最久：{s["place"]}（{s["years"][0]}–{s["years"][1]}，{s["duration"]} 年）')
+    if travel['furthest_from_birthplace']:
+        f = travel['furthest_from_birthplace']
+        lines.append(f'离出生地（{f["birthplace"]}）最远：{f["place"]}，约 {f["distance_km"]:.0f} 公里')
+    return lines
+
+
+def _table_header(c: Canvas, y: float) -> float:
+    x = MARGIN
+    for title, _, width in COLUMNS:
+        c.text(x, y, title, size=FONT_SIZE + 1)
+        x += width
+    c.line(MARGIN, y + 4, PAGE_W - MARGIN, y + 4)
+    return y + LINE_H + 2
+
+
+def render(person: Dict[str, Any]) -> bytes:
+    """生成 PDF 文件内容。"""
+    pages: List[Canvas] = [Canvas()]
+    c = pages[0]
+    c.text(MARGIN, MARGIN + 16, str(person.get('name', '')), size=20)
+    c.text(PAGE_W - MARGIN - 150, MARGIN + 16, time.strftime('生成于 %Y-%m-%d'), size=8)
+    y = MARGIN + 44
+    for line in _summary(person):
+        c.text(MARGIN, y, line, size=10)
+        y += LINE_H + 2
+    y += 6
+    _route_thumbnail(c, overlap.path(person)['points'], MARGIN, y, PAGE_W - 2 * MARGIN, 200)
+    y = _table_header(c, y + 200 + 24)
+
+    for e in datacheck.normalize_events([dict(e) for e in person.get('events') or []]):
+        # 年号纪年的事件显示原文
+        values = dict(e, year=e.get('year_text') or e.get('year', ''))
+        cells = [wrap(values.get(field, ''), width - 6, FONT_SIZE) for _, field, width in COLUMNS]
+        rows = max(len(cell) for cell in cells)
+        if y + rows * LINE_H > PAGE_H - MARGIN:
+            c = Canvas()
+            pages.append(c)
+            y = _table_header(c, MARGIN + 10)
+        x = MARGIN
+        for cell, (_, _, width) in zip(cells, COLUMNS):
+            for k, line in enumerate(cell):
+                c.text(x, y + k * LINE_H, line)
+            x += width
+        y += rows * LINE_H
+        c.line(MARGIN, y - 8, PAGE_W - MARGIN, y - 8, width=0.3, gray=0.8)
+        y += 4
+    for i, page in enumerate(pages):
+        page.text(PAGE_W / 2 - 10, PAGE_H - 20, f'{i + 1} / {len(pages)}', size=8)
+    return _assemble(pages, str(person.get('name', '')))
+
+
+def _assemble(pages: List[Canvas], title: str) -> bytes:
+    objects: List[bytes] = []
+
+    def add(body: bytes) -> int:
+        objects.append(body)
+        return len(objects)
+
+    catalog = add(b'')  # 1：目录，页树编号确定后回填
+    page_tree = add(b'')  # 2
+    descriptor = add(b'<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] '
+                     b'/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>')
+    cid_font = add(('<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light '
+                    '/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> '
+                    f'/FontDescriptor {descriptor} 0 R /DW 1000 /W [1 95 500] >>').encode())
+    font = add(('<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light-UniGB-UCS2-H /Encoding /UniGB-UCS2-H '
+                f'/DescendantFonts [{cid_font} 0 R] >>').encode())
+    kids = []
+    for page in pages:
+        data = page.stream()
+        content = add(b'<< /Length %d >>\nstream\n' % len(data) + data + b'\nendstream')
+        kids.append(add((f'<< /Type /Page /Parent {page_tree} 0 R /MediaBox [0 0 {PAGE_W} {PAGE_H}] '
+                         f'/Resources << /Font << /F1 {font} 0 R >> >> /Contents {content} 0 R >>').encode()))
+    info = add(f'<< /Title <FEFF{_hex(title)}> /Producer (feTrace) >>'.encode())
+    objects[catalog - 1] = f'<< /Type /Catalog /Pages {page_tree} 0 R >>'.encode()
+    objects[page_tree - 1] = f'<< /Type /Pages /Kids [{" ".join(f"{k} 0 R" for k in kids)}] /Count {len(kids)} >>'.encode()
+
+    out = bytearray(b'%PDF-1.4\n%\xe2\xe3\xcf\xd3\n')
+    offsets = []
+    for i, body in enumerate(objects, 1):
+        offsets.append(len(out))
+        out += b'%d 0 obj\n' % i + body + b'\nendobj\n'
+    xref = len(out)
+    out += b'xref\n0 %d\n0000000000 65535 f \n' % (len(objects) + 1)
+    for off in offsets:
+        out += b'%010d 00000 n \n' % off
+    out += b'trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n' % (len(objects) + 1, catalog, info, xref)
+    return bytes(out)
@@ -0,0 +1,62 @@
+"""
+响应字段投影（?fields=name,events.year,events.place）
+
+- 字段路径以点分隔，数组透明（events.year 表示每个事件只保留 year）
+- 只构造新对象，不修改缓存中的原始数据
+- 派生字段（如 eventCount 事件数）按需计算，列表页只取 name,style,eventCount 即可不传事件详情
+"""
+
+from typing import Any, Callable, Dict, List, Optional
+
+# 人物对象（带 events 列表）上可选的派生字段
+DERIVED: Dict[str, Callable[[Dict[str, Any]], Any]] = {
+    'eventCount': lambda p: len(p.get('events') or []),
+}
+
+
+def parse_fields(spec: str) -> Optional[Dict[str, Any]]:
+    """将 "name,events.year" 解析为字段树 {"name": True, "events": {"year": True}}；空则返回 None。"""
+    tree: Dict[str, Any] = {}
+    for raw in str(spec or '').split(','):
+        parts = [p.strip() for p in raw.strip().split('.') if p.strip()]
+        if not parts:
+            continue
+        node = tree
+        for i, part in enumerate(parts):
+            last = i == len(parts) - 1
+            cur = node.get(part)
+            if last:
+                node[part] = True
+            elif cur is True:
+                break  # 已选择整个字段，子路径无需再细分
+            else:
+                node = node.setdefault(part, {})
+    return tree or None
+
+
+def project(obj: Any, tree: Dict[str, Any]) -> Any:
+    if isinstance(obj, list):
+        return [project(x, tree) for x in obj]
+    if not isinstance(obj, dict):
+        return obj
+    out = {}
+    for key, sub in tree.items():
+        if key not in obj:
+            if sub is True and key in DERIVED and isinstance(obj.get('events'), list):
+                out[key] = DERIVED[key](obj)
+            continue
+        out[key] = obj[key] if sub is True else project(obj[key], sub)
+    return out
+
+
+def project_at(obj: Any, path: List[str], tree: Dict[str, Any]) -> Any:
+    """在 path 指向的位置（如 people 响应中的 persons）应用投影，其余结构保持不变。"""
+    if not path:
+        return project(obj, tree)
+    if isinstance(obj, list):
+        return [project_at(x, path, tree) for x in obj]
+    if not isinstance(obj, dict) or path[0] not in obj or obj[path[0]] is None:
+        return obj
+    out = dict(obj)
+    out[path[0]] = project_at(obj[path[0]], path[1:], tree)
+    return out
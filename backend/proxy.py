@@ -0,0 +1,216 @@
+"""
+地图瓦片与外部图片代理（带磁盘缓存）
+
+前端经由本服务取图，避免跨域限制与直接盗链第三方站点：
+- 瓦片：GET /api/tiles/{provider}/{z}/{x}/{y}，按 TILE_PROVIDERS 中的地址模板回源（{s} 在 a/b/c 间轮换），y 可带 .png 后缀
+- 图片：GET /api/proxy/image?url=，仅代理已缓存人物事件 media 中引用的外部图片，不做开放代理
+- 磁盘缓存：PROXY_CACHE_DIR，总量超过 PROXY_CACHE_MAX_BYTES 时按最近访问时间淘汰（命中时刷新 mtime）
+- 上游限流：每个上游主机每秒至多 PROXY_UPSTREAM_RATE_PER_SEC 次回源（令牌桶），超出直接返回 429，不排队
+- 只接受按文件头识别为图片的内容（见 media.sniff），单个不超过 PROXY_MAX_BYTES
+"""
+
+import os
+import time
+import hashlib
+import logging
+import threading
+import urllib.error
+import urllib.request
+from typing import Any, Dict, Iterable, List, Optional, Tuple
+from urllib.parse import urlparse
+
+import media
+
+logger = logging.getLogger('api')
+
+DEFAULT_PROVIDERS = {
+    'osm': 'https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png',
+    'carto': 'https://{s}.basemaps.cartocdn.com/light_all/{z}/{x}/{y}.png',
+    'geoq': 'http://map.geoq.cn/arcgis/rest/services/ChinaOnlineStreetPurplishBlue/MapServer/tile/{z}/{y}/{x}',
+}
+MAX_ZOOM = 20
+MIME_BY_EXT = {'.jpg': 'image/jpeg', '.png': 'image/png', '.gif': 'image/gif', '.webp': 'image/webp'}
+
+
+class UpstreamError(Exception):
+    """回源失败；status 为上游状态码（网络错误、超时时为 None）。"""
+
+    def __init__(self, reason: str, status: Optional[int] = None, timeout: bool = False):
+        super().__init__(reason)
+        self.status = status
+        self.timeout = timeout
+
+
+def tile_url(template: str, z: int, x: int, y: int) -> str:
+    s = 'abc'[(x + y) % 3]
+    return template.replace('{s}', s).replace('{z}', str(z)).replace('{x}', str(x)).replace('{y}', str(y)).replace('{r}', '')
+
+
+def parse_tile(z: str, x: str, y: str) -> Optional[Tuple[int, int, int]]:
+    """校验瓦片坐标（y 可带扩展名），越界或非整数时返回 None。"""
+    y = y.split('.', 1)[0]
+    try:
+        zi, xi, yi = int(z), int(x), int(y)
+    except ValueError:
+        return None
+    if not 0 <= zi <= MAX_ZOOM or not 0 <= xi < 2 ** zi or not 0 <= yi < 2 ** zi:
+        return None
+    return zi, xi, yi
+
+
+def referenced_images(persons: Iterable[Dict[str, Any]]) -> set:
+    """事件 media 中引用的外部图片地址。"""
+    urls = set()
+    for p in persons:
+        for e in p.get('events') or []:
+            for m in e.get('media') or []:
+                url = str(m.get('url') or '')
+                if m.get('type') == 'image' and urlparse(url).scheme in ('http', 'https'):
+                    urls.add(url)
+    return urls
+
+
+class TokenBucket:
+    """按键（上游主机）的令牌桶，容量为一秒的配额（至少 1）。"""
+
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._buckets: Dict[str, Tuple[float, float]] = {}
+
+    def allow(self, key: str, rate: float) -> bool:
+        if rate <= 0:
+            return True
+        now = time.monotonic()
+        burst = max(rate, 1.0)
+        with self._lock:
+            tokens, last = self._buckets.get(key, (burst, now))
+            tokens = min(burst, tokens + (now - last) * rate)
+            if tokens < 1:
+                self._buckets[key] = (tokens, now)
+                return False
+            self._buckets[key] = (tokens - 1, now)
+            return True
+
+
+class DiskCache:
+    """以地址哈希命名的文件缓存；总量按需统计，超限时删除最久未访问的文件直到降至上限的 90%。"""
+
+    def __init__(self, root: str, max_bytes: int):
+        self.root = root
+        self.max_bytes = max_bytes
+        self._lock = threading.Lock()
+        self._total: Optional[int] = None
+        self.hits = 0
+        self.misses = 0
+
+    def _path(self, key: str) -> str:
+        digest = hashlib.sha256(key.encode('utf-8')).hexdigest()
+        return os.path.join(self.root, digest[:2], digest[2:34])
+
+    def get(self, key: str) -> Optional[bytes]:
+        path = self._path(key)
+        try:
+            with open(path, 'rb') as f:
+                data = f.read()
+            os.utime(path)
+        except OSError:
+            self.misses += 1
+            return None
+        self.hits += 1
+        return data
+
+    def put(self, key: str, data: bytes):
+        if self.max_bytes <= 0 or len(data) > self.max_bytes:
+            return
+        path = self._path(key)
+        try:
+            os.makedirs(os.path.dirname(path), exist_ok=True)
+            old = os.path.getsize(path) if os.path.exists(path) else 0
+            tmp = f'{path}.{threading.get_ident()}.tmp'
+            with open(tmp, 'wb') as f:
+                f.write(data)
+            os.replace(tmp, path)
+        except OSError as e:
+            logger.warning("代理缓存写入失败：%s", e)
+            return
+        with self._lock:
+            if self._total is None:
+                self._total = sum(size for _, size, _ in self._scan())
+            else:
+                self._total += len(data) - old
+            if self._total > self.max_bytes:
+                self._evict()
+
+    def _scan(self) -> List[Tuple[float, int, str]]:
+        entries = []
+        for dirpath, _, files in os.walk(self.root):
+            for fn in files:
+                if fn.endswith('.tmp'):
+                    continue
+                path = os.path.join(dirpath, fn)
+                try:
+                    st = os.stat(path)
+                except OSError:
+                    continue
+                entries.append((st.st_mtime, st.st_size, path))
+        return entries
+
+    def _evict(self):
+        entries = sorted(self._scan())
+        total = sum(size for _, size, _ in entries)
+        target = int(self.max_bytes * 0.9)
+        removed = 0
+        for _, size, path in entries:
+            if total <= target:
+                break
+            try:
+                os.remove(path)
+            except OSError:
+                continue
+            total -= size
+            removed += 1
+        self._total = total
+        logger.info("代理缓存淘汰 %d 个文件，当前 %d 字节", removed, total)
+
+    def stats(self) -> Dict[str, Any]:
+        with self._lock:
+            if self._total is None:
+                self._total = sum(size for _, size, _ in self._scan())
+            return {'bytes': self._total, 'max_bytes': self.max_bytes, 'hits': self.hits, 'misses': self.misses}
+
+
+class Proxy:
+    def __init__(self, cache: DiskCache, rate_per_sec: float, max_bytes: int, timeout: float = 10):
+        self.cache = cache
+        self.rate_per_sec = rate_per_sec
+        self.max_bytes = max_bytes
+        self.timeout = timeout
+        self.limiter = TokenBucket()
+
+    def fetch(self, url: str) -> Optional[Tuple[bytes, str]]:
+        """返回 (内容, Content-Type)；上游被本地限流时返回 None，回源失败抛出 UpstreamError。"""
+        data = self.cache.get(url)
+        if data is None:
+            if not self.limiter.allow(urlparse(url).hostname or '', self.rate_per_sec):
+                return None
+            data = self._download(url)
+            self.cache.put(url, data)
+        detected = media.sniff(data)
+        return data, MIME_BY_EXT.get(detected[0] if detected else '', 'application/octet-stream')
+
+    def _download(self, url: str) -> bytes:
+        req = urllib.request.Request(url, headers={'User-Agent': 'feTrace/1.0'})
+        try:
+            with urllib.request.urlopen(req, timeout=self.timeout) as resp:
+                data = resp.read(self.max_bytes + 1)
+        except urllib.error.HTTPError as e:
+            raise UpstreamError(f'HTTP {e.code}', status=e.code)
+        except (TimeoutError, OSError) as e:
+            timed_out = isinstance(e, TimeoutError) or 'timed out' in str(e)
+            raise UpstreamError(repr(e), timeout=timed_out)
+        if len(data) > self.max_bytes:
+            raise UpstreamError('too_large')
+        detected = media.sniff(data)
+        if detected is None or detected[1] != 'image':
+            raise UpstreamError('not_image')
+        return data
@@ -0,0 +1,211 @@
+"""
+按 API Key 的每日配额（多团队共用一个实例时保护 DeepSeek 等外部预算）
+
+客户端以请求头 X-API-Key（或 ?api_key=）标识身份，中间件 quota 解析后把额度绑定到请求上下文 ctx.quota：
+- generations  每日 AI 调用次数（生成人物轨迹、翻译、生成前的别名识别、解说音频合成），超出时接口返回 429 quota_exceeded，附 Retry-After（到 UTC 零点）
+- geocode      每日地理编码外部请求次数，超出后不再查询坐标（事件坐标留空，不报错）
+未带 Key 的请求计入共享的 anonymous 额度；API_KEY_REQUIRED=1 时必须携带有效 Key。携带未知 Key 一律返回 401。
+
+Key 来自 API_KEYS（config.json 中为对象 {"team-a": {"key": "...", "generations_per_day": 50}}，
+环境变量写作 "team-a=<key>,team-b=<key>"）与管理接口 POST /api/admin/quotas 的覆盖；
+未单独设置的额度取 QUOTA_GENERATIONS_PER_DAY / QUOTA_GEOCODE_PER_DAY（0 为不限）。
+覆盖与当日用量保存在 data/quotas.json，重启后继续累计。
+"""
+
+import os
+import json
+import time
+import hmac
+import hashlib
+import threading
+from typing import Any, Dict, Optional
+
+import config
+import errors
+from errors import ApiError
+
+KINDS = ('generations', 'geocode')
+ANONYMOUS = 'anonymous'
+
+
+def _today() -> str:
+    return time.strftime('%Y-%m-%d', time.gmtime())
+
+
+def _reset_in() -> int:
+    """距下一个 UTC 零点的秒数。"""
+    now = time.time()
+    return int(86400 - now % 86400) + 1
+
+
+class QuotaExceeded(ApiError):
+    def __init__(self, team: str, kind: str, limit: int, used: int):
+        reset = _reset_in()
+        super().__init__(errors.RATE_LIMITED, 'quota_exceeded',
+                         {"key": team, "quota": kind, "limit": limit, "used": used, "reset_in_sec": reset},
+                         headers={'Retry-After': str(reset), 'X-Quota-Limit': str(limit), 'X-Quota-Remaining': '0'})
+
+
+class Binding:
+    """一次请求所属 Key 的额度句柄，经 ctx.quota 传到生成与地理编码调用处。"""
+
+    def __init__(self, store: 'QuotaStore', team: str):
+        self.store = store
+        self.team = team
+
+    def consume(self, kind: str):
+        """扣减一次，超出时抛出 QuotaExceeded；成功时同时记入用量账本。"""
+        self.store.consume(self.team, kind)
+        self.record(kind)
+
+    def try_consume(self, kind: str) -> bool:
+        try:
+            self.consume(kind)
+            return True
+        except QuotaExceeded:
+            return False
+
+    def record(self, field: str, n: int = 1):
+        """只记账、不受额度限制（请求数等，见 usage.py）。"""
+        if self.store.ledger is not None:
+            self.store.ledger.add(self.team, field, n)
+
+    def record_tokens(self, usage: Dict[str, Any]):
+        if self.store.ledger is not None and isinstance(usage, dict):
+            self.store.ledger.add_tokens(self.team, usage)
+
+
+class QuotaStore:
+    def __init__(self, path: Optional[str] = None, ledger=None):
+        self.path = path
+        self.ledger = ledger  # usage.UsageLedger，为 None 时不记账
+        self._lock = threading.Lock()
+        self._overrides: Dict[str, Dict[str, Any]] = {}
+        self._usage: Dict[str, Dict[str, int]] = {}
+        self._day = _today()
+        self._dirty = False
+        self._load()
+
+    def _load(self):
+        if not self.path or not os.path.isfile(self.path):
+            return
+        try:
+            with open(self.path, 'r', encoding='utf-8') as f:
+                data = json.load(f)
+        except (OSError, ValueError):
+            return
+        self._overrides = dict(data.get('keys') or {})
+        if data.get('day') == self._day:
+            self._usage = {k: dict(v) for k, v in (data.get('usage') or {}).items()}
+
+    def _keys(self) -> Dict[str, Dict[str, Any]]:
+        keys = {name: dict(v) for name, v in config.get_api_keys().items()}
+        for name, v in self._overrides.items():
+            keys[name] = dict(keys.get(name) or {}, **v)
+        return keys
+
+    def _limits(self, entry: Dict[str, Any]) -> Dict[str, int]:
+        defaults = config.get_quota_defaults()
+        out = {}
+        for kind in KINDS:
+            val = entry.get(f'{kind}_per_day')
+            out[kind] = defaults[kind] if val is None else int(val)
+        return out
+
+    def resolve(self, key: Optional[str]) -> Optional[str]:
+        """Key → 团队名；未带 Key 时为 anonymous，未知 Key 返回 None。"""
+        if not key:
+            return ANONYMOUS
+        for name, entry in self._keys().items():
+            if entry.get('key') and hmac.compare_digest(str(entry['key']), key):
+                return name
+        return None
+
+    def bind(self, team: str) -> Binding:
+        return Binding(self, team)
+
+    def _roll(self):
+        day = _today()
+        if day != self._day:
+            self._day, self._usage, self._dirty = day, {}, True
+
+    def consume(self, team: str, kind: str):
+        entry = self._keys().get(team) or {}
+        limit = self._limits(entry)[kind]
+        with self._lock:
+            self._roll()
+            usage = self._usage.setdefault(team, {})
+            used = usage.get(kind, 0)
+            if limit > 0 and used >= limit:
+                raise QuotaExceeded(team, kind, limit, used)
+            usage[kind] = used + 1
+            self._dirty = True
+
+    def status(self) -> Dict[str, Any]:
+        """各 Key 的额度与当日用量（Key 只显示指纹）。"""
+        keys = self._keys()
+        keys.setdefault(ANONYMOUS, {})
+        with self._lock:
+            self._roll()
+            usage = {k: dict(v) for k, v in self._usage.items()}
+        out = {}
+        for name, entry in sorted(keys.items()):
+            limits = self._limits(entry)
+            used = usage.get(name, {})
+            out[name] = {
+                'key_fingerprint': hashlib.sha256(entry['key'].encode('utf-8')).hexdigest()[:12] if entry.get('key') else None,
+                'limits': limits,
+                'used': {k: used.get(k, 0) for k in KINDS},
+                'remaining': {k: (max(0, limits[k] - used.get(k, 0)) if limits[k] > 0 else None) for k in KINDS},
+                'source': 'admin' if name in self._overrides else ('config' if name != ANONYMOUS else 'default'),
+            }
+        return {'day': self._day, 'reset_in_sec': _reset_in(), 'keys': out}
+
+    def update(self, name: str, fields: Dict[str, Any]):
+        """写入管理覆盖：key 与各 *_per_day（null 表示回到默认值）。"""
+        with self._lock:
+            entry = self._overrides.setdefault(name, {})
+            for k, v in fields.items():
+                if v is None:
+                    entry.pop(k, None)
+                else:
+                    entry[k] = v
+            self._dirty = True
+        self.flush()
+
+    def remove(self, name: str) -> bool:
+        with self._lock:
+            found = self._overrides.pop(name, None) is not None
+            self._dirty = self._dirty or found
+        self.flush()
+        return found
+
+    def reset_usage(self, name: Optional[str] = None):
+        with self._lock:
+            if name:
+                self._usage.pop(name, None)
+            else:
+                self._usage = {}
+            self._dirty = True
+        self.flush()
+
+    def flush(self) -> bool:
+        if not self.path:
+            return False
+        with self._lock:
+            if not self._dirty:
+                return False
+            data = {'keys': json.loads(json.dumps(self._overrides)), 'day': self._day,
+                    'usage': {k: dict(v) for k, v in self._usage.items()}}
+            self._dirty = False
+        try:
+            os.makedirs(os.path.dirname(self.path) or '.', exist_ok=True)
+            tmp = self.path + '.tmp'
+            with open(tmp, 'w', encoding='utf-8') as f:
+                json.dump(data, f, ensure_ascii=False)
+            os.replace(tmp, self.path)
+            return True
+        except OSError:
+            with self._lock:
+                self._dirty = True
+            return False
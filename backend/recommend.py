@@ -0,0 +1,115 @@
+"""
+相关人物推荐（GET /api/person/{name}/related，“你可能还想看”面板）
+
+对已缓存的其他人物逐一打分，综合四类信号（各自归一到 0–1 后加权）：
+- places   到过的相同地点（按归一化名称），取 Jaccard 系数
+- era      活动期（首末事件年份）的重叠年数占较短一方的比例
+- mention  一方的事件文本中提到另一方的姓名或别名（记为关系链接）
+- text     生平文本（事件标题与详情）的相似度：字符二元组 TF-IDF 向量的余弦
+总分为 0 的人物不返回；reasons 给出各信号的依据，便于前端展示“为何推荐”。
+本地计算、不调用 AI，数据量较大时可按需改为离线预计算。
+"""
+
+import math
+from collections import Counter
+from typing import Any, Dict, Iterable, List, Optional, Tuple
+
+import overlap
+from textnorm import name_key
+
+WEIGHTS = {'places': 0.3, 'era': 0.2, 'mention': 0.2, 'text': 0.3}
+
+
+def _places(person: Dict[str, Any]) -> Dict[str, str]:
+    out = {}
+    for e in person.get('events') or []:
+        place = str(e.get('place') or '').strip()
+        if place and name_key(place) not in out:
+            out[name_key(place)] = place
+    return out
+
+
+def _era(person: Dict[str, Any]) -> Optional[Tuple[int, int]]:
+    spans = overlap.stays(person)
+    return (spans[0]['start'], spans[-1]['end']) if spans else None
+
+
+def _text(person: Dict[str, Any]) -> str:
+    return '\n'.join(f"{e.get('title') or ''} {e.get('detail') or ''}" for e in person.get('events') or [])
+
+
+def _bigrams(text: str) -> Counter:
+    chars = [ch for ch in text if not ch.isspace() and ch not in '，。、；：,.;:!?！？（）()“”"\'']
+    return Counter(a + b for a, b in zip(chars, chars[1:]))
+
+
+def _tfidf(docs: Dict[str, Counter]) -> Dict[str, Dict[str, float]]:
+    df = Counter()
+    for grams in docs.values():
+        df.update(grams.keys())
+    n = len(docs)
+    vectors = {}
+    for key, grams in docs.items():
+        vec = {g: (1 + math.log(c)) * math.log((1 + n) / (1 + df[g])) for g, c in grams.items()}
+        norm = math.sqrt(sum(v * v for v in vec.values())) or 1.0
+        vectors[key] = {g: v / norm for g, v in vec.items()}
+    return vectors
+
+
+def _cosine(a: Dict[str, float], b: Dict[str, float]) -> float:
+    if len(a) > len(b):
+        a, b = b, a
+    return sum(v * b.get(g, 0.0) for g, v in a.items())
+
+
+def _mentions(text: str, names: Iterable[str]) -> bool:
+    return any(n and len(n) >= 2 and n in text for n in names)
+
+
+def related(target: Dict[str, Any], persons: List[Dict[str, Any]], aliases_of=None, limit: int = 10) -> List[Dict[str, Any]]:
+    """按总分降序返回 [{name, score, signals, reasons}]；aliases_of(name) 返回该人物的别名列表（可选）。"""
+    aliases_of = aliases_of or (lambda name: [])
+    target_key = name_key(target.get('name', ''))
+    others = [p for p in persons if p.get('events') and name_key(p.get('name', '')) != target_key]
+    if not others:
+        return []
+    texts = {name_key(p.get('name', '')): _text(p) for p in others + [target]}
+    vectors = _tfidf({k: _bigrams(t) for k, t in texts.items()})
+    t_places, t_era, t_vec = _places(target), _era(target), vectors[target_key]
+    t_names = [target.get('name', '')] + list(aliases_of(target.get('name', '')))
+
+    out = []
+    for p in others:
+        key, name = name_key(p.get('name', '')), p.get('name', '')
+        reasons: Dict[str, Any] = {}
+        signals = {k: 0.0 for k in WEIGHTS}
+
+        places = _places(p)
+        shared = sorted(set(t_places) & set(places))
+        if shared:
+            signals['places'] = len(shared) / len(set(t_places) | set(places))
+            reasons['shared_places'] = [t_places[k] for k in shared]
+
+        era = _era(p)
+        if t_era and era:
+            lo, hi = max(t_era[0], era[0]), min(t_era[1], era[1])
+            if hi >= lo:
+                shorter = min(t_era[1] - t_era[0], era[1] - era[0]) + 1
+                signals['era'] = min(1.0, (hi - lo + 1) / shorter)
+                reasons['overlap_years'] = [lo, hi]
+
+        if _mentions(texts[target_key], [name] + list(aliases_of(name))) or _mentions(texts[key], t_names):
+            signals['mention'] = 1.0
+            reasons['mentioned'] = True
+
+        sim = _cosine(t_vec, vectors[key])
+        if sim > 0.05:
+            signals['text'] = min(1.0, sim)
+            reasons['text_similarity'] = round(sim, 3)
+
+        score = sum(WEIGHTS[k] * v for k, v in signals.items())
+        if score > 0:
+            out.append({'name': name, 'score': round(score, 4),
+                        'signals': {k: round(v, 3) for k, v in signals.items()}, 'reasons': reasons})
+    out.sort(key=lambda r: (-r['score'], r['name']))
+    return out[:limit]
@@ -0,0 +1,161 @@
+"""
+API 请求回放日志
+
+记录（REPLAY_LOG_FILE 非空时开启）：
+- 每个 /api/ 请求追加一行 JSON：{ts, method, path, query, lang, status, ms}
+- 已匿名化：不记录客户端地址、请求头与管理接口（/api/admin/）；REPLAY_LOG_SAMPLE 控制采样比例
+- 超过 REPLAY_LOG_MAX_BYTES 时轮转为 <文件>.1
+
+回放：
+
+    python index.py replay <日志> --target http://其他实例:8001 [--concurrency 4] [--speed 0] [--limit N] [--json]
+
+- 按记录顺序重发请求，对比状态码并汇总原始与回放延迟（p50/p90/p99）
+- --speed 0 为尽快发送；1 为按原始时间间隔，2 为两倍速，以此类推
+- 未命中缓存的 /api/person 会在目标实例上触发 AI 生成，回放前请确认目标实例的上游配置
+"""
+
+import os
+import sys
+import json
+import time
+import random
+import argparse
+import threading
+from urllib.parse import urlencode
+from typing import Any, Dict, List, Optional
+
+import bench
+
+
+class ReplayLog:
+    def __init__(self, path: str, max_bytes: int = 50 * 1024 * 1024, sample: float = 1.0):
+        self.path = path
+        self.max_bytes = max_bytes
+        self.sample = sample
+        self._lock = threading.Lock()
+
+    def record(self, method: str, path: str, query: Dict[str, List[str]], lang: str, status: int, seconds: float):
+        if path.startswith('/api/admin/'):
+            return
+        if self.sample < 1.0 and random.random() >= self.sample:
+            return
+        line = json.dumps({
+            'ts': round(time.time(), 3),
+            'method': method,
+            'path': path,
+            'query': query,
+            'lang': lang,
+            'status': status,
+            'ms': round(seconds * 1000, 2),
+        }, ensure_ascii=False) + '\n'
+        with self._lock:
+            try:
+                if self.max_bytes and os.path.exists(self.path) and os.path.getsize(self.path) >= self.max_bytes:
+                    os.replace(self.path, self.path + '.1')
+                with open(self.path, 'a', encoding='utf-8') as f:
+                    f.write(line)
+            except Exception:
+                pass  # 回放日志仅用于排查，写入失败不影响请求
+
+
+def read_entries(path: str, limit: Optional[int] = None) -> List[Dict[str, Any]]:
+    entries = []
+    with open(path, 'r', encoding='utf-8') as f:
+        for line in f:
+            try:
+                e = json.loads(line)
+            except ValueError:
+                continue
+            if isinstance(e, dict) and e.get('path'):
+                entries.append(e)
+                if limit and len(entries) >= limit:
+                    break
+    return entries
+
+
+def replay(entries: List[Dict[str, Any]], target: str, concurrency: int = 4, speed: float = 0.0,
+           timeout: float = 30.0) -> Dict[str, Any]:
+    results: List[Optional[Dict[str, Any]]] = [None] * len(entries)
+    cursor = {'i': 0}
+    lock = threading.Lock()
+    start_wall = time.monotonic()
+    first_ts = entries[0].get('ts', 0) if entries else 0
+
+    def worker():
+        client = bench.Client(target, timeout)
+        while True:
+            with lock:
+                i = cursor['i']
+                if i >= len(entries):
+                    break
+                cursor['i'] += 1
+            e = entries[i]
+            if speed > 0:
+                # 按原始时间间隔（除以倍速）发送
+                due = (float(e.get('ts', first_ts)) - first_ts) / speed
+                delay = due - (time.monotonic() - start_wall)
+                if delay > 0:
+                    time.sleep(delay)
+            path = e['path'] + ('?' + urlencode(e.get('query') or {}, doseq=True) if e.get('query') else '')
+            t0 = time.perf_counter()
+            try:
+                status = client.get(path, {'Accept-Language': e['lang']} if e.get('lang') else None)
+            except Exception:
+                client.close()
+                status = 0
+            results[i] = {'status': status, 'ms': (time.perf_counter() - t0) * 1000}
+        client.close()
+
+    threads = [threading.Thread(target=worker, daemon=True) for _ in range(max(1, concurrency))]
+    for t in threads:
+        t.start()
+    for t in threads:
+        t.join()
+
+    mismatches = []
+    for e, r in zip(entries, results):
+        if r and r['status'] != e.get('status'):
+            mismatches.append({'path': e['path'], 'query': e.get('query'), 'recorded': e.get('status'), 'replayed': r['status']})
+
+    def dist(values: List[float]) -> Dict[str, Any]:
+        values = sorted(values)
+        pick = lambda p: None if not values else round(bench.percentile(values, p), 2)
+        return {'p50_ms': pick(50), 'p90_ms': pick(90), 'p99_ms': pick(99), 'max_ms': round(values[-1], 2) if values else None}
+
+    return {
+        'target': target,
+        'requests': len(entries),
+        'failed': sum(1 for r in results if not r or r['status'] == 0),
+        'status_mismatches': len(mismatches),
+        'recorded': dist([float(e.get('ms') or 0) for e in entries]),
+        'replayed': dist([r['ms'] for r in results if r]),
+        'mismatches': mismatches[:50],
+    }
+
+
+def main(argv: List[str], default_target: str) -> int:
+    parser = argparse.ArgumentParser(prog='index.py replay', description='将回放日志中的请求重发到目标实例')
+    parser.add_argument('log', help='REPLAY_LOG_FILE 记录的日志文件')
+    parser.add_argument('--target', default=default_target, help=f'目标地址（默认 {default_target}）')
+    parser.add_argument('--concurrency', type=int, default=4, help='并发连接数（默认 4）')
+    parser.add_argument('--speed', type=float, default=0.0, help='0 为尽快发送，1 为原始节奏，2 为两倍速')
+    parser.add_argument('--limit', type=int, default=None, help='只回放前 N 条')
+    parser.add_argument('--json', action='store_true', help='以 JSON 输出报告')
+    args = parser.parse_args(argv)
+    try:
+        entries = read_entries(args.log, args.limit)
+    except OSError as e:
+        print(f'无法读取 {args.log}：{e}', file=sys.stderr)
+        return 1
+    report = replay(entries, args.target.rstrip('/'), args.concurrency, max(0.0, args.speed))
+    if args.json:
+        print(json.dumps(report, ensure_ascii=False, indent=2))
+    else:
+        fmt = lambda d: '  '.join(f'{k[:-3]}={"-" if v is None else v}' for k, v in d.items())
+        print(f'{report["target"]}：请求 {report["requests"]}，失败 {report["failed"]}，状态码不一致 {report["status_mismatches"]}')
+        print(f'  原始延迟(ms)  {fmt(report["recorded"])}')
+        print(f'  回放延迟(ms)  {fmt(report["replayed"])}')
+        for m in report['mismatches'][:10]:
+            print(f'  {m["path"]} {m["query"]}: {m["recorded"]} → {m["replayed"]}')
+    return 1 if report['failed'] or report['status_mismatches'] else 0
@@ -0,0 +1,90 @@
+"""
+请求上下文
+
+每个 API 请求创建一个 Context（中间件 request_context），沿处理函数 → 服务 → 上游调用逐层传递：
+- request_id：取请求头 X-Request-ID（校验后），否则生成；写入响应头与上游请求头，便于串联日志
+- 截止时间：API_REQUEST_TIMEOUT_SEC（0 为不限）；上游调用的读超时不超过剩余时间，到期后不再发起新的调用
+- 取消：cancel() 后同样不再发起新的调用（已发出的请求不会被中断）
+- 耗时分段：with ctx.span('geocode'): ...，请求结束时随访问日志输出
+- 配额：quota 为所属 API Key 的额度句柄（中间件 quota 设置，见 quotas.py），后台任务为 None
+
+后台任务（预热、定时落盘、CLI）使用 background()：无截止时间、不可取消。
+请求发起、但需在请求结束后继续执行的任务（异步生成、超时转入后台的生成）使用 detach(ctx)。
+"""
+
+import re
+import time
+import uuid
+import threading
+from contextlib import contextmanager
+from typing import Any, Dict, List, Optional
+
+_RID_RE = re.compile(r'^[A-Za-z0-9._:-]{1,64}$')
+
+
+class Cancelled(Exception):
+    """上下文已取消或已过截止时间。"""
+
+
+class Context:
+    def __init__(self, request_id: Optional[str] = None, timeout: Optional[float] = None):
+        self.request_id = request_id or uuid.uuid4().hex[:16]
+        self.deadline = time.monotonic() + timeout if timeout else None
+        self._cancelled = threading.Event()
+        self._lock = threading.Lock()
+        self.spans: List[Dict[str, Any]] = []
+        self.quota = None
+
+    def remaining(self) -> Optional[float]:
+        """距截止时间的秒数（可能为负）；无截止时间时返回 None。"""
+        return None if self.deadline is None else self.deadline - time.monotonic()
+
+    def cancel(self):
+        self._cancelled.set()
+
+    def done(self) -> bool:
+        if self._cancelled.is_set():
+            return True
+        rem = self.remaining()
+        return rem is not None and rem <= 0
+
+    def check(self):
+        if self.done():
+            raise Cancelled('cancelled' if self._cancelled.is_set() else 'deadline exceeded')
+
+    def timeout(self, default):
+        """把上游调用的超时（秒，或 requests 的 (connect, read) 元组）收紧到剩余时间以内。"""
+        rem = self.remaining()
+        if rem is None:
+            return default
+        rem = max(rem, 0.001)
+        if isinstance(default, tuple):
+            return tuple(min(t, rem) for t in default)
+        return min(default, rem)
+
+    @contextmanager
+    def span(self, name: str, **attrs):
+        start = time.perf_counter()
+        try:
+            yield
+        finally:
+            entry = {'name': name, 'ms': round((time.perf_counter() - start) * 1000, 1)}
+            entry.update(attrs)
+            with self._lock:
+                self.spans.append(entry)
+
+
+def background() -> Context:
+    return Context(request_id='background')
+
+
+def detach(ctx: Context, suffix: str = 'job') -> Context:
+    """脱离请求的上下文：沿用 request_id 前缀与配额，不受请求截止时间与取消影响。"""
+    out = Context(request_id=f'{ctx.request_id}-{suffix}')
+    out.quota = ctx.quota
+    return out
+
+
+def from_headers(headers, timeout: Optional[float] = None) -> Context:
+    rid = str(headers.get('X-Request-ID') or '').strip()
+    return Context(rid if _RID_RE.match(rid) else None, timeout)
@@ -0,0 +1,67 @@
+"""
+API 路由器：路由表与各分组中间件链的组合
+
+路由表形如 {路径: (允许的方法, 分组, 处理函数)}，分组对应 chains 中的一条中间件链（见 middleware.py），
+路径中的 {参数} 匹配单段（URL 解码后存入 handler.route_params），精确路径优先。
+未匹配的路径与不允许的方法经 chains['error'] 输出标准错误信封。
+
+路由器由 HTTP server 持有（httpd.router，见 listeners.make_server），处理器通过 self.server.router 分派，
+同一进程中可运行多个使用不同路由表或中间件的服务（如测试中另起一个只含部分接口的服务）。
+"""
+
+from urllib.parse import unquote, urlparse
+from typing import Callable, Dict, Optional, Tuple
+
+import errors
+from errors import ApiError
+
+
+def _not_found(handler):
+    raise ApiError(errors.NOT_FOUND, 'route_not_found', {"path": urlparse(handler.path).path})
+
+
+def _method_not_allowed(handler):
+    handler.close_connection = True  # 未读取请求体，不再复用连接
+    raise ApiError(errors.METHOD_NOT_ALLOWED, 'method_not_allowed', {"path": urlparse(handler.path).path})
+
+
+class Router:
+    def __init__(self, routes: Dict[str, Tuple], chains: Dict[str, Callable]):
+        self.routes = routes
+        self.handlers = {path: chains[group](endpoint) for path, (_, group, endpoint) in routes.items()}
+        self.patterns = [(path, path.split('/')) for path in routes if '{' in path]
+        self.not_found = chains['error'](_not_found)
+        self.method_not_allowed = chains['error'](_method_not_allowed)
+
+    def match(self, path: str) -> Tuple[Optional[str], Dict[str, str]]:
+        """返回 (路由表中的路径, 路径参数)；未匹配时为 (None, {})。"""
+        if path in self.routes:
+            return path, {}
+        parts = path.split('/')
+        for pattern, segments in self.patterns:
+            if len(segments) != len(parts):
+                continue
+            params = {}
+            for seg, part in zip(segments, parts):
+                if seg.startswith('{') and seg.endswith('}') and part:
+                    params[seg[1:-1]] = unquote(part)
+                elif seg != part:
+                    break
+            else:
+                return pattern, params
+        return None, {}
+
+    def group(self, path: str) -> Optional[str]:
+        """路径所属路由的分组（见 chains）；未匹配时为 None。"""
+        key, _ = self.match(path)
+        return self.routes[key][1] if key else None
+
+    def dispatch(self, handler, path: str):
+        key, handler.route_params = self.match(path)
+        route = self.routes.get(key) if key else None
+        if route is None:
+            self.not_found(handler)
+        elif handler.command not in route[0]:
+            self.method_not_allowed(handler)
+        else:
+            self.handlers[key](handler)
@@ -1,49 +1,1527 @@
+import copy
+import hashlib
+import hmac
 import json
-from urllib.parse import parse_qs
-from typing import Dict, Any
+import os
+import time
+import threading
+from datetime import datetime, timezone
+from concurrent.futures import ThreadPoolExecutor, TimeoutError as FutureTimeout, wait
+from urllib.parse import parse_qs, quote, urlparse
+from typing import Dict, Any, List, Optional
+import analytics
+import clusters
+import datacheck
+import datastats
 import deepseek
+import dynasty
+import embeddings
+import encoders
+import enrich
+import export
+import grpcapi
+import errorreport
+import config
+from textnorm import normalize_name, name_key
+from projection import parse_fields, project_at
+from errors import ApiError
+import errors
+import i18n
+import reqctx
+import logsetup
+import media
+import migrate
+import narration
+import openapi
+import overlap
+import pdfreport
+import recommend
+import proxy
+import search
+import static
+import quotas
+import settings
+import translations
+import usage
+from cache import SORTS
+from jobs import JOBS
+from metrics import METRICS
+from flags import FLAGS
+from validation import validate_name, validate_names, validate_query_text, read_body, read_json_body
 
 
-def handle_people(handler, cache, fallback: Dict[str, Any]):
-    payload = cache.get_people_or_fallback(fallback)
-    handler._set_headers(200)
-    handler.wfile.write(json.dumps(payload, ensure_ascii=False).encode('utf-8'))
+def _query(handler) -> Dict[str, list]:
+    return parse_qs((handler.path.split('?', 1)[1] if '?' in handler.path else '') or '')
 
 
-def handle_person(handler, cache, fallback: Dict[str, Any], logger=None):
-    qs = parse_qs((handler.path.split('?', 1)[1] if '?' in handler.path else '') or '')
-    name = (qs.get('name') or [''])[0].strip()
-    if not name:
-        handler._set_headers(400)
-        handler.wfile.write(json.dumps({"error": "missing name"}, ensure_ascii=False).encode('utf-8'))
+def _int_param(qs: Dict[str, list], key: str, default: Optional[int] = None) -> Optional[int]:
+    val = (qs.get(key) or [''])[0].strip()
+    if not val:
+        return default
+    try:
+        return int(val)
+    except Exception:
+        return default
+
+
+def _count_param(qs: Dict[str, list], key: str, default: Optional[int] = None) -> Optional[int]:
+    """非负整数参数（offset、limit）；带了但不是整数或为负数时报 invalid_param。"""
+    val = (qs.get(key) or [''])[0].strip()
+    if not val:
+        return default
+    try:
+        n = int(val)
+    except ValueError:
+        n = -1
+    if n < 0:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": key})
+    return n
+
+
+def _year_param(qs: Dict[str, list], key: str) -> Optional[int]:
+    """年份参数（可为负数表示公元前）；带了但不是整数时报 invalid_param。"""
+    val = (qs.get(key) or [''])[0].strip()
+    if not val:
+        return None
+    try:
+        return int(val)
+    except ValueError:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": key})
+
+
+def _sort_param(qs: Dict[str, list]) -> str:
+    """?sort=name|events|year|added，前缀 - 降序；不带时为 added（原有顺序）。"""
+    val = (qs.get('sort') or [''])[0].strip() or 'added'
+    if val.lstrip('-') not in SORTS or val.startswith('--'):
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "sort", "allowed": list(SORTS)})
+    return val
+
+
+# 当前 API 版本，随每个 JSON 响应返回（version 字段）；不兼容的改动放到新版本下，旧版本路径继续可用
+API_VERSION = 'v1'
+
+
+def _write_body(handler, code: int, body: bytes, content_type: str, headers: Optional[Dict[str, str]] = None):
+    headers = dict(headers or {})
+    # 编码由 compress_json 中间件协商；较小的响应压缩收益不大，按原样输出
+    encoding = getattr(handler, 'response_encoding', None)
+    if encoding is not None and len(body) >= config.get_compress_min_bytes():
+        headers['Vary'] = ', '.join(v for v in (headers.get('Vary'), 'Accept-Encoding') if v)
+        if encoding:
+            body = static.compress(body, encoding)
+            headers['Content-Encoding'] = encoding
+    handler._set_headers(code, content_type=content_type, length=len(body), headers=headers)
+    handler.wfile.write(body)
+
+
+def _write_json(handler, code: int, payload: Any, headers: Optional[Dict[str, str]] = None):
+    _write_body(handler, code, json.dumps(payload, ensure_ascii=False).encode('utf-8'), encoders.JSON, headers)
+
+
+def _write_envelope(handler, code: int, envelope: Dict[str, Any], headers: Optional[Dict[str, str]] = None,
+                    model: Optional[encoders.Model] = None):
+    """信封按 Accept 编码为 JSON / MessagePack（model 非空时另可为 protobuf），见 encoders.py。
+    requestId 与响应头 X-Request-ID 相同，便于客户端反馈问题时据此查日志。"""
+    ctx = getattr(handler, 'ctx', None)
+    if ctx is not None:
+        envelope['requestId'] = ctx.request_id
+    body, content_type = encoders.encode(encoders.choose(handler.headers, model), envelope, model)
+    _write_body(handler, code, body, content_type, dict(headers or {}, Vary='Accept'))
+
+
+def write_ok(handler, data: Any, meta: Optional[Dict[str, Any]] = None, project_path: Optional[List[str]] = None, code: int = 200,
+             headers: Optional[Dict[str, str]] = None, model: Optional[encoders.Model] = None):
+    """成功响应 {data, meta, error: null, version}；project_path 指明 data 中人物对象所在位置，用于 ?fields= 字段投影。"""
+    if project_path is not None:
+        tree = parse_fields(','.join(_query(handler).get('fields') or []))
+        if tree:
+            data = project_at(data, project_path, tree)
+    _write_envelope(handler, code, {"data": data, "meta": meta or {}, "error": None, "version": API_VERSION}, headers, model)
+
+
+def _cache_headers(handler, app, model: Optional[encoders.Model] = None) -> Dict[str, str]:
+    """轮询类 GET 接口的协商缓存头：弱 ETag 由缓存数据版本（见 Cache.data_version）、请求 URL 与响应格式计算，须在读取数据之前取得。"""
+    media = encoders.choose(handler.headers, model)
+    digest = hashlib.sha1(f'{app.cache.data_version()}|{handler.path}|{media}'.encode('utf-8')).hexdigest()[:20]
+    return {'ETag': f'W/"{digest}"', 'Cache-Control': 'no-cache', 'Vary': 'Accept'}
+
+
+def not_modified(handler, headers: Dict[str, str]) -> bool:
+    """If-None-Match 与 ETag 一致时回 304（不读取数据、不编码 JSON），返回 True。"""
+    if not handler.headers.get('If-None-Match') or not static.is_not_modified(handler.headers, headers['ETag'][2:], 0):
+        return False
+    handler._set_headers(304, headers=headers)
+    return True
+
+
+def request_lang(handler) -> str:
+    try:
+        return i18n.pick_lang(handler.headers.get('Accept-Language'))
+    except Exception:
+        return i18n.default_lang()
+
+
+def write_error(handler, err: ApiError):
+    handler._error_code = err.code
+    _write_envelope(handler, err.status, {"data": None, "meta": {}, "error": err.to_dict(request_lang(handler)), "version": API_VERSION}, err.headers)
+
+
+# Accept: application/x-protobuf 时 GET /api/people 的消息模型，与 gRPC ListPeople 的响应相同
+PEOPLE_MODEL = ('fetrace.v1.ListPeopleResponse', grpcapi.LIST_PEOPLE_RESPONSE,
+                lambda data, meta: {'persons': [grpcapi.person_message(p) for p in data.get('persons') or []],
+                                    'total': meta.get('total', 0)})
+
+
+def handle_people(handler, app):
+    """GET 全部人物；?limit=&offset=（或 ?page=&per_page=，page 从 1 起）分页，meta.total 为总数。
+    不带分页参数时返回全部（兼容旧客户端），单页最多 PEOPLE_MAX_PAGE_SIZE 个。
+    ?fromYear=1800&toYear=1900&place=上海：仅返回有事件同时满足年份与地点条件的人物，加 events=matching 时只保留这些事件。
+    ?sort=name|events|year|added（前缀 - 降序）：排序先于分页，同值按姓名升序。
+    Accept: application/msgpack 或 application/x-protobuf 时返回二进制编码（见 encoders.py）。"""
+    qs = _query(handler)
+    sort = _sort_param(qs)
+    payload = app.cache.get_people_or_fallback(app.fallback)
+    wanted = (qs.get('dynasty') or [''])[0].strip()
+    place = validate_query_text((qs.get('place') or [''])[0], 'place')
+    year_from, year_to = _year_param(qs, 'fromYear'), _year_param(qs, 'toYear')
+    if year_from is not None and year_to is not None and year_from > year_to:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "toYear"})
+    only_matching = (qs.get('events') or [''])[0].strip()
+    if only_matching not in ('', 'all', 'matching'):
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "events"})
+    filtering = place or year_from is not None or year_to is not None
+    matches = lambda e: overlap.event_matches(e, year_from, year_to, place)
+    conds = []
+    # ?dynasty=北宋：仅返回有事件落在该朝代的人物
+    if wanted:
+        conds.append(lambda p: wanted in dynasty.TABLE.annotate(p, write=False))
+    if filtering:
+        conds.append(lambda p: any(matches(e) for e in p.get('events') or []))
+    where = (lambda p: all(c(p) for c in conds)) if conds else None
+    cache_headers = _cache_headers(handler, app, PEOPLE_MODEL)
+    limit, offset = _count_param(qs, 'limit'), _count_param(qs, 'offset', 0)
+    per_page, page = _count_param(qs, 'per_page'), _count_param(qs, 'page')
+    if per_page is not None or page is not None:
+        limit = per_page if per_page is not None else config.get_people_default_page_size()
+        offset = (max(1, page or 1) - 1) * limit
+    if limit is not None and not 0 < limit <= config.get_people_max_page_size():
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "limit" if per_page is None else "per_page"})
+    if not_modified(handler, cache_headers):
         return
-    logger.info("查询人物：name=%s", name)
-    source = cache.get_people_or_fallback(fallback)
-    persons = (source or {}).get('persons') or []
-    found = None
-    for p in persons:
-        if str(p.get('name', '')).strip() == name:
-            found = p
-            break
-    if not found:
-        try:
-            found = deepseek.get_person_timeline(name)
-        except Exception:
-            found = None
-    if found and len(found.get('events', [])) > 0:
-        try:
-            cache.upsert_person(found, fallback)
+    total, persons = app.cache.get_people_page(app.fallback, offset, limit, where, sort)
+    if filtering and only_matching == 'matching':
+        persons = [dict(p, events=[e for e in p.get('events') or [] if matches(e)]) for p in persons]
+    meta = {"total": total, "sort": sort}
+    if filtering:
+        meta['filter'] = {"fromYear": year_from, "toYear": year_to, "place": place or None, "events": only_matching or 'all'}
+    if limit is not None:
+        meta.update(offset=offset, limit=limit, count=len(persons), has_more=offset + len(persons) < total)
+    write_ok(handler, dict(payload, persons=persons), meta=meta, project_path=['persons'], headers=cache_headers,
+             model=PEOPLE_MODEL)
+
+
+def _parse_since(value: str) -> Optional[float]:
+    """?since= 接受 Unix 秒数（可带小数）或 ISO 8601 时间（无时区按 UTC）。"""
+    try:
+        return float(value)
+    except ValueError:
+        pass
+    try:
+        dt = datetime.fromisoformat(value.replace('Z', '+00:00'))
+    except ValueError:
+        return None
+    if dt.tzinfo is None:
+        dt = dt.replace(tzinfo=timezone.utc)
+    return dt.timestamp()
+
+
+def handle_people_changes(handler, app):
+    """GET ?since=<时间>：增量同步，返回此后新增或修改的人物与被移除的姓名。
+    客户端保存 meta.next_since 作为下一次的 since；has_more 时立即再取，reset 为 true 时需全量重拉 /api/people。
+    since=0 返回全部人物。"""
+    qs = _query(handler)
+    raw = (qs.get('since') or [''])[0].strip()
+    if not raw:
+        raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "since"})
+    since = _parse_since(raw)
+    if since is None:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "since"})
+    limit = _int_param(qs, 'limit', config.get_people_max_page_size())
+    if not 0 < limit <= config.get_people_max_page_size():
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "limit"})
+    result = app.cache.changes_since(since, app.fallback, limit)
+    meta = {k: result[k] for k in ('total', 'has_more', 'next_since', 'now', 'reset')}
+    meta.update(since=since, count=len(result['persons']))
+    write_ok(handler, {'persons': result['persons'], 'deleted': result['deleted']}, meta=meta, project_path=['persons'])
+
+
+def _lookup_person(ctx, app, name: str, logger=None, endpoint: str = 'person', record: bool = True):
+    """仅查缓存（含别名表与近似匹配，不调用 AI）；返回 (规范姓名, 人物或 None)，并按接口记录命中/未命中。
+    record=False 时不计入查询热度，由调用方在生成结束后按最终结果记录。"""
+    cache, fallback = app.cache, app.fallback
+    queried = name
+    found = cache.find_person(name, fallback)
+    enabled, max_distance = config.get_fuzzy_lookup()
+    if not found and enabled:
+        # 写法略有出入（空白、称谓、错一个字）时直接用已缓存的人物，避免再调用一次 AI
+        fuzzy = cache.find_fuzzy(name, max_distance)
+        if fuzzy:
+            found = fuzzy['person']
+            name = found.get('name', name)
+            METRICS.incr('lookup.fuzzy')
             if logger:
-                logger.info("缓存已更新并标记落盘：name=%s, events=%d", name, len(found.get('events', [])))
-        except Exception:
-            pass
+                logger.info("近似命中：%s → %s（%s）", queried, name, fuzzy['match'])
+    hit = bool(found) and len(found.get('events') or []) > 0
+    cache.record_lookup(endpoint, found.get('name', name) if hit else queried, hit)
+    if record:
+        analytics.ANALYTICS.record_request(endpoint, found.get('name', name) if hit else queried, hit)
+    return name, found
+
+
+def _resolve_alias(ctx, app, name: str, logger=None):
+    """生成前识别字/号（开关 alias_ai）：AI 给出的本名与 name 不同时改用本名，避免以别名重复生成。
+    返回 (姓名, 已缓存的本名人物或 None)。识别调用计入 generations 额度；
+    识别结果只在携带 API Key（或经管理接口）的请求中写入别名表，匿名请求仅本次使用。"""
+    if not FLAGS.enabled('alias_ai'):
+        return name, None
+    if ctx.quota is not None:
+        ctx.quota.consume('generations')
+    with ctx.span('resolve_alias', person=name):
+        canonical = app.timeline.resolve_canonical_name(ctx, name)
+    if not canonical or name_key(canonical) == name_key(name):
+        return name, None
+    if ctx.quota is None or ctx.quota.team != quotas.ANONYMOUS:
+        app.cache.add_alias(name, canonical)
+    if logger:
+        logger.info("识别别名：%s → %s, rid=%s", name, canonical, ctx.request_id)
+    name = normalize_name(canonical)
+    found = app.cache.find_person(name, app.fallback)
+    return name, found if found and found.get('events') else None
+
+
+def _generate_person(ctx, app, name: str, logger=None) -> Optional[Dict[str, Any]]:
+    """调用 AI 生成并写入缓存（先识别别名，见 _resolve_alias）；无事件时返回 None，上游失败抛出 ApiError。"""
+    if not FLAGS.enabled('generation') or FLAGS.enabled('read_only'):
+        raise ApiError(errors.PERSON_NOT_FOUND, 'generation_disabled', {"name": name})
+    name, cached = _resolve_alias(ctx, app, name, logger)
+    if cached:
+        return cached
+    if ctx.quota is not None:
+        ctx.quota.consume('generations')
+    start = time.monotonic()
+    try:
+        with ctx.span('generate', person=name):
+            found = app.timeline.timeline(ctx, name)
+    except deepseek.UpstreamError as e:
+        METRICS.incr('generation.failure')
+        errorreport.REPORTER.record_upstream_failure(e.kind, name)
+        METRICS.observe('generation', time.monotonic() - start)
+        raise _upstream_api_error(e, name)
+    except Exception:
+        found = None
+    METRICS.observe('generation', time.monotonic() - start)
     if not found or len(found.get('events', [])) == 0:
-        found = {"name": name, "style": None, "events": []}
-    handler._set_headers(200)
-    handler.wfile.write(json.dumps(found, ensure_ascii=False).encode('utf-8'))
+        METRICS.incr('generation.empty')
+        return None
+    METRICS.incr('generation.success')
+    found = enrich.run(found, enrich.build_pipeline(geocoder=app.geocoder, ctx=ctx))
+    try:
+        app.cache.upsert_person(found, app.fallback)
+        if logger:
+            logger.info("缓存已更新并标记落盘：name=%s, events=%d, rid=%s", name, len(found.get('events', [])), ctx.request_id)
+    except Exception:
+        pass
+    return found
+
+
+# 生成任务线程池：请求超时后任务仍在后台完成并写入缓存，下次请求即可命中
+_GEN_POOL = ThreadPoolExecutor(max_workers=config.get_person_batch_workers(), thread_name_prefix='generate')
+_GEN_PENDING = [0]
+_GEN_LOCK = threading.Lock()
+
+
+def _submit(fn):
+    def task():
+        try:
+            return fn()
+        finally:
+            with _GEN_LOCK:
+                _GEN_PENDING[0] -= 1
+    with _GEN_LOCK:
+        _GEN_PENDING[0] += 1
+    return _GEN_POOL.submit(task)
+
+
+def _submit_generate(ctx, app, name: str, logger=None):
+    # 请求超时后生成仍在后台继续，不能沿用请求上下文的截止时间（见 reqctx.detach）
+    job_ctx = reqctx.detach(ctx)
+    return _submit(lambda: _generate_person(job_ctx, app, name, logger))
+
+
+def pending_generations() -> int:
+    """排队或进行中的生成任务数（含请求已超时、转入后台的任务），停机前据此等待。"""
+    with _GEN_LOCK:
+        return _GEN_PENDING[0]
+
+
+def _generate_with_deadline(ctx, app, name: str, logger=None) -> Optional[Dict[str, Any]]:
+    timeout = config.get_generate_timeout_sec()
+    fut = _submit_generate(ctx, app, name, logger)
+    try:
+        return fut.result(timeout=timeout)
+    except FutureTimeout:
+        if logger:
+            logger.warning("生成超时，转入后台继续：name=%s, timeout=%ss, rid=%s", name, timeout, ctx.request_id)
+        raise ApiError(errors.UPSTREAM_TIMEOUT, 'generation_timeout', {"name": name, "timeout_sec": timeout})
+
+
+def _upstream_api_error(e: deepseek.UpstreamError, name: str) -> ApiError:
+    if e.kind == 'timeout':
+        return ApiError(errors.UPSTREAM_TIMEOUT, 'upstream_timeout', {"name": name})
+    if e.kind == 'rate_limited':
+        return ApiError(errors.RATE_LIMITED, 'upstream_rate_limited', {"name": name})
+    return ApiError(errors.UPSTREAM_ERROR, 'upstream_unavailable', {"name": name, "reason": str(e)})
+
+
+def _translate_person(ctx, app, person: Dict[str, Any], lang: str, logger=None) -> Optional[Dict[str, Any]]:
+    """按需生成 lang 译文并写回缓存；生成关闭或只读时返回 None，上游失败抛出 ApiError。"""
+    if not FLAGS.enabled('generation') or FLAGS.enabled('read_only'):
+        return None
+    name = person.get('name', '')
+    texts = translations.source_texts(person)
+    if ctx.quota is not None:
+        ctx.quota.consume('generations')
+    try:
+        with ctx.span('translate', person=name, lang=lang):
+            items = translations.clean_items(app.timeline.translate(ctx, texts, lang), len(texts))
+    except deepseek.UpstreamError as e:
+        errorreport.REPORTER.record_upstream_failure(e.kind, name)
+        raise _upstream_api_error(e, name)
+    if not items:
+        return None
+    if logger:
+        logger.info("已生成译文：name=%s, lang=%s, events=%d, rid=%s", name, lang, len(items), ctx.request_id)
+    updated = app.cache.set_translation(name, lang, items)
+    if updated is None:
+        # 人物仅存在于兜底数据中：本次返回译文，不落盘
+        updated = dict(person, translations=dict(person.get('translations') or {}, **{lang: {'events': items}}))
+    return updated
+
+
+def _requested_langs(handler, qs: Dict[str, list]):
+    """返回 (显式 ?lang=, 候选语言列表)；显式语言优先于 Accept-Language。"""
+    raw = (qs.get('lang') or [''])[0].strip()
+    explicit = translations.normalize_lang(raw) if raw else None
+    if raw and not explicit:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "lang"})
+    return explicit, [explicit] if explicit else translations.parse_accept_language(handler.headers.get('Accept-Language'))
+
+
+PERSON_FIELDS = ('name', 'style', 'tags', 'lang')
+EVENT_WRITE_FIELDS = datacheck.EVENT_FIELDS + ('year_text', 'media')
+
+
+def _person_from_body(body: Any) -> Dict[str, Any]:
+    """校验人工录入的人物 JSON，只保留已知字段；结构不符时抛出 ApiError(400)。"""
+    if not isinstance(body, dict):
+        raise ApiError(errors.BAD_REQUEST, 'person_invalid', {"reason": "body must be an object"})
+    name = validate_name(body.get('name'))
+    events = body.get('events')
+    if not isinstance(events, list) or not events:
+        raise ApiError(errors.BAD_REQUEST, 'person_invalid', {"reason": "events must be a non-empty array"})
+    if len(events) > config.get_person_max_events():
+        raise ApiError(errors.BAD_REQUEST, 'person_invalid', {"reason": f"too many events (max {config.get_person_max_events()})"})
+    person = {k: body[k] for k in PERSON_FIELDS if body.get(k) not in (None, '')}
+    person['name'] = name
+    if 'style' in person and not isinstance(person['style'], dict):
+        raise ApiError(errors.BAD_REQUEST, 'person_invalid', {"reason": "style must be an object"})
+    if 'tags' in person and (not isinstance(person['tags'], list) or not all(isinstance(t, str) for t in person['tags'])):
+        raise ApiError(errors.BAD_REQUEST, 'person_invalid', {"reason": "tags must be an array of strings"})
+    person['events'] = [_event_from_body(e, f'events[{i}]') for i, e in enumerate(events)]
+    return person
+
+
+def _event_from_body(e: Any, label: str = 'event', partial: bool = False) -> Dict[str, Any]:
+    """校验单个事件，只保留可写字段；partial=True 时（PATCH）不要求 title，值为 null 表示删除该字段。"""
+    if not isinstance(e, dict):
+        raise ApiError(errors.BAD_REQUEST, 'person_invalid', {"reason": f"{label} must be an object"})
+    for f in datacheck.EVENT_FIELDS:
+        val = e.get(f)
+        if val is not None and (isinstance(val, bool) or not isinstance(val, (str, int, float))):
+            raise ApiError(errors.BAD_REQUEST, 'person_invalid', {"reason": f"{label}.{f} must be a string or number"})
+    if (not partial or 'title' in e) and not str(e.get('title') or '').strip():
+        raise ApiError(errors.BAD_REQUEST, 'person_invalid', {"reason": f"{label}.title is required"})
+    return {f: e[f] for f in EVENT_WRITE_FIELDS if f in e and (partial or e[f] is not None)}
+
+
+def handle_person_write(handler, app, logger=None):
+    """POST /api/person 新建（已存在时 409）、PUT /api/person 新建或整体替换人工编写的人物轨迹。
+
+    需要管理令牌，只读模式下拒绝；事件经与 AI 生成相同的增强流水线（排序去重、朝代、坐标补全等），
+    再按 validate 的规则校验，存在 error 级问题时返回 400 并附问题列表。
+    """
+    require_admin(handler)
+    if FLAGS.enabled('read_only'):
+        raise ApiError(errors.READ_ONLY, 'read_only')
+    person = _person_from_body(read_json_body(handler))
+    name = person['name']
+    existing = app.cache.find_person(name, app.fallback)
+    exists = bool(existing) and bool(existing.get('events'))
+    if exists and handler.command == 'POST':
+        raise ApiError(errors.CONFLICT, 'person_exists', {"name": existing.get('name', name)})
+    if exists:
+        name = person['name'] = existing.get('name', name)
+    person = enrich.run(person, enrich.build_pipeline(geocoder=app.geocoder, ctx=handler.ctx))
+    issues = datacheck.check_people({'persons': [person]})
+    problems = [it for it in issues if it['level'] == 'error']
+    if problems:
+        raise ApiError(errors.BAD_REQUEST, 'person_invalid', {"reason": problems[0]['message'], "issues": problems})
+    app.cache.upsert_person(person, app.fallback)
+    if logger:
+        logger.info("人工%s人物：name=%s, events=%d, rid=%s", '更新' if exists else '新建', name,
+                    len(person['events']), handler.ctx.request_id)
+    write_ok(handler, person, meta={"created": not exists,
+                                    "warnings": [it for it in issues if it['level'] == 'warning']},
+             code=200 if exists else 201)
+
+
+def handle_person_event(handler, app, logger=None):
+    """单个事件的增删改（按事件 id，兼容数字下标）：
+    - POST   /api/person/{name}/events        插入事件（按年份排入时间线）
+    - PATCH  /api/person/{name}/events/{id}   修改部分字段；改了地点而未给坐标时清空坐标以便重新补全
+    - DELETE /api/person/{name}/events/{id}   删除事件（不能删除最后一个）
+    修改后经增强流水线与 validate 规则校验；其余事件的 id 与译文保持不变。返回受影响的事件。
+    """
+    name = validate_name(handler.route_params.get('name', ''))
+    found = app.cache.find_person(name, app.fallback)
+    if not found or not found.get('events'):
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+    person = copy.deepcopy(found)
+    migrate.assign_ids(person)
+    events = person['events']
+    # 译文按下标与事件对应：先按 id 记下，重排后再对齐
+    by_id = {lang: {e['id']: item for e, item in zip(events, (t or {}).get('events') or [])}
+             for lang, t in (person.get('translations') or {}).items()}
+    stale = set()
+    ref = handler.route_params.get('id')
+    index = None
+    if ref is not None:
+        index = next((i for i, e in enumerate(events) if e.get('id') == ref), None)
+        if index is None and ref.isdigit() and int(ref) < len(events):
+            index = int(ref)
+        if index is None:
+            raise ApiError(errors.NOT_FOUND, 'event_not_found', {"name": person['name'], "index": ref})
+
+    if handler.command == 'DELETE':
+        if len(events) == 1:
+            raise ApiError(errors.BAD_REQUEST, 'person_invalid', {"reason": "cannot delete the only event"})
+        event = events.pop(index)
+    elif handler.command == 'PATCH':
+        patch = _event_from_body(read_json_body(handler), partial=True)
+        event = events[index]
+        if 'place' in patch and patch['place'] != event.get('place') and 'lat' not in patch and 'lon' not in patch:
+            patch.update(lat=None, lon=None)
+        if 'year' in patch:
+            # 年份变了：原文年份与年龄随之失效，由增强流水线重新推算
+            patch.setdefault('year_text', None)
+            patch.setdefault('age', None)
+        for f, v in patch.items():
+            if v is None:
+                event.pop(f, None)
+            else:
+                event[f] = v
+        if any(f in patch for f in translations.TEXT_FIELDS):
+            stale.add(event['id'])
+    else:
+        event = _event_from_body(read_json_body(handler))
+        events.append(event)
+        migrate.assign_ids(person)
+
+    person = enrich.run(person, enrich.build_pipeline(geocoder=app.geocoder, ctx=handler.ctx))
+    if by_id:
+        person['translations'] = {lang: {'events': [{} if e['id'] in stale else items.get(e['id'], {}) for e in person['events']]}
+                                  for lang, items in by_id.items()}
+    problems = [it for it in datacheck.check_people({'persons': [person]}) if it['level'] == 'error']
+    if problems:
+        raise ApiError(errors.BAD_REQUEST, 'person_invalid', {"reason": problems[0]['message'], "issues": problems})
+    app.cache.upsert_person(person, app.fallback)
+    if logger:
+        logger.info("编辑事件：name=%s, op=%s, id=%s, rid=%s", person['name'], handler.command, event.get('id'), handler.ctx.request_id)
+    current = next((e for e in person['events'] if e.get('id') == event.get('id')), event)
+    write_ok(handler, current, meta={"person": person['name'], "events": len(person['events'])},
+             code=201 if handler.command == 'POST' else 200)
+
+
+def handle_person(handler, app, logger=None):
+    """GET ?name=：取人物轨迹，缓存未命中时调用 AI 生成（?refresh=true 由管理员强制重新生成）；?names=a,b 一次取多位。
+    POST / PUT 为人工录入（见 handle_person_write）。"""
+    if handler.command in ('POST', 'PUT'):
+        handle_person_write(handler, app, logger=logger)
+        return
+    qs = _query(handler)
+    if 'names' in qs:
+        handle_person_multi(handler, app, qs, logger=logger)
+        return
+    name = validate_name((qs.get('name') or [''])[0])
+    ctx = handler.ctx
+    logger.info("查询人物：name=%s, rid=%s", name, ctx.request_id)
+    queried = name
+    meta_extra: Dict[str, Any] = {}
+    if (qs.get('refresh') or [''])[0].strip().lower() in ('1', 'true', 'yes'):
+        found, meta_extra = _refresh_person(handler, app, name, logger)
+        name, source = found.get('name', name), 'refreshed'
+    else:
+        name, found = _lookup_person(ctx, app, name, logger, record=False)
+        source = 'cache'
+    if not found:
+        try:
+            found = _generate_with_deadline(ctx, app, name, logger)
+        except ApiError:
+            analytics.ANALYTICS.record_request('person', queried, False)
+            raise
+        source = 'generated'
+    hit = bool(found) and len(found.get('events', [])) > 0
+    analytics.ANALYTICS.record_request('person', found.get('name', name) if hit else queried, hit)
+    if not hit:
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+    explicit, wanted = _requested_langs(handler, qs)
+    if explicit and explicit not in translations.available(found):
+        found = _translate_person(ctx, app, found, explicit, logger) or found
+    lang = translations.pick(found, wanted)
+    meta = {"source": source, "travel": overlap.travel_stats(found), "lang": lang, "available_langs": translations.available(found)}
+    if name_key(found.get('name', '')) != name_key(queried):
+        meta['query'] = queried
+    meta.update(meta_extra)
+    write_ok(handler, translations.localize(found, lang), meta=meta, project_path=[],
+             headers={'Content-Language': lang, 'Vary': 'Accept-Language'})
+
+
+def _refresh_person(handler, app, name: str, logger=None):
+    """?refresh=true：忽略缓存重新调用 AI 生成并覆盖已存的人物，覆盖前另存旧版本（需管理令牌，只读模式下拒绝）。
+    AI 未返回事件时保留原数据并报错。返回 (人物, 附加 meta)。"""
+    require_admin(handler)
+    if FLAGS.enabled('read_only'):
+        raise ApiError(errors.READ_ONLY, 'read_only')
+    existing = app.cache.find_person(name)
+    if existing:
+        name = existing.get('name', name)
+    backup = app.cache.backup_person(name, handler.ctx) if existing and existing.get('events') else None
+    found = _generate_with_deadline(handler.ctx, app, name, logger)
+    if not found or not found.get('events'):
+        raise ApiError(errors.UPSTREAM_ERROR, 'refresh_empty', {"name": name})
+    if logger:
+        logger.info("重新生成人物：name=%s, events=%d, backup=%s, rid=%s", name, len(found['events']),
+                    os.path.basename(backup) if backup else None, handler.ctx.request_id)
+    return found, {"replaced": bool(existing and existing.get('events')),
+                   "backup": os.path.basename(backup) if backup else None}
+
+
+def _run_generate_job(ctx, app, jid: str, name: str, logger=None):
+    JOBS.started(jid)
+    try:
+        person = _generate_person(ctx, app, name, logger)
+    except ApiError as e:
+        JOBS.failed(jid, e)
+        return
+    except Exception:
+        if logger:
+            logger.exception("异步生成失败：name=%s, job=%s", name, jid)
+        JOBS.failed(jid, ApiError(errors.INTERNAL_ERROR, 'internal_error'))
+        return
+    if person:
+        JOBS.finished(jid, person)
+    else:
+        JOBS.failed(jid, ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name}))
+
+
+def _job_view(handler, job: Dict[str, Any]) -> Dict[str, Any]:
+    out = dict(job)
+    if isinstance(out.get('error'), ApiError):
+        out['error'] = out['error'].to_dict(request_lang(handler))
+    return out
+
+
+def handle_person_generate(handler, app, logger=None):
+    """POST /api/person/generate {"name": "..."}（或 ?name=）：在后台生成人物轨迹，立即返回 202 与任务，
+    Location 指向 GET /api/v1/jobs/{id}。已缓存时直接返回已完成的任务（200），同一人物已在生成时返回该任务。"""
+    qs = _query(handler)
+    body = read_json_body(handler) if int(handler.headers.get('Content-Length') or 0) > 0 else {}
+    raw = (body.get('name') if isinstance(body, dict) else None) or (qs.get('name') or [''])[0]
+    name = validate_name(raw if isinstance(raw, str) else '')
+    ctx = handler.ctx
+    name, found = _lookup_person(ctx, app, name, logger, endpoint='generate', record=False)
+    if found and found.get('events'):
+        job = JOBS.create(found.get('name', name), status='done')
+        JOBS.finished(job['id'], found, source='cache')
+        write_ok(handler, _job_view(handler, JOBS.get(job['id'])), code=200, project_path=['person'])
+        return
+    if not FLAGS.enabled('generation') or FLAGS.enabled('read_only'):
+        raise ApiError(errors.PERSON_NOT_FOUND, 'generation_disabled', {"name": name})
+    job = JOBS.active(name)
+    if job is None:
+        job = JOBS.create(name)
+        # 任务脱离请求执行：沿用请求的 request_id 前缀与配额，但不受请求截止时间限制
+        job_ctx = reqctx.detach(ctx)
+        _submit(lambda: _run_generate_job(job_ctx, app, job['id'], name, logger))
+        if logger:
+            logger.info("已提交异步生成：name=%s, job=%s, rid=%s", name, job['id'], ctx.request_id)
+    write_ok(handler, _job_view(handler, JOBS.get(job['id']) or job), code=202,
+             headers={'Location': f"/api/{API_VERSION}/jobs/{job['id']}"})
+
+
+def handle_job(handler):
+    """GET /api/jobs/{id}：异步任务状态；完成后 person 为生成的人物（支持 ?fields=），失败时 error 为统一错误结构。"""
+    jid = handler.route_params.get('id', '')
+    job = JOBS.get(jid)
+    if job is None:
+        raise ApiError(errors.NOT_FOUND, 'job_not_found', {"id": jid})
+    write_ok(handler, _job_view(handler, job), project_path=['person'])
+
+
+def handle_person_multi(handler, app, qs: Dict[str, list], logger=None):
+    """/api/person?names=a,b,c[&generate=1]
+
+    按请求顺序返回 [{name, status, person}]：
+    - status=cached：命中缓存，直接返回
+    - status=generated：未命中且 generate=1，经 AI 并发生成
+    - status=missing：未命中（或生成失败），person 为 null，生成失败时附 error
+    """
+    names = validate_names(','.join(qs.get('names') or []))
+    generate = (qs.get('generate') or [''])[0].strip().lower() in ('1', 'true', 'yes')
+    _person_multi(handler, app, qs, names, generate, logger)
+
+
+def handle_people_batch(handler, app, logger=None):
+    """POST /api/people/batch {"names": [...], "generate": false}：与 GET /api/person?names= 相同，
+    姓名放在请求体中，便于多人地图一次取回（姓名较多时不受 URL 长度限制）。"""
+    body = read_json_body(handler)
+    raw = body.get('names') if isinstance(body, dict) else None
+    if not isinstance(raw, list) or not all(isinstance(n, str) for n in raw):
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "names"})
+    if any(',' in n or '，' in n for n in raw):
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "names", "reason": "comma"})
+    names = validate_names(','.join(raw))
+    generate = body.get('generate') is True
+    _person_multi(handler, app, _query(handler), names, generate, logger)
+
+
+def _person_multi(handler, app, qs: Dict[str, list], names: List[str], generate: bool, logger=None):
+    ctx = handler.ctx
+    results = []
+    misses = []
+    for n in names:
+        resolved, found = _lookup_person(ctx, app, n, logger, endpoint='person_multi', record=False)
+        if found and len(found.get('events', [])) > 0:
+            results.append({"name": n, "status": "cached", "person": found})
+        else:
+            results.append({"name": n, "status": "missing", "person": None})
+            misses.append((len(results) - 1, resolved))
+    if logger:
+        logger.info("批量查询人物：total=%d, cached=%d, missing=%d", len(names), len(names) - len(misses), len(misses))
+
+    if generate and misses and FLAGS.enabled('batch_generate'):
+        timeout = config.get_generate_timeout_sec()
+        futures = {_submit_generate(ctx, app, resolved, logger): idx for idx, resolved in misses}
+        done, _ = wait(list(futures), timeout=timeout)
+        for fut, idx in futures.items():
+            if fut not in done:
+                err = ApiError(errors.UPSTREAM_TIMEOUT, 'generation_timeout', {"name": results[idx]["name"], "timeout_sec": timeout})
+                results[idx]["error"] = err.to_dict(request_lang(handler))
+                continue
+            try:
+                person = fut.result()
+            except ApiError as e:
+                results[idx]["error"] = e.to_dict(request_lang(handler))
+                person = None
+            except Exception:
+                person = None
+            if person:
+                results[idx]["status"] = "generated"
+                results[idx]["person"] = person
+
+    # 多语言：只在已有语言中选择，不按需翻译
+    _, wanted = _requested_langs(handler, qs)
+    counts = {}
+    for r in results:
+        counts[r["status"]] = counts.get(r["status"], 0) + 1
+        analytics.ANALYTICS.record_request('person_multi', r["person"].get('name', r["name"]) if r["person"] else r["name"],
+                                           r["person"] is not None)
+        if r["person"]:
+            r["lang"] = translations.pick(r["person"], wanted)
+            r["person"] = translations.localize(r["person"], r["lang"])
+    write_ok(handler, results, meta={"total": len(results), "counts": counts}, project_path=['person'],
+             headers={'Vary': 'Accept-Language'})
+
+
+def _fill_coords(ctx, app, persons: List[Dict[str, Any]], budget: int) -> Dict[str, int]:
+    """为缺坐标的事件补上坐标（就地修改，调用方传入副本）：先取缓存中同名地点的坐标，
+    再调用地理编码，外部查询最多 budget 次。返回 {from_cache, geocoded, unresolved}。"""
+    everyone = (app.cache.get_people_or_fallback(app.fallback) or {}).get('persons') or []
+    stats = {'from_cache': 0, 'geocoded': 0, 'unresolved': 0}
+    looked_up: Dict[str, Any] = {}
+    for p in persons:
+        for e in p.get('events') or []:
+            place = str(e.get('place') or '').strip()
+            if not place or (e.get('lat') not in (None, '') and e.get('lon') not in (None, '')):
+                continue
+            key = name_key(place)
+            if key not in looked_up:
+                coords = overlap.place_coords(everyone, place)
+                if coords:
+                    looked_up[key] = (coords, 'from_cache')
+                elif budget > 0 and config.get_geocode_enabled():
+                    budget -= 1
+                    found = app.geocoder.geocode(ctx, place)
+                    looked_up[key] = ((float(found['lat']), float(found['lon'])), 'geocoded') if found else (None, 'unresolved')
+                else:
+                    looked_up[key] = (None, 'unresolved')
+            coords, how = looked_up[key]
+            stats[how] += 1
+            if coords:
+                e['lat'], e['lon'] = coords
+    return stats
+
+
+def handle_overlap(handler, app, logger=None):
+    """GET ?names=A,B[,C]&window=年&radius_km=公里[&geocode=1]：已缓存人物两两之间同时同地的交集（见 overlap.py），
+    即可能见过面的时间与地点。geocode=1 且 radius_km > 0 时先为缺坐标的事件补坐标再按距离比较（不写回缓存）。"""
+    qs = _query(handler)
+    names = validate_names(','.join(qs.get('names') or []))
+    if len(names) < 2:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "names"})
+    window = _int_param(qs, 'window', 0) or 0
+    radius_km = _int_param(qs, 'radius_km', 0) or 0
+    if window < 0:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "window"})
+    if radius_km < 0:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "radius_km"})
+    persons, missing = [], []
+    for n in names:
+        _, found = _lookup_person(handler.ctx, app, n, logger, endpoint='overlap')
+        if found and found.get('events'):
+            persons.append(found)
+        else:
+            missing.append(n)
+    if len(persons) < 2:
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": ','.join(missing)})
+    meta = {"persons": [p.get('name') for p in persons], "missing": missing, "window": window, "radius_km": radius_km}
+    if (qs.get('geocode') or [''])[0].strip().lower() in ('1', 'true', 'yes') and radius_km > 0:
+        persons = copy.deepcopy(persons)
+        with handler.ctx.span('overlap_geocode'):
+            meta['coords'] = _fill_coords(handler.ctx, app, persons, config.get_overlap_geocode_max())
+    results = overlap.find(persons, window=window, radius_km=radius_km)
+    write_ok(handler, results, meta=dict(meta, total=len(results)))
+
+
+def handle_compare(handler, app, logger=None):
+    """GET ?names=A,B[,C][&fromYear=&toYear=&years=events|all]：多位已缓存人物按年份对齐的对照表（见 overlap.compare）。"""
+    qs = _query(handler)
+    names = validate_names(','.join(qs.get('names') or []))
+    if len(names) < 2:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "names"})
+    year_from, year_to = _year_param(qs, 'fromYear'), _year_param(qs, 'toYear')
+    if year_from is not None and year_to is not None and year_from > year_to:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "toYear"})
+    mode = (qs.get('years') or ['events'])[0].strip() or 'events'
+    if mode not in ('events', 'all'):
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "years"})
+    persons, missing = [], []
+    for n in names:
+        _, found = _lookup_person(handler.ctx, app, n, logger, endpoint='compare')
+        if found and found.get('events'):
+            persons.append(found)
+        else:
+            missing.append(n)
+    if len(persons) < 2:
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": ','.join(missing)})
+    max_rows = config.get_compare_max_years()
+    data = overlap.compare(persons, year_from, year_to, all_years=mode == 'all', max_rows=max_rows)
+    if data is None:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "years", "max": max_rows})
+    write_ok(handler, data, meta={"rows": len(data['rows']), "missing": missing, "years": mode,
+                                  "fromYear": year_from, "toYear": year_to})
+
+
+def handle_timeline_merged(handler, app, logger=None):
+    """GET ?names=A,B[,C][&fromYear=&toYear=]：多位已缓存人物的事件按年份合并为一条事件流（见 overlap.merged）。"""
+    qs = _query(handler)
+    names = validate_names(','.join(qs.get('names') or []))
+    year_from, year_to = _year_param(qs, 'fromYear'), _year_param(qs, 'toYear')
+    if year_from is not None and year_to is not None and year_from > year_to:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "toYear"})
+    persons, missing = [], []
+    for n in names:
+        _, found = _lookup_person(handler.ctx, app, n, logger, endpoint='timeline_merged')
+        if found and found.get('events'):
+            persons.append(found)
+        else:
+            missing.append(n)
+    if not persons:
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": ','.join(missing)})
+    data = overlap.merged(persons, year_from, year_to)
+    write_ok(handler, data, meta={"total": len(data['events']), "undated": data['undated'], "missing": missing,
+                                  "fromYear": year_from, "toYear": year_to})
+
+
+def handle_colocation(handler, app):
+    """GET ?place=杭州&yearFrom=1070&yearTo=1090[&radius_km=20]：该时段在该地（含半径内）的已缓存人物。"""
+    qs = _query(handler)
+    place = validate_query_text((qs.get('place') or [''])[0], 'place')
+    if not place:
+        raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "place"})
+    year_from, year_to = _year_param(qs, 'yearFrom'), _year_param(qs, 'yearTo')
+    if year_from is not None and year_to is not None and year_from > year_to:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "yearTo"})
+    radius_km = _count_param(qs, 'radius_km', config.get_colocation_radius_km())
+    persons = (app.cache.get_people_or_fallback(app.fallback) or {}).get('persons') or []
+    coords = overlap.place_coords(persons, place)
+    if coords is None and radius_km > 0 and config.get_geocode_enabled():
+        found = app.geocoder.geocode(handler.ctx, place)
+        coords = (float(found['lat']), float(found['lon'])) if found else None
+    results = overlap.colocated(persons, place, coords, year_from, year_to, radius_km)
+    write_ok(handler, results, meta={"total": len(results), "place": place, "coords": list(coords) if coords else None,
+                                     "yearFrom": year_from, "yearTo": year_to, "radius_km": radius_km})
+
+
+def handle_snapshot(handler, app):
+    """GET ?year=1080[&names=A,B]：当年处于活动期的已缓存人物及其最近一次事件的位置，供时间轴滑块使用。"""
+    qs = _query(handler)
+    year = _int_param(qs, 'year')
+    if year is None:
+        raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "year"})
+    persons = (app.cache.get_people_or_fallback(app.fallback) or {}).get('persons') or []
+    if qs.get('names'):
+        wanted = {name_key(n) for n in validate_names(','.join(qs['names']))}
+        persons = [p for p in persons if name_key(p.get('name', '')) in wanted]
+    results = overlap.snapshot(persons, year)
+    write_ok(handler, results, meta={"total": len(results), "year": year})
+
+
+def handle_person_path(handler, app, logger=None):
+    """GET /api/person/{name}/path[?steps=N]：已缓存人物按时间顺序的坐标序列与分段（见 overlap.path），不触发生成。"""
+    qs = _query(handler)
+    name = validate_name(handler.route_params.get('name', ''))
+    steps = _int_param(qs, 'steps', 0) or 0
+    max_steps = config.get_path_max_steps()
+    if steps < 0 or steps > max_steps:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "steps", "max": max_steps})
+    name, found = _lookup_person(handler.ctx, app, name, logger, endpoint='path')
+    if not found or not found.get('events'):
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+    data = overlap.path(found, steps)
+    write_ok(handler, dict(data, name=found.get('name', name), style=found.get('style')),
+             meta={"points": len(data['points']), "segments": len(data['segments']), "steps": steps})
+
+
+def handle_stats(handler, app):
+    """GET 已缓存人物的总览与各人物行程统计（按总里程降序），供「趣味数据」面板使用；
+    dataset 为数据盘点（年代分布、常见地点、坐标覆盖率、事件最少的人物等，见 datastats.py），?top= 控制各榜单长度。"""
+    qs = _query(handler)
+    top = _int_param(qs, 'top', 10)
+    if top is None or not 0 < top <= 100:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "top", "max": 100})
+    payload = app.cache.get_people_or_fallback(app.fallback) or {}
+    persons = [p for p in payload.get('persons') or [] if p.get('events')]
+    travel = [dict(overlap.travel_stats(p), name=p.get('name', '')) for p in persons]
+    travel.sort(key=lambda t: (-t['total_km'], t['name']))
+    data = {
+        "persons": len(persons),
+        "events": sum(len(p.get('events') or []) for p in persons),
+        "total_km": round(sum(t['total_km'] for t in travel), 1),
+        "travel": travel,
+        "dataset": datastats.collect(payload, top),
+    }
+    write_ok(handler, data, meta={"total": len(travel), "top": top})
+
+
+_OPENAPI: Dict[str, Any] = {}
+
+
+def handle_openapi(handler, api_routes):
+    """GET /api/v1/openapi.json：由路由表生成的 OpenAPI 3 描述（见 openapi.py），直接返回文档本身，不套 {data, meta}。"""
+    if not _OPENAPI:
+        _OPENAPI.update(openapi.build(api_routes, API_VERSION))
+    _write_json(handler, 200, _OPENAPI, {'Cache-Control': 'public, max-age=300'})
+
+
+def handle_dynasty(handler):
+    """GET ?year=1080 查询朝代与年号；不带 year 时列出朝代表。"""
+    qs = _query(handler)
+    if not (qs.get('year') or [''])[0].strip():
+        write_ok(handler, dynasty.TABLE.dynasties())
+        return
+    year = _int_param(qs, 'year')
+    if year is None:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "year"})
+    write_ok(handler, dynasty.TABLE.lookup(year), meta={"year": year})
+
+
+def handle_person_export(handler, app, logger=None):
+    """GET /api/person/{name}/export?format=csv|json|geojson：下载已缓存人物的事件表（默认 CSV，带 BOM 便于 Excel 打开）。"""
+    qs = _query(handler)
+    name = validate_name(handler.route_params.get('name', ''))
+    fmt = (qs.get('format') or ['csv'])[0].strip().lower() or 'csv'
+    if fmt not in export.FORMATS:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "format"})
+    name, found = _lookup_person(handler.ctx, app, name, logger, endpoint='export')
+    if not found or not found.get('events'):
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+    if fmt == 'csv':
+        text = '\ufeff' + export.to_csv([found], export.EVENT_COLUMNS)
+    elif fmt == 'json':
+        text = json.dumps(found, ensure_ascii=False, indent=2)
+    else:
+        text = export.to_geojson([found])
+    body = text.encode('utf-8')
+    filename = quote(f"{found.get('name', name)}.{fmt}")
+    handler._set_headers(200, export.CONTENT_TYPES[fmt], length=len(body),
+                         headers={'Content-Disposition': f"attachment; filename=\"person.{fmt}\"; filename*=UTF-8''{filename}"})
+    handler.wfile.write(body)
+
+
+def handle_person_report(handler, app, logger=None):
+    """GET /api/person/{name}/report.pdf：已缓存人物的可打印传记报告（见 pdfreport.py）。"""
+    name = validate_name(handler.route_params.get('name', ''))
+    name, found = _lookup_person(handler.ctx, app, name, logger, endpoint='report')
+    if not found or not found.get('events'):
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+    body = pdfreport.render(found)
+    filename = quote(f"{found.get('name', name)}.pdf")
+    handler._set_headers(200, 'application/pdf', length=len(body),
+                         headers={'Content-Disposition': f"inline; filename=\"report.pdf\"; filename*=UTF-8''{filename}"})
+    handler.wfile.write(body)
+
+
+def _write_proxied(handler, px, url):
+    host = urlparse(url).hostname or ''
+    try:
+        result = px.fetch(url)
+    except proxy.UpstreamError as e:
+        if e.timeout:
+            raise ApiError(errors.UPSTREAM_TIMEOUT, 'proxy_upstream_timeout', {"host": host})
+        if e.status == 404:
+            raise ApiError(errors.NOT_FOUND, 'proxy_upstream_error', {"reason": str(e), "host": host})
+        raise ApiError(errors.UPSTREAM_ERROR, 'proxy_upstream_error', {"reason": str(e), "host": host})
+    if result is None:
+        raise ApiError(errors.RATE_LIMITED, 'proxy_rate_limited', {"host": host}, headers={'Retry-After': '1'})
+    data, ctype = result
+    handler._set_headers(200, ctype, length=len(data), headers={'Cache-Control': 'public, max-age=86400'})
+    handler.wfile.write(data)
+
+
+def handle_tile(handler, px, providers):
+    """GET /api/tiles/{provider}/{z}/{x}/{y}：经磁盘缓存代理地图瓦片（见 proxy.py）。"""
+    params = handler.route_params
+    template = providers.get(params.get('provider', ''))
+    if template is None:
+        raise ApiError(errors.NOT_FOUND, 'unknown_tile_provider', {"provider": params.get('provider', '')})
+    tile = proxy.parse_tile(params.get('z', ''), params.get('x', ''), params.get('y', ''))
+    if tile is None:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "z/x/y"})
+    _write_proxied(handler, px, proxy.tile_url(template, *tile))
+
+
+def handle_proxy_image(handler, app, px):
+    """GET ?url=：代理事件附件中引用的外部图片，其他地址一律拒绝。"""
+    url = (_query(handler).get('url') or [''])[0].strip()
+    if not url:
+        raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "url"})
+    persons = (app.cache.get_people_or_fallback(app.fallback) or {}).get('persons') or []
+    if url not in proxy.referenced_images(persons):
+        raise ApiError(errors.FORBIDDEN, 'proxy_url_not_allowed')
+    _write_proxied(handler, px, url)
+
+
+def handle_person_translate(handler, app, logger=None):
+    """POST /api/person/{name}/translate?lang=en[&force=1]：经 AI 翻译已缓存人物的事件文本并保存为该语言版本；
+    已有译文时直接返回（cached=true），force=1 时重新翻译。"""
+    name = validate_name(handler.route_params.get('name', ''))
+    qs = _query(handler)
+    explicit, _ = _requested_langs(handler, qs)
+    if not explicit:
+        raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "lang"})
+    name, found = _lookup_person(handler.ctx, app, name, logger, endpoint='translate')
+    if not found or not found.get('events'):
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+    force = (qs.get('force') or [''])[0].strip().lower() in ('1', 'true', 'yes')
+    cached = explicit == translations.base_lang(found) or (explicit in translations.available(found) and not force)
+    if not cached:
+        if FLAGS.enabled('read_only'):
+            raise ApiError(errors.READ_ONLY, 'read_only')
+        updated = _translate_person(handler.ctx, app, found, explicit, logger)
+        if updated is None:
+            raise ApiError(errors.PERSON_NOT_FOUND, 'generation_disabled', {"name": name})
+        found = updated
+    meta = {"lang": explicit, "cached": cached, "available_langs": translations.available(found)}
+    write_ok(handler, translations.localize(found, explicit), meta=meta, project_path=[],
+             headers={'Content-Language': explicit})
+
+
+def handle_person_narration(handler, app, narrator, logger=None):
+    """GET /api/person/{name}/narration[?lang=&voice=&script=1]：人物轨迹的解说音频（支持 Range）或解说词（见 narration.py）。"""
+    name = validate_name(handler.route_params.get('name', ''))
+    qs = _query(handler)
+    name, found = _lookup_person(handler.ctx, app, name, logger, endpoint='narration')
+    if not found or not found.get('events'):
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+    _, wanted = _requested_langs(handler, qs)
+    lang = translations.pick(found, wanted)
+    segments = narration.script(translations.localize(found, lang), config.get_narration_max_chars())
+    text = '\n'.join(seg['text'] for seg in segments)
+    if (qs.get('script') or [''])[0].strip().lower() in ('1', 'true', 'yes'):
+        write_ok(handler, {"name": found.get('name', name), "text": text, "segments": segments}, meta={"lang": lang},
+                 headers={'Content-Language': lang})
+        return
+    voice = (qs.get('voice') or [''])[0].strip() or config.get_tts_voice()
+    voices = config.get_tts_voices()
+    if voice not in voices:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "voice", "allowed": voices})
+    synthesize = FLAGS.enabled('generation')
+    if synthesize and handler.ctx.quota is not None and not narrator.cached(text, lang, voice):
+        # 每次合成都是一次付费调用：未命中缓存时先扣额度
+        handler.ctx.quota.consume('generations')
+    try:
+        with handler.ctx.span('tts', person=name, chars=len(text)):
+            path, _ = narrator.audio(text, lang, voice, handler.ctx.timeout(float(config.get_tts_timeout_sec())), synthesize)
+    except narration.TTSError as e:
+        if e.kind == 'disabled':
+            raise ApiError(errors.PERSON_NOT_FOUND, 'generation_disabled', {"name": name})
+        if e.kind == 'unavailable':
+            raise ApiError(errors.UPSTREAM_ERROR, 'tts_unavailable', {"reason": str(e)})
+        if e.kind == 'timeout':
+            raise ApiError(errors.UPSTREAM_TIMEOUT, 'tts_timeout', {"name": name})
+        raise ApiError(errors.UPSTREAM_ERROR, 'tts_failed', {"reason": str(e)})
+    # 以静态文件方式输出：条件请求与 Range 由 _serve_file 处理
+    handler._status = 200
+    handler._serve_file(path)
+
+
+def handle_person_related(handler, app, logger=None):
+    """GET /api/person/{name}/related[?limit=10]：相关人物推荐（共同地点、时代重叠、相互提及、生平文本相似，见 recommend.py）。"""
+    name = validate_name(handler.route_params.get('name', ''))
+    limit = max(1, min(_int_param(_query(handler), 'limit', 10) or 10, 50))
+    name, found = _lookup_person(handler.ctx, app, name, logger, endpoint='related')
+    if not found or not found.get('events'):
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+    by_canonical: Dict[str, List[str]] = {}
+    for alias, canonical in app.cache.alias_map().items():
+        by_canonical.setdefault(name_key(canonical), []).append(alias)
+    persons = (app.cache.get_people_or_fallback(app.fallback) or {}).get('persons') or []
+    with handler.ctx.span('related', person=name, candidates=len(persons)):
+        items = recommend.related(found, persons, lambda n: by_canonical.get(name_key(n), []), limit)
+    write_ok(handler, items, meta={"name": found.get('name', name), "total": len(items), "weights": recommend.WEIGHTS})
+
+
+def handle_search(handler, backend):
+    """GET /api/search?q=...[&in=name,title,detail,place&limit=20&offset=0]：全文检索人物与事件，返回带高亮位置的片段（见 search.py）。"""
+    qs = _query(handler)
+    q = validate_query_text((qs.get('q') or [''])[0]).strip()
+    if not q:
+        raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "q"})
+    fields = tuple(f.strip() for f in ','.join(qs.get('in') or []).split(',') if f.strip()) or search.FIELDS
+    if any(f not in search.FIELDS for f in fields):
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "in", "allowed": list(search.FIELDS)})
+    limit = max(1, min(_int_param(qs, 'limit', 20) or 20, 100))
+    offset = max(0, _int_param(qs, 'offset', 0) or 0)
+    with handler.ctx.span('search'):
+        result = backend.search(q, limit, offset, fields)
+    if offset == 0:
+        analytics.ANALYTICS.record_search('fulltext', q, result['total'])
+    write_ok(handler, result['items'], meta={"total": result['total'], "offset": offset, "limit": limit, "q": q,
+                                             "in": list(fields), "has_more": offset + len(result['items']) < result['total']})
+
+
+def handle_semantic_search(handler, index):
+    """GET /api/search/semantic?q=...[&type=person|event&limit=10]：按语义相似度检索人物与事件（见 embeddings.py）。"""
+    qs = _query(handler)
+    q = validate_query_text((qs.get('q') or [''])[0]).strip()
+    if not q:
+        raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "q"})
+    kind = (qs.get('type') or [''])[0].strip() or None
+    if kind not in (None, 'person', 'event'):
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "type"})
+    limit = max(1, min(_int_param(qs, 'limit', 10) or 10, 100))
+    try:
+        with handler.ctx.span('semantic_search'):
+            items = index.search(q, limit, kind)
+    except embeddings.EmbeddingError as e:
+        raise ApiError(errors.UPSTREAM_ERROR, 'embedding_failed', {"reason": str(e)})
+    analytics.ANALYTICS.record_search('semantic', q, len(items))
+    write_ok(handler, items, meta=dict(index.stats(), total=len(items), q=q))
+
+
+def handle_admin_embeddings_rebuild(handler, app, index):
+    """POST 按当前缓存增量重建向量索引，返回新增/复用/移除条目数。"""
+    persons = (app.cache.get_people_or_fallback(app.fallback) or {}).get('persons') or []
+    try:
+        report = index.rebuild(persons)
+    except embeddings.EmbeddingError as e:
+        raise ApiError(errors.UPSTREAM_ERROR, 'embedding_failed', {"reason": str(e)})
+    write_ok(handler, report)
+
+
+def handle_clusters(handler, job):
+    """GET 最近一次聚类分析的结果（不含事件明细）；?q= 按簇名/地点/人物过滤，?min_persons= 只看较大的簇。"""
+    qs = _query(handler)
+    q = validate_query_text((qs.get('q') or [''])[0]).strip()
+    min_persons = _int_param(qs, 'min_persons', 0) or 0
+    limit = max(1, min(_int_param(qs, 'limit', 100) or 100, 1000))
+    items = []
+    for c in (job.result() or {}).get('clusters') or []:
+        if c['person_count'] < min_persons:
+            continue
+        if q and q not in c['label'] and not any(q in x for x in c['places'] + c['persons']):
+            continue
+        items.append({k: v for k, v in c.items() if k != 'events'})
+    write_ok(handler, items[:limit], meta=dict(job.status(), matched=len(items)))
+
+
+def handle_cluster(handler, job):
+    """GET /api/analysis/clusters/{id}：单个簇及其事件明细。"""
+    raw = handler.route_params.get('id', '')
+    clusters = (job.result() or {}).get('clusters') or []
+    found = next((c for c in clusters if str(c.get('id')) == raw), None)
+    if found is None:
+        raise ApiError(errors.NOT_FOUND, 'cluster_not_found', {"id": raw})
+    write_ok(handler, found, meta=job.status())
+
+
+def handle_admin_clusters_run(handler, app, job):
+    """POST {"radius_km", "gap_years", "min_persons"}（均可省略）在后台重新聚类，返回 202；已有任务运行时返回 409。"""
+    body = read_json_body(handler) if handler.headers.get('Content-Length') not in (None, '0') else {}
+    params = clusters.parse_params(body if isinstance(body, dict) else {})
+    if params is None:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "radius_km/gap_years/min_persons"})
+    persons = (app.cache.get_people_or_fallback(app.fallback) or {}).get('persons') or []
+    if not job.start(persons, params):
+        raise ApiError(errors.CONFLICT, 'job_running')
+    write_ok(handler, {"started": True, "params": params}, meta=job.status(), code=202)
+
+
+def handle_person_translation(handler, app):
+    """POST /api/person/{name}/translations/{lang} {"events": [{place, title, detail}]} 写入译文（按事件下标对应）；DELETE 删除。"""
+    name = validate_name(handler.route_params.get('name', ''))
+    lang = translations.normalize_lang(handler.route_params.get('lang', ''))
+    if not lang:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "lang"})
+    person = app.cache.find_person(name)
+    if not person or not person.get('events'):
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+    if lang == translations.base_lang(person):
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "lang"})
+    items = None
+    if handler.command != 'DELETE':
+        body = read_json_body(handler)
+        items = translations.clean_items(body.get('events') if isinstance(body, dict) else None, len(person['events']))
+        if items is None:
+            raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "events"})
+    updated = app.cache.set_translation(name, lang, items)
+    if updated is None:
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+    write_ok(handler, {"name": updated.get('name', name), "lang": lang, "available_langs": translations.available(updated)})
+
+
+def handle_names(handler, app):
+    """GET 姓名列表 [{name, cached}]：q 子串过滤，sort 同 /api/people，offset/limit 分页。
+    cached 用于区分“直接查看”与“需生成（较慢）”。"""
+    qs = _query(handler)
+    q = validate_query_text((qs.get('q') or [''])[0])
+    sort = _sort_param(qs)
+    offset = _count_param(qs, 'offset', 0)
+    limit = _count_param(qs, 'limit')
+    cache_headers = _cache_headers(handler, app)
+    if not_modified(handler, cache_headers):
+        return
+    total, items = app.cache.get_names_page(q, offset, limit, sort)
+    if q.strip() and offset == 0:
+        # 只统计首页，翻页不重复计数
+        analytics.ANALYTICS.record_search('names', q, total)
+    write_ok(handler, items, meta={"total": total, "offset": offset, "limit": limit, "sort": sort}, headers=cache_headers)
+
+
+def handle_names_suggest(handler, app):
+    """GET ?q=李[&limit=N]：搜索框输入提示，前缀匹配优先、再子串匹配，最多 NAMES_SUGGEST_MAX 条。"""
+    qs = _query(handler)
+    q = validate_query_text((qs.get('q') or [''])[0]).strip()
+    if not q:
+        raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "q"})
+    max_results = config.get_names_suggest_max()
+    limit = _int_param(qs, 'limit', max_results)
+    if limit is None or not 0 < limit <= max_results:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "limit", "max": max_results})
+    items = app.cache.suggest_names(q, limit)
+    write_ok(handler, items, meta={"total": len(items), "q": q, "limit": limit})
+
+
+def handle_aliases(handler, app):
+    """GET 别名表（别名 → 规范姓名）。"""
+    write_ok(handler, app.cache.alias_map())
+
+
+def require_admin(handler):
+    # 管理接口需携带 Authorization: Bearer <token> 或 X-Admin-Token；未配置 ADMIN_TOKEN 时一律拒绝（ADMIN_OPEN=1 仅供本地开发）
+    token = config.get_admin_token()
+    if not token:
+        if config.get_admin_open():
+            return
+        raise ApiError(errors.FORBIDDEN, 'admin_disabled')
+    auth = str(handler.headers.get('Authorization') or '')
+    given = auth[7:].strip() if auth.lower().startswith('bearer ') else str(handler.headers.get('X-Admin-Token') or '').strip()
+    if not hmac.compare_digest(given.encode('utf-8'), token.encode('utf-8')):
+        raise ApiError(errors.UNAUTHORIZED, 'unauthorized')
+
+
+def _memory_usage() -> Dict[str, Any]:
+    out: Dict[str, Any] = {}
+    try:
+        import resource
+        # Linux 下 ru_maxrss 单位为 KB
+        out['max_rss_bytes'] = resource.getrusage(resource.RUSAGE_SELF).ru_maxrss * 1024
+    except Exception:
+        pass
+    try:
+        with open('/proc/self/statm', 'r') as f:
+            out['rss_bytes'] = int(f.read().split()[1]) * os.sysconf('SC_PAGE_SIZE')
+    except Exception:
+        pass
+    return out
+
+
+def handle_admin_stats(handler, app):
+    """GET 运行状态：运行时长、缓存与内存、生成成功率与延迟等。"""
+    snap = METRICS.snapshot()
+    counters = snap['counters']
+    gen = snap['durations'].get('generation') or {'count': 0, 'avg_ms': 0, 'max_ms': 0}
+    data = {
+        "uptime_sec": int(time.time() - METRICS.started_at),
+        "profile": app.profile,
+        "cache": app.cache.summary(),
+        "memory": _memory_usage(),
+        "generation": {
+            "success": counters.get('generation.success', 0),
+            "failure": counters.get('generation.failure', 0),
+            "empty": counters.get('generation.empty', 0),
+            "avg_latency_ms": gen['avg_ms'],
+            "max_latency_ms": gen['max_ms'],
+        },
+        "lookups": app.cache.lookup_summary(),
+        "enrich": {"pipeline": enrich.pipeline_names(), "available": sorted(enrich.REGISTRY)},
+        "geocode": {
+            "calls": counters.get('geocode.calls', 0),
+            "cache_hits": counters.get('geocode.cache_hit', 0),
+            "errors": counters.get('geocode.errors', 0),
+            "max_calls_per_person": config.get_geocode_max_calls(),
+        },
+    }
+    write_ok(handler, data)
+
+
+def handle_admin_analytics(handler, app):
+    """GET ?limit=20&days=30：查询热度汇总（见 analytics.py）；DELETE 清空统计。"""
+    if handler.command == 'DELETE':
+        analytics.ANALYTICS.reset()
+        write_ok(handler, {"reset": True})
+        return
+    qs = _query(handler)
+    limit = max(1, min(_int_param(qs, 'limit', 20) or 20, 500))
+    days = max(1, min(_int_param(qs, 'days', 30) or 30, 366))
+    is_cached = lambda name: bool((app.cache.find_person(name, app.fallback) or {}).get('events'))  # noqa: E731
+    write_ok(handler, analytics.ANALYTICS.report(limit, days, is_cached), meta={"limit": limit, "days": days})
+
+
+def handle_admin_quotas(handler, store):
+    """GET 各 API Key 的额度与当日用量；
+    POST {"name", "key"?, "generations_per_day"?, "geocode_per_day"?, "reset_usage"?} 调整额度（null 恢复默认）；
+    DELETE ?name= 删除管理接口添加的覆盖。"""
+    if handler.command == 'DELETE':
+        name = (_query(handler).get('name') or [''])[0].strip()
+        if not name:
+            raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "name"})
+        write_ok(handler, {"name": name, "removed": store.remove(name)})
+        return
+    if handler.command == 'POST':
+        body = read_json_body(handler)
+        name = str(body.get('name') or '').strip() if isinstance(body, dict) else ''
+        if not name:
+            raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "name"})
+        fields = {}
+        for kind in quotas.KINDS:
+            field = f'{kind}_per_day'
+            if field in body:
+                val = body[field]
+                if val is not None and (isinstance(val, bool) or not isinstance(val, int) or val < 0):
+                    raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": field})
+                fields[field] = val
+        if 'key' in body:
+            key = body['key']
+            if key is not None and (not isinstance(key, str) or len(key.strip()) < 16):
+                raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "key"})
+            fields['key'] = key.strip() if key else None
+        if fields:
+            store.update(name, fields)
+        if body.get('reset_usage'):
+            store.reset_usage(name)
+    write_ok(handler, store.status())
+
+
+def handle_admin_usage(handler, ledger):
+    """GET ?month=YYYY-MM[&format=csv]：某月按租户的用量（见 usage.py）；不带 month 时列出各月合计。"""
+    qs = _query(handler)
+    month = (qs.get('month') or [''])[0].strip()
+    fmt = (qs.get('format') or ['json'])[0].strip().lower() or 'json'
+    if fmt not in ('json', 'csv'):
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "format"})
+    if not month:
+        write_ok(handler, ledger.months(), meta={"current": usage.current_month()})
+        return
+    if not usage.valid_month(month):
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "month"})
+    rows = ledger.monthly(month)
+    if fmt == 'json':
+        write_ok(handler, rows, meta={"month": month, "total": len(rows)})
+        return
+    body = ('\ufeff' + usage.to_csv(rows)).encode('utf-8')
+    handler._set_headers(200, 'text/csv; charset=utf-8', length=len(body),
+                         headers={'Content-Disposition': f'attachment; filename="usage-{month}.csv"'})
+    handler.wfile.write(body)
+
+
+def handle_admin_flags(handler):
+    """GET 列出全部开关；POST {"name": ..., "enabled": true|false|null} 设置或清除运行时覆盖。"""
+    if handler.command == 'POST':
+        body = read_json_body(handler)
+        if not isinstance(body, dict) or not isinstance(body.get('name'), str):
+            raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "name"})
+        value = body.get('enabled')
+        if value is not None and not isinstance(value, bool):
+            raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "enabled"})
+        if not FLAGS.set(body['name'], value):
+            raise ApiError(errors.BAD_REQUEST, 'unknown_flag', {"name": body['name']})
+    write_ok(handler, FLAGS.all())
+
+
+def handle_admin_flush(handler, app):
+    """POST 立即落盘；?force=1 或 {"force": true} 时即使没有变更也重写 people.json。返回写入字节数与耗时。"""
+    force = (_query(handler).get('force') or [''])[0].strip().lower() in ('1', 'true', 'yes')
+    if handler.headers.get('Content-Length') not in (None, '0'):
+        body = read_json_body(handler)
+        force = force or (isinstance(body, dict) and body.get('force') is True)
+    report = app.cache.flush_now(force=force, ctx=handler.ctx)
+    if report.get('cancelled'):
+        raise ApiError(errors.UPSTREAM_TIMEOUT, 'flush_cancelled')
+    if report['attempted'] and not report['saved']:
+        raise ApiError(errors.INTERNAL_ERROR, 'flush_failed')
+    write_ok(handler, report)
+
+
+def handle_person_rename(handler, app):
+    """POST {"from": 原名或别名, "to": 新名} 更改人物的规范姓名，已有轨迹与编辑保留，旧名作为别名继续可查。"""
+    body = read_json_body(handler)
+    if not isinstance(body, dict):
+        raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "from"})
+    for param in ('from', 'to'):
+        if not isinstance(body.get(param), str):
+            raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": param})
+    old, new = validate_name(body['from']), validate_name(body['to'])
+    result = app.cache.rename_person(old, new)
+    if result['status'] == 'not_found':
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": old})
+    if result['status'] == 'exists':
+        raise ApiError(errors.CONFLICT, 'person_exists', {"name": new})
+    write_ok(handler, {k: v for k, v in result.items() if k != 'status'})
+
+
+def handle_admin_media_upload(handler, media_root):
+    """POST 请求体为文件内容，保存后返回 {url, type, bytes}（见 media.py）。"""
+    data = read_body(handler, config.get_media_max_bytes())
+    stored = media.store(media_root, data)
+    if stored is None:
+        raise ApiError(errors.BAD_REQUEST, 'unsupported_media')
+    write_ok(handler, stored, code=201)
+
+
+def handle_event_media(handler, app, media_root):
+    """POST {"url", "caption"} 为事件添加附件（同一地址只保留一条，更新说明）；DELETE ?url= 移除。返回事件的 media 列表。
+    事件按稳定的事件 id 定位（事件会重排、增删，下标不可靠）。"""
+    name = validate_name(handler.route_params.get('name', ''))
+    event_id = handler.route_params.get('id', '')
+    if handler.command == 'DELETE':
+        url = (_query(handler).get('url') or [''])[0].strip()
+        if not url:
+            raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "url"})
+
+        def update(event):
+            event['media'] = [m for m in event.get('media') or [] if m.get('url') != url]
+    else:
+        body = read_json_body(handler)
+        if not isinstance(body, dict) or not isinstance(body.get('url'), str):
+            raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "url"})
+        entry = media.make_entry(media_root, body['url'], body.get('caption', ''))
+        if entry is None:
+            raise ApiError(errors.BAD_REQUEST, 'invalid_media_url')
+
+        def update(event):
+            items = [m for m in event.get('media') or [] if m.get('url') != entry['url']]
+            if len(items) >= media.MAX_PER_EVENT:
+                raise ApiError(errors.BAD_REQUEST, 'too_many_media', {"max": media.MAX_PER_EVENT})
+            event['media'] = items + [entry]
+    event = app.cache.update_event(name, event_id, update)
+    if event is None:
+        raise ApiError(errors.NOT_FOUND, 'event_not_found', {"name": name, "index": event_id})
+    write_ok(handler, event.get('media') or [])
+
+
+def handle_admin_evict_person(handler, app):
+    """DELETE ?name=X 从内存缓存移除人物以便重新生成，people.json 中的记录保留到重新生成为止；
+    ?persist=1 时同时从 people.json 删除并立即落盘。"""
+    qs = _query(handler)
+    name = validate_name((qs.get('name') or [''])[0])
+    persist = (qs.get('persist') or [''])[0].strip().lower() in ('1', 'true', 'yes')
+    removed = app.cache.evict_person(name, persist=persist)
+    if removed is None:
+        raise ApiError(errors.PERSON_NOT_FOUND, 'person_not_found', {"name": name})
+    data = {"name": removed.get('name'), "events": len(removed.get('events') or []), "persisted": False}
+    if persist:
+        report = app.cache.flush_now(ctx=handler.ctx)
+        if report['attempted'] and not report['saved']:
+            raise ApiError(errors.INTERNAL_ERROR, 'flush_failed')
+        data['persisted'] = report['saved']
+    write_ok(handler, data)
+
+
+def handle_admin_reload_names(handler, app, excel_dir):
+    """POST 重新扫描姓名来源并把新姓名并入姓名列表，无需重启。返回扫描的文件、新增数与总数。"""
+    write_ok(handler, app.cache.reload_names(excel_dir, handler.ctx))
+
+
+def handle_admin_settings(handler):
+    """GET 列出运行时可调的配置；POST {"key": ..., "value": ...} 修改并写回 config.json（见 settings.py）。"""
+    if handler.command == 'POST':
+        body = read_json_body(handler)
+        if not isinstance(body, dict) or not isinstance(body.get('key'), str):
+            raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "key"})
+        problem = settings.update(body['key'], body.get('value'))
+        if problem == 'unknown':
+            raise ApiError(errors.BAD_REQUEST, 'unknown_setting', {"key": body['key']})
+        if problem:
+            raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "value"})
+    write_ok(handler, settings.all_settings())
+
+
+def handle_admin_log_levels(handler):
+    """GET 列出各组件日志级别；POST {"component": ..., "level": "DEBUG"} 运行时调整（不持久化）。"""
+    if handler.command == 'POST':
+        body = read_json_body(handler)
+        if not isinstance(body, dict) or not isinstance(body.get('component'), str):
+            raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": "component"})
+        if body['component'] not in logsetup.COMPONENTS:
+            raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "component"})
+        if not logsetup.set_level(body['component'], str(body.get('level') or '')):
+            raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "level"})
+    write_ok(handler, logsetup.levels())
 
 
-def handle_names(handler, cache):
-    names = cache.get_names()
-    handler._set_headers(200)
-    handler.wfile.write(json.dumps(names, ensure_ascii=False).encode('utf-8'))
\ No newline at end of file
+def handle_admin_cache_stats(handler, app):
+    """GET ?top=：缓存命中统计（按接口与人物，人物取前 top 个）。"""
+    top = max(1, min(_int_param(_query(handler), 'top', 20) or 20, 500))
+    write_ok(handler, app.cache.lookup_summary(top))
\ No newline at end of file
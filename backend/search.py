@@ -0,0 +1,100 @@
+"""
+全文检索（GET /api/search?q=...）
+
+在人物姓名与事件的标题、详情、地点中查找关键词，返回匹配的人物及带高亮位置的片段：
+- 查询按空白切分为多个词，人物须包含全部词（可分布在不同字段、不同事件中）
+- 匹配前逐字归一（全半角、繁简、异体字、大小写），「蘇軾 黄州」也能命中「苏轼」在「黄州」的事件
+- 得分按命中字段加权累计（姓名 > 地点 > 标题 > 详情），同分按姓名排序
+- 片段截取命中处前后若干字，highlights 为片段内 [起, 止) 字符位置，由前端自行加粗
+
+目前为线性扫描（LinearSearch，数据量在数千人以内足够）；换用倒排索引或外部搜索服务时，
+实现同样的 search(q, limit, offset, fields) 并在 index.py 中替换 SEARCH 即可，路由与响应格式不变。
+"""
+
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+from textnorm import fold_chars, name_key
+
+FIELDS = ('name', 'title', 'detail', 'place')
+WEIGHTS = {'name': 10, 'place': 3, 'title': 2, 'detail': 1}
+SNIPPET_CONTEXT = 20
+MAX_MATCHES = 5
+
+
+def terms(q: str) -> List[str]:
+    seen, out = set(), []
+    for t in fold_chars(q).split():
+        if t not in seen:
+            seen.add(t)
+            out.append(t)
+    return out
+
+
+def _spans(folded: str, words: List[str]) -> List[Tuple[int, int]]:
+    spans = []
+    for w in words:
+        start = folded.find(w)
+        while start >= 0:
+            spans.append((start, start + len(w)))
+            start = folded.find(w, start + len(w))
+    spans.sort()
+    merged: List[List[int]] = []
+    for s, e in spans:
+        if merged and s <= merged[-1][1]:
+            merged[-1][1] = max(merged[-1][1], e)
+        else:
+            merged.append([s, e])
+    return [(s, e) for s, e in merged]
+
+
+def snippet(text: str, spans: List[Tuple[int, int]], context: int = SNIPPET_CONTEXT) -> Dict[str, Any]:
+    """以首个命中为中心截取片段，highlights 换算为片段内位置；截断处加省略号。"""
+    start = max(0, spans[0][0] - context)
+    end = min(len(text), max(spans[0][1] + context, start + 2 * context))
+    prefix = '…' if start > 0 else ''
+    suffix = '…' if end < len(text) else ''
+    shift = len(prefix) - start
+    highlights = [[max(s, start) + shift, min(e, end) + shift] for s, e in spans if s < end and e > start]
+    return {'snippet': prefix + text[start:end] + suffix, 'highlights': highlights}
+
+
+class LinearSearch:
+    def __init__(self, persons: Callable[[], List[Dict[str, Any]]]):
+        self._persons = persons
+
+    def _match_person(self, person: Dict[str, Any], words: List[str], fields: Tuple[str, ...]) -> Optional[Dict[str, Any]]:
+        hits, found, score = [], set(), 0
+        sources = []
+        if 'name' in fields:
+            sources.append(('name', None, person.get('name', '')))
+        for i, e in enumerate(person.get('events') or []):
+            for field in ('title', 'place', 'detail'):
+                if field in fields:
+                    sources.append((field, i, e.get(field)))
+        for field, event, text in sources:
+            text = str(text or '')
+            folded = fold_chars(text)
+            matched = [w for w in words if w in folded]
+            if not matched:
+                continue
+            found.update(matched)
+            score += WEIGHTS[field] * len(matched)
+            hits.append(dict(snippet(text, _spans(folded, matched)), field=field, event=event))
+        if len(found) < len(words):
+            return None
+        hits.sort(key=lambda h: -WEIGHTS[h['field']])
+        return {'name': person.get('name', ''), 'score': score, 'eventCount': len(person.get('events') or []),
+                'matches': hits[:MAX_MATCHES], 'more_matches': max(0, len(hits) - MAX_MATCHES)}
+
+    def search(self, q: str, limit: int = 20, offset: int = 0, fields: Tuple[str, ...] = FIELDS) -> Dict[str, Any]:
+        """返回 {total, items}，items 为 [{name, score, eventCount, matches: [{field, event, snippet, highlights}]}]。"""
+        words = terms(q)
+        if not words:
+            return {'total': 0, 'items': []}
+        results = []
+        for person in self._persons() or []:
+            hit = self._match_person(person, words, fields)
+            if hit is not None:
+                results.append(hit)
+        results.sort(key=lambda r: (-r['score'], name_key(r['name'])))
+        return {'total': len(results), 'items': results[max(0, offset):max(0, offset) + max(0, limit)]}
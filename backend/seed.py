@@ -0,0 +1,129 @@
+"""
+合成数据生成（不调用 AI）
+
+    python index.py seed --count 50000 --out /tmp/people.json [--seed 42]
+    python index.py seed --count 2000 --store [--force]
+
+- 姓名由常见姓氏与名字用字随机组合且互不重复；人物均带 tags: ["synthetic"]，便于筛选或清理
+- 出生年份在公元前 500 年至 2005 年间分布（近现代更密集），事件 3–15 条、年份递增
+- 地点取自内置城市表并加入小幅坐标抖动，约 10% 的事件不带坐标，用于覆盖缺失坐标的展示
+- 默认写入 --out 指定的文件；--store 写入当前数据目录的 people.json（已有数据时需 --force，写前备份）
+"""
+
+import os
+import sys
+import json
+import random
+import argparse
+from typing import Any, Dict, List
+
+import integrity
+import migrate
+
+SURNAMES = '王李张刘陈杨黄赵吴周徐孙马朱胡郭何高林罗郑梁谢宋唐许韩冯邓曹彭曾肖田董袁潘于蒋蔡余杜叶程苏魏吕丁任沈姚卢姜崔钟谭陆汪范金石廖贾夏韦付方白邹孟熊秦邱江尹薛闫段雷侯龙史陶黎贺顾毛郝龚邵万钱严覃武戴莫孔向汤'
+GIVEN = '伟芳娜秀英敏静丽强磊军洋勇艳杰娟涛明超秀兰霞平刚桂英华玉萍红娥玲芬燕彬鹏辉建国文斌宇浩然子轩梓涵一诺欣怡思远嘉懿博文志强晓峰海燕春生秋实云飞德明守仁望舒清照'
+
+CITIES = [
+    ('北京', 39.904, 116.407), ('上海', 31.230, 121.474), ('广州', 23.129, 113.264), ('深圳', 22.543, 114.058),
+    ('南京', 32.060, 118.797), ('杭州', 30.274, 120.155), ('苏州', 31.299, 120.585), ('西安', 34.342, 108.940),
+    ('洛阳', 34.620, 112.454), ('开封', 34.797, 114.307), ('成都', 30.573, 104.066), ('重庆', 29.563, 106.551),
+    ('武汉', 30.593, 114.305), ('长沙', 28.228, 112.939), ('南昌', 28.683, 115.858), ('福州', 26.075, 119.296),
+    ('厦门', 24.480, 118.089), ('济南', 36.651, 117.120), ('青岛', 36.067, 120.383), ('曲阜', 35.581, 116.986),
+    ('太原', 37.871, 112.549), ('大同', 40.077, 113.300), ('郑州', 34.747, 113.625), ('合肥', 31.821, 117.227),
+    ('昆明', 25.038, 102.718), ('贵阳', 26.647, 106.630), ('南宁', 22.817, 108.366), ('桂林', 25.274, 110.290),
+    ('兰州', 36.061, 103.834), ('敦煌', 40.142, 94.662), ('拉萨', 29.652, 91.172), ('乌鲁木齐', 43.825, 87.617),
+    ('沈阳', 41.806, 123.432), ('哈尔滨', 45.803, 126.535), ('长春', 43.817, 125.324), ('天津', 39.343, 117.362),
+    ('扬州', 32.394, 119.413), ('绍兴', 29.998, 120.586), ('泉州', 24.874, 118.676), ('香港', 22.320, 114.169),
+    ('台北', 25.033, 121.565), ('东京', 35.690, 139.692), ('巴黎', 48.857, 2.352), ('伦敦', 51.507, -0.128),
+    ('纽约', 40.713, -74.006), ('莫斯科', 55.756, 37.617),
+]
+TITLES = ['求学', '游历', '任职', '迁居', '著书', '讲学', '出使', '成婚', '获奖', '创业', '隐居', '演出', '访问', '归乡']
+
+
+def _birth_year(rnd: random.Random) -> int:
+    # 约 70% 为近现代人物，其余分布在古代
+    if rnd.random() < 0.7:
+        return rnd.randint(1840, 2005)
+    return rnd.randint(-500, 1839)
+
+
+def _format_year(year: int) -> str:
+    return f'前{-year}年' if year < 0 else str(year)
+
+
+def make_person(name: str, rnd: random.Random) -> Dict[str, Any]:
+    birth = _birth_year(rnd)
+    lifespan = rnd.randint(30, 90)
+    home = rnd.choice(CITIES)
+    events = []
+    year, city = birth, home
+    for i in range(rnd.randint(3, 15)):
+        if i:
+            year = min(birth + lifespan, year + rnd.randint(1, 8))
+            # 多数事件在少数几个城市之间往返，便于测试地图聚合
+            city = home if rnd.random() < 0.3 else rnd.choice(CITIES[:24] if rnd.random() < 0.8 else CITIES)
+        event = {
+            'year': year,
+            'age': year - birth,
+            'place': city[0],
+            'lat': round(city[1] + rnd.uniform(-0.05, 0.05), 4),
+            'lon': round(city[2] + rnd.uniform(-0.05, 0.05), 4),
+            'title': '出生' if i == 0 else rnd.choice(TITLES),
+            'detail': f'{name}于{_format_year(year)}在{city[0]}{"出生" if i == 0 else "的经历"}（合成数据）。',
+        }
+        if i and rnd.random() < 0.1:
+            event['lat'] = event['lon'] = ''
+        events.append(event)
+    return {'name': name, 'tags': ['synthetic'], 'events': events}
+
+
+def make_names(count: int, rnd: random.Random) -> List[str]:
+    names: List[str] = []
+    seen = set()
+    attempts = 0
+    while len(names) < count:
+        attempts += 1
+        n = rnd.choice(SURNAMES) + ''.join(rnd.choice(GIVEN) for _ in range(rnd.choice((1, 2, 2, 3))))
+        if attempts > count * 20:
+            n += str(len(names))  # 组合空间耗尽时追加序号保证唯一
+        if n in seen:
+            continue
+        seen.add(n)
+        names.append(n)
+    return names
+
+
+def generate(count: int, seed: int) -> Dict[str, Any]:
+    rnd = random.Random(seed)
+    data = {'persons': [make_person(n, rnd) for n in make_names(count, rnd)]}
+    migrate.upgrade(data)  # 生成的数据直接使用最新 schema（含 id）
+    return data
+
+
+def main(argv: List[str], store_path: str, backup_keep: int = 5) -> int:
+    parser = argparse.ArgumentParser(prog='index.py seed', description='生成合成人物数据（不调用 AI）')
+    parser.add_argument('--count', type=int, default=1000, help='人物数量（默认 1000）')
+    parser.add_argument('--seed', type=int, default=42, help='随机种子，相同种子生成相同数据')
+    target = parser.add_mutually_exclusive_group(required=True)
+    target.add_argument('--out', help='输出文件路径')
+    target.add_argument('--store', action='store_true', help='写入当前数据目录的 people.json')
+    parser.add_argument('--force', action='store_true', help='--store 时允许覆盖已有数据（先备份）')
+    args = parser.parse_args(argv)
+
+    path = store_path if args.store else args.out
+    if args.store and os.path.exists(path) and not args.force:
+        print(f'{path} 已存在，覆盖请加 --force（会先备份）', file=sys.stderr)
+        return 1
+    data = generate(max(0, args.count), args.seed)
+    if args.store:
+        backup = integrity.backup_file(path, os.path.dirname(os.path.abspath(path)), max(1, backup_keep))
+        if backup:
+            print(f'备份：{backup}', file=sys.stderr)
+    os.makedirs(os.path.dirname(os.path.abspath(path)), exist_ok=True)
+    tmp = path + '.tmp'
+    with open(tmp, 'w', encoding='utf-8') as f:
+        json.dump(data, f, ensure_ascii=False)
+    os.replace(tmp, path)
+    events = sum(len(p['events']) for p in data['persons'])
+    print(f'{path}：persons={len(data["persons"])}，events={events}', file=sys.stderr)
+    return 0
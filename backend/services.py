@@ -0,0 +1,196 @@
+"""
+应用容器与服务接口
+
+接口处理函数不直接引用模块级单例，而是从 App 取得所需服务：
+- cache     人物与姓名缓存（CacheService，实现为 cache.Cache）
+- timeline  轨迹生成（TimelineProvider）：DeepSeek 或模拟数据
+- geocoder  地点坐标查询（Geocoder）：Nominatim 或不查询
+- importer  数据文件读取（Importer）
+
+build_app() 按 APP_PROFILE 装配：
+- default：DeepSeek + Nominatim（AI_PROVIDER=mock / mock_provider 开关仍在 deepseek.py 内生效）
+- offline：模拟轨迹、不查询坐标，不访问任何外部网络
+
+服务方法的第一个参数为 reqctx.Context（请求 ID、截止时间、取消），由处理函数逐层传入。
+替换实现只需构造 App(...) 传入满足接口的对象，见 testsupport.py 与 index.py 的 APP。
+"""
+
+from typing import Any, Callable, Dict, List, Optional, Protocol, Tuple
+
+import config
+import deepseek
+import importer
+import mockai
+from cache import Cache
+from reqctx import Context
+
+
+class CacheService(Protocol):
+    """接口处理函数使用的缓存操作；启动、预热与定时落盘等装配代码直接使用 cache.Cache。
+    查询与修改只在内存中进行，不接收 ctx；读写磁盘的方法接收可选的 ctx（见 Cache）。"""
+
+    def data_version(self) -> str:
+        """人物、姓名列表与别名表的当前版本，GET 接口的 ETag 据此计算。"""
+
+    def find_person(self, name: str, fallback: Optional[Dict[str, Any]] = None) -> Optional[Dict[str, Any]]:
+        """按归一化姓名或别名查找人物，未命中返回 None。"""
+
+    def find_fuzzy(self, name: str, max_distance: int = 0) -> Optional[Dict[str, Any]]:
+        """近似查找：{"person", "match"}，未命中返回 None。"""
+
+    def record_lookup(self, endpoint: str, name: str, hit: bool) -> None:
+        """记录一次查询的命中情况。"""
+
+    def get_people_or_fallback(self, fallback: Dict[str, Any]) -> Dict[str, Any]:
+        """全部人物 {persons: [...]}；未加载时返回 fallback。返回的记录只读。"""
+
+    def get_people_page(self, fallback: Dict[str, Any], offset: int = 0, limit: Optional[int] = None,
+                        where: Optional[Callable[[Dict[str, Any]], bool]] = None,
+                        sort: str = 'added') -> Tuple[int, List[Dict[str, Any]]]:
+        """按 where 过滤、按 sort 排序后分页，返回 (总数, 本页人物)。"""
+
+    def changes_since(self, since: float, fallback: Dict[str, Any], limit: Optional[int] = None) -> Dict[str, Any]:
+        """增量同步：since 之后变更的人物与删除记录。"""
+
+    def get_names_page(self, q: str = '', offset: int = 0, limit: Optional[int] = None,
+                       sort: str = 'added') -> Tuple[int, List[Dict[str, Any]]]:
+        """按子串过滤并分页的姓名列表，返回 (总数, 本页条目)。"""
+
+    def suggest_names(self, q: str, limit: int = 10) -> List[Dict[str, Any]]:
+        """输入提示。"""
+
+    def summary(self) -> Dict[str, Any]:
+        """缓存规模与落盘信息。"""
+
+    def lookup_summary(self, top: int = 10) -> Dict[str, Any]:
+        """查询命中率与热门、未命中姓名。"""
+
+    def add_alias(self, alias: str, canonical: str) -> bool:
+        """登记别名并持久化；未登记时返回 False。"""
+
+    def alias_map(self) -> Dict[str, str]:
+        """别名 → 规范姓名。"""
+
+    def upsert_person(self, person: Dict[str, Any], fallback: Dict[str, Any]) -> None:
+        """新增或整体替换人物，标记待落盘。"""
+
+    def update_event(self, name: str, event_id: str, update: Callable[[Dict[str, Any]], Any]) -> Optional[Dict[str, Any]]:
+        """按事件 id 修改事件副本并替换人物，返回更新后的事件；人物或事件不存在时返回 None。"""
+
+    def set_translation(self, name: str, lang: str, items: Optional[List[Dict[str, str]]]) -> Optional[Dict[str, Any]]:
+        """写入或删除（items 为 None）人物的 lang 译文，返回更新后的人物；人物不存在时返回 None。"""
+
+    def rename_person(self, old: str, new: str) -> Dict[str, Any]:
+        """更改规范姓名：{"status": "ok" | "not_found" | "exists", ...}。"""
+
+    def evict_person(self, name: str, persist: bool = False) -> Optional[Dict[str, Any]]:
+        """从缓存移除人物（persist 时同时从磁盘删除），返回被移除的记录。"""
+
+    def backup_person(self, name: str, ctx: Optional[Context] = None) -> Optional[str]:
+        """另存人物当前版本，返回备份路径；失败返回 None。"""
+
+    def reload_names(self, data_dir: str, ctx: Optional[Context] = None) -> Dict[str, Any]:
+        """重新扫描姓名来源并并入姓名列表，返回扫描报告。"""
+
+    def flush_now(self, force: bool = False, ctx: Optional[Context] = None) -> Dict[str, Any]:
+        """立即落盘并返回明细（attempted、saved、cancelled?、persons、bytes、duration_ms）。"""
+
+
+class TimelineProvider(Protocol):
+    def timeline(self, ctx: Context, name: str) -> Dict[str, Any]:
+        """返回 {name, style, events}；上游失败抛出 deepseek.UpstreamError。"""
+
+    def resolve_canonical_name(self, ctx: Context, name: str) -> Optional[str]:
+        """name 为字/号等别名时返回本名，否则返回 None。"""
+
+    def translate(self, ctx: Context, texts: List[Dict[str, str]], lang: str) -> List[Dict[str, str]]:
+        """将事件文本译为 lang（见 translations.py），按原顺序返回；上游失败抛出 deepseek.UpstreamError。"""
+
+    def health(self, ctx: Context) -> Dict[str, Any]:
+        """上游是否可达：{"status": "ok" | "fail" | "disabled", "detail"?, "latency_ms"?}，见 health.py。"""
+
+
+class Geocoder(Protocol):
+    def geocode(self, ctx: Context, place: str) -> Optional[Dict[str, float]]:
+        """返回 {"lat", "lon"}，查不到时返回 None。"""
+
+    def health(self, ctx: Context) -> Dict[str, Any]:
+        """同 TimelineProvider.health。"""
+
+
+class Importer(Protocol):
+    def read(self, ctx: Context, path: str) -> List[Dict[str, Any]]:
+        """读取数据文件中的人物列表；格式不支持或结构异常时抛出 ValueError。"""
+
+
+class DeepSeekTimeline:
+    def timeline(self, ctx, name):
+        return deepseek.get_person_timeline(name, raise_on_error=True, ctx=ctx)
+
+    def resolve_canonical_name(self, ctx, name):
+        return deepseek.resolve_canonical_name(name, ctx)
+
+    def translate(self, ctx, texts, lang):
+        return deepseek.translate_events(texts, lang, ctx)
+
+    def health(self, ctx):
+        return deepseek.health_check(config.get_health_check_timeout_sec(), ctx)
+
+
+class MockTimeline:
+    def timeline(self, ctx, name):
+        return deepseek._mock_person_timeline(name, True, ctx)
+
+    def resolve_canonical_name(self, ctx, name):
+        return None
+
+    def translate(self, ctx, texts, lang):
+        return mockai.translate(texts, lang)
+
+    def health(self, ctx):
+        return {"status": "ok", "detail": "mock"}
+
+
+class NominatimGeocoder:
+    def geocode(self, ctx, place):
+        return deepseek._geocode_place(place, ctx)
+
+    def health(self, ctx):
+        return deepseek.geocoder_health_check(config.get_health_check_timeout_sec(), ctx)
+
+
+class NullGeocoder:
+    def geocode(self, ctx, place):
+        return None
+
+    def health(self, ctx):
+        return {"status": "disabled"}
+
+
+class FileImporter:
+    def read(self, ctx, path):
+        ctx.check()
+        return importer.read_file(path)
+
+
+class App:
+    def __init__(self, cache: CacheService, fallback: Dict[str, Any], timeline: TimelineProvider, geocoder: Geocoder,
+                 importer: Importer, profile: str = 'default'):
+        self.cache = cache
+        self.fallback = fallback
+        self.timeline = timeline
+        self.geocoder = geocoder
+        self.importer = importer
+        self.profile = profile
+
+
+PROFILES = {
+    'default': lambda: (DeepSeekTimeline(), NominatimGeocoder()),
+    'offline': lambda: (MockTimeline(), NullGeocoder()),
+}
+
+
+def build_app(fallback: Dict[str, Any], profile: Optional[str] = None, cache: Optional[CacheService] = None) -> App:
+    profile = profile or config.get_app_profile()
+    timeline, geocoder = PROFILES.get(profile, PROFILES['default'])()
+    return App(cache or Cache(), fallback, timeline, geocoder, FileImporter(), profile)
@@ -0,0 +1,57 @@
+"""
+运行时可调的配置项
+
+管理接口 GET/POST /api/admin/settings 读取与修改下列配置，修改写回 config/config.json 并立即生效
+（config.get 每次读取配置文件）。同名环境变量优先级更高：此时写入仍会保存，但在去掉环境变量前不生效，
+接口以 "shadowed": true 标明。
+"""
+
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+import config
+
+
+def _bool(val: Any) -> Optional[bool]:
+    return val if isinstance(val, bool) else None
+
+
+def _int_range(lo: int, hi: int) -> Callable[[Any], Optional[int]]:
+    def parse(val: Any) -> Optional[int]:
+        if isinstance(val, bool) or not isinstance(val, int) or not lo <= val <= hi:
+            return None
+        return val
+    return parse
+
+
+def _choice(*options: str) -> Callable[[Any], Optional[str]]:
+    def parse(val: Any) -> Optional[str]:
+        return val if isinstance(val, str) and val in options else None
+    return parse
+
+
+# 键 → (校验函数（非法返回 None）, 当前生效值, 说明)
+DEFINITIONS: Dict[str, Tuple[Callable[[Any], Any], Callable[[], Any], str]] = {
+    'GEOCODE_ENABLED': (_bool, config.get_geocode_enabled, '为缺少坐标的事件查询地点坐标'),
+    'GEOCODE_MAX_CALLS': (_int_range(0, 50), config.get_geocode_max_calls, '每个人物最多的地理编码请求数'),
+    'AI_PROVIDER': (_choice('deepseek', 'mock'), config.get_ai_provider, 'AI 提供方：deepseek 或 mock'),
+    'API_RATE_LIMIT_PER_MIN': (_int_range(0, 100000), config.get_api_rate_limit_per_min, '每个客户端每分钟的 API 请求上限，0 为不限'),
+}
+
+
+def all_settings() -> List[Dict[str, Any]]:
+    out = []
+    for key, (_, current, desc) in DEFINITIONS.items():
+        out.append({'key': key, 'value': current(), 'source': config.source(key),
+                    'shadowed': config.source(key) == 'env', 'description': desc})
+    return out
+
+
+def update(key: str, value: Any) -> Optional[str]:
+    """校验并写回 config.json；返回错误原因（'unknown' / 'invalid'），成功返回 None。"""
+    if key not in DEFINITIONS:
+        return 'unknown'
+    parsed = DEFINITIONS[key][0](value)
+    if parsed is None:
+        return 'invalid'
+    config.save(key, parsed)
+    return None
@@ -0,0 +1,226 @@
+"""
+静态资源路径解析
+
+将 URL 路径安全映射到 FRONTEND_DIR 下的本地文件：
+- 先 URL 解码（%2e%2e、%2f 等编码穿越在解码后统一检查）
+- 拒绝 NUL、反斜杠、盘符/绝对路径与 .. 片段
+- 以 realpath 解析符号链接后，校验结果仍位于根目录内（commonpath，而非字符串前缀）
+
+另提供目录列表（DIR_INDEX_ENABLED 开启时使用），支持 HTML 与 JSON 两种格式；
+以及条件请求（ETag / Last-Modified）与单段 Range 的解析、预压缩（.br/.gz）资源选择、即时压缩的编码协商。
+"""
+
+import email.utils
+import gzip
+import html
+import os
+import time
+from typing import Any, Dict, List, Optional
+from urllib.parse import quote, unquote
+
+try:
+    import brotli  # 可选：pip install brotli，未安装时即时压缩只用 gzip
+except Exception:
+    brotli = None
+
+
+def resolve_static_path(root: str, url_path: str, default: str = 'index.html') -> Optional[str]:
+    """返回 root 内的真实文件路径；不安全或越界时返回 None（不保证文件存在）。"""
+    try:
+        rel = unquote(url_path or '', errors='strict')
+    except Exception:
+        return None
+    if '\x00' in rel or '\\' in rel:
+        return None
+    rel = rel.lstrip('/')
+    if not rel:
+        rel = default
+    parts = rel.split('/')
+    if '..' in parts:
+        return None
+    if os.path.isabs(rel) or os.path.splitdrive(rel)[0]:
+        return None
+    real_root = os.path.realpath(root)
+    candidate = os.path.realpath(os.path.join(real_root, *[p for p in parts if p not in ('', '.')]))
+    try:
+        if os.path.commonpath([real_root, candidate]) != real_root:
+            return None
+    except ValueError:
+        return None
+    return candidate
+
+
+def list_directory(root: str, fs_dir: str) -> List[Dict[str, Any]]:
+    """列出目录内容（跳过隐藏文件与指向根目录之外的符号链接），目录在前、按名称排序。"""
+    real_root = os.path.realpath(root)
+    entries: List[Dict[str, Any]] = []
+    try:
+        names = os.listdir(fs_dir)
+    except Exception:
+        return entries
+    for name in names:
+        if name.startswith('.'):
+            continue
+        full = os.path.join(fs_dir, name)
+        real = os.path.realpath(full)
+        try:
+            if os.path.commonpath([real_root, real]) != real_root:
+                continue
+            st = os.stat(real)
+        except Exception:
+            continue
+        is_dir = os.path.isdir(real)
+        entries.append({
+            'name': name,
+            'type': 'dir' if is_dir else 'file',
+            'size': None if is_dir else st.st_size,
+            'mtime': int(st.st_mtime),
+        })
+    entries.sort(key=lambda e: (e['type'] != 'dir', e['name']))
+    return entries
+
+
+def render_notice_html(title: str, message: str) -> str:
+    return (
+        '<!doctype html><html lang="zh-CN"><head><meta charset="utf-8">'
+        f'<title>{html.escape(title)}</title></head><body>'
+        f'<h3>{html.escape(title)}</h3><p>{html.escape(message)}</p></body></html>'
+    )
+
+
+def render_listing_html(url_path: str, entries: List[Dict[str, Any]]) -> str:
+    title = html.escape(url_path)
+    rows = []
+    if url_path.rstrip('/'):
+        rows.append('<tr><td><a href="../">../</a></td><td></td><td></td></tr>')
+    for e in entries:
+        label = e['name'] + ('/' if e['type'] == 'dir' else '')
+        href = quote(e['name']) + ('/' if e['type'] == 'dir' else '')
+        size = '-' if e['size'] is None else str(e['size'])
+        mtime = time.strftime('%Y-%m-%d %H:%M', time.localtime(e['mtime']))
+        rows.append(f'<tr><td><a href="{href}">{html.escape(label)}</a></td><td>{size}</td><td>{mtime}</td></tr>')
+    return (
+        '<!doctype html><html lang="zh-CN"><head><meta charset="utf-8">'
+        f'<title>目录：{title}</title></head><body>'
+        f'<h3>目录：{title}</h3><table><thead><tr><th>名称</th><th>大小</th><th>修改时间</th></tr></thead>'
+        f'<tbody>{"".join(rows)}</tbody></table></body></html>'
+    )
+
+
+def file_etag(st: os.stat_result) -> str:
+    return '"%x-%x"' % (int(st.st_mtime), st.st_size)
+
+
+def is_not_modified(headers, etag: str, mtime: float) -> bool:
+    """条件请求：If-None-Match 优先，其次 If-Modified-Since。"""
+    inm = headers.get('If-None-Match')
+    if inm:
+        tags = [t.strip() for t in inm.split(',')]
+        return '*' in tags or etag in tags or ('W/' + etag) in tags
+    ims = headers.get('If-Modified-Since')
+    if ims:
+        try:
+            since = email.utils.parsedate_to_datetime(ims).timestamp()
+            return int(mtime) <= int(since)
+        except Exception:
+            return False
+    return False
+
+
+def parse_range(headers, size: int, etag: str, last_modified: str):
+    """解析单段 Range 头，返回 (start, end) 闭区间。
+
+    - 无 Range、多段或格式无法识别、If-Range 不匹配时返回 None（按完整内容响应）
+    - 范围不可满足时返回 False（应响应 416）
+    """
+    value = str(headers.get('Range') or '').strip()
+    if not value.startswith('bytes=') or ',' in value:
+        return None
+    if_range = headers.get('If-Range')
+    if if_range and if_range.strip() not in (etag, last_modified):
+        return None
+    spec = value[6:].strip()
+    if '-' not in spec:
+        return None
+    first, last = spec.split('-', 1)
+    try:
+        if first == '':
+            # 后缀范围：最后 N 个字节
+            n = int(last)
+            if n <= 0:
+                return False
+            return (max(0, size - n), size - 1) if size else False
+        start = int(first)
+        end = int(last) if last else size - 1
+    except ValueError:
+        return None
+    if start >= size or start < 0 or end < start:
+        return False
+    return start, min(end, size - 1)
+
+
+def copy_range(src, dst, length: int, chunk: int = 64 * 1024):
+    """从 src 当前位置复制 length 字节到 dst，分块进行以限制内存占用。"""
+    remaining = length
+    while remaining > 0:
+        buf = src.read(min(chunk, remaining))
+        if not buf:
+            break
+        dst.write(buf)
+        remaining -= len(buf)
+
+
+def accepts_encoding(headers, coding: str) -> bool:
+    """Accept-Encoding 是否接受指定编码（q=0 视为拒绝）。"""
+    for part in str(headers.get('Accept-Encoding') or '').split(','):
+        bits = [b.strip() for b in part.split(';')]
+        if not bits or bits[0].lower() not in (coding, '*'):
+            continue
+        q = 1.0
+        for b in bits[1:]:
+            if b.startswith('q='):
+                try:
+                    q = float(b[2:])
+                except ValueError:
+                    q = 0.0
+        return q > 0
+    return False
+
+
+def choose_encoding(headers, allow_brotli: bool = True) -> Optional[str]:
+    """即时压缩所用编码：已安装 brotli 且客户端接受时为 br，其次 gzip；都不接受时为 None。"""
+    if allow_brotli and brotli is not None and accepts_encoding(headers, 'br'):
+        return 'br'
+    if accepts_encoding(headers, 'gzip'):
+        return 'gzip'
+    return None
+
+
+def compress(body: bytes, coding: str) -> bytes:
+    if coding == 'br':
+        return brotli.compress(body, quality=5)
+    return gzip.compress(body, compresslevel=6)
+
+
+# 预压缩兄弟文件：优先 brotli，其次 gzip
+PRECOMPRESSED = (('.br', 'br'), ('.gz', 'gzip'))
+
+COMPRESSIBLE_TYPES = ('text/', 'application/javascript', 'application/json', 'application/geo+json', 'image/svg+xml')
+
+
+def pick_precompressed(headers, fs_path: str, mtime: float):
+    """返回 (兄弟文件路径, 编码)；兄弟文件须不旧于原文件，否则视为过期而忽略。"""
+    for ext, coding in PRECOMPRESSED:
+        candidate = fs_path + ext
+        if not accepts_encoding(headers, coding):
+            continue
+        try:
+            if os.path.isfile(candidate) and os.path.getmtime(candidate) >= mtime:
+                return candidate, coding
+        except Exception:
+            continue
+    return None, None
+
+
+def is_compressible(ctype: str) -> bool:
+    return any(ctype.startswith(t) for t in COMPRESSIBLE_TYPES)
@@ -0,0 +1,51 @@
+"""
+systemd 集成（均为可选，非 systemd 环境下自动跳过）
+
+- 套接字激活：继承 LISTEN_FDS 传入的监听描述符（自 fd 3 起），服务重启期间连接由 systemd 暂存而不被拒绝
+  LISTEN_FDNAMES 中的名称若为 all/public/admin，则作为该监听的路由作用域
+- 就绪通知：数据加载完成后经 NOTIFY_SOCKET 发送 READY=1（配合 Type=notify）
+示例单元文件见 deploy/systemd/。
+"""
+
+import os
+import socket
+from typing import List, Tuple
+
+SD_LISTEN_FDS_START = 3
+
+
+def listen_sockets() -> List[Tuple[socket.socket, str]]:
+    """返回 [(socket, fd 名称)]；未经 systemd 激活时返回空列表。"""
+    try:
+        if int(os.environ.get('LISTEN_PID', '0')) != os.getpid():
+            return []
+        count = int(os.environ.get('LISTEN_FDS', '0'))
+    except ValueError:
+        return []
+    names = os.environ.get('LISTEN_FDNAMES', '').split(':')
+    out = []
+    for i in range(count):
+        fd = SD_LISTEN_FDS_START + i
+        os.set_inheritable(fd, False)
+        sock = socket.socket(fileno=fd)
+        out.append((sock, names[i] if i < len(names) else ''))
+    # 仅由本进程消费，避免传递给子进程
+    for key in ('LISTEN_PID', 'LISTEN_FDS', 'LISTEN_FDNAMES'):
+        os.environ.pop(key, None)
+    return out
+
+
+def notify(state: str) -> bool:
+    """向 systemd 发送状态（如 "READY=1"、"STATUS=..."、"STOPPING=1"）；无 NOTIFY_SOCKET 时返回 False。"""
+    addr = os.environ.get('NOTIFY_SOCKET')
+    if not addr:
+        return False
+    if addr.startswith('@'):
+        addr = '\0' + addr[1:]  # 抽象命名空间
+    try:
+        with socket.socket(socket.AF_UNIX, socket.SOCK_DGRAM | socket.SOCK_CLOEXEC) as s:
+            s.connect(addr)
+            s.sendall(state.encode('utf-8'))
+        return True
+    except Exception:
+        return False
@@ -0,0 +1,87 @@
+"""
+AI 别名识别只在生成路径上调用：计入 generations 额度，匿名请求的识别结果不写入别名表
+（运行：cd backend && python3 -m unittest）
+"""
+
+import unittest
+
+import index
+import testsupport
+
+
+class FakeTimeline:
+    """字/号 → 本名的固定映射；记录别名识别的调用次数。"""
+
+    ALIASES = {'号甲': '本名甲', '号乙': '本名乙', '号丙': '本名丙'}
+
+    def __init__(self):
+        self.resolve_calls = []
+
+    def timeline(self, ctx, name):
+        return {'name': name, 'events': [{'year': '1900', 'place': '北京', 'lat': 39.9, 'lon': 116.4, 'title': '出生'}]}
+
+    def resolve_canonical_name(self, ctx, name):
+        self.resolve_calls.append(name)
+        return self.ALIASES.get(name)
+
+    def translate(self, ctx, texts, lang):
+        return []
+
+    def health(self, ctx):
+        return {"status": "ok"}
+
+
+class AliasResolutionTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.env = testsupport.env(ALIAS_AI_ENABLED='1', API_KEYS='team-a=key-a')
+        cls.env.__enter__()
+        cls.server = testsupport.ApiServer(profile='offline')
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.server.close()
+        cls.env.__exit__(None, None, None)
+
+    def setUp(self):
+        self.timeline = FakeTimeline()
+        self.server.app.timeline = self.timeline
+
+    def used(self, team):
+        return index.QUOTAS.status()['keys'][team]['used']['generations']
+
+    def test_cached_only_endpoints_do_not_call_ai(self):
+        before = self.used('anonymous')
+        for path, params in (('/api/v1/person/号甲/path', {}), ('/api/v1/person/号甲/export', {}),
+                             ('/api/v1/compare', {'names': '号甲,号乙'}), ('/api/v1/overlap', {'names': '号甲,号乙'})):
+            with self.subTest(path=path):
+                status, _ = self.server.get(path, **params)
+                self.assertNotEqual(status, 200)
+        self.assertEqual(self.timeline.resolve_calls, [])
+        self.assertEqual(self.used('anonymous'), before)
+        self.assertEqual(self.server.app.cache.aliases.resolve('号甲'), '号甲')
+
+    def test_anonymous_generation_does_not_persist_alias(self):
+        before = self.used('anonymous')
+        status, body = self.server.get('/api/v1/person', name='号乙')
+        self.assertEqual(status, 200, body)
+        self.assertEqual(body['data']['name'], '本名乙')
+        self.assertEqual(self.timeline.resolve_calls, ['号乙'])
+        # 别名识别与生成各计一次
+        self.assertEqual(self.used('anonymous'), before + 2)
+        self.assertEqual(self.server.app.cache.aliases.resolve('号乙'), '号乙')
+
+    def test_keyed_generation_persists_alias(self):
+        before = self.used('team-a')
+        status, body = self.server.get('/api/v1/person', headers={'X-API-Key': 'key-a'}, name='号丙')
+        self.assertEqual(status, 200, body)
+        self.assertEqual(self.used('team-a'), before + 2)
+        self.assertEqual(self.server.app.cache.aliases.resolve('号丙'), '本名丙')
+        # 之后按别名查询直接命中缓存，不再调用 AI
+        status, body = self.server.get('/api/v1/person', name='号丙')
+        self.assertEqual((status, body['meta']['source']), (200, 'cache'))
+        self.assertEqual(self.timeline.resolve_calls, ['号丙'])
+
+
+if __name__ == '__main__':
+    unittest.main()
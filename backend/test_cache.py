@@ -0,0 +1,135 @@
+"""
+Cache 的落盘语义测试：evict_person 默认只移除内存记录；修改方法写时复制，落盘快照不受之后的修改影响；
+落盘记入请求上下文的耗时分段，上下文到期后不再写入；接口处理函数只使用 services.CacheService 声明的方法
+（运行：cd backend && python3 -m unittest）
+"""
+
+import json
+import os
+import re
+import shutil
+import tempfile
+import unittest
+
+import reqctx
+import services
+from cache import Cache
+
+
+def _person(name, place='某地'):
+    return {'name': name, 'events': [{'year': '1900', 'place': place, 'lat': 30.0, 'lon': 120.0}]}
+
+
+class EvictPersonTest(unittest.TestCase):
+    def setUp(self):
+        self.root = tempfile.mkdtemp()
+        os.makedirs(os.path.join(self.root, 'data'))
+        self.path = os.path.join(self.root, 'data', 'people.json')
+        with open(self.path, 'w', encoding='utf-8') as f:
+            json.dump({'persons': [_person('甲'), _person('乙')]}, f, ensure_ascii=False)
+        self.cache = Cache()
+        self.fallback = {'persons': []}
+        self.cache.preload(self.root, os.path.join(self.root, 'data'), self.fallback)
+
+    def tearDown(self):
+        shutil.rmtree(self.root, ignore_errors=True)
+
+    def saved(self):
+        with open(self.path, 'r', encoding='utf-8') as f:
+            return {p['name']: p for p in json.load(f)['persons']}
+
+    def test_default_is_memory_only(self):
+        self.assertIsNotNone(self.cache.evict_person('甲'))
+        self.assertIsNone(self.cache.find_person('甲'))
+        self.assertFalse(self.cache.dirty)
+        self.assertNotIn('甲', self.cache.tombstones)
+        # 其他变更触发的落盘仍保留被移除的记录
+        self.cache.upsert_person(_person('丙'), self.fallback)
+        self.cache.flush_now()
+        self.assertEqual(set(self.saved()), {'甲', '乙', '丙'})
+
+    def test_regenerated_record_replaces_evicted(self):
+        self.cache.evict_person('甲')
+        self.cache.upsert_person(_person('甲', '新地'), self.fallback)
+        self.cache.flush_now()
+        saved = self.saved()
+        self.assertEqual(set(saved), {'甲', '乙'})
+        self.assertEqual(saved['甲']['events'][0]['place'], '新地')
+
+    def test_persist_removes_from_disk(self):
+        self.assertIsNotNone(self.cache.evict_person('甲', persist=True))
+        self.assertTrue(self.cache.dirty)
+        self.cache.flush_now()
+        self.assertEqual(set(self.saved()), {'乙'})
+
+    def test_persist_after_memory_evict(self):
+        self.cache.evict_person('甲')
+        self.assertIsNotNone(self.cache.evict_person('甲', persist=True))
+        self.cache.flush_now()
+        self.assertEqual(set(self.saved()), {'乙'})
+        self.assertIsNone(self.cache.evict_person('甲'))
+
+    def test_flush_records_disk_span(self):
+        ctx = reqctx.background()
+        self.cache.upsert_person(_person('丙'), self.fallback)
+        report = self.cache.flush_now(ctx=ctx)
+        self.assertTrue(report['saved'])
+        self.assertIn('disk.people', [s['name'] for s in ctx.spans])
+
+    def test_flush_skipped_after_deadline(self):
+        ctx = reqctx.background()
+        ctx.cancel()
+        self.cache.upsert_person(_person('丙'), self.fallback)
+        report = self.cache.flush_now(ctx=ctx)
+        self.assertTrue(report['cancelled'])
+        self.assertFalse(report['saved'])
+        self.assertTrue(self.cache.dirty)
+        self.assertNotIn('丙', self.saved())
+
+
+class CopyOnWriteTest(unittest.TestCase):
+    def setUp(self):
+        self.cache = Cache()
+        self.cache.people = {'persons': []}
+        self.cache.upsert_person(_person('甲'), {'persons': []})
+
+    def snapshot(self):
+        # 与 flush_now 相同：锁内只复制 persons 列表
+        with self.cache._lock:
+            return list(self.cache.people['persons'])
+
+    def test_set_translation_replaces_record(self):
+        before = self.snapshot()
+        frozen = json.dumps(before, ensure_ascii=False, sort_keys=True)
+        self.cache.set_translation('甲', 'en', [{'title': 'Born'}])
+        self.assertEqual(json.dumps(before, ensure_ascii=False, sort_keys=True), frozen)
+        self.assertIn('en', self.cache.find_person('甲')['translations'])
+
+    def test_update_event_replaces_record(self):
+        before = self.snapshot()
+        frozen = json.dumps(before, ensure_ascii=False, sort_keys=True)
+        event_id = before[0]['events'][0]['id']
+        event = self.cache.update_event('甲', event_id, lambda e: e.update(media=[{'url': 'https://example.com/a.jpg'}]))
+        self.assertEqual(event['media'][0]['url'], 'https://example.com/a.jpg')
+        self.assertEqual(json.dumps(before, ensure_ascii=False, sort_keys=True), frozen)
+        self.assertEqual(self.cache.find_person('甲')['events'][0]['media'], event['media'])
+        self.assertIsNone(self.cache.update_event('甲', 'missing', lambda e: None))
+
+
+class CacheServiceTest(unittest.TestCase):
+    def protocol_methods(self):
+        return {n for n, v in vars(services.CacheService).items() if callable(v) and not n.startswith('_')}
+
+    def test_routes_use_protocol_only(self):
+        with open(os.path.join(os.path.dirname(os.path.abspath(__file__)), 'routes.py'), encoding='utf-8') as f:
+            used = set(re.findall(r'\bcache\.(\w+)', f.read()))
+        self.assertTrue(used)
+        self.assertEqual(used - self.protocol_methods(), set())
+
+    def test_cache_implements_protocol(self):
+        missing = [n for n in self.protocol_methods() if not callable(getattr(Cache, n, None))]
+        self.assertEqual(missing, [])
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,73 @@
+"""
+代理之后的客户端地址识别与按客户端限流（运行：cd backend && python3 -m unittest）
+"""
+
+import time
+import unittest
+
+import clientip
+import testsupport
+
+
+class FakeHandler:
+    def __init__(self, peer, **headers):
+        self.peer = peer
+        self.headers = {k.replace('_', '-'): v for k, v in headers.items()}
+
+    def address_string(self):
+        return self.peer
+
+
+class ResolveTest(unittest.TestCase):
+    def resolve(self, peer, trusted='127.0.0.1,10.0.0.0/8', **headers):
+        with testsupport.env(TRUSTED_PROXIES=trusted):
+            return clientip.resolve(FakeHandler(peer, **headers))
+
+    def test_untrusted_peer_ignores_headers(self):
+        self.assertEqual(self.resolve('198.51.100.7', X_Forwarded_For='203.0.113.1'), '198.51.100.7')
+        self.assertEqual(self.resolve('127.0.0.1', trusted='', X_Real_IP='203.0.113.1'), '127.0.0.1')
+
+    def test_trusted_peer_uses_forwarded_for(self):
+        self.assertEqual(self.resolve('127.0.0.1', X_Forwarded_For='203.0.113.1'), '203.0.113.1')
+        self.assertEqual(self.resolve('127.0.0.1', X_Real_IP='203.0.113.2'), '203.0.113.2')
+        self.assertEqual(self.resolve('127.0.0.1'), '127.0.0.1')
+
+    def test_spoofed_left_entries_are_ignored(self):
+        # 客户端自带的 X-Forwarded-For 在左侧，代理追加的真实地址在右侧
+        self.assertEqual(self.resolve('127.0.0.1', X_Forwarded_For='1.2.3.4, 203.0.113.1, 10.0.0.5'), '203.0.113.1')
+        self.assertEqual(self.resolve('127.0.0.1', X_Forwarded_For='203.0.113.9, bogus, 203.0.113.1'), '203.0.113.1')
+
+    def test_unix_socket_peer(self):
+        self.assertEqual(self.resolve('unix', trusted='unix', X_Real_IP='203.0.113.3'), '203.0.113.3')
+        self.assertEqual(self.resolve('unix', X_Real_IP='203.0.113.3'), 'unix')
+
+
+class RateLimitBehindProxyTest(unittest.TestCase):
+    LIMIT = 3
+
+    @classmethod
+    def setUpClass(cls):
+        cls.env = testsupport.env(TRUSTED_PROXIES='127.0.0.1', API_RATE_LIMIT_PER_MIN=str(cls.LIMIT))
+        cls.env.__enter__()
+        cls.server = testsupport.ApiServer(profile='offline')
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.server.close()
+        cls.env.__exit__(None, None, None)
+
+    def test_clients_are_limited_separately(self):
+        # 限流按自然分钟计数，临近分钟末尾时等到下一分钟再开始
+        if time.time() % 60 > 55:
+            time.sleep(60 - time.time() % 60 + 0.1)
+        a = {'X-Forwarded-For': '203.0.113.10'}
+        b = {'X-Forwarded-For': '203.0.113.20'}
+        for _ in range(self.LIMIT):
+            self.assertEqual(self.server.get('/api/v1/names', headers=a)[0], 200)
+        status, body = self.server.get('/api/v1/names', headers=a)
+        self.assertEqual((status, body['error']['code']), (429, 'RATE_LIMITED'))
+        self.assertEqual(self.server.get('/api/v1/names', headers=b)[0], 200)
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,99 @@
+"""
+端到端测试：handle_person 的 未命中 → AI 生成 → 地理编码 → 写入缓存 → 落盘
+
+API 服务与上游均在进程内：DeepSeek 与 Nominatim 为 testsupport 中的假服务，不访问外部网络、不消耗 Token。
+经 DeepSeek 的用例需要 requests（与生产调用路径一致），未安装时跳过；离线装配（模拟 AI）的用例不依赖它。
+"""
+
+import json
+import unittest
+
+import deepseek
+import testsupport
+from testsupport import FakeResponse
+
+
+def _saved_names(path: str):
+    with open(path, 'r', encoding='utf-8') as f:
+        return [p.get('name') for p in json.load(f).get('persons') or []]
+
+
+@unittest.skipIf(deepseek.requests is None, 'requests not installed')
+class DeepSeekPersonFlowTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.ds = testsupport.deepseek_fake().start()
+        cls.geo = testsupport.nominatim_fake().start()
+        cls.env = testsupport.env(**testsupport.DEEPSEEK_ENV, DEEPSEEK_BASE_URL=cls.ds.url, GEOCODE_URL=cls.geo.url + '/search')
+        cls.env.__enter__()
+        cls.server = testsupport.ApiServer()
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.server.close()
+        cls.env.__exit__(None, None, None)
+        cls.ds.stop()
+        cls.geo.stop()
+
+    def setUp(self):
+        self.ds.reset()
+        self.geo.reset()
+
+    def test_miss_generates_geocodes_and_persists(self):
+        status, body = self.server.get('/api/v1/person', name='测试甲')
+        self.assertEqual(status, 200, body)
+        self.assertEqual(body['meta']['source'], 'generated')
+        self.assertEqual(len(self.ds.calls), 1)
+        self.assertEqual(self.ds.calls[0]['headers'].get('Authorization'), 'Bearer test-key')
+        events = body['data']['events']
+        self.assertEqual(len(events), 2)
+        # 第二条事件缺少坐标，经假 Nominatim 补全
+        self.assertEqual((events[1]['lat'], events[1]['lon']), (30.0, 120.0))
+        self.assertIn('假想城', [(c['query'].get('q') or [''])[0] for c in self.geo.calls])
+
+        status, body = self.server.get('/api/v1/person', name='测试甲')
+        self.assertEqual((status, body['meta']['source']), (200, 'cache'))
+        self.assertEqual(len(self.ds.calls), 1, '命中缓存时不应再调用上游')
+
+        self.server.app.cache.flush()
+        self.assertIn('测试甲', _saved_names(self.server.people_path))
+
+    def test_upstream_errors_map_to_codes(self):
+        cases = [
+            ('测试乙', FakeResponse(429, {'error': 'rate limited'}), 429, 'RATE_LIMITED'),
+            ('测试丙', FakeResponse(200, testsupport.deepseek_tool_response([]), delay=2.5), 504, 'UPSTREAM_TIMEOUT'),
+            ('测试丁', FakeResponse(500, {'error': 'boom'}), 502, 'UPSTREAM_ERROR'),
+        ]
+        for name, resp, http_status, code in cases:
+            with self.subTest(code=code):
+                self.ds.script(resp)
+                status, body = self.server.get('/api/v1/person', name=name)
+                self.assertEqual(status, http_status, body)
+                self.assertEqual(body['error']['code'], code)
+
+
+class OfflinePersonFlowTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.server = testsupport.ApiServer(profile='offline')
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.server.close()
+
+    def test_miss_generates_and_persists(self):
+        status, body = self.server.get('/api/v1/person', name='测试戊')
+        self.assertEqual(status, 200, body)
+        self.assertEqual(body['meta']['source'], 'generated')
+        self.assertTrue(body['data']['events'])
+        self.server.app.cache.flush()
+        self.assertIn('测试戊', _saved_names(self.server.people_path))
+
+    def test_invalid_name_is_bad_request(self):
+        status, body = self.server.get('/api/v1/person', name='')
+        self.assertEqual(status, 400)
+        self.assertEqual(body['error']['code'], 'BAD_REQUEST')
+
+
+if __name__ == '__main__':
+    unittest.main()
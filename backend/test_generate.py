@@ -0,0 +1,57 @@
+"""
+生成任务脱离请求上下文：请求截止时间（API_REQUEST_TIMEOUT_SEC）与生成时限到期后，生成仍在后台完成并写入缓存
+（运行：cd backend && python3 -m unittest）
+"""
+
+import time
+import unittest
+
+import testsupport
+
+
+class SlowTimeline:
+    """耗时 delay 秒；上下文到期（ctx.done()）时放弃，与真实上游调用一致。"""
+
+    def __init__(self, delay):
+        self.delay = delay
+
+    def timeline(self, ctx, name):
+        time.sleep(self.delay)
+        if ctx.done():
+            return None
+        return {'name': name, 'events': [{'year': '1900', 'place': '北京', 'lat': 39.9, 'lon': 116.4, 'title': '出生'}]}
+
+    def resolve_canonical_name(self, ctx, name):
+        return None
+
+    def translate(self, ctx, texts, lang):
+        return []
+
+    def health(self, ctx):
+        return {"status": "ok"}
+
+
+class BackgroundGenerationTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.env = testsupport.env(API_REQUEST_TIMEOUT_SEC='0.2', GENERATE_TIMEOUT_SEC='1')
+        cls.env.__enter__()
+        cls.server = testsupport.ApiServer(profile='offline')
+        cls.server.app.timeline = SlowTimeline(1.5)
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.server.close()
+        cls.env.__exit__(None, None, None)
+
+    def test_generation_continues_after_timeout(self):
+        status, body = self.server.get('/api/v1/person', name='慢生成')
+        self.assertEqual((status, body['error']['code']), (504, 'UPSTREAM_TIMEOUT'))
+        deadline = time.monotonic() + 5
+        while time.monotonic() < deadline and self.server.app.cache.find_person('慢生成') is None:
+            time.sleep(0.1)
+        self.assertIsNotNone(self.server.app.cache.find_person('慢生成'))
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,97 @@
+"""
+监听作用域：public 监听上不开放任何管理接口（分组 admin、admin_write），admin 监听只开放管理接口；/exports/ 的开放条件
+（运行：cd backend && python3 -m unittest）
+"""
+
+import os
+import re
+import shutil
+import tempfile
+import unittest
+import urllib.error
+import urllib.request
+
+import index
+import listeners
+import testsupport
+
+
+def _admin_routes():
+    # (方法, 路径)；路径参数以占位值填充
+    for path, (methods, group, _) in sorted(index.API_ROUTES.items()):
+        if group in listeners.ADMIN_GROUPS:
+            url = '/api/v1' + re.sub(r'\{[a-z_]+\}', '1', path[len('/api'):])
+            for method in methods:
+                yield method, url
+
+
+class PublicScopeTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.env = testsupport.env(ADMIN_TOKEN='secret')
+        cls.env.__enter__()
+        cls.public = testsupport.ApiServer(profile='offline', scope='public')
+        cls.admin = testsupport.ApiServer(profile='offline', scope='admin')
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.admin.close()
+        cls.public.close()
+        cls.env.__exit__(None, None, None)
+
+    def test_admin_routes_not_found_on_public_listener(self):
+        routes = list(_admin_routes())
+        self.assertIn(('POST', '/api/v1/person/rename'), routes)
+        auth = {'Authorization': 'Bearer secret'}
+        for method, url in routes:
+            with self.subTest(method=method, url=url):
+                status, body = self.public.request(method, url, body={} if method != 'DELETE' else None, headers=auth)
+                self.assertEqual(status, 404, body)
+                self.assertEqual(body['error']['code'], 'NOT_FOUND')
+
+    def test_public_routes_not_found_on_admin_listener(self):
+        self.assertEqual(self.admin.get('/api/v1/names')[0], 404)
+        self.assertEqual(self.admin.get('/api/v1/admin/stats', headers={'Authorization': 'Bearer secret'})[0], 200)
+        self.assertEqual(self.public.get('/api/v1/names')[0], 200)
+
+
+class ExportsScopeTest(unittest.TestCase):
+    def setUp(self):
+        self.exports = tempfile.mkdtemp()
+        with open(os.path.join(self.exports, 'people.csv'), 'w') as f:
+            f.write('name\n')
+        self.saved_root, index.EXPORTS_ROOT = index.EXPORTS_ROOT, self.exports
+        self.servers = {scope: testsupport.ApiServer(profile='offline', scope=scope) for scope in ('public', 'admin', 'all')}
+
+    def tearDown(self):
+        for server in self.servers.values():
+            server.close()
+        index.EXPORTS_ROOT = self.saved_root
+        shutil.rmtree(self.exports, ignore_errors=True)
+
+    def status(self, scope):
+        try:
+            with urllib.request.urlopen(self.servers[scope].url + '/exports/people.csv', timeout=15) as resp:
+                return resp.status
+        except urllib.error.HTTPError as e:
+            return e.code
+
+    def test_disabled_by_default(self):
+        with testsupport.env(EXPORTS_SERVE_ENABLED='0'):
+            self.assertEqual([self.status(s) for s in ('public', 'admin', 'all')], [404, 404, 404])
+
+    def test_enabled_only_on_admin_and_all(self):
+        with testsupport.env(EXPORTS_SERVE_ENABLED='1'):
+            self.assertEqual([self.status(s) for s in ('public', 'admin', 'all')], [404, 200, 200])
+
+
+class RouteAllowedTest(unittest.TestCase):
+    def test_by_group(self):
+        for scope, group, allowed in (('public', 'admin_write', False), ('public', 'admin', False), ('public', 'public', True),
+                                      ('public', None, True), ('admin', 'admin', True), ('admin', 'proxy', False),
+                                      ('admin', None, False), ('all', 'admin_write', True)):
+            self.assertEqual(listeners.route_allowed(scope, group), allowed, (scope, group))
+
+
+if __name__ == '__main__':
+    unittest.main()
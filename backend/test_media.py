@@ -0,0 +1,55 @@
+"""
+事件附件按稳定的事件 id 关联：事件插入、重排后仍落在原事件上（运行：cd backend && python3 -m unittest）
+"""
+
+import unittest
+
+import testsupport
+
+AUTH = {'Authorization': 'Bearer secret'}
+
+
+class EventMediaTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.env = testsupport.env(ADMIN_TOKEN='secret')
+        cls.env.__enter__()
+        cls.server = testsupport.ApiServer(profile='offline')
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.server.close()
+        cls.env.__exit__(None, None, None)
+
+    def setUp(self):
+        self.server.app.cache.upsert_person({'name': '附件甲', 'events': [
+            {'year': '1900', 'place': '北京', 'lat': 39.9, 'lon': 116.4, 'title': '出生'},
+            {'year': '1920', 'place': '上海', 'lat': 31.2, 'lon': 121.5, 'title': '迁居'}]}, self.server.app.fallback)
+
+    def events(self):
+        return self.server.app.cache.find_person('附件甲')['events']
+
+    def test_media_follows_event_after_insert(self):
+        target = self.events()[1]
+        # 在其前面插入一个事件：原下标 1 已指向新事件
+        status, body = self.server.request('POST', '/api/v1/person/附件甲/events', headers=AUTH,
+                                           body={'year': '1910', 'place': '天津', 'lat': 39.1, 'lon': 117.2, 'title': '求学'})
+        self.assertIn(status, (200, 201), body)
+        self.assertNotEqual(self.events()[1]['id'], target['id'])
+        status, body = self.server.request('POST', f"/api/v1/person/附件甲/events/{target['id']}/media", headers=AUTH,
+                                           body={'url': 'https://example.com/a.jpg', 'caption': '照片'})
+        self.assertEqual(status, 200, body)
+        by_id = {e['id']: e for e in self.events()}
+        self.assertEqual([m['url'] for m in by_id[target['id']].get('media') or []], ['https://example.com/a.jpg'])
+        self.assertEqual(sum(len(e.get('media') or []) for e in self.events()), 1)
+
+    def test_unknown_or_index_ref_is_not_found(self):
+        for ref in ('1', 'nope'):
+            with self.subTest(ref=ref):
+                status, body = self.server.request('POST', f'/api/v1/person/附件甲/events/{ref}/media', headers=AUTH,
+                                                   body={'url': 'https://example.com/b.jpg'})
+                self.assertEqual((status, body['error']['code']), (404, 'NOT_FOUND'))
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,46 @@
+"""
+GET /api/names 的分页参数校验与 OpenAPI 描述（运行：cd backend && python3 -m unittest）
+"""
+
+import unittest
+
+import index
+import openapi
+import testsupport
+
+
+class NamesPagingTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.server = testsupport.ApiServer(profile='offline')
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.server.close()
+
+    def test_valid_paging(self):
+        status, body = self.server.get('/api/v1/names', offset='0', limit='1')
+        self.assertEqual(status, 200, body)
+        self.assertLessEqual(len(body['data']), 1)
+        self.assertEqual((body['meta']['offset'], body['meta']['limit']), (0, 1))
+        status, body = self.server.get('/api/v1/names')
+        self.assertEqual((status, body['meta']['limit']), (200, None))
+
+    def test_invalid_paging(self):
+        for param, value in (('limit', 'abc'), ('limit', '-1'), ('limit', '1.5'), ('offset', '-1'), ('offset', 'x')):
+            with self.subTest(param=param, value=value):
+                status, body = self.server.get('/api/v1/names', **{param: value})
+                self.assertEqual(status, 400, body)
+                self.assertEqual(body['error']['code'], 'BAD_REQUEST')
+                self.assertEqual(body['error']['details']['param'], param)
+
+
+class NamesSpecTest(unittest.TestCase):
+    def test_paging_params_documented(self):
+        params = openapi.build(index.API_ROUTES, 'v1')['paths']['/names']['get']['parameters']
+        types = {p['name']: p['schema']['type'] for p in params}
+        self.assertEqual((types.get('offset'), types.get('limit')), ('integer', 'integer'))
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,61 @@
+"""
+解说音频：音色限于 TTS_VOICES，未命中缓存的合成计入 generations 额度（运行：cd backend && python3 -m unittest）
+"""
+
+import shutil
+import tempfile
+import unittest
+import urllib.error
+import urllib.request
+
+import index
+import narration
+import testsupport
+
+
+class NarrationQuotaTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.env = testsupport.env(TTS_VOICE='alloy', TTS_VOICES='alloy,nova')
+        cls.env.__enter__()
+        cls.server = testsupport.ApiServer(profile='offline')
+        cls.server.app.cache.upsert_person({'name': '解说甲', 'events': [
+            {'year': '1900', 'place': '北京', 'lat': 39.9, 'lon': 116.4, 'title': '出生', 'detail': '出生于北京'}]},
+            cls.server.app.fallback)
+        cls.audio_dir = tempfile.mkdtemp()
+        cls.saved, index.NARRATOR = index.NARRATOR, narration.Narrator(cls.audio_dir, 'mock')
+
+    @classmethod
+    def tearDownClass(cls):
+        index.NARRATOR = cls.saved
+        shutil.rmtree(cls.audio_dir, ignore_errors=True)
+        cls.server.close()
+        cls.env.__exit__(None, None, None)
+
+    def used(self):
+        return index.QUOTAS.status()['keys']['anonymous']['used']['generations']
+
+    def fetch(self, voice):
+        url = self.server.url + '/api/v1/person/%E8%A7%A3%E8%AF%B4%E7%94%B2/narration?voice=' + voice
+        try:
+            with urllib.request.urlopen(url, timeout=15) as resp:
+                return resp.status
+        except urllib.error.HTTPError as e:
+            return e.code
+
+    def test_voice_allow_list(self):
+        before = self.used()
+        self.assertEqual(self.fetch('echo'), 400)
+        self.assertEqual(self.used(), before)
+
+    def test_synthesis_consumes_quota_once(self):
+        before = self.used()
+        self.assertEqual(self.fetch('nova'), 200)
+        self.assertEqual(self.used(), before + 1)
+        # 已合成的音频直接输出，不再计额度
+        self.assertEqual(self.fetch('nova'), 200)
+        self.assertEqual(self.used(), before + 1)
+
+
+if __name__ == '__main__':
+    unittest.main()
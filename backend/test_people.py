@@ -0,0 +1,43 @@
+"""
+GET /api/people 分页参数与 /api/query/colocation 年份参数的校验（运行：cd backend && python3 -m unittest）
+"""
+
+import unittest
+
+import testsupport
+
+
+class ParamValidationTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.server = testsupport.ApiServer(profile='offline')
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.server.close()
+
+    def assertInvalid(self, path, param, **params):
+        status, body = self.server.get(path, **params)
+        self.assertEqual(status, 400, body)
+        self.assertEqual((body['error']['code'], body['error']['details']['param']), ('BAD_REQUEST', param))
+
+    def test_people_paging(self):
+        for param, value in (('limit', 'abc'), ('limit', '-1'), ('offset', 'x'), ('offset', '-5'),
+                             ('page', 'two'), ('page', '-1'), ('per_page', 'abc'), ('per_page', '0')):
+            with self.subTest(param=param, value=value):
+                self.assertInvalid('/api/v1/people', param, **{param: value})
+        status, body = self.server.get('/api/v1/people', page='1', per_page='1')
+        self.assertEqual(status, 200, body)
+        self.assertLessEqual(len(body['data']['persons']), 1)
+
+    def test_colocation_years(self):
+        for param in ('yearFrom', 'yearTo'):
+            with self.subTest(param=param):
+                self.assertInvalid('/api/v1/query/colocation', param, place='北京', **{param: 'abc'})
+        self.assertInvalid('/api/v1/query/colocation', 'radius_km', place='北京', radius_km='-1')
+        status, _ = self.server.get('/api/v1/query/colocation', place='北京', yearFrom='-200', yearTo='1900', radius_km='0')
+        self.assertEqual(status, 200)
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,47 @@
+"""
+路由器由各自的 HTTP server 持有：同一进程中的两个服务使用不同路由表时互不影响（运行：cd backend && python3 -m unittest）
+"""
+
+import unittest
+
+import index
+import router
+import routes
+import testsupport
+
+
+class SeparateRoutersTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        # 第二个服务只有 /api/names 与一个仅属于它的 /api/names-only
+        names = index.API_ROUTES['/api/names']
+        subset = {
+            '/api/names': names,
+            '/api/names-only': (('GET',), 'public', lambda h: routes.handle_names(h, index.APP)),
+        }
+        cls.full = testsupport.ApiServer(profile='offline')
+        cls.partial = testsupport.ApiServer(profile='offline', router=router.Router(subset, index.API_CHAINS))
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.partial.close()
+        cls.full.close()
+
+    def test_routes_do_not_leak(self):
+        self.assertEqual(self.full.get('/api/v1/people')[0], 200)
+        self.assertEqual(self.full.get('/api/v1/names')[0], 200)
+        status, body = self.full.get('/api/v1/names-only')
+        self.assertEqual((status, body['error']['code']), (404, 'NOT_FOUND'))
+
+        self.assertEqual(self.partial.get('/api/v1/names')[0], 200)
+        self.assertEqual(self.partial.get('/api/v1/names-only')[0], 200)
+        status, body = self.partial.get('/api/v1/people')
+        self.assertEqual((status, body['error']['code']), (404, 'NOT_FOUND'))
+
+    def test_default_router_is_unchanged(self):
+        self.assertIs(self.full.httpd.router, index.ROUTER)
+        self.assertNotIn('/api/names-only', index.ROUTER.routes)
+
+
+if __name__ == '__main__':
+    unittest.main()
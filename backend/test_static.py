@@ -0,0 +1,91 @@
+"""
+static.resolve_static_path 的路径安全测试（运行：cd backend && python3 -m unittest）
+"""
+
+import os
+import shutil
+import tempfile
+import unittest
+
+import static
+
+
+class ResolveStaticPathTest(unittest.TestCase):
+    def setUp(self):
+        self.base = tempfile.mkdtemp()
+        self.root = os.path.join(self.base, 'frontend')
+        os.makedirs(os.path.join(self.root, 'src'))
+        for rel in ('index.html', os.path.join('src', 'app.js')):
+            with open(os.path.join(self.root, rel), 'w') as f:
+                f.write('x')
+        with open(os.path.join(self.base, 'secret.txt'), 'w') as f:
+            f.write('secret')
+        self.real_root = os.path.realpath(self.root)
+
+    def tearDown(self):
+        shutil.rmtree(self.base, ignore_errors=True)
+
+    def resolve(self, url_path):
+        return static.resolve_static_path(self.root, url_path)
+
+    def assertInsideRoot(self, url_path):
+        # 要么拒绝，要么解析到根目录之内
+        got = self.resolve(url_path)
+        if got is not None:
+            self.assertEqual(os.path.commonpath([self.real_root, got]), self.real_root, url_path)
+
+    def test_normal_paths(self):
+        self.assertEqual(self.resolve('/'), os.path.join(self.real_root, 'index.html'))
+        self.assertEqual(self.resolve('/src/app.js'), os.path.join(self.real_root, 'src', 'app.js'))
+        self.assertEqual(self.resolve('/src/./app.js'), os.path.join(self.real_root, 'src', 'app.js'))
+
+    def test_plain_traversal(self):
+        self.assertIsNone(self.resolve('/../secret.txt'))
+        self.assertIsNone(self.resolve('/src/../../secret.txt'))
+
+    def test_encoded_traversal(self):
+        for url in ('/%2e%2e/secret.txt', '/%2E%2E/secret.txt', '/..%2fsecret.txt', '/%2e%2e%2fsecret.txt',
+                    '/src/%2e%2e/%2e%2e/secret.txt', '/.%2e/secret.txt'):
+            self.assertIsNone(self.resolve(url), url)
+
+    def test_double_encoded_traversal(self):
+        # 只解码一次：%252e%252e 变为字面量 "%2e%2e"，不会越出根目录
+        for url in ('/%252e%252e/secret.txt', '/%252e%252e%252fsecret.txt', '/..%252fsecret.txt'):
+            self.assertInsideRoot(url)
+        self.assertNotEqual(self.resolve('/%252e%252e%252fsecret.txt'), os.path.join(os.path.realpath(self.base), 'secret.txt'))
+
+    def test_absolute_paths(self):
+        secret = os.path.join(os.path.realpath(self.base), 'secret.txt')
+        for url in ('//etc/passwd', '/%2fetc/passwd', '/' + secret, '/%2F' + secret.lstrip('/')):
+            self.assertInsideRoot(url)
+            self.assertNotEqual(self.resolve(url), secret)
+
+    def test_backslash_and_nul(self):
+        for url in ('/..\\secret.txt', '/src\\app.js', '/%5c..%5csecret.txt', '/index.html%00.js', '/index.html\x00'):
+            self.assertIsNone(self.resolve(url), url)
+
+    def test_invalid_utf8(self):
+        self.assertIsNone(self.resolve('/%ff%fe'))
+
+    def test_symlink_outside_root(self):
+        link = os.path.join(self.root, 'leak.txt')
+        linked_dir = os.path.join(self.root, 'leakdir')
+        try:
+            os.symlink(os.path.join(self.base, 'secret.txt'), link)
+            os.symlink(self.base, linked_dir)
+        except (OSError, NotImplementedError):
+            self.skipTest('symlinks not supported')
+        self.assertIsNone(self.resolve('/leak.txt'))
+        self.assertIsNone(self.resolve('/leakdir/secret.txt'))
+
+    def test_symlink_inside_root(self):
+        link = os.path.join(self.root, 'app-link.js')
+        try:
+            os.symlink(os.path.join(self.root, 'src', 'app.js'), link)
+        except (OSError, NotImplementedError):
+            self.skipTest('symlinks not supported')
+        self.assertEqual(self.resolve('/app-link.js'), os.path.join(self.real_root, 'src', 'app.js'))
+
+
+if __name__ == '__main__':
+    unittest.main()
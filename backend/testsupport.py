@@ -0,0 +1,230 @@
+"""
+测试支持：进程内假上游与 API 服务（供 test_*.py 使用，运行：cd backend && python3 -m unittest）
+
+- FakeUpstream：监听 127.0.0.1 随机端口的 HTTP 服务，按脚本依次返回预设响应，并记录收到的请求
+- deepseek_fake()：模拟 DeepSeek /v1/chat/completions（函数工具调用格式）
+- nominatim_fake()：模拟 Nominatim /search
+- env()：临时覆盖环境变量（DEEPSEEK_BASE_URL、GEOCODE_URL 指向假上游等）
+- ApiServer：在临时数据目录中启动 index.py 的 HTTP 服务（随机端口，可指定路由器），get()、request() 发请求并解析 JSON 信封
+"""
+
+import contextlib
+import json
+import logging
+import os
+import shutil
+import tempfile
+import time
+import threading
+import urllib.error
+import urllib.request
+from http.server import BaseHTTPRequestHandler, ThreadingHTTPServer
+from urllib.parse import quote, urlencode, urlparse, parse_qs
+from typing import Any, Callable, Dict, Iterator, List, Optional, Tuple
+
+
+class FakeResponse:
+    def __init__(self, status: int = 200, body: Any = None, delay: float = 0.0, headers: Optional[Dict[str, str]] = None):
+        self.status = status
+        self.body = body
+        self.delay = delay
+        self.headers = headers or {}
+
+
+class FakeUpstream:
+    """脚本化假服务：script() 追加一次性响应，用尽后由 default 回调生成响应。"""
+
+    def __init__(self, name: str, default: Callable[[Dict[str, Any]], FakeResponse]):
+        self.name = name
+        self.default = default
+        self.calls: List[Dict[str, Any]] = []
+        self._script: List[FakeResponse] = []
+        self._lock = threading.Lock()
+        self._httpd: Optional[ThreadingHTTPServer] = None
+
+    @property
+    def url(self) -> str:
+        host, port = self._httpd.server_address[:2]
+        return f'http://{host}:{port}'
+
+    def script(self, *responses: FakeResponse):
+        with self._lock:
+            self._script.extend(responses)
+
+    def reset(self):
+        with self._lock:
+            self._script.clear()
+            self.calls.clear()
+
+    def start(self) -> 'FakeUpstream':
+        fake = self
+
+        class _Handler(BaseHTTPRequestHandler):
+            def _handle(self):
+                parsed = urlparse(self.path)
+                length = int(self.headers.get('Content-Length') or 0)
+                raw = self.rfile.read(length) if length else b''
+                try:
+                    body = json.loads(raw.decode('utf-8')) if raw else None
+                except ValueError:
+                    body = raw.decode('utf-8', 'replace')
+                call = {'method': self.command, 'path': parsed.path, 'query': parse_qs(parsed.query),
+                        'headers': dict(self.headers), 'json': body}
+                with fake._lock:
+                    fake.calls.append(call)
+                    resp = fake._script.pop(0) if fake._script else None
+                resp = resp or fake.default(call)
+                if resp.delay:
+                    time.sleep(resp.delay)
+                payload = resp.body if isinstance(resp.body, (bytes, str)) else json.dumps(resp.body, ensure_ascii=False)
+                data = payload.encode('utf-8') if isinstance(payload, str) else payload
+                try:
+                    self.send_response(resp.status)
+                    self.send_header('Content-Type', 'application/json')
+                    self.send_header('Content-Length', str(len(data)))
+                    for k, v in resp.headers.items():
+                        self.send_header(k, v)
+                    self.end_headers()
+                    self.wfile.write(data)
+                except (BrokenPipeError, ConnectionResetError):
+                    pass  # 客户端已超时断开
+
+            do_GET = _handle
+            do_POST = _handle
+
+            def log_message(self, format, *args):
+                pass
+
+        self._httpd = ThreadingHTTPServer(('127.0.0.1', 0), _Handler)
+        self._httpd.daemon_threads = True
+        threading.Thread(target=self._httpd.serve_forever, daemon=True).start()
+        return self
+
+    def stop(self):
+        if self._httpd is not None:
+            self._httpd.shutdown()
+            self._httpd.server_close()
+            self._httpd = None
+
+
+def deepseek_tool_response(events: List[Dict[str, Any]]) -> Dict[str, Any]:
+    """构造 DeepSeek 函数工具调用格式的成功响应。"""
+    return {
+        'choices': [{
+            'message': {
+                'role': 'assistant',
+                'content': None,
+                'tool_calls': [{
+                    'type': 'function',
+                    'function': {'name': 'return_events', 'arguments': json.dumps({'events': events}, ensure_ascii=False)},
+                }],
+            },
+        }],
+    }
+
+
+def nominatim_response(lat: float, lon: float) -> List[Dict[str, str]]:
+    return [{'lat': str(lat), 'lon': str(lon), 'display_name': 'fake'}]
+
+
+def deepseek_fake(events_for: Optional[Callable[[str], List[Dict[str, Any]]]] = None) -> FakeUpstream:
+    """默认按用户消息中的姓名返回两条事件（第二条缺少坐标，用于触发地理编码）。"""
+    def default(call):
+        messages = ((call.get('json') or {}).get('messages') or [])
+        prompt = str(messages[-1].get('content', '')) if messages else ''
+        name = prompt.replace('请根据维基百科、百科资料和常识，生成 ', '').replace(' 的生平轨迹', '')
+        events = events_for(name) if events_for else [
+            {'year': '1900', 'age': '0', 'place': '北京', 'lat': 39.9, 'lon': 116.4, 'title': '出生', 'detail': f'{name}出生'},
+            {'year': '1920', 'age': '', 'place': '假想城', 'lat': '', 'lon': '', 'title': '迁居', 'detail': f'{name}迁居'},
+        ]
+        return FakeResponse(200, deepseek_tool_response(events))
+    return FakeUpstream('deepseek', default)
+
+
+def nominatim_fake(coords: Optional[Dict[str, tuple]] = None) -> FakeUpstream:
+    """按 q 查 coords 表返回坐标，未列出的地点返回固定坐标 (30.0, 120.0)。"""
+    def default(call):
+        q = (call['query'].get('q') or [''])[0]
+        lat, lon = (coords or {}).get(q, (30.0, 120.0))
+        return FakeResponse(200, nominatim_response(lat, lon))
+    return FakeUpstream('nominatim', default)
+
+
+# 经假 DeepSeek 生成时的配置：不重试、读超时 1 秒（便于覆盖超时映射），不做别名识别
+DEEPSEEK_ENV = {
+    'AI_PROVIDER': 'deepseek',
+    'DEEPSEEK_API_KEY': 'test-key',
+    'DEEPSEEK_RETRY_TOTAL': '0',
+    'DEEPSEEK_READ_TIMEOUT': '1',
+    'ALIAS_AI_ENABLED': '0',
+    'GEOCODE_MAX_CALLS': '3',
+    'GENERATE_TIMEOUT_SEC': '10',
+}
+
+
+@contextlib.contextmanager
+def env(**values: str) -> Iterator[None]:
+    saved = {k: os.environ.get(k) for k in values}
+    os.environ.update(values)
+    try:
+        yield
+    finally:
+        for k, v in saved.items():
+            if v is None:
+                os.environ.pop(k, None)
+            else:
+                os.environ[k] = v
+
+
+class ApiServer:
+    """临时数据目录中的 API 服务；profile 为 services.build_app 的装配方式，router 缺省为 index.ROUTER，scope 为监听作用域（见 listeners.py）。"""
+
+    def __init__(self, profile: str = 'default', router=None, scope: str = 'all'):
+        import index
+        import listeners
+        import services
+        self.index = index
+        self.root = tempfile.mkdtemp(prefix='fetrace-test-')
+        os.makedirs(os.path.join(self.root, 'data'))
+        index._setup_logging(logging.WARNING)
+        self.app = services.build_app(index.FALLBACK, profile=profile)
+        self.app.cache.preload(self.root, self.root, index.FALLBACK)
+        index.APP = self.app  # 路由表中的处理函数在请求时取 index.APP
+        self.httpd = listeners.make_server('127.0.0.1:0', index.Handler, scope=scope, router=router or index.ROUTER)
+        threading.Thread(target=self.httpd.serve_forever, daemon=True).start()
+        index.READY.set()
+
+    @property
+    def url(self) -> str:
+        host, port = self.httpd.server_address[:2]
+        return f'http://{host}:{port}'
+
+    @property
+    def people_path(self) -> str:
+        return os.path.join(self.root, 'data', 'people.json')
+
+    def get(self, path: str, headers: Optional[Dict[str, str]] = None, **params) -> Tuple[int, Dict[str, Any]]:
+        return self.request('GET', path, headers=headers, **params)
+
+    def request(self, method: str, path: str, body: Optional[Dict[str, Any]] = None,
+                headers: Optional[Dict[str, str]] = None, **params) -> Tuple[int, Dict[str, Any]]:
+        data = json.dumps(body).encode('utf-8') if body is not None else (b'' if method in ('POST', 'PUT', 'PATCH') else None)
+        headers = dict(headers or {})
+        if body is not None:
+            headers.setdefault('Content-Type', 'application/json')
+        req = urllib.request.Request(self.url + quote(path) + ('?' + urlencode(params) if params else ''), data=data,
+                                     headers=headers, method=method)
+        try:
+            with urllib.request.urlopen(req, timeout=15) as resp:
+                status, raw = resp.status, resp.read()
+        except urllib.error.HTTPError as e:
+            status, raw = e.code, e.read()
+        try:
+            return status, json.loads(raw.decode('utf-8') or '{}')
+        except ValueError:
+            return status, {}
+
+    def close(self):
+        self.httpd.shutdown()
+        self.httpd.server_close()
+        shutil.rmtree(self.root, ignore_errors=True)
@@ -0,0 +1,86 @@
+"""
+中文文本归一化工具
+
+- 全角/半角统一（NFKC），例如全角字母、全角空格
+- 空白归一：去除首尾空白、合并连续空白、去掉汉字之间的空白
+- 繁体转简体：优先使用 OpenCC（可选依赖：pip install opencc-python-reimplemented），
+  否则回退到内置常用字表
+- 异体字统一为通行写法
+
+Excel 导入、缓存键与查询统一使用本模块，保证「蘇軾」与「苏轼」落到同一条记录。
+"""
+
+import re
+import unicodedata
+
+try:
+    from opencc import OpenCC  # 可选依赖
+    _OPENCC = OpenCC('t2s')
+except Exception:
+    _OPENCC = None
+
+# 内置常用繁体 → 简体对照（覆盖常见人名、地名用字；完整转换请安装 OpenCC）
+_T2S_PAIRS = (
+    "蘇苏軾轼東东劉刘陳陈張张趙赵孫孙鄭郑馮冯錢钱衛卫蔣蒋韓韩楊杨許许呂吕嚴严華华葉叶鄧邓蕭萧"
+    "賈贾馬马龍龙鳳凤歐欧陽阳黃黄羅罗顧顾譚谭盧卢齊齐魯鲁關关範范陸陆鍾钟鐘钟鄒邹龔龚閻阎湯汤"
+    "溫温紀纪樂乐餘余鮑鲍萬万貝贝倫伦寶宝義义國国學学詩诗書书畫画傳传軍军將将興兴憲宪漢汉維维"
+    "偉伟濤涛鵬鹏飛飞雲云聖圣賢贤禮礼讓让護护麗丽鳴鸣進进遠远達达運运慶庆輝辉廣广長长門门開开"
+    "間间問问陰阴隱隐閒闲響响語语說说讀读論论記记談谈誠诚議议變变氣气點点黨党豐丰鄉乡區区縣县"
+    "島岛灣湾臺台過过還还這这來来時时後后發发會会無无與与為为們们個个對对從从見见現现實实歲岁"
+    "經经歷历戰战爭争亂乱權权勝胜敗败親亲愛爱憂忧歡欢懷怀壽寿劍剑鐵铁銀银錦锦綠绿紅红藍蓝鳥鸟"
+    "魚鱼龜龟鶴鹤莊庄園园圖图團团嶺岭壇坛澤泽濟济滬沪陝陕遼辽寧宁貴贵僑侨傑杰淵渊潔洁瑩莹靜静"
+    "鈞钧銘铭鋒锋凱凯擇择揚扬顯显賓宾穎颖頤颐顏颜願愿風风麥麦齡龄齋斋闊阔綱纲紹绍壯壮聶聂蘭兰"
+    "簡简鄺邝闞阚賀贺費费鄔邬師师參参愷恺曄晔燁烨瑋玮緒绪綺绮維维縉缙繆缪嬌娇嬰婴鶯莺嶽岳"
+)
+# 异体字 → 通行字
+_VARIANT_PAIRS = "羣群峯峰裡里裏里綫线線线眞真爲为敎教淸清靑青戶户吿告內内兪俞硏研衆众衞卫"
+
+
+def _pairs_to_map(pairs: str) -> dict:
+    return {pairs[i]: pairs[i + 1] for i in range(0, len(pairs) - 1, 2)}
+
+
+_T2S = _pairs_to_map(_T2S_PAIRS)
+_VARIANTS = _pairs_to_map(_VARIANT_PAIRS)
+
+_WS_RE = re.compile(r"\s+")
+_CJK_GAP_RE = re.compile(r"(?<=[㐀-鿿])\s+(?=[㐀-鿿])")
+
+
+def to_simplified(text: str) -> str:
+    if not text:
+        return ''
+    if _OPENCC is not None:
+        try:
+            return _OPENCC.convert(text)
+        except Exception:
+            pass
+    return ''.join(_T2S.get(ch, ch) for ch in text)
+
+
+def normalize_text(text) -> str:
+    """通用归一：全角转半角、异体字统一、繁转简、合并空白。"""
+    s = unicodedata.normalize('NFKC', str(text or ''))
+    s = ''.join(_VARIANTS.get(ch, ch) for ch in s)
+    s = to_simplified(s)
+    return _WS_RE.sub(' ', s).strip()
+
+
+def normalize_name(name) -> str:
+    """人名归一：在通用归一基础上去掉汉字之间的空白（如「鲁 迅」→「鲁迅」）。"""
+    return _CJK_GAP_RE.sub('', normalize_text(name))
+
+
+def name_key(name) -> str:
+    """缓存键：归一化后的人名再做大小写折叠。"""
+    return normalize_name(name).casefold()
+
+
+def fold_chars(text) -> str:
+    """逐字归一（全半角、异体字、繁简、大小写）且保持长度不变，用于检索时按位置标出原文中的命中。"""
+    out = []
+    for ch in str(text or ''):
+        c = unicodedata.normalize('NFKC', ch)
+        c = to_simplified(_VARIANTS.get(c, c)).casefold() if len(c) == 1 else ch
+        out.append(c if len(c) == 1 else ch.lower()[:1] or ch)
+    return ''.join(out)
@@ -0,0 +1,97 @@
+"""
+人物内容的多语言版本
+
+同一人物记录内保存各语言的事件文本，原文语言为 person["lang"]（缺省 zh）：
+    "translations": {"en": {"events": [{"place", "title", "detail"}, ...]}}
+译文按事件下标与 events 对应，只含可翻译的文本字段；年份、坐标等仍取原文事件。
+
+- /api/person 按 ?lang= 或 Accept-Language 选择已有语言，响应头 Content-Language 标明实际语言
+- 显式 ?lang= 且尚无该语言时按需调用 AI 翻译并写回缓存（受 generation 与只读开关约束）
+- POST /api/person/{name}/translate?lang=en 显式翻译并保存（已有译文时直接返回，force=1 重译）
+- POST /api/person/{name}/translations/{lang} 直接写入译文，DELETE 删除
+语言标签只取主标签并转小写（zh-CN → zh，en-US → en）。
+"""
+
+import copy
+import re
+from typing import Any, Dict, List, Optional
+
+TEXT_FIELDS = ('place', 'title', 'detail')
+DEFAULT_LANG = 'zh'
+MAX_TEXT = 2000
+_LANG_RE = re.compile(r'^[a-z]{2,3}$')
+
+
+def normalize_lang(tag: str) -> Optional[str]:
+    lang = str(tag or '').strip().replace('_', '-').split('-', 1)[0].lower()
+    return lang if _LANG_RE.match(lang) else None
+
+
+def parse_accept_language(header: Optional[str]) -> List[str]:
+    """按 q 值降序返回语言（已归一化、去重）。"""
+    weighted = []
+    for i, part in enumerate(str(header or '').split(',')):
+        tag, _, params = part.strip().partition(';')
+        q = 1.0
+        if params.strip().startswith('q='):
+            try:
+                q = float(params.strip()[2:])
+            except ValueError:
+                q = 0.0
+        lang = normalize_lang(tag)
+        if lang and q > 0:
+            weighted.append((-q, i, lang))
+    out = []
+    for _, _, lang in sorted(weighted):
+        if lang not in out:
+            out.append(lang)
+    return out
+
+
+def base_lang(person: Dict[str, Any]) -> str:
+    return normalize_lang(person.get('lang') or '') or DEFAULT_LANG
+
+
+def available(person: Dict[str, Any]) -> List[str]:
+    base = base_lang(person)
+    return [base] + sorted(k for k in (person.get('translations') or {}) if k != base)
+
+
+def pick(person: Dict[str, Any], wanted: List[str]) -> str:
+    """wanted 中第一个已有的语言，都没有时为原文语言。"""
+    langs = available(person)
+    return next((lang for lang in wanted if lang in langs), langs[0])
+
+
+def localize(person: Dict[str, Any], lang: str) -> Dict[str, Any]:
+    """返回 lang 版本的人物副本（不含 translations）；缺失的字段保留原文。"""
+    out = {k: v for k, v in person.items() if k != 'translations'}
+    out['lang'] = base_lang(person)
+    items = ((person.get('translations') or {}).get(lang) or {}).get('events') or []
+    if lang == out['lang'] or not items:
+        return out
+    events = copy.deepcopy(person.get('events') or [])
+    for e, t in zip(events, items):
+        for field in TEXT_FIELDS:
+            if isinstance(t, dict) and t.get(field):
+                e[field] = t[field]
+    out['events'] = events
+    out['lang'] = lang
+    return out
+
+
+def source_texts(person: Dict[str, Any]) -> List[Dict[str, str]]:
+    """待翻译的原文：每个事件的文本字段。"""
+    return [{f: str(e.get(f) or '') for f in TEXT_FIELDS} for e in person.get('events') or []]
+
+
+def clean_items(items: Any, count: int) -> Optional[List[Dict[str, str]]]:
+    """校验译文列表：至多 count 项，每项只保留文本字段；结构不符时返回 None。"""
+    if not isinstance(items, list) or len(items) > count:
+        return None
+    out = []
+    for item in items:
+        if not isinstance(item, dict):
+            return None
+        out.append({f: str(item[f]).strip()[:MAX_TEXT] for f in TEXT_FIELDS if isinstance(item.get(f), str) and item[f].strip()})
+    return out
@@ -0,0 +1,150 @@
+"""
+按租户（API Key）的用量记账，供费用分摊（chargeback）
+
+每个公开接口请求按 quotas.py 解析出的租户（未带 Key 为 anonymous）累计，按自然月（UTC）汇总：
+- requests           请求数
+- generations        AI 调用次数（生成轨迹、翻译）
+- prompt_tokens / completion_tokens / total_tokens  DeepSeek 响应 usage 中的 token 数（模拟模式为 0）
+- geocode            地理编码外部请求次数
+费用列 cost = total_tokens / 1000 × USAGE_PRICE_PER_1K_TOKENS + geocode × USAGE_PRICE_PER_GEOCODE（未配置单价时为 0）。
+
+数据保存在 data/usage.json，随缓存周期落盘；导出：
+- GET /api/admin/usage?month=2026-10[&format=csv]（不带 month 时列出各月合计）
+- python index.py usage [--month 2026-10] [--out 文件或 -]，默认上月
+"""
+
+import io
+import os
+import csv
+import sys
+import json
+import time
+import argparse
+import threading
+from typing import Any, Dict, List, Optional
+
+import config
+
+FIELDS = ('requests', 'generations', 'prompt_tokens', 'completion_tokens', 'total_tokens', 'geocode')
+CSV_COLUMNS = ['month', 'tenant'] + list(FIELDS) + ['cost']
+
+
+def current_month() -> str:
+    return time.strftime('%Y-%m', time.gmtime())
+
+
+def previous_month() -> str:
+    y, m = (int(x) for x in current_month().split('-'))
+    return f'{y - 1}-12' if m == 1 else f'{y}-{m - 1:02d}'
+
+
+def valid_month(month: str) -> bool:
+    try:
+        time.strptime(month, '%Y-%m')
+        return len(month) == 7
+    except ValueError:
+        return False
+
+
+def cost(row: Dict[str, Any]) -> float:
+    token_price, geocode_price = config.get_usage_prices()
+    return round(row.get('total_tokens', 0) / 1000 * token_price + row.get('geocode', 0) * geocode_price, 4)
+
+
+class UsageLedger:
+    def __init__(self, path: Optional[str] = None):
+        self.path = path
+        self._lock = threading.Lock()
+        self._months: Dict[str, Dict[str, Dict[str, int]]] = {}
+        self._dirty = False
+        if path and os.path.isfile(path):
+            try:
+                with open(path, 'r', encoding='utf-8') as f:
+                    self._months = dict(json.load(f).get('months') or {})
+            except (OSError, ValueError, AttributeError):
+                self._months = {}
+
+    def add(self, tenant: str, field: str, n: int = 1):
+        if field not in FIELDS or n <= 0:
+            return
+        with self._lock:
+            row = self._months.setdefault(current_month(), {}).setdefault(tenant, {})
+            row[field] = row.get(field, 0) + int(n)
+            self._dirty = True
+
+    def add_tokens(self, tenant: str, usage: Dict[str, Any]):
+        """记录一次 DeepSeek 响应的 usage 字段。"""
+        for field in ('prompt_tokens', 'completion_tokens', 'total_tokens'):
+            try:
+                self.add(tenant, field, int(usage.get(field) or 0))
+            except (TypeError, ValueError):
+                pass
+
+    def months(self) -> List[Dict[str, Any]]:
+        """各月全部租户的合计，新月份在前。"""
+        with self._lock:
+            months = {m: {t: dict(r) for t, r in rows.items()} for m, rows in self._months.items()}
+        out = []
+        for month in sorted(months, reverse=True):
+            total = {f: sum(r.get(f, 0) for r in months[month].values()) for f in FIELDS}
+            out.append(dict(total, month=month, tenants=len(months[month]), cost=cost(total)))
+        return out
+
+    def monthly(self, month: str) -> List[Dict[str, Any]]:
+        """某月各租户一行，按 total_tokens、requests 降序。"""
+        with self._lock:
+            rows = {t: dict(r) for t, r in (self._months.get(month) or {}).items()}
+        out = []
+        for tenant, r in rows.items():
+            row = {'month': month, 'tenant': tenant, **{f: r.get(f, 0) for f in FIELDS}}
+            row['cost'] = cost(row)
+            out.append(row)
+        out.sort(key=lambda r: (-r['total_tokens'], -r['requests'], r['tenant']))
+        return out
+
+    def flush(self) -> bool:
+        if not self.path:
+            return False
+        with self._lock:
+            if not self._dirty:
+                return False
+            data = {'months': json.loads(json.dumps(self._months))}
+            self._dirty = False
+        try:
+            os.makedirs(os.path.dirname(self.path) or '.', exist_ok=True)
+            tmp = self.path + '.tmp'
+            with open(tmp, 'w', encoding='utf-8') as f:
+                json.dump(data, f, ensure_ascii=False)
+            os.replace(tmp, self.path)
+            return True
+        except OSError:
+            with self._lock:
+                self._dirty = True
+            return False
+
+
+def to_csv(rows: List[Dict[str, Any]]) -> str:
+    buf = io.StringIO()
+    w = csv.DictWriter(buf, fieldnames=CSV_COLUMNS, extrasaction='ignore')
+    w.writeheader()
+    for row in rows:
+        w.writerow(row)
+    return buf.getvalue()
+
+
+def main(argv: List[str], ledger: UsageLedger) -> int:
+    parser = argparse.ArgumentParser(prog='index.py usage', description='导出按租户的月度用量（CSV）')
+    parser.add_argument('--month', default=previous_month(), help='YYYY-MM，默认上月')
+    parser.add_argument('--out', default='-', help='输出文件，"-" 表示标准输出')
+    args = parser.parse_args(argv)
+    if not valid_month(args.month):
+        parser.error(f'月份格式应为 YYYY-MM：{args.month}')
+    rows = ledger.monthly(args.month)
+    text = to_csv(rows)
+    if args.out == '-':
+        sys.stdout.write(text)
+    else:
+        with open(args.out, 'w', encoding='utf-8-sig', newline='') as f:
+            f.write(text)
+        print(f'{args.month}: {args.out}（tenants={len(rows)}）', file=sys.stderr)
+    return 0
@@ -0,0 +1,91 @@
+"""
+请求参数校验与请求体限制
+
+- 人名：归一化后校验长度与字符集（汉字/字母/数字/空格及常见间隔符），防止异常输入进入 AI 生成链路
+- 批量：限制一次请求的姓名个数
+- 请求体：按 Content-Length 限制大小后再读取（用于上传/导入类接口），超限返回 413
+校验失败统一抛出 ApiError，details 中给出 param 与 reason，便于客户端定位。
+"""
+
+import json
+import unicodedata
+from typing import Any, List
+import config
+import errors
+from errors import ApiError
+from textnorm import normalize_name, name_key
+
+# 人名中允许的非字母数字字符（外文名间隔号、连字符、缩写点、括注等）
+_NAME_PUNCT = set(" ·・•‧-'’.()（）")
+
+
+def _name_char_ok(ch: str) -> bool:
+    if ch in _NAME_PUNCT:
+        return True
+    cat = unicodedata.category(ch)
+    return cat[0] in ('L', 'M', 'N')
+
+
+def validate_name(raw: Any, param: str = 'name') -> str:
+    """返回归一化后的人名；为空、超长或含非法字符时抛出 ApiError(400)。"""
+    name = normalize_name(raw)
+    if not name:
+        raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": param})
+    max_len = config.get_name_max_len()
+    if len(name) > max_len:
+        raise ApiError(errors.BAD_REQUEST, 'name_too_long', {"param": param, "reason": "too_long", "max": max_len})
+    bad = [ch for ch in name if not _name_char_ok(ch)]
+    if bad:
+        raise ApiError(errors.BAD_REQUEST, 'name_invalid_chars', {"param": param, "reason": "invalid_chars", "chars": ''.join(sorted(set(bad)))})
+    return name
+
+
+def validate_names(raw: str, param: str = 'names') -> List[str]:
+    """解析逗号分隔（兼容中文逗号）的姓名列表，去重并逐个校验，且不超过批量上限。"""
+    names: List[str] = []
+    seen = set()
+    for part in str(raw or '').replace('，', ',').split(','):
+        if not part.strip():
+            continue
+        n = validate_name(part, param)
+        if name_key(n) not in seen:
+            seen.add(name_key(n))
+            names.append(n)
+    if not names:
+        raise ApiError(errors.BAD_REQUEST, 'missing_param', {"param": param})
+    max_names = config.get_person_batch_max()
+    if len(names) > max_names:
+        raise ApiError(errors.BAD_REQUEST, 'too_many_names', {"param": param, "reason": "too_many", "max": max_names})
+    return names
+
+
+def validate_query_text(raw: Any, param: str = 'q') -> str:
+    text = str(raw or '').strip()
+    max_len = config.get_name_max_len()
+    if len(text) > max_len:
+        raise ApiError(errors.BAD_REQUEST, 'param_too_long', {"param": param, "reason": "too_long", "max": max_len})
+    return text
+
+
+def read_body(handler, max_bytes: int) -> bytes:
+    """按 Content-Length 读取请求体，超过 max_bytes 时不读取直接拒绝。"""
+    length_text = handler.headers.get('Content-Length')
+    if length_text is None:
+        raise ApiError(errors.LENGTH_REQUIRED, 'length_required')
+    try:
+        length = int(length_text)
+    except Exception:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "Content-Length"})
+    if length < 0:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_param', {"param": "Content-Length"})
+    if length > max_bytes:
+        raise ApiError(errors.PAYLOAD_TOO_LARGE, 'payload_too_large', {"max_bytes": max_bytes, "bytes": length})
+    return handler.rfile.read(length) if length else b''
+
+
+def read_json_body(handler, max_bytes: int = 0) -> Any:
+    body = read_body(handler, max_bytes or config.get_max_body_bytes())
+    try:
+        return json.loads(body.decode('utf-8') or 'null')
+    except Exception:
+        raise ApiError(errors.BAD_REQUEST, 'invalid_json')
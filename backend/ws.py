@@ -0,0 +1,169 @@
+"""
+WebSocket 推送通道（GET /ws）
+
+缓存中的人物新增、修改、删除、改名或批量导入时（见 Cache.subscribe），向所有连接广播一条 JSON 文本消息：
+    {"type": "person.added" | "person.updated" | "person.deleted" | "person.evicted" | "person.renamed" | "people.imported",
+     "name": "...", "seq": 12, "at": 1760000000.0, ...}
+连接建立后先收到 {"type": "hello", "seq": 当前序号}；客户端据 seq 判断是否漏收（漏收时重拉 /api/people/changes）。
+
+只实现 RFC 6455 的最小子集：文本帧下发、ping/pong、close，不支持扩展与分片的客户端消息（客户端无需发送数据）。
+每个连接占用一个处理线程；连接数上限 WS_MAX_CLIENTS，发送队列积压超过 WS_QUEUE_MAX 条的慢客户端会被断开。
+停机时以 1001（going away）关闭全部连接，客户端重连到新实例。
+"""
+
+import json
+import time
+import queue
+import base64
+import select
+import struct
+import hashlib
+import threading
+from typing import Any, Dict, Optional
+
+import config
+
+GUID = '258EAFA5-E914-47DA-95CA-C5AB0DC85B11'
+OP_TEXT, OP_CLOSE, OP_PING, OP_PONG = 0x1, 0x8, 0x9, 0xA
+GOING_AWAY, POLICY_VIOLATION = 1001, 1008
+
+
+def accept_key(key: str) -> str:
+    return base64.b64encode(hashlib.sha1((key + GUID).encode('ascii')).digest()).decode('ascii')
+
+
+def encode_frame(opcode: int, payload: bytes = b'') -> bytes:
+    head = bytes([0x80 | opcode])
+    n = len(payload)
+    if n < 126:
+        head += bytes([n])
+    elif n < 65536:
+        head += bytes([126]) + struct.pack('!H', n)
+    else:
+        head += bytes([127]) + struct.pack('!Q', n)
+    return head + payload
+
+
+def read_frame(rfile) -> Optional[tuple]:
+    """读取一个客户端帧，返回 (opcode, payload)；连接已关闭或帧不合法时返回 None。"""
+    head = rfile.read(2)
+    if len(head) < 2:
+        return None
+    opcode, masked, n = head[0] & 0x0F, head[1] & 0x80, head[1] & 0x7F
+    if n == 126:
+        n = struct.unpack('!H', rfile.read(2))[0]
+    elif n == 127:
+        n = struct.unpack('!Q', rfile.read(8))[0]
+    if not masked or n > 65536:
+        return None
+    mask = rfile.read(4)
+    data = rfile.read(n)
+    if len(mask) < 4 or len(data) < n:
+        return None
+    return opcode, bytes(b ^ mask[i % 4] for i, b in enumerate(data))
+
+
+class Hub:
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._clients: Dict[int, 'queue.Queue'] = {}
+        self._next_id = 0
+        self.seq = 0
+
+    def clients(self) -> int:
+        with self._lock:
+            return len(self._clients)
+
+    def publish(self, event: Dict[str, Any]):
+        """广播一条消息；积压过多的客户端放入 None 以断开。"""
+        with self._lock:
+            self.seq += 1
+            msg = json.dumps(dict(event, seq=self.seq, at=time.time()), ensure_ascii=False)
+            for q in self._clients.values():
+                try:
+                    q.put_nowait(msg)
+                except queue.Full:
+                    q.queue.clear()
+                    q.put_nowait(None)
+
+    def close_all(self):
+        with self._lock:
+            for q in self._clients.values():
+                q.queue.clear()
+                q.put_nowait(GOING_AWAY)
+
+    def _register(self) -> Optional[tuple]:
+        with self._lock:
+            if len(self._clients) >= config.get_ws_max_clients():
+                return None
+            self._next_id += 1
+            q: 'queue.Queue' = queue.Queue(maxsize=config.get_ws_queue_max())
+            self._clients[self._next_id] = q
+            return self._next_id, q, self.seq
+
+    def _unregister(self, cid: int):
+        with self._lock:
+            self._clients.pop(cid, None)
+
+    def serve(self, handler):
+        """完成握手并在当前处理线程中维持连接，直到任一方关闭。"""
+        key = handler.headers.get('Sec-WebSocket-Key')
+        if (handler.headers.get('Upgrade') or '').lower() != 'websocket' or not key:
+            handler.send_error(400, 'Expected WebSocket upgrade')
+            return
+        registered = self._register()
+        if registered is None:
+            handler.send_error(503, 'Too many WebSocket clients')
+            return
+        cid, q, seq = registered
+        handler.send_response(101, 'Switching Protocols')
+        handler.send_header('Upgrade', 'websocket')
+        handler.send_header('Connection', 'Upgrade')
+        handler.send_header('Sec-WebSocket-Accept', accept_key(key.strip()))
+        handler.end_headers()
+        handler.wfile.flush()
+        handler.close_connection = True
+        sock = handler.connection
+        ping_every = config.get_ws_ping_sec()
+        last_ping = time.monotonic()
+        code = 1000
+        try:
+            handler.wfile.write(encode_frame(OP_TEXT, json.dumps({'type': 'hello', 'seq': seq}).encode('utf-8')))
+            while True:
+                readable, _, _ = select.select([sock], [], [], 0.5)
+                if readable:
+                    frame = read_frame(handler.rfile)
+                    if frame is None or frame[0] == OP_CLOSE:
+                        break
+                    if frame[0] == OP_PING:
+                        handler.wfile.write(encode_frame(OP_PONG, frame[1]))
+                item = ''
+                while True:
+                    try:
+                        item = q.get_nowait()
+                    except queue.Empty:
+                        break
+                    if item is None or isinstance(item, int):
+                        break
+                    handler.wfile.write(encode_frame(OP_TEXT, item.encode('utf-8')))
+                if item is None:
+                    code = POLICY_VIOLATION
+                    break
+                if isinstance(item, int):
+                    code = item
+                    break
+                if time.monotonic() - last_ping >= ping_every:
+                    handler.wfile.write(encode_frame(OP_PING))
+                    last_ping = time.monotonic()
+        except (OSError, ValueError, struct.error):
+            code = None
+        finally:
+            self._unregister(cid)
+            if code is not None:
+                try:
+                    handler.wfile.write(encode_frame(OP_CLOSE, struct.pack('!H', code)))
+                except OSError:
+                    pass
+
+
+HUB = Hub()
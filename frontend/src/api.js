@@ -1,26 +1,148 @@
+// 使用带版本的 /api/v1；未带版本的 /api 为兼容别名，仅供旧页面
 export const API_BASE = (() => {
-  const originBase = `${window.location.origin}/api`;
+  const originBase = `${window.location.origin}/api/v1`;
   const isLocalPreview = (location.hostname === 'localhost');
-  const previewFallback = 'http://localhost:8001/api';
+  const previewFallback = 'http://localhost:8001/api/v1';
   return window.FETRACE_API_BASE || (isLocalPreview ? previewFallback : originBase);
 })();
 
+// 后端统一返回 { data, meta, error, requestId }；失败时抛出带 code 的 Error，便于按错误码分支
+// （如 PERSON_NOT_FOUND、UPSTREAM_TIMEOUT、RATE_LIMITED），requestId 用于反馈问题时查日志
+async function readEnvelope(resp) {
+  let body = null;
+  try { body = await resp.json(); } catch (_) { body = null; }
+  if (!resp.ok || body?.error) {
+    const err = new Error(body?.error?.message || `接口返回错误：${resp.status}`);
+    err.code = body?.error?.code || 'HTTP_ERROR';
+    err.status = resp.status;
+    err.requestId = body?.requestId || resp.headers.get('X-Request-ID') || '';
+    throw err;
+  }
+  return body;
+}
+
 async function httpGetJSON(url) {
-  const resp = await fetch(url);
-  if (!resp.ok) throw new Error(`接口返回错误：${resp.status}`);
-  return await resp.json();
+  return (await readEnvelope(await fetch(url)))?.data;
 }
 
+// 返回 [{ name, cached }]，cached 为 false 表示点击后需实时生成（较慢）
 export async function fetchNames() {
   try {
-    const list = await httpGetJSON(`${API_BASE}/names`);
-    return Array.isArray(list) ? list : [];
+    const items = await httpGetJSON(`${API_BASE}/names`);
+    return (Array.isArray(items) ? items : []).filter(it => it && it.name);
   } catch (e) {
     console.error('加载姓名列表失败：', e);
     return [];
   }
 }
 
+// 搜索框输入提示 [{ name, cached, match, alias? }]，失败时返回空列表
+export async function suggestNames(q, limit) {
+  if (!q || !q.trim()) return [];
+  try {
+    const items = await httpGetJSON(`${API_BASE}/names/suggest?q=${encodeURIComponent(q)}${limit ? `&limit=${limit}` : ''}`);
+    return Array.isArray(items) ? items : [];
+  } catch (e) {
+    console.error('加载输入提示失败：', e);
+    return [];
+  }
+}
+
+// 分页取人物列表（page 从 1 起），返回 { persons, total, hasMore }；fields 如 'name,style,eventCount' 时只取这些字段
+export async function fetchPeoplePage(page = 1, perPage = 50, fields = '') {
+  const f = fields ? `&fields=${encodeURIComponent(fields)}` : '';
+  const resp = await fetch(`${API_BASE}/people?page=${page}&per_page=${perPage}${f}`);
+  const body = await readEnvelope(resp);
+  return { persons: body?.data?.persons || [], total: body?.meta?.total || 0, hasMore: !!body?.meta?.has_more };
+}
+
+// 增量同步：取 since（Unix 秒，0 为全部）之后变更的人物，返回 { persons, deleted, nextSince, hasMore, reset }
+export async function fetchPeopleChanges(since = 0) {
+  const resp = await fetch(`${API_BASE}/people/changes?since=${encodeURIComponent(since)}`);
+  const body = await readEnvelope(resp);
+  const meta = body?.meta || {};
+  return { persons: body?.data?.persons || [], deleted: body?.data?.deleted || [], nextSince: meta.next_since, hasMore: !!meta.has_more, reset: !!meta.reset };
+}
+
+// 订阅缓存变更推送（/ws）：onEvent 收到 { type, name, seq, ... }，断线后 retryMs 毫秒重连；返回取消订阅函数
+// seq 不连续或重连后应以 fetchPeopleChanges 补齐漏收的变更
+export function subscribeCacheUpdates(onEvent, retryMs = 3000) {
+  const url = new URL(API_BASE.replace(/\/api(\/v\d+)?\/?$/, '/ws'), window.location.href);
+  url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:';
+  let socket = null;
+  let stopped = false;
+  const connect = () => {
+    socket = new WebSocket(url.href);
+    socket.onmessage = (msg) => {
+      try { onEvent(JSON.parse(msg.data)); } catch (e) { console.error('处理推送消息失败：', e); }
+    };
+    socket.onclose = () => { if (!stopped) setTimeout(connect, retryMs); };
+  };
+  connect();
+  return () => { stopped = true; socket?.close(); };
+}
+
+// 全文检索：返回 { items: [{ name, score, matches: [{ field, event, snippet, highlights }] }], total }，highlights 为片段内 [起, 止)
+export async function searchFullText(q, limit = 20, offset = 0) {
+  const resp = await fetch(`${API_BASE}/search?q=${encodeURIComponent(q)}&limit=${limit}&offset=${offset}`);
+  const body = await readEnvelope(resp);
+  return { items: body?.data || [], total: body?.meta?.total || 0 };
+}
+
 export async function fetchPerson(name) {
-  return await httpGetJSON(`${API_BASE}/person?name=${encodeURIComponent(name)}`);
-}
\ No newline at end of file
+  try {
+    return await httpGetJSON(`${API_BASE}/person?name=${encodeURIComponent(name)}`);
+  } catch (e) {
+    // 未找到人物按空轨迹展示，其余错误交由调用方处理
+    if (e.code === 'PERSON_NOT_FOUND') return { name, style: null, events: [] };
+    throw e;
+  }
+}
+// 取人物的 lang 语言版本：后端已有译文时直接返回，否则翻译一次并保存，之后访问不再重复翻译
+export async function translatePerson(name, lang) {
+  const resp = await fetch(`${API_BASE}/person/${encodeURIComponent(name)}/translate?lang=${encodeURIComponent(lang)}`, { method: 'POST' });
+  return (await readEnvelope(resp))?.data;
+}
+
+// 异步生成：提交后返回任务 { id, status, person? }，再用 fetchJob(id) 轮询到 status 为 done / failed
+export async function startGeneration(name) {
+  const resp = await fetch(`${API_BASE}/person/generate`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ name }),
+  });
+  const body = await readEnvelope(resp);
+  return body?.data;
+}
+
+export async function fetchJob(id) {
+  return httpGetJSON(`${API_BASE}/jobs/${encodeURIComponent(id)}`);
+}
+
+// 多人地图一次取回多位人物：返回 [{ name, status: cached|generated|missing, person }]，generate 为 true 时未命中的会生成
+export async function fetchPeopleBatch(names, generate = false) {
+  const resp = await fetch(`${API_BASE}/people/batch`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ names, generate }),
+  });
+  const body = await readEnvelope(resp);
+  return Array.isArray(body?.data) ? body.data : [];
+}
+
+// 导览模式的解说音频地址（<audio src> 直接使用，后端支持 Range）
+export function narrationUrl(name, lang) {
+  const q = lang ? `?lang=${encodeURIComponent(lang)}` : '';
+  return `${API_BASE}/person/${encodeURIComponent(name)}/narration${q}`;
+}
+
+// “你可能还想看”：相关人物 [{ name, score, signals, reasons }]，失败时返回空列表
+export async function fetchRelated(name, limit = 8) {
+  try {
+    const items = await httpGetJSON(`${API_BASE}/person/${encodeURIComponent(name)}/related?limit=${limit}`);
+    return Array.isArray(items) ? items : [];
+  } catch (e) {
+    console.error('加载相关人物失败：', e);
+    return [];
+  }
+}
@@ -1,4 +1,4 @@
-import { fetchNames, fetchPerson } from './api.js';
+import { API_BASE, fetchNames, fetchPerson } from './api.js';
 import { state, setPersonData, setCurrentIndex, setPlayTimer, setLoadingState } from './state.js';
 
 // DOM 引用集中
@@ -26,23 +26,25 @@ function initMap() {
 
   // 支持通过全局覆盖（如在 index.html 里 window.FETRACE_TILE_URL = '...'）
   const overrideUrl = window.FETRACE_TILE_URL;
+  // window.FETRACE_TILE_PROXY = true 时经后端 /api/tiles/ 代理取瓦片（带缓存，避免跨域与直连第三方）
+  const tileUrl = (name, direct) => (window.FETRACE_TILE_PROXY ? `${API_BASE}/tiles/${name}/{z}/{x}/{y}` : direct);
 
   const providers = overrideUrl ? [
     { url: overrideUrl, options: { maxZoom: 19, attribution: '' } }
   ] : [
     // 1) OSM 官方（可能国内不可达）
     {
-      url: 'https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png',
+      url: tileUrl('osm', 'https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png'),
       options: { maxZoom: 19, attribution: '&copy; OpenStreetMap contributors' }
     },
     // 2) Carto 底图（通常国内可访问）
     {
-      url: 'https://{s}.basemaps.cartocdn.com/light_all/{z}/{x}/{y}{r}.png',
+      url: tileUrl('carto', 'https://{s}.basemaps.cartocdn.com/light_all/{z}/{x}/{y}{r}.png'),
       options: { maxZoom: 19, attribution: '&copy; CARTO' }
     },
     // 3) GeoQ（ArcGIS 瓦片，国内可访问；注意许可），HTTP
     {
-      url: 'http://map.geoq.cn/arcgis/rest/services/ChinaOnlineStreetPurplishBlue/MapServer/tile/{z}/{y}/{x}',
+      url: tileUrl('geoq', 'http://map.geoq.cn/arcgis/rest/services/ChinaOnlineStreetPurplishBlue/MapServer/tile/{z}/{y}/{x}'),
       options: { maxZoom: 18, attribution: 'Map © GeoQ' }
     }
   ];
@@ -110,7 +112,7 @@ function drawMarkersAndLine() {
 
 function updateInfoOverlay(e) {
   DOM.infoOverlay.innerHTML = `<div style="min-width:220px">
-    <strong>${e.year} · ${e.title}</strong>
+    <strong>${e.year_label ?? e.year} · ${e.title}</strong>
     <div class="small" style="margin-top:6px">${e.place} · 年龄：${e.age}</div>
     <div style="margin-top:8px">${e.detail}</div>
   </div>`;
@@ -119,7 +121,7 @@ function updateInfoOverlay(e) {
 function updateUI(index) {
   if (index < 0 || index >= state.events.length) return;
   const e = state.events[index];
-  if (DOM.yearLabel) DOM.yearLabel.textContent = e.year;
+  if (DOM.yearLabel) DOM.yearLabel.textContent = e.year_label ?? e.year;
   document.querySelectorAll('.event-card').forEach(el => el.classList.remove('active'));
   const active = document.querySelector(`.event-card[data-idx='${index}']`);
   if (active) active.classList.add('active');
@@ -144,7 +146,7 @@ function renderList() {
       const div = document.createElement('div');
       div.className = 'event-card';
       div.dataset.idx = idx;
-      div.innerHTML = `<div style="font-weight:600">${e.year} · ${e.title}</div>
+      div.innerHTML = `<div style="font-weight:600">${e.year_label ?? e.year} · ${e.title}</div>
                        <div class="event-meta">${e.place} · 年龄：${e.age}</div>
                        <div style="color:#333">${e.detail}</div>`;
       frag.appendChild(div);
@@ -206,7 +208,10 @@ function bindUIEvents() {
 function renderSuggestions(list) {
   if (!list.length) { DOM.suggestEl.style.display = 'none'; DOM.suggestEl.innerHTML = ''; return; }
   DOM.suggestEl.style.display = 'block';
-  DOM.suggestEl.innerHTML = list.map((n, i) => `<div class="suggest-item${i===state.activeSuggestIndex?' active':''}" data-name="${n}">${n}</div>`).join('');
+  DOM.suggestEl.innerHTML = list.map((n, i) => {
+    const pending = state.cachedNames.has(n) ? '' : '<span class="suggest-tag">需生成</span>';
+    return `<div class="suggest-item${i===state.activeSuggestIndex?' active':''}" data-name="${n}">${n}${pending}</div>`;
+  }).join('');
   DOM.suggestEl.querySelectorAll('.suggest-item').forEach(item => {
     item.addEventListener('click', () => selectPerson(item.dataset.name));
   });
@@ -275,6 +280,7 @@ async function loadPerson(name) {
     if (shouldRefetch) {
       const p = await fetchPerson(name);
       setPersonData(name, p.events || [], p.style);
+      if ((p.events || []).length) state.cachedNames.add(name);
     } else {
       setPersonData(name, state.peopleCache[name], state.personStyles[name]);
     }
@@ -286,7 +292,7 @@ async function loadPerson(name) {
     }
   } catch (e) {
     console.error('加载人物失败：', e);
-    if (DOM.status) DOM.status.textContent = `加载 ${name} 失败`;
+    if (DOM.status) DOM.status.textContent = `加载 ${name} 失败：${e.message}`;
   } finally {
     setLoadingState(false, null);
     hideLoadingBanner();
@@ -341,7 +347,9 @@ async function init() {
   bindSuggestEvents();
 
   // 加载搜索建议（后端 names）
-  state.allNames = Array.from(new Set(await fetchNames()));
+  const nameItems = await fetchNames();
+  state.allNames = Array.from(new Set(nameItems.map(it => it.name)));
+  state.cachedNames = new Set(nameItems.filter(it => it.cached).map(it => it.name));
   const defaultName = state.allNames.includes(state.currentPerson) ? state.currentPerson : (state.allNames[0] || '赵今麦');
   // 首次进入时将输入框设置为默认人物，避免出现空输入的下拉框
   if (DOM.searchInput) DOM.searchInput.value = defaultName;
@@ -6,6 +6,7 @@ export const state = {
   currentIndex: 0,
   playTimer: null,
   allNames: [],
+  cachedNames: new Set(), // 已有缓存轨迹的姓名
   filteredNames: [],
   activeSuggestIndex: -1,
   map: null,